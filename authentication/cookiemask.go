@@ -2,7 +2,6 @@ package authentication
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -176,9 +175,7 @@ func (f *CookiemaskFilter) ServeHTTP(
 	// TODO remove
 	_ = log.Debug(fmt.Sprintf("sesh is: %v", sesh))
 
-	req = req.WithContext(
-		context.WithValue(req.Context(), ctxKeySession, sesh),
-	)
+	req = req.WithContext(NewSessionContext(req.Context(), sesh))
 
 	fwdCkes, setCkes, err := sesh.CookieMask(
 		req.Cookies(),
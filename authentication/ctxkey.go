@@ -1,7 +1,24 @@
 package authentication
 
+import (
+	"context"
+)
+
 type ctxKey int
 
 const (
 	ctxKeySession ctxKey = iota
 )
+
+// NewSessionContext gives a copy of the given context which carries the given
+// Session, as is done by a CookiemaskFilter for the requests it forwards.
+func NewSessionContext(ctx context.Context, sesh Session) context.Context {
+	return context.WithValue(ctx, ctxKeySession, sesh)
+}
+
+// SessionFromContext gives the Session carried by the given context (such as
+// the context of a request forwarded by a CookiemaskFilter), if there is one.
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	sesh, ok := ctx.Value(ctxKeySession).(Session)
+	return sesh, ok
+}
@@ -26,11 +26,23 @@ const msgInvalidCredentials = "Invalid Credentials"
 // tokens and authentication flags from other components, possibly including
 // other LoginHandlers), a PasswordChecker (which it allows users to
 // authenticate against in conjunction with its own XSRF token), and a
-// downstream RequestFilter (possibly an entire pipeline).
+// downstream RequestFilter (possibly an entire pipeline). The login page and
+// any error pages are rendered using Pages (or the built-in defaults if Pages
+// is nil).
 type LoginHandler struct {
 	Identifier      string
 	PasswordChecker PasswordChecker
 	Downstream      http.Handler
+	Pages           *util.PageTemplate
+}
+
+// loginForm holds the names and values of the fields of the login form, as
+// given to the login page template.
+type loginForm struct {
+	UsernameField string
+	PasswordField string
+	XSRFField     string
+	XSRFToken     string
 }
 
 func init() {
@@ -48,6 +60,7 @@ func (h *LoginHandler) UnmarshalJSON(input []byte) error {
 		Identifier      string
 		PasswordChecker config.Resource
 		Downstream      config.Resource
+		Pages           *config.Resource
 	}
 
 	dec := json.NewDecoder(bytes.NewReader(input))
@@ -82,6 +95,22 @@ func (h *LoginHandler) UnmarshalJSON(input []byte) error {
 		return config.UnexpectedResourceType
 	}
 
+	h.Pages = nil
+	if t.Pages != nil && t.Pages.Unmarshalled != nil {
+		p, ok := t.Pages.Unmarshalled.(*util.PageTemplate)
+		if !ok {
+			_ = log.Err(
+				fmt.Sprintf(
+					"Registry value is not a PageTemplate:"+
+						" %#v",
+					t.Pages,
+				),
+			)
+			return config.UnexpectedResourceType
+		}
+		h.Pages = p
+	}
+
 	h.Identifier = t.Identifier
 
 	return nil
@@ -98,7 +127,7 @@ func (h *LoginHandler) ServeHTTP(
 			"login handler was unable to retrieve session from" +
 				" context",
 		)
-		util.InternalServerError.ServeHTTP(w, request)
+		h.Pages.ServeError(w, request, 500)
 		return
 	}
 	sesh := rawsesh.(Session)
@@ -122,7 +151,7 @@ func (h *LoginHandler) ServeHTTP(
 				err,
 			),
 		)
-		util.InternalServerError.ServeHTTP(w, request)
+		h.Pages.ServeError(w, request, 500)
 		return
 	}
 
@@ -136,7 +165,7 @@ func (h *LoginHandler) ServeHTTP(
 				err,
 			),
 		)
-		util.InternalServerError.ServeHTTP(w, request)
+		h.Pages.ServeError(w, request, 500)
 		return
 	} else if err == NoSuchSessionValueError {
 		_ = log.Info("login handler received new request")
@@ -149,7 +178,7 @@ func (h *LoginHandler) ServeHTTP(
 		)
 		if err != nil {
 			// this is too suspicious
-			util.Forbidden.ServeHTTP(w, request)
+			h.Pages.ServeError(w, request, 403)
 			return
 		}
 		errString = "Bad request"
@@ -182,9 +211,11 @@ func (h *LoginHandler) ServeHTTP(
 		pVals[0],
 	); err == NoSuchIdentifierError {
 		_ = log.Info("login handler received bad username")
+		logins.Inc(h.Identifier, "failure")
 		errString = msgInvalidCredentials
 	} else if err == BadPasswordError {
 		_ = log.Info("login handler received bad password")
+		logins.Inc(h.Identifier, "failure")
 		errString = msgInvalidCredentials
 	} else if err != nil {
 		_ = log.Err(
@@ -193,7 +224,7 @@ func (h *LoginHandler) ServeHTTP(
 				err,
 			),
 		)
-		util.InternalServerError.ServeHTTP(w, request)
+		h.Pages.ServeError(w, request, 500)
 		return
 	} else if err = sesh.SetValue(authSeshKey, true); err != nil {
 		_ = log.Err(
@@ -202,9 +233,10 @@ func (h *LoginHandler) ServeHTTP(
 				err,
 			),
 		)
-		util.InternalServerError.ServeHTTP(w, request)
+		h.Pages.ServeError(w, request, 500)
 		return
 	} else {
+		logins.Inc(h.Identifier, "success")
 		err = log.Notice(
 			fmt.Sprintf(
 				"login successful for: %s",
@@ -212,7 +244,7 @@ func (h *LoginHandler) ServeHTTP(
 			),
 		)
 		if err != nil {
-			util.InternalServerError.ServeHTTP(w, request)
+			h.Pages.ServeError(w, request, 500)
 			return
 		}
 		h.Downstream.ServeHTTP(w, request)
@@ -233,7 +265,7 @@ func (h *LoginHandler) ServeHTTP(
 				err,
 			),
 		)
-		util.InternalServerError.ServeHTTP(w, request)
+		h.Pages.ServeError(w, request, 500)
 		return
 	}
 	nextXSRFToken := hex.EncodeToString(rawXSRFToken)
@@ -245,45 +277,22 @@ func (h *LoginHandler) ServeHTTP(
 				err,
 			),
 		)
-		util.InternalServerError.ServeHTTP(w, request)
+		h.Pages.ServeError(w, request, 500)
 		return
 	}
 
-	errMarkup := ""
-	if errString != "" {
-		errMarkup = fmt.Sprintf(
-			"<label class=\"error\">%s</label><br />",
-			errString,
-		)
-	}
-
-	_, err := fmt.Fprintf(
+	h.Pages.ServePage(
 		w,
-		"<html><head><title>Pullcord Login</title></head><body>"+
-			"<form method=\"POST\" action=\"%s\"><fieldset>"+
-			"<legend>Pullcord Login</legend>%s"+
-			"<label for=\"username\">Username:</label>"+
-			"<input type=\"text\" name=\"%s\" id=\"username\" />"+
-			"<label for=\"password\">Password:</label>"+
-			"<input type=\"password\" name=\"%s\""+
-			"id=\"password\" /><input type=\"hidden\" name=\"%s\""+
-			" value=\"%s\" /><input type=\"submit\""+
-			" value=\"Login\"/></fieldset></form></body></html>",
-		request.URL.Path,
-		errMarkup,
-		usernameKey,
-		passwordKey,
-		xsrfKey,
-		nextXSRFToken,
+		request,
+		util.LoginPage,
+		util.PageContext{
+			Message: errString,
+			Data: loginForm{
+				UsernameField: usernameKey,
+				PasswordField: passwordKey,
+				XSRFField:     xsrfKey,
+				XSRFToken:     nextXSRFToken,
+			},
+		},
 	)
-	if err != nil {
-		_ = log.Error(
-			fmt.Sprintf(
-				"Unable to write login form: %s",
-				err.Error(),
-			),
-		)
-		util.InternalServerError.ServeHTTP(w, request)
-	}
-	return
 }
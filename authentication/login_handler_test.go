@@ -15,6 +15,7 @@ import (
 	"github.com/proidiot/gone/log"
 	"github.com/stretchr/testify/assert"
 	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/util"
 
 	"golang.org/x/net/html"
 )
@@ -109,6 +110,7 @@ func TestInitialLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -191,6 +193,7 @@ func TestNoXSRFLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -277,6 +280,7 @@ func TestBadXSRFLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -350,6 +354,7 @@ func TestNoUsernameLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -443,6 +448,7 @@ func TestNoPasswordLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -537,6 +543,7 @@ func TestUsernameArrayLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -635,6 +642,7 @@ func TestBadUsernameLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -732,6 +740,7 @@ func TestBadPasswordLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -829,6 +838,7 @@ func TestGoodLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -926,6 +936,7 @@ func TestPassthruLoginPage(t *testing.T) {
 		"testLoginHandler",
 		&passwordChecker,
 		downstreamFilter,
+		nil,
 	}
 	filter := &CookiemaskFilter{
 		sessionHandler,
@@ -1001,6 +1012,54 @@ func TestPassthruLoginPage(t *testing.T) {
 	)
 }
 
+func TestLoginPageTemplate(t *testing.T) {
+	/* setup */
+	sessionHandler := NewMinSessionHandler(
+		"testSessionHandler",
+		"/",
+		"example.com",
+	)
+	passwordChecker := InMemPwdStore{}
+
+	request, err := http.NewRequest("GET", "/login", nil)
+	assert.NoError(t, err)
+
+	/* run */
+	handler := &LoginHandler{
+		"testLoginHandler",
+		&passwordChecker,
+		util.NotFound,
+		util.MustNewPageTemplate(
+			map[string]string{
+				util.LoginPage: `<p>Anmelden at {{.Path}}</p>` +
+					`<input type="hidden"` +
+					` name="{{.Data.XSRFField}}"` +
+					` value="{{.Data.XSRFToken}}" />`,
+			},
+			nil,
+		),
+	}
+	filter := &CookiemaskFilter{
+		sessionHandler,
+		handler,
+	}
+	rec := httptest.NewRecorder()
+	filter.ServeHTTP(rec, request)
+	response := rec.Result()
+
+	/* check */
+	assert.Equal(t, 200, response.StatusCode)
+
+	content, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Anmelden at /login")
+	htmlRoot, err := html.Parse(bytes.NewReader(content))
+	assert.NoError(t, err)
+	xsrfToken, err := getXSRFToken(htmlRoot, "xsrf-"+handler.Identifier)
+	assert.NoError(t, err)
+	assert.Len(t, xsrfToken, 2*XSRFTokenLength)
+}
+
 func TestLoginHandlerFromConfig(t *testing.T) {
 	test := configutil.ConfigTest{
 		ResourceType: "loginhandler",
@@ -1087,6 +1146,27 @@ func TestLoginHandlerFromConfig(t *testing.T) {
 				}`,
 				Explanation: "good config",
 			},
+			{
+				Data: `{
+					"passwordchecker": {
+						"type": "inmempwdstore",
+						"data": {}
+					},
+					"downstream": {
+						"type": "landinghandler",
+						"data": {}
+					},
+					"pages": {
+						"type": "pagetemplate",
+						"data": {
+							"inline": {
+								"login": "<form></form>"
+							}
+						}
+					}
+				}`,
+				Explanation: "config with login page template",
+			},
 		},
 	}
 
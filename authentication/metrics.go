@@ -0,0 +1,24 @@
+package authentication
+
+import (
+	"github.com/stuphlabs/pullcord/metrics"
+)
+
+var (
+	sessionTableSize = metrics.NewGauge(
+		"pullcord_session_table_size",
+		"Sessions currently known to each session handler.",
+		"handler",
+	)
+	logins = metrics.NewCounter(
+		"pullcord_login_attempts_total",
+		"Login attempts for each login handler, by result (success or"+
+			" failure).",
+		"handler",
+		"result",
+	)
+)
+
+func init() {
+	metrics.MustRegister(sessionTableSize, logins)
+}
@@ -285,6 +285,10 @@ func (sesh *MinSession) CookieMask(incomingCookies []*http.Cookie) (
 					)
 
 					delete(sesh.handler.table, cookie.Name)
+					sessionTableSize.Set(
+						float64(len(sesh.handler.table)),
+						sesh.handler.Name,
+					)
 
 					// TODO: should this destroy every
 					// session that is touched?
@@ -366,6 +370,10 @@ func (sesh *MinSession) CookieMask(incomingCookies []*http.Cookie) (
 
 		sesh.core.cvalue = newCookie.Value
 		sesh.handler.table[newCookie.Name] = sesh
+		sessionTableSize.Set(
+			float64(len(sesh.handler.table)),
+			sesh.handler.Name,
+		)
 		_ = log.Debug(
 			fmt.Sprintf(
 				"minsession cookiemask has created a new"+
@@ -0,0 +1,283 @@
+// Package awstest provides fakes of the AWS APIs used by Pullcord, against
+// which AWS clients can be tested locally.
+package awstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EC2 is a fake EC2 API which knows of a set of instances. Instances which are
+// started (or stopped) remain pending (or stopping) for Transitions calls to
+// DescribeInstances before they are running (or stopped).
+type EC2 struct {
+	// URL is the endpoint of the fake EC2 API.
+	URL string
+
+	// Transitions is the number of times an instance which is changing
+	// state is described before its change of state completes.
+	Transitions int
+
+	// Actions is the action of each request received, in order.
+	Actions []string
+
+	// Authorizations is the Authorization header of each request
+	// received, in order.
+	Authorizations []string
+
+	instances map[string]*instance
+	server    *httptest.Server
+	mutex     sync.Mutex
+}
+
+type instance struct {
+	state     string
+	remaining int
+}
+
+// NewEC2 starts a fake EC2 API with no instances.
+func NewEC2() *EC2 {
+	e := &EC2{instances: make(map[string]*instance)}
+	e.server = httptest.NewServer(e)
+	e.URL = e.server.URL + "/"
+
+	return e
+}
+
+// Close stops the fake EC2 API.
+func (e *EC2) Close() {
+	e.server.Close()
+}
+
+// SetInstance adds an instance in the given state, or replaces the state of
+// an existing instance.
+func (e *EC2) SetInstance(id string, state string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.instances[id] = &instance{state: state}
+}
+
+// Instance gives the current state of the given instance.
+func (e *EC2) Instance(id string) (string, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	i, present := e.instances[id]
+	if !present {
+		return "", false
+	}
+
+	return i.state, true
+}
+
+func writeError(w http.ResponseWriter, code int, errCode string, msg string) {
+	w.WriteHeader(code)
+	fmt.Fprintf(
+		w,
+		"<Response><Errors><Error><Code>%s</Code>"+
+			"<Message>%s</Message></Error></Errors></Response>",
+		errCode,
+		msg,
+	)
+}
+
+func (e *EC2) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if err := req.ParseForm(); err != nil {
+		writeError(w, 400, "MalformedQueryString", err.Error())
+		return
+	}
+
+	action := req.PostForm.Get("Action")
+	e.Actions = append(e.Actions, action)
+	e.Authorizations = append(
+		e.Authorizations,
+		req.Header.Get("Authorization"),
+	)
+	if !strings.HasPrefix(
+		req.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 ",
+	) {
+		writeError(w, 401, "AuthFailure", "request was not signed")
+		return
+	}
+
+	var ids []string
+	for key, values := range req.PostForm {
+		if strings.HasPrefix(key, "InstanceId.") {
+			ids = append(ids, values...)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if _, present := e.instances[id]; !present {
+			writeError(
+				w,
+				400,
+				"InvalidInstanceID.NotFound",
+				"The instance ID '"+id+"' does not exist",
+			)
+			return
+		}
+	}
+
+	switch action {
+	case "StartInstances":
+		e.change(w, "StartInstancesResponse", ids, "pending")
+	case "StopInstances":
+		e.change(w, "StopInstancesResponse", ids, "stopping")
+	case "DescribeInstances":
+		fmt.Fprint(
+			w,
+			"<DescribeInstancesResponse><reservationSet><item>"+
+				"<instancesSet>",
+		)
+		for _, id := range ids {
+			i := e.instances[id]
+			if i.remaining > 0 {
+				i.remaining--
+			} else if i.state == "pending" {
+				i.state = "running"
+			} else if i.state == "stopping" {
+				i.state = "stopped"
+			}
+			fmt.Fprintf(
+				w,
+				"<item><instanceId>%s</instanceId>"+
+					"<instanceState><name>%s</name>"+
+					"</instanceState></item>",
+				id,
+				i.state,
+			)
+		}
+		fmt.Fprint(
+			w,
+			"</instancesSet></item></reservationSet>"+
+				"</DescribeInstancesResponse>",
+		)
+	default:
+		writeError(w, 400, "InvalidAction", "unknown action: "+action)
+	}
+}
+
+// change begins changing the state of the given instances, unless they are
+// already in (or changing to) the requested state.
+func (e *EC2) change(
+	w http.ResponseWriter,
+	response string,
+	ids []string,
+	transitional string,
+) {
+	fmt.Fprintf(w, "<%s><instancesSet>", response)
+	for _, id := range ids {
+		i := e.instances[id]
+		previous := i.state
+		if transitional == "pending" && previous != "running" &&
+			previous != "pending" {
+			i.state = transitional
+			i.remaining = e.Transitions
+		} else if transitional == "stopping" && previous != "stopped" &&
+			previous != "stopping" {
+			i.state = transitional
+			i.remaining = e.Transitions
+		}
+		fmt.Fprintf(
+			w,
+			"<item><instanceId>%s</instanceId>"+
+				"<currentState><name>%s</name></currentState>"+
+				"<previousState><name>%s</name></previousState>"+
+				"</item>",
+			id,
+			i.state,
+			previous,
+		)
+	}
+	fmt.Fprintf(w, "</instancesSet></%s>", response)
+}
+
+// Metadata is a fake instance metadata service, giving the credentials of a
+// single role and the region of the instance.
+type Metadata struct {
+	// URL is the endpoint of the fake instance metadata service.
+	URL string
+
+	// Requests is the number of requests for credentials received.
+	Requests int
+
+	Region          string
+	Role            string
+	AccessKeyID     string
+	SecretAccessKey string
+	Token           string
+
+	server *httptest.Server
+	mutex  sync.Mutex
+}
+
+// NewMetadata starts a fake instance metadata service.
+func NewMetadata(region string, role string) *Metadata {
+	m := &Metadata{
+		Region:          region,
+		Role:            role,
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "metadatasecret",
+		Token:           "metadatatoken",
+	}
+	m.server = httptest.NewServer(m)
+	m.URL = m.server.URL
+
+	return m
+}
+
+// Close stops the fake instance metadata service.
+func (m *Metadata) Close() {
+	m.server.Close()
+}
+
+func (m *Metadata) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	const token = "faketoken"
+	const credsPath = "/latest/meta-data/iam/security-credentials/"
+
+	if req.URL.Path == "/latest/api/token" && req.Method == "PUT" {
+		fmt.Fprint(w, token)
+		return
+	} else if req.Header.Get("X-aws-ec2-metadata-token") != token {
+		w.WriteHeader(401)
+		return
+	}
+
+	switch req.URL.Path {
+	case "/latest/meta-data/placement/region":
+		fmt.Fprint(w, m.Region)
+	case credsPath:
+		fmt.Fprint(w, m.Role)
+	case credsPath + m.Role:
+		m.Requests++
+		_ = json.NewEncoder(w).Encode(
+			map[string]string{
+				"Code":            "Success",
+				"AccessKeyId":     m.AccessKeyID,
+				"SecretAccessKey": m.SecretAccessKey,
+				"Token":           m.Token,
+				"Expiration": time.Now().Add(
+					time.Hour,
+				).UTC().Format(time.RFC3339),
+			},
+		)
+	default:
+		w.WriteHeader(404)
+	}
+}
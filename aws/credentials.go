@@ -0,0 +1,239 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/proidiot/gone/errors"
+)
+
+// DefaultMetadataEndpoint is the address of the instance metadata service
+// used if no other address has been specified.
+const DefaultMetadataEndpoint = "http://169.254.169.254"
+
+// DefaultMetadataTimeout is the amount of time a request to the instance
+// metadata service may take if no other timeout has been specified. It is
+// kept short, since the service will not exist at all when not running on an
+// instance.
+const DefaultMetadataTimeout = 2 * time.Second
+
+// NoCredentialsError indicates that no AWS credentials were available.
+const NoCredentialsError = errors.New("No AWS credentials available")
+
+// NoRegionError indicates that the AWS region could not be determined.
+const NoRegionError = errors.New("Unable to determine the AWS region")
+
+// metadataTokenTTL is how long (in seconds) a token for the instance metadata
+// service is requested to be valid for.
+const metadataTokenTTL = "21600"
+
+// credentialsExpiryMargin is how long before they expire that credentials
+// from the instance metadata service are refreshed.
+const credentialsExpiryMargin = 5 * time.Minute
+
+// maxMetadataSize is the most of a response from the instance metadata service
+// that will be read.
+const maxMetadataSize = 1 << 16
+
+// Credentials are the credentials used to sign requests to AWS (or
+// AWS-compatible) APIs.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Resolve gives the credentials, falling back to the standard AWS environment
+// variables if no access key has been given.
+func (c Credentials) Resolve() Credentials {
+	if c.AccessKeyID != "" {
+		return c
+	}
+
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Valid determines if the credentials include both an access key and a
+// secret.
+func (c Credentials) Valid() bool {
+	return c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+// EnvRegion gives the region from the standard AWS environment variables, or
+// an empty string if neither is set.
+func EnvRegion() string {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := os.Getenv(env); r != "" {
+			return r
+		}
+	}
+
+	return ""
+}
+
+// InstanceMetadata gives the credentials of the role of the instance (and the
+// region of the instance) from the instance metadata service. Credentials are
+// cached until shortly before they expire. An InstanceMetadata is safe for
+// concurrent use.
+type InstanceMetadata struct {
+	Endpoint string
+	Client   *http.Client
+	cached   Credentials
+	expires  time.Time
+	mutex    sync.Mutex
+}
+
+// NewInstanceMetadata creates an InstanceMetadata for the instance metadata
+// service at the given endpoint (or DefaultMetadataEndpoint).
+func NewInstanceMetadata(endpoint string) *InstanceMetadata {
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+	}
+
+	return &InstanceMetadata{Endpoint: strings.TrimSuffix(endpoint, "/")}
+}
+
+func (m *InstanceMetadata) client() *http.Client {
+	if m.Client != nil {
+		return m.Client
+	}
+
+	return &http.Client{Timeout: DefaultMetadataTimeout}
+}
+
+// get gives the metadata at the given path, using a session token (as
+// required by version 2 of the instance metadata service).
+func (m *InstanceMetadata) get(
+	ctx context.Context,
+	path string,
+) ([]byte, error) {
+	client := m.client()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"PUT",
+		m.Endpoint+"/latest/api/token",
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", metadataTokenTTL)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	token, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf(
+			"instance metadata token request failed with status:"+
+				" %d",
+			resp.StatusCode,
+		)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "GET", m.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf(
+			"instance metadata request for %s failed with"+
+				" status: %d",
+			path,
+			resp.StatusCode,
+		)
+	}
+
+	return body, nil
+}
+
+// Credentials gives the credentials of the role of the instance, giving up if
+// the context is cancelled.
+func (m *InstanceMetadata) Credentials(
+	ctx context.Context,
+) (Credentials, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.cached.Valid() && time.Now().Before(m.expires) {
+		return m.cached, nil
+	}
+
+	const credsPath = "/latest/meta-data/iam/security-credentials/"
+	roles, err := m.get(ctx, credsPath)
+	if err != nil {
+		return Credentials{}, err
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return Credentials{}, NoCredentialsError
+	}
+
+	body, err := m.get(ctx, credsPath+role)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var t struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err = json.Unmarshal(body, &t); err != nil {
+		return Credentials{}, err
+	}
+
+	m.cached = Credentials{
+		AccessKeyID:     t.AccessKeyID,
+		SecretAccessKey: t.SecretAccessKey,
+		SessionToken:    t.Token,
+	}
+	m.expires = t.Expiration.Add(-credentialsExpiryMargin)
+	if !m.cached.Valid() {
+		return Credentials{}, NoCredentialsError
+	}
+
+	return m.cached, nil
+}
+
+// Region gives the region of the instance, giving up if the context is
+// cancelled.
+func (m *InstanceMetadata) Region(ctx context.Context) (string, error) {
+	body, err := m.get(ctx, "/latest/meta-data/placement/region")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
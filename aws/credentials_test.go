@@ -0,0 +1,98 @@
+package aws_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/aws/awstest"
+)
+
+var awsEnv = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+}
+
+// clearEnv unsets the standard AWS environment variables, giving a function
+// which restores them.
+func clearEnv() func() {
+	saved := make(map[string]string)
+	for _, env := range awsEnv {
+		if v, present := os.LookupEnv(env); present {
+			saved[env] = v
+		}
+		_ = os.Unsetenv(env)
+	}
+
+	return func() {
+		for _, env := range awsEnv {
+			if v, present := saved[env]; present {
+				_ = os.Setenv(env, v)
+			} else {
+				_ = os.Unsetenv(env)
+			}
+		}
+	}
+}
+
+func TestCredentialsResolve(t *testing.T) {
+	restore := clearEnv()
+	defer restore()
+
+	assert.False(t, aws.Credentials{}.Resolve().Valid())
+	assert.Equal(t, "", aws.EnvRegion())
+
+	_ = os.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	_ = os.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+	_ = os.Setenv("AWS_DEFAULT_REGION", "us-east-2")
+
+	creds := aws.Credentials{}.Resolve()
+	assert.True(t, creds.Valid())
+	assert.Equal(t, "AKIDENV", creds.AccessKeyID)
+	assert.Equal(t, "us-east-2", aws.EnvRegion())
+
+	creds = aws.Credentials{
+		AccessKeyID:     "AKIDCONFIG",
+		SecretAccessKey: "configsecret",
+	}.Resolve()
+	assert.Equal(t, "AKIDCONFIG", creds.AccessKeyID)
+
+	_ = os.Setenv("AWS_REGION", "us-west-1")
+	assert.Equal(t, "us-west-1", aws.EnvRegion())
+}
+
+func TestInstanceMetadata(t *testing.T) {
+	f := awstest.NewMetadata("ap-southeast-2", "pullcord")
+	defer f.Close()
+
+	m := aws.NewInstanceMetadata(f.URL)
+
+	region, err := m.Region(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ap-southeast-2", region)
+
+	creds, err := m.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ASIAEXAMPLE", creds.AccessKeyID)
+	assert.Equal(t, "metadatasecret", creds.SecretAccessKey)
+	assert.Equal(t, "metadatatoken", creds.SessionToken)
+
+	_, err = m.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, f.Requests)
+}
+
+func TestInstanceMetadataUnavailable(t *testing.T) {
+	f := awstest.NewMetadata("ap-southeast-2", "pullcord")
+	f.Close()
+
+	m := aws.NewInstanceMetadata(f.URL)
+	_, err := m.Credentials(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,4 @@
+// Package aws provides minimal clients for the AWS APIs (or AWS-compatible
+// APIs) used to manage Pullcord services, along with the request signing and
+// credentials they need.
+package aws
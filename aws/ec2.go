@@ -0,0 +1,329 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/proidiot/gone/log"
+)
+
+const ec2APIVersion = "2016-11-15"
+
+// DefaultEC2Timeout is the amount of time a request to the EC2 API may take if
+// no other Client has been given.
+const DefaultEC2Timeout = 30 * time.Second
+
+const (
+	// InstancePending is the state of an instance which is starting.
+	InstancePending = "pending"
+	// InstanceRunning is the state of an instance which is running.
+	InstanceRunning = "running"
+	// InstanceStopping is the state of an instance which is stopping.
+	InstanceStopping = "stopping"
+	// InstanceStopped is the state of an instance which is stopped.
+	InstanceStopped = "stopped"
+)
+
+// APIError is an error returned by an AWS (or AWS-compatible) API.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf(
+		"AWS request failed with status %d: %s: %s",
+		e.StatusCode,
+		e.Code,
+		e.Message,
+	)
+}
+
+// EC2 is a client for the EC2 API (or an EC2-compatible API).
+//
+// Requests are signed with AWS Signature Version 4 using the given
+// Credentials, the standard AWS environment variables if no access key has
+// been given, or the role of the instance (from Metadata) if neither is
+// available. The region is taken from Region if given, from the AWS_REGION
+// (or AWS_DEFAULT_REGION) environment variable, or from Metadata. Requests
+// are sent to the EC2 endpoint for the region, unless Endpoint is given, and
+// are abandoned if no response has been received within DefaultEC2Timeout,
+// unless Client is given.
+type EC2 struct {
+	Region      string
+	Endpoint    string
+	Credentials Credentials
+	Metadata    *InstanceMetadata
+	Client      *http.Client
+}
+
+// NewEC2 creates an EC2 client for the given region (which may be empty, in
+// which case the region of the instance is used) with credentials from the
+// environment or the instance metadata service.
+func NewEC2(region string) *EC2 {
+	return &EC2{
+		Region:   region,
+		Metadata: NewInstanceMetadata(""),
+	}
+}
+
+func (e *EC2) region(ctx context.Context) (string, error) {
+	if e.Region != "" {
+		return e.Region, nil
+	} else if r := EnvRegion(); r != "" {
+		return r, nil
+	} else if e.Metadata != nil {
+		if r, err := e.Metadata.Region(ctx); err == nil && r != "" {
+			return r, nil
+		}
+	}
+
+	return "", NoRegionError
+}
+
+func (e *EC2) credentials(ctx context.Context) (Credentials, error) {
+	if creds := e.Credentials.Resolve(); creds.Valid() {
+		return creds, nil
+	} else if e.Metadata != nil {
+		return e.Metadata.Credentials(ctx)
+	}
+
+	return Credentials{}, NoCredentialsError
+}
+
+// do makes a request of the EC2 API with the given action and parameters,
+// decoding the response into the given value. The request is abandoned if the
+// context is cancelled.
+func (e *EC2) do(
+	ctx context.Context,
+	action string,
+	params url.Values,
+	v interface{},
+) error {
+	region, err := e.region(ctx)
+	if err != nil {
+		return err
+	}
+
+	creds, err := e.credentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	endpoint := e.Endpoint
+	if endpoint == "" {
+		endpoint = "https://ec2." + region + ".amazonaws.com/"
+	}
+
+	form := url.Values{}
+	for k, vs := range params {
+		form[k] = vs
+	}
+	form.Set("Action", action)
+	form.Set("Version", ec2APIVersion)
+	body := []byte(form.Encode())
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		endpoint,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(
+		"Content-Type",
+		"application/x-www-form-urlencoded; charset=utf-8",
+	)
+	SignV4(req, body, "ec2", region, creds, time.Now())
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultEC2Timeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var r struct {
+			Code    string `xml:"Errors>Error>Code"`
+			Message string `xml:"Errors>Error>Message"`
+		}
+		_ = xml.Unmarshal(contents, &r)
+
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Code:       r.Code,
+			Message:    r.Message,
+		}
+	}
+
+	return xml.Unmarshal(contents, v)
+}
+
+func instanceParams(ids []string) url.Values {
+	params := url.Values{}
+	for i, id := range ids {
+		params.Set("InstanceId."+strconv.Itoa(i+1), id)
+	}
+
+	return params
+}
+
+// instanceStateChange is the part of the response to StartInstances and
+// StopInstances which is of interest.
+type instanceStateChange struct {
+	Instances []struct {
+		InstanceID string `xml:"instanceId"`
+		State      string `xml:"currentState>name"`
+	} `xml:"instancesSet>item"`
+}
+
+// StartInstances starts the given instances, giving the state of each
+// instance (which would typically be pending) by ID.
+func (e *EC2) StartInstances(
+	ctx context.Context,
+	ids ...string,
+) (map[string]string, error) {
+	var r instanceStateChange
+	err := e.do(ctx, "StartInstances", instanceParams(ids), &r)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string)
+	for _, i := range r.Instances {
+		states[i.InstanceID] = i.State
+	}
+
+	return states, nil
+}
+
+// StopInstances stops the given instances, giving the state of each instance
+// (which would typically be stopping) by ID.
+func (e *EC2) StopInstances(
+	ctx context.Context,
+	ids ...string,
+) (map[string]string, error) {
+	var r instanceStateChange
+	err := e.do(ctx, "StopInstances", instanceParams(ids), &r)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string)
+	for _, i := range r.Instances {
+		states[i.InstanceID] = i.State
+	}
+
+	return states, nil
+}
+
+// DescribeInstances gives the state of each of the given instances by ID.
+func (e *EC2) DescribeInstances(
+	ctx context.Context,
+	ids ...string,
+) (map[string]string, error) {
+	var r struct {
+		Instances []struct {
+			InstanceID string `xml:"instanceId"`
+			State      string `xml:"instanceState>name"`
+		} `xml:"reservationSet>item>instancesSet>item"`
+	}
+	err := e.do(ctx, "DescribeInstances", instanceParams(ids), &r)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string)
+	for _, i := range r.Instances {
+		states[i.InstanceID] = i.State
+	}
+
+	for _, id := range ids {
+		if _, present := states[id]; !present {
+			return nil, &APIError{
+				StatusCode: 200,
+				Code:       "InvalidInstanceID.NotFound",
+				Message:    "no such instance: " + id,
+			}
+		}
+	}
+
+	return states, nil
+}
+
+// WaitForState waits until all the given instances are in the given state,
+// checking every interval, and giving an error if they are not all in that
+// state within the timeout (or the error of the context if it is cancelled
+// first).
+func (e *EC2) WaitForState(
+	ctx context.Context,
+	state string,
+	timeout time.Duration,
+	interval time.Duration,
+	ids ...string,
+) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		states, err := e.DescribeInstances(ctx, ids...)
+		if err != nil {
+			return err
+		}
+
+		var waiting []string
+		for id, s := range states {
+			if s != state {
+				waiting = append(waiting, id+" ("+s+")")
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		sort.Strings(waiting)
+
+		if !time.Now().Add(interval).Before(deadline) {
+			return fmt.Errorf(
+				"instances did not reach %s within %s: %s",
+				state,
+				timeout.String(),
+				strings.Join(waiting, ", "),
+			)
+		}
+
+		_ = log.Debug(
+			fmt.Sprintf(
+				"waiting for instances to reach %s: %s",
+				state,
+				strings.Join(waiting, ", "),
+			),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package aws_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/aws/awstest"
+)
+
+func getEC2(t *testing.T) (*aws.EC2, *awstest.EC2) {
+	f := awstest.NewEC2()
+	f.Transitions = 2
+	f.SetInstance("i-0123", aws.InstanceStopped)
+
+	c := aws.NewEC2("us-west-2")
+	c.Endpoint = f.URL
+	c.Credentials = aws.Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	}
+	c.Metadata = nil
+
+	return c, f
+}
+
+func TestEC2StartStop(t *testing.T) {
+	c, f := getEC2(t)
+	defer f.Close()
+
+	states, err := c.StartInstances(context.Background(), "i-0123")
+	require.NoError(t, err)
+	assert.Equal(t, aws.InstancePending, states["i-0123"])
+	assert.True(
+		t,
+		strings.Contains(
+			f.Authorizations[0],
+			"/us-west-2/ec2/aws4_request",
+		),
+	)
+
+	err = c.WaitForState(
+		context.Background(),
+		aws.InstanceRunning,
+		time.Second,
+		time.Millisecond,
+		"i-0123",
+	)
+	assert.NoError(t, err)
+	state, _ := f.Instance("i-0123")
+	assert.Equal(t, aws.InstanceRunning, state)
+
+	states, err = c.StopInstances(context.Background(), "i-0123")
+	require.NoError(t, err)
+	assert.Equal(t, aws.InstanceStopping, states["i-0123"])
+
+	states, err = c.DescribeInstances(context.Background(), "i-0123")
+	require.NoError(t, err)
+	assert.Equal(t, aws.InstanceStopping, states["i-0123"])
+}
+
+func TestEC2WaitTimeout(t *testing.T) {
+	c, f := getEC2(t)
+	defer f.Close()
+
+	f.Transitions = 1000
+	_, err := c.StartInstances(context.Background(), "i-0123")
+	require.NoError(t, err)
+
+	err = c.WaitForState(
+		context.Background(),
+		aws.InstanceRunning,
+		5*time.Millisecond,
+		time.Millisecond,
+		"i-0123",
+	)
+	assert.Error(t, err)
+}
+
+func TestEC2NoSuchInstance(t *testing.T) {
+	c, f := getEC2(t)
+	defer f.Close()
+
+	_, err := c.DescribeInstances(context.Background(), "i-0123", "i-4567")
+	require.Error(t, err)
+	apiErr, ok := err.(*aws.APIError)
+	require.True(t, ok)
+	assert.Equal(t, "InvalidInstanceID.NotFound", apiErr.Code)
+}
+
+func TestEC2MetadataCredentials(t *testing.T) {
+	restore := clearEnv()
+	defer restore()
+
+	c, f := getEC2(t)
+	defer f.Close()
+
+	m := awstest.NewMetadata("eu-central-1", "pullcord")
+	defer m.Close()
+
+	c.Region = ""
+	c.Credentials = aws.Credentials{}
+	c.Metadata = aws.NewInstanceMetadata(m.URL)
+
+	_, err := c.DescribeInstances(context.Background(), "i-0123")
+	require.NoError(t, err)
+	_, err = c.DescribeInstances(context.Background(), "i-0123")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, m.Requests)
+	require.Len(t, f.Authorizations, 2)
+	assert.True(
+		t,
+		strings.Contains(
+			f.Authorizations[0],
+			"Credential=ASIAEXAMPLE/",
+		),
+	)
+	assert.True(
+		t,
+		strings.Contains(
+			f.Authorizations[0],
+			"/eu-central-1/ec2/aws4_request",
+		),
+	)
+}
+
+func TestEC2NoCredentials(t *testing.T) {
+	restore := clearEnv()
+	defer restore()
+
+	c, f := getEC2(t)
+	defer f.Close()
+
+	c.Credentials = aws.Credentials{}
+	_, err := c.DescribeInstances(context.Background(), "i-0123")
+	assert.Equal(t, aws.NoCredentialsError, err)
+	assert.Len(t, f.Actions, 0)
+}
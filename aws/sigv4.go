@@ -0,0 +1,145 @@
+package aws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+const sigV4TimeFormat = "20060102T150405Z"
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sigV4Escape escapes a string as required by AWS Signature Version 4, which
+// leaves only the unreserved characters of RFC 3986 unescaped.
+func sigV4Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z',
+			'0' <= c && c <= '9', c == '-', c == '_', c == '.',
+			c == '~', keepSlash && c == '/':
+			b.WriteByte(c)
+		default:
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString(
+				[]byte{c},
+			)))
+		}
+	}
+
+	return b.String()
+}
+
+// SignV4 signs a request (with the given body) for the given service and
+// region using AWS Signature Version 4, adding the X-Amz-Date,
+// X-Amz-Security-Token (if there is a session token), and Authorization
+// headers to the request.
+func SignV4(
+	req *http.Request,
+	body []byte,
+	service string,
+	region string,
+	creds Credentials,
+	now time.Time,
+) {
+	amzDate := now.UTC().Format(sigV4TimeFormat)
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" || name == "user-agent" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	var params []string
+	for key, values := range query {
+		for _, v := range values {
+			params = append(
+				params,
+				sigV4Escape(key, false)+"="+
+					sigV4Escape(v, false),
+			)
+		}
+	}
+	sort.Strings(params)
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join(
+		[]string{
+			req.Method,
+			sigV4Escape(path, true),
+			strings.Join(params, "&"),
+			canonicalHeaders.String(),
+			signedHeaders,
+			sha256Hex(body),
+		},
+		"\n",
+	)
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join(
+		[]string{
+			sigV4Algorithm,
+			amzDate,
+			scope,
+			sha256Hex([]byte(canonicalRequest)),
+		},
+		"\n",
+	)
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set(
+		"Authorization",
+		sigV4Algorithm+" Credential="+creds.AccessKeyID+"/"+scope+
+			", SignedHeaders="+signedHeaders+
+			", Signature="+signature,
+	)
+}
@@ -0,0 +1,49 @@
+package aws
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSigV4 checks the signer against the example given in the AWS Signature
+// Version 4 documentation.
+func TestSigV4(t *testing.T) {
+	req, err := http.NewRequest(
+		"GET",
+		"https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+		nil,
+	)
+	require.NoError(t, err)
+	req.Header.Set(
+		"Content-Type",
+		"application/x-www-form-urlencoded; charset=utf-8",
+	)
+
+	SignV4(
+		req,
+		nil,
+		"iam",
+		"us-east-1",
+		Credentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		},
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC),
+	)
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(
+		t,
+		"AWS4-HMAC-SHA256"+
+			" Credential=AKIDEXAMPLE/20150830/us-east-1/iam/"+
+			"aws4_request,"+
+			" SignedHeaders=content-type;host;x-amz-date,"+
+			" Signature=5d672d79c15b13162d9279b0855cfba6789a8edb"+
+			"4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"),
+	)
+}
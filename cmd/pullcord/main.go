@@ -12,9 +12,12 @@ import (
 	"github.com/proidiot/gone/log"
 	"github.com/stuphlabs/pullcord/authentication"
 	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/metrics"
 	"github.com/stuphlabs/pullcord/monitor"
 	pcnet "github.com/stuphlabs/pullcord/net"
+	"github.com/stuphlabs/pullcord/probe"
 	"github.com/stuphlabs/pullcord/proxy"
+	"github.com/stuphlabs/pullcord/schedule"
 	"github.com/stuphlabs/pullcord/trigger"
 	"github.com/stuphlabs/pullcord/util"
 )
@@ -145,9 +148,12 @@ func main() {
 	}
 
 	authentication.LoadPlugin()
+	metrics.LoadPlugin()
 	monitor.LoadPlugin()
 	pcnet.LoadPlugin()
+	probe.LoadPlugin()
 	proxy.LoadPlugin()
+	schedule.LoadPlugin()
 	trigger.LoadPlugin()
 	util.LoadPlugin()
 
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/proidiot/gone/log"
+
+	"github.com/stuphlabs/pullcord"
+)
+
+// Backgrounder is implemented by resources which have work to do in the
+// background for as long as the server they were configured as part of is
+// running (periodic health checks, for example). A Parser keeps track of every
+// Backgrounder it creates, and the server it produces will start each of them
+// before it begins serving and stop each of them once it has been closed.
+//
+// Resources should not start any background work while being unmarshalled, as
+// a config which fails to parse will never have its resources stopped.
+type Backgrounder interface {
+	StartBackground() error
+	StopBackground() error
+}
+
+// backgroundServer wraps a .../pullcord.Server so that the Backgrounders
+// created along with it are started and stopped along with it.
+type backgroundServer struct {
+	pullcord.Server
+	backgrounders []Backgrounder
+	stopOnce      sync.Once
+	stopErr       error
+}
+
+// Serve implements .../pullcord.Server.
+func (s *backgroundServer) Serve() error {
+	for i, b := range s.backgrounders {
+		if e := b.StartBackground(); e != nil {
+			_ = log.Err(
+				fmt.Sprintf(
+					"Unable to start background resource"+
+						" %T: %s",
+					b,
+					e.Error(),
+				),
+			)
+			_ = s.stop(s.backgrounders[:i])
+			return e
+		}
+	}
+
+	defer func() {
+		_ = s.stop(s.backgrounders)
+	}()
+
+	return s.Server.Serve()
+}
+
+// Close implements .../pullcord.Server.
+func (s *backgroundServer) Close() error {
+	err := s.Server.Close()
+	if e := s.stop(s.backgrounders); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func (s *backgroundServer) stop(backgrounders []Backgrounder) error {
+	s.stopOnce.Do(
+		func() {
+			for i := len(backgrounders) - 1; i >= 0; i-- {
+				e := backgrounders[i].StopBackground()
+				if e != nil {
+					_ = log.Err(
+						fmt.Sprintf(
+							"Unable to stop"+
+								" background"+
+								" resource %T:"+
+								" %s",
+							backgrounders[i],
+							e.Error(),
+						),
+					)
+					if s.stopErr == nil {
+						s.stopErr = e
+					}
+				}
+			}
+		},
+	)
+
+	return s.stopErr
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backgroundTestHandler struct {
+	mutex    sync.Mutex
+	starts   int
+	stops    int
+	startErr error
+}
+
+var lastBackgroundTestHandler *backgroundTestHandler
+
+func (h *backgroundTestHandler) UnmarshalJSON(d []byte) error {
+	var failStart bool
+	if e := json.Unmarshal(d, &failStart); e != nil {
+		return e
+	}
+
+	if failStart {
+		h.startErr = errors.New("backgroundTestHandler start failure")
+	}
+
+	lastBackgroundTestHandler = h
+	return nil
+}
+
+func (h *backgroundTestHandler) ServeHTTP(http.ResponseWriter, *http.Request) {
+}
+
+func (h *backgroundTestHandler) StartBackground() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.startErr != nil {
+		return h.startErr
+	}
+
+	h.starts++
+	return nil
+}
+
+func (h *backgroundTestHandler) StopBackground() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.stops++
+	return nil
+}
+
+func (h *backgroundTestHandler) counts() (int, int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.starts, h.stops
+}
+
+type backgroundTestListener struct {
+	net.Listener
+}
+
+func (l *backgroundTestListener) UnmarshalJSON([]byte) error {
+	var e error
+	l.Listener, e = net.Listen("tcp", "127.0.0.1:0")
+	return e
+}
+
+func init() {
+	MustRegisterResourceType(
+		"backgroundtesthandler",
+		func() json.Unmarshaler {
+			return new(backgroundTestHandler)
+		},
+	)
+
+	MustRegisterResourceType(
+		"backgroundtestlistener",
+		func() json.Unmarshaler {
+			return new(backgroundTestListener)
+		},
+	)
+}
+
+func backgroundTestConfig(failStart bool) string {
+	data := "false"
+	if failStart {
+		data = "true"
+	}
+
+	return `{
+		"resources": {
+			"listener": {
+				"type": "backgroundtestlistener",
+				"data": null
+			}
+		},
+		"server": {
+			"type": "httpserver",
+			"data": {
+				"handler": {
+					"type": "backgroundtesthandler",
+					"data": ` + data + `
+				},
+				"listener": {
+					"type": "ref",
+					"data": "listener"
+				}
+			}
+		}
+	}`
+}
+
+func TestBackgroundServer(t *testing.T) {
+	parser := Parser{strings.NewReader(backgroundTestConfig(false))}
+	s, e := parser.Server()
+	require.NoError(t, e)
+	require.NotNil(t, s)
+	h := lastBackgroundTestHandler
+
+	starts, stops := h.counts()
+	assert.Equal(t, 0, starts)
+	assert.Equal(t, 0, stops)
+
+	served := make(chan error)
+	go func() {
+		served <- s.Serve()
+	}()
+
+	for i := 0; i < 100; i++ {
+		if starts, _ = h.counts(); starts > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	starts, stops = h.counts()
+	assert.Equal(t, 1, starts)
+	assert.Equal(t, 0, stops)
+
+	assert.NoError(t, s.Close())
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Error("Serve did not return after the server was closed")
+	}
+
+	starts, stops = h.counts()
+	assert.Equal(t, 1, starts)
+	assert.Equal(t, 1, stops)
+}
+
+func TestBackgroundServerStartError(t *testing.T) {
+	parser := Parser{strings.NewReader(backgroundTestConfig(true))}
+	s, e := parser.Server()
+	require.NoError(t, e)
+	require.NotNil(t, s)
+
+	assert.Error(t, s.Serve())
+
+	starts, stops := lastBackgroundTestHandler.counts()
+	assert.Equal(t, 0, starts)
+	assert.Equal(t, 0, stops)
+}
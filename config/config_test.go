@@ -917,3 +917,99 @@ func TestServerFromReader(t *testing.T) {
 		})
 	}
 }
+
+type refPairTestHandler struct {
+	TestHandler
+	first  json.Unmarshaler
+	second json.Unmarshaler
+}
+
+func (h *refPairTestHandler) UnmarshalJSON(input []byte) error {
+	var t struct {
+		First  Resource
+		Second Resource
+	}
+
+	if e := json.Unmarshal(input, &t); e != nil {
+		return e
+	}
+
+	h.first = t.First.Unmarshalled
+	h.second = t.Second.Unmarshalled
+	return nil
+}
+
+type refPairTestListener struct {
+	TestListener
+	id int
+}
+
+func TestServerFromReaderSharedReference(t *testing.T) {
+	assert.NoError(
+		t,
+		RegisterResourceType(
+			"refpairtesthandler",
+			func() json.Unmarshaler {
+				return new(refPairTestHandler)
+			},
+		),
+	)
+	assert.NoError(
+		t,
+		RegisterResourceType(
+			"refpairtestlistener",
+			func() json.Unmarshaler {
+				return new(refPairTestListener)
+			},
+		),
+	)
+
+	// Whichever order the resources are constructed in, every reference
+	// to a resource gives the same instance.
+	for i := 0; i < 10; i++ {
+		parser := Parser{strings.NewReader(`{
+			"resources": {
+				"handler": {
+					"type": "refpairtesthandler",
+					"data": {
+						"first": {
+							"type": "ref",
+							"data": "listener"
+						},
+						"second": {
+							"type": "ref",
+							"data": "listener"
+						}
+					}
+				},
+				"listener": {
+					"type": "refpairtestlistener",
+					"data": {}
+				}
+			},
+			"server": {
+				"type": "httpserver",
+				"data": {
+					"handler": {
+						"type": "ref",
+						"data": "handler"
+					},
+					"listener": {
+						"type": "ref",
+						"data": "listener"
+					}
+				}
+			}
+		}`)}
+		s, e := parser.Server()
+		assert.NoError(t, e)
+
+		server, ok := s.(*HTTPServer)
+		if !assert.True(t, ok) {
+			return
+		}
+		h := server.Handler.(*refPairTestHandler)
+		assert.True(t, h.first == h.second)
+		assert.True(t, h.first.(net.Listener) == server.Listener)
+	}
+}
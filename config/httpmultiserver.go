@@ -11,10 +11,12 @@ import (
 )
 
 // HTTPMultiServer implements the Pullcord server interface with an HTTP handler
-// and multiple listeners.
+// and multiple listeners. As with an HTTPServer, closing the server cancels
+// the contexts of any requests it is still handling.
 type HTTPMultiServer struct {
 	Listeners []net.Listener
 	Handler   http.Handler
+	base      baseContext
 }
 
 func init() {
@@ -65,7 +67,7 @@ func (s *HTTPMultiServer) UnmarshalJSON(d []byte) error {
 func (s *HTTPMultiServer) Serve() error {
 	_ = log.Debug(
 		fmt.Sprintf(
-			"Serving with listeners %#v and handler %#v",
+			"Serving with listeners %#v and handler %T",
 			s.Listeners,
 			s.Handler,
 		),
@@ -83,8 +85,12 @@ func (s *HTTPMultiServer) Serve() error {
 					gl.Addr(),
 				),
 			)
-			if e != nil {
-				e = http.Serve(gl, s.Handler)
+			if e == nil {
+				server := &http.Server{
+					Handler:     s.Handler,
+					BaseContext: s.base.context,
+				}
+				e = server.Serve(gl)
 			}
 			gErrChan <- e
 		}(l, errChan)
@@ -103,6 +109,8 @@ func (s *HTTPMultiServer) Serve() error {
 
 // Close implements .../pullcord/Server.
 func (s *HTTPMultiServer) Close() error {
+	s.base.close()
+
 	var err error
 	for _, l := range s.Listeners {
 		_ = log.Info(fmt.Sprintf("Closing server at %s...", l.Addr()))
@@ -2,18 +2,58 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 
 	"github.com/proidiot/gone/log"
 )
 
 // HTTPServer implements the Pullcord server interface with an HTTP handler.
+// Closing the server cancels the contexts of any requests it is still
+// handling, so that anything being done on their behalf (such as running a
+// trigger) is cancelled as well.
 type HTTPServer struct {
 	Listener net.Listener
 	Handler  http.Handler
+	base     baseContext
+}
+
+// baseContext is the context from which the contexts of the requests handled
+// by a server are derived, which is cancelled when the server is closed.
+type baseContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+}
+
+// init creates the context if it has not yet been created. The mutex must be
+// held.
+func (b *baseContext) init() {
+	if b.ctx == nil {
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// context gives the context.
+func (b *baseContext) context(net.Listener) context.Context {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.init()
+	return b.ctx
+}
+
+// close cancels the context.
+func (b *baseContext) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.init()
+	b.cancel()
 }
 
 func init() {
@@ -59,7 +99,7 @@ func (s *HTTPServer) UnmarshalJSON(d []byte) error {
 func (s *HTTPServer) Serve() error {
 	_ = log.Debug(
 		fmt.Sprintf(
-			"Serving with listener %#v and handler %#v",
+			"Serving with listener %#v and handler %T",
 			s.Listener,
 			s.Handler,
 		),
@@ -73,7 +113,11 @@ func (s *HTTPServer) Serve() error {
 		return e
 	}
 
-	e = http.Serve(s.Listener, s.Handler)
+	server := &http.Server{
+		Handler:     s.Handler,
+		BaseContext: s.base.context,
+	}
+	e = server.Serve(s.Listener)
 	if e != nil {
 		_ = log.Debug("Server exited with an error")
 		return e
@@ -85,5 +129,6 @@ func (s *HTTPServer) Serve() error {
 // Close implements .../pullcord.Server.
 func (s *HTTPServer) Close() error {
 	_ = log.Info(fmt.Sprintf("Closing server at %s...", s.Listener.Addr()))
+	s.base.close()
 	return s.Listener.Close()
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServerCloseCancelsRequests(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	s := &HTTPServer{
+		Listener: l,
+		Handler: http.HandlerFunc(
+			func(w http.ResponseWriter, req *http.Request) {
+				close(started)
+				select {
+				case <-req.Context().Done():
+					cancelled <- req.Context().Err()
+				case <-time.After(10 * time.Second):
+					cancelled <- nil
+				}
+			},
+		),
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve()
+	}()
+
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String() + "/")
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+
+	<-started
+	require.NoError(t, s.Close())
+	assert.Error(t, <-cancelled)
+	assert.Error(t, <-served)
+}
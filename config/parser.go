@@ -27,6 +27,7 @@ func (p Parser) Server() (pullcord.Server, error) {
 
 	dec := json.NewDecoder(p.Reader)
 	registry = make(map[string]*Resource)
+	backgrounders = nil
 
 	if e := dec.Decode(&config); e != nil {
 		_ = log.Crit(
@@ -80,6 +81,18 @@ func (p Parser) Server() (pullcord.Server, error) {
 	}
 
 	if server, ok := rserver.Unmarshalled.(pullcord.Server); ok {
+		if len(backgrounders) > 0 {
+			_ = log.Debug(
+				fmt.Sprintf(
+					"Server has %d background resources",
+					len(backgrounders),
+				),
+			)
+			return &backgroundServer{
+				Server:        server,
+				backgrounders: backgrounders,
+			}, nil
+		}
 		return server, nil
 	}
 
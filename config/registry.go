@@ -8,3 +8,4 @@ import (
 var registry map[string]*Resource
 var unregisterredResources map[string]json.RawMessage
 var registrationMutex sync.Mutex
+var backgrounders []Backgrounder
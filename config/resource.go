@@ -85,7 +85,21 @@ func (rsc *Resource) UnmarshalJSON(input []byte) error {
 			return e
 		}
 
-		return rsc.unmarshalByName(name)
+		// The named resource is registered before it is constructed,
+		// so that any other references to it share the same instance
+		// (and so that a reference back to it is found to be cyclic).
+		d = new(Resource)
+		if registry != nil {
+			registry[name] = d
+		}
+		if e := d.unmarshalByName(name); e != nil {
+			return e
+		}
+		d.complete = true
+
+		rsc.Unmarshalled = d.Unmarshalled
+		rsc.complete = true
+		return nil
 	}
 
 	newFunc, present := typeRegistry[newRscDef.Type]
@@ -101,6 +115,9 @@ func (rsc *Resource) UnmarshalJSON(input []byte) error {
 	if e := json.Unmarshal(newRscDef.Data, u); e != nil {
 		return e
 	}
+	if b, ok := u.(Backgrounder); ok {
+		backgrounders = append(backgrounders, b)
+	}
 	rsc.Unmarshalled = u
 	rsc.complete = true
 	return nil
@@ -0,0 +1,273 @@
+package dbus
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/proidiot/gone/errors"
+)
+
+// DefaultSystemBusAddress is the address of the system bus used if the
+// DBUS_SYSTEM_BUS_ADDRESS environment variable is not set.
+const DefaultSystemBusAddress = "unix:path=/var/run/dbus/system_bus_socket"
+
+// DefaultTimeout is the amount of time a method call may take if no other
+// timeout has been specified.
+const DefaultTimeout = 25 * time.Second
+
+// AuthenticationError indicates that the bus did not accept the credentials
+// of the connection.
+const AuthenticationError = errors.New("D-Bus authentication failed")
+
+// NoAddressError indicates that none of the given bus addresses could be
+// used.
+const NoAddressError = errors.New("No usable D-Bus address given")
+
+// Error is an error reply to a method call.
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+
+	return e.Name + ": " + e.Message
+}
+
+// SystemBusAddress gives the address of the system bus.
+func SystemBusAddress() string {
+	if a := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); a != "" {
+		return a
+	}
+
+	return DefaultSystemBusAddress
+}
+
+// Conn is a connection to a message bus. Signals received while waiting for
+// the reply to a method call are kept until they are waited for. A Conn is
+// safe for concurrent use, though calls are made one at a time.
+type Conn struct {
+	// Timeout is the amount of time a method call may take, or
+	// DefaultTimeout if not given.
+	Timeout time.Duration
+
+	conn    net.Conn
+	reader  *bufio.Reader
+	serial  uint32
+	signals []*Message
+	mutex   sync.Mutex
+}
+
+// dialAddress connects to the first usable address of a D-Bus server address
+// list. Only unix socket addresses are supported.
+func dialAddress(address string) (net.Conn, error) {
+	var lastErr error = NoAddressError
+	for _, a := range strings.Split(address, ";") {
+		colon := strings.IndexByte(a, ':')
+		if colon < 0 || a[:colon] != "unix" {
+			continue
+		}
+
+		params := make(map[string]string)
+		for _, kv := range strings.Split(a[colon+1:], ",") {
+			eq := strings.IndexByte(kv, '=')
+			if eq < 0 {
+				continue
+			}
+			v, err := url.PathUnescape(kv[eq+1:])
+			if err != nil {
+				return nil, err
+			}
+			params[kv[:eq]] = v
+		}
+
+		path := params["path"]
+		if abstract, present := params["abstract"]; present {
+			path = "@" + abstract
+		}
+		if path == "" {
+			continue
+		}
+
+		conn, err := net.DialTimeout("unix", path, DefaultTimeout)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// Dial connects to the message bus at the given address, authenticating as
+// the user of the process.
+func Dial(address string) (*Conn, error) {
+	conn, err := dialAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	if err = c.authenticate(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if _, err = c.Call(
+		"org.freedesktop.DBus",
+		"/org/freedesktop/DBus",
+		"org.freedesktop.DBus",
+		"Hello",
+		"",
+	); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// authenticate authenticates with the EXTERNAL mechanism, which has the bus
+// use the credentials of the unix socket.
+func (c *Conn) authenticate() error {
+	_ = c.conn.SetDeadline(time.Now().Add(DefaultTimeout))
+	defer func() {
+		_ = c.conn.SetDeadline(time.Time{})
+	}()
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := fmt.Fprintf(
+		c.conn,
+		"\x00AUTH EXTERNAL %s\r\n",
+		uid,
+	); err != nil {
+		return err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	} else if !strings.HasPrefix(line, "OK ") {
+		return AuthenticationError
+	}
+
+	_, err = fmt.Fprint(c.conn, "BEGIN\r\n")
+	return err
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Call calls a method, giving the body of the reply. An error reply is given
+// as an *Error.
+func (c *Conn) Call(
+	destination string,
+	path ObjectPath,
+	iface string,
+	member string,
+	signature Signature,
+	args ...interface{},
+) ([]interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.serial++
+	call := &Message{
+		Type:        TypeMethodCall,
+		Serial:      c.serial,
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Destination: destination,
+		Signature:   signature,
+		Body:        args,
+	}
+	data, err := call.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(timeout))
+	defer func() {
+		_ = c.conn.SetDeadline(time.Time{})
+	}()
+
+	if _, err = c.conn.Write(data); err != nil {
+		return nil, err
+	}
+
+	for {
+		m, err := ReadMessage(c.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case m.Type == TypeSignal:
+			c.signals = append(c.signals, m)
+		case m.ReplySerial != call.Serial:
+		case m.Type == TypeMethodReturn:
+			return m.Body, nil
+		case m.Type == TypeError:
+			e := &Error{Name: m.ErrorName}
+			if len(m.Body) > 0 {
+				e.Message, _ = m.Body[0].(string)
+			}
+			return nil, e
+		}
+	}
+}
+
+// WaitSignal waits for a signal for which the given function gives true,
+// giving an error if no such signal is received within the timeout.
+func (c *Conn) WaitSignal(
+	match func(*Message) bool,
+	timeout time.Duration,
+) (*Message, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, m := range c.signals {
+		if match(m) {
+			c.signals = append(c.signals[:i], c.signals[i+1:]...)
+			return m, nil
+		}
+	}
+	c.signals = nil
+
+	_ = c.conn.SetDeadline(time.Now().Add(timeout))
+	defer func() {
+		_ = c.conn.SetDeadline(time.Time{})
+	}()
+
+	for {
+		m, err := ReadMessage(c.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.Type == TypeSignal && match(m) {
+			return m, nil
+		}
+	}
+}
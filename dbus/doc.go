@@ -0,0 +1,3 @@
+// Package dbus provides a minimal D-Bus client, enough to call methods of
+// services on the system bus (such as systemd) and to wait for their signals.
+package dbus
@@ -0,0 +1,620 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Message types.
+const (
+	TypeMethodCall   = 1
+	TypeMethodReturn = 2
+	TypeError        = 3
+	TypeSignal       = 4
+)
+
+// FlagNoReplyExpected indicates that no reply should be sent to a method
+// call.
+const FlagNoReplyExpected = 0x1
+
+// maxMessageSize is the largest message which will be read.
+const maxMessageSize = 1 << 24
+
+// Header field codes.
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSender      = 7
+	fieldSignature   = 8
+)
+
+// ObjectPath is a D-Bus object path.
+type ObjectPath string
+
+// Signature is a D-Bus type signature.
+type Signature string
+
+// Variant is a D-Bus value along with its type.
+type Variant struct {
+	Signature Signature
+	Value     interface{}
+}
+
+// Message is a D-Bus message. The Body holds one value for each complete type
+// in the Signature. Arrays, structs, and dict entries are given as
+// []interface{}, and the other types as the corresponding Go types (with
+// object paths given as ObjectPath, signatures as Signature, and variants as
+// Variant).
+type Message struct {
+	Type        byte
+	Flags       byte
+	Serial      uint32
+	Path        ObjectPath
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   Signature
+	Body        []interface{}
+}
+
+// splitType splits the first complete type from a signature.
+func splitType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("dbus: incomplete signature")
+	}
+
+	switch sig[0] {
+	case 'a':
+		t, rest, err := splitType(sig[1:])
+		return "a" + t, rest, err
+	case '(', '{':
+		depth := 0
+		for i := 0; i < len(sig); i++ {
+			switch sig[i] {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+				if depth == 0 {
+					return sig[:i+1], sig[i+1:], nil
+				}
+			}
+		}
+		return "", "", fmt.Errorf("dbus: unbalanced signature: %s", sig)
+	}
+
+	if strings.IndexByte("ybnqiuxtdsogvh", sig[0]) < 0 {
+		return "", "", fmt.Errorf("dbus: unknown type in signature: %s", sig)
+	}
+
+	return sig[:1], sig[1:], nil
+}
+
+// splitTypes splits a signature into its complete types.
+func splitTypes(sig string) ([]string, error) {
+	var types []string
+	for sig != "" {
+		t, rest, err := splitType(sig)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+		sig = rest
+	}
+
+	return types, nil
+}
+
+func alignment(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a', 'h':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+
+	return 1
+}
+
+// encoder writes values in the little-endian D-Bus wire format.
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) align(n int) {
+	for e.buf.Len()%n != 0 {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.align(8)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf.WriteString(s)
+	e.buf.WriteByte(0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf.WriteByte(byte(len(s)))
+	e.buf.WriteString(s)
+	e.buf.WriteByte(0)
+}
+
+func (e *encoder) encode(t string, v interface{}) error {
+	bad := fmt.Errorf("dbus: cannot encode %T as %s", v, t)
+
+	switch t[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return bad
+		}
+		e.buf.WriteByte(b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return bad
+		}
+		if b {
+			e.uint32(1)
+		} else {
+			e.uint32(0)
+		}
+	case 'n', 'q':
+		var u uint16
+		switch n := v.(type) {
+		case int16:
+			u = uint16(n)
+		case uint16:
+			u = n
+		default:
+			return bad
+		}
+		e.align(2)
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], u)
+		e.buf.Write(b[:])
+	case 'i', 'u', 'h':
+		switch n := v.(type) {
+		case int32:
+			e.uint32(uint32(n))
+		case uint32:
+			e.uint32(n)
+		default:
+			return bad
+		}
+	case 'x', 't', 'd':
+		switch n := v.(type) {
+		case int64:
+			e.uint64(uint64(n))
+		case uint64:
+			e.uint64(n)
+		case float64:
+			e.uint64(math.Float64bits(n))
+		default:
+			return bad
+		}
+	case 's', 'o':
+		switch s := v.(type) {
+		case string:
+			e.string(s)
+		case ObjectPath:
+			e.string(string(s))
+		default:
+			return bad
+		}
+	case 'g':
+		switch s := v.(type) {
+		case string:
+			e.signature(s)
+		case Signature:
+			e.signature(string(s))
+		default:
+			return bad
+		}
+	case 'v':
+		variant, ok := v.(Variant)
+		if !ok {
+			return bad
+		}
+		e.signature(string(variant.Signature))
+		return e.encode(string(variant.Signature), variant.Value)
+	case 'a':
+		elems, ok := v.([]interface{})
+		if !ok {
+			return bad
+		}
+		e.uint32(0)
+		lenPos := e.buf.Len() - 4
+		e.align(alignment(t[1]))
+		start := e.buf.Len()
+		for _, elem := range elems {
+			if err := e.encode(t[1:], elem); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint32(
+			e.buf.Bytes()[lenPos:],
+			uint32(e.buf.Len()-start),
+		)
+	case '(', '{':
+		fields, ok := v.([]interface{})
+		if !ok {
+			return bad
+		}
+		types, err := splitTypes(t[1 : len(t)-1])
+		if err != nil {
+			return err
+		} else if len(types) != len(fields) {
+			return bad
+		}
+		e.align(8)
+		for i, field := range fields {
+			if err = e.encode(types[i], field); err != nil {
+				return err
+			}
+		}
+	default:
+		return bad
+	}
+
+	return nil
+}
+
+// decoder reads values in the D-Bus wire format.
+type decoder struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.data) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.order.Uint32(b), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	if err := d.align(8); err != nil {
+		return 0, err
+	}
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.order.Uint64(b), nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b[:n]), nil
+}
+
+func (d *decoder) signature() (string, error) {
+	n, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b[:n[0]]), nil
+}
+
+func (d *decoder) decode(t string) (interface{}, error) {
+	switch t[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		n, err := d.uint32()
+		return n != 0, err
+	case 'n', 'q':
+		if err := d.align(2); err != nil {
+			return nil, err
+		}
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		if t[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i':
+		n, err := d.uint32()
+		return int32(n), err
+	case 'u', 'h':
+		return d.uint32()
+	case 'x':
+		n, err := d.uint64()
+		return int64(n), err
+	case 't':
+		return d.uint64()
+	case 'd':
+		n, err := d.uint64()
+		return math.Float64frombits(n), err
+	case 's':
+		return d.string()
+	case 'o':
+		s, err := d.string()
+		return ObjectPath(s), err
+	case 'g':
+		s, err := d.signature()
+		return Signature(s), err
+	case 'v':
+		sig, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		types, err := splitTypes(sig)
+		if err != nil {
+			return nil, err
+		} else if len(types) != 1 {
+			return nil, fmt.Errorf(
+				"dbus: variant must have a single complete"+
+					" type: %s",
+				sig,
+			)
+		}
+		v, err := d.decode(sig)
+		return Variant{Signature: Signature(sig), Value: v}, err
+	case 'a':
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		} else if n > maxMessageSize {
+			return nil, fmt.Errorf("dbus: array too long: %d", n)
+		}
+		if err = d.align(alignment(t[1])); err != nil {
+			return nil, err
+		}
+		end := d.pos + int(n)
+		if end > len(d.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		elems := []interface{}{}
+		for d.pos < end {
+			elem, err := d.decode(t[1:])
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	case '(', '{':
+		types, err := splitTypes(t[1 : len(t)-1])
+		if err != nil {
+			return nil, err
+		}
+		if err = d.align(8); err != nil {
+			return nil, err
+		}
+		fields := make([]interface{}, 0, len(types))
+		for _, ft := range types {
+			field, err := d.decode(ft)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+		return fields, nil
+	}
+
+	return nil, fmt.Errorf("dbus: cannot decode type: %s", t)
+}
+
+// Encode gives the message in the (little-endian) D-Bus wire format.
+func (m *Message) Encode() ([]byte, error) {
+	types, err := splitTypes(string(m.Signature))
+	if err != nil {
+		return nil, err
+	} else if len(types) != len(m.Body) {
+		return nil, fmt.Errorf(
+			"dbus: signature %s does not match %d body values",
+			m.Signature,
+			len(m.Body),
+		)
+	}
+
+	var body encoder
+	for i, t := range types {
+		if err = body.encode(t, m.Body[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields []interface{}
+	addField := func(code byte, sig Signature, v interface{}) {
+		fields = append(
+			fields,
+			[]interface{}{code, Variant{Signature: sig, Value: v}},
+		)
+	}
+	if m.Path != "" {
+		addField(fieldPath, "o", m.Path)
+	}
+	if m.Interface != "" {
+		addField(fieldInterface, "s", m.Interface)
+	}
+	if m.Member != "" {
+		addField(fieldMember, "s", m.Member)
+	}
+	if m.ErrorName != "" {
+		addField(fieldErrorName, "s", m.ErrorName)
+	}
+	if m.ReplySerial != 0 {
+		addField(fieldReplySerial, "u", m.ReplySerial)
+	}
+	if m.Destination != "" {
+		addField(fieldDestination, "s", m.Destination)
+	}
+	if m.Sender != "" {
+		addField(fieldSender, "s", m.Sender)
+	}
+	if m.Signature != "" {
+		addField(fieldSignature, "g", m.Signature)
+	}
+
+	var header encoder
+	header.buf.Write([]byte{'l', m.Type, m.Flags, 1})
+	header.uint32(uint32(body.buf.Len()))
+	header.uint32(m.Serial)
+	if err = header.encode("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	header.align(8)
+	header.buf.Write(body.buf.Bytes())
+
+	return header.buf.Bytes(), nil
+}
+
+// ReadMessage reads a single message in the D-Bus wire format.
+func ReadMessage(r io.Reader) (*Message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("dbus: invalid byte order: %q", fixed[0])
+	}
+	if fixed[3] != 1 {
+		return nil, fmt.Errorf("dbus: unsupported version: %d", fixed[3])
+	}
+
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	if bodyLen > maxMessageSize || fieldsLen > maxMessageSize {
+		return nil, fmt.Errorf("dbus: message too large")
+	}
+
+	headerLen := (16 + int(fieldsLen) + 7) &^ 7
+	data := make([]byte, headerLen+int(bodyLen))
+	copy(data, fixed)
+	if _, err := io.ReadFull(r, data[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		Type:   fixed[1],
+		Flags:  fixed[2],
+		Serial: order.Uint32(fixed[8:]),
+	}
+
+	header := &decoder{data: data[:headerLen], pos: 12, order: order}
+	fields, err := header.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields.([]interface{}) {
+		field := f.([]interface{})
+		v := field[1].(Variant).Value
+		switch field[0].(byte) {
+		case fieldPath:
+			m.Path, _ = v.(ObjectPath)
+		case fieldInterface:
+			m.Interface, _ = v.(string)
+		case fieldMember:
+			m.Member, _ = v.(string)
+		case fieldErrorName:
+			m.ErrorName, _ = v.(string)
+		case fieldReplySerial:
+			m.ReplySerial, _ = v.(uint32)
+		case fieldDestination:
+			m.Destination, _ = v.(string)
+		case fieldSender:
+			m.Sender, _ = v.(string)
+		case fieldSignature:
+			m.Signature, _ = v.(Signature)
+		}
+	}
+
+	types, err := splitTypes(string(m.Signature))
+	if err != nil {
+		return nil, err
+	}
+	body := &decoder{data: data[headerLen:], order: order}
+	for _, t := range types {
+		v, err := body.decode(t)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = append(m.Body, v)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package dbus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := &Message{
+		Type:        TypeSignal,
+		Serial:      7,
+		Path:        "/org/freedesktop/systemd1",
+		Interface:   "org.freedesktop.systemd1.Manager",
+		Member:      "JobRemoved",
+		Sender:      ":1.1",
+		ReplySerial: 3,
+		Signature:   "uossa{sv}(yb)ax",
+		Body: []interface{}{
+			uint32(42),
+			ObjectPath("/org/freedesktop/systemd1/job/42"),
+			"wiki.service",
+			"done",
+			[]interface{}{
+				[]interface{}{
+					"ActiveState",
+					Variant{Signature: "s", Value: "active"},
+				},
+				[]interface{}{
+					"NRestarts",
+					Variant{Signature: "u", Value: uint32(2)},
+				},
+			},
+			[]interface{}{byte(1), true},
+			[]interface{}{},
+		},
+	}
+
+	data, err := m.Encode()
+	require.NoError(t, err)
+
+	got, err := ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func TestMessageEncodeErrors(t *testing.T) {
+	m := &Message{
+		Type:      TypeMethodCall,
+		Signature: "ss",
+		Body:      []interface{}{"only one"},
+	}
+	_, err := m.Encode()
+	assert.Error(t, err)
+
+	m.Body = []interface{}{"one", 2}
+	_, err = m.Encode()
+	assert.Error(t, err)
+
+	m.Signature = "a(s"
+	m.Body = []interface{}{[]interface{}{}}
+	_, err = m.Encode()
+	assert.Error(t, err)
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	m := &Message{
+		Type:      TypeMethodReturn,
+		Serial:    1,
+		Signature: "s",
+		Body:      []interface{}{"hello"},
+	}
+	data, err := m.Encode()
+	require.NoError(t, err)
+
+	_, err = ReadMessage(bytes.NewReader(data[:len(data)-2]))
+	assert.Error(t, err)
+
+	data[0] = 'x'
+	_, err = ReadMessage(bytes.NewReader(data))
+	assert.Error(t, err)
+}
@@ -0,0 +1,292 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/proidiot/gone/errors"
+)
+
+// DefaultHost is the address of the Docker Engine API used if no other
+// address has been specified.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// DefaultTimeout is the amount of time a request to the Docker Engine API may
+// take (in addition to any time given to a container to stop) if no other
+// timeout has been specified.
+const DefaultTimeout = 30 * time.Second
+
+// NoSuchContainerError indicates that the Docker Engine has no container with
+// the requested name.
+const NoSuchContainerError = errors.New("No such container")
+
+// maxErrorBodySize is the most of the body of an error response that will be
+// read for its message.
+const maxErrorBodySize = 1 << 16
+
+// APIError is an error returned by the Docker Engine API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf(
+		"docker engine responded with status %d: %s",
+		e.StatusCode,
+		e.Message,
+	)
+}
+
+// Health is the result of the health check of a container.
+type Health struct {
+	Status string
+}
+
+// ContainerState is the state of a container, as given by the Docker Engine.
+type ContainerState struct {
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	Health     *Health
+}
+
+// Client is a client for the Docker Engine API.
+type Client struct {
+	Host       string
+	APIVersion string
+	Timeout    time.Duration
+	base       url.URL
+	transport  http.RoundTripper
+}
+
+// NewClient creates a Client for the Docker Engine API at the given host,
+// which can be a unix socket (such as DefaultHost), or a TCP address (given
+// as tcp://, http://, or https://). If an API version is given, requests are
+// made for that version of the API rather than whichever version the Docker
+// Engine defaults to.
+func NewClient(host string, apiVersion string) (*Client, error) {
+	if host == "" {
+		host = DefaultHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Host:       host,
+		APIVersion: strings.TrimPrefix(apiVersion, "v"),
+	}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		c.base = url.URL{Scheme: "http", Host: "docker"}
+		c.transport = &http.Transport{
+			DialContext: func(
+				ctx context.Context,
+				_ string,
+				_ string,
+			) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	case "tcp", "http":
+		c.base = url.URL{Scheme: "http", Host: u.Host}
+		c.transport = http.DefaultTransport
+	case "https":
+		c.base = url.URL{Scheme: "https", Host: u.Host}
+		c.transport = http.DefaultTransport
+	default:
+		return nil, fmt.Errorf(
+			"docker host must be a unix, tcp, http, or https"+
+				" address, but was given: %s",
+			host,
+		)
+	}
+
+	return c, nil
+}
+
+// do makes a request of the Docker Engine API, giving the response if its
+// status code is one of the given status codes, or an error otherwise. The
+// body of a successful response must be closed by the caller. The request is
+// abandoned if the context is cancelled.
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	query url.Values,
+	extraTime time.Duration,
+	okStatus ...int,
+) (*http.Response, error) {
+	u := c.base
+	u.Path = path
+	if c.APIVersion != "" {
+		u.Path = "/v" + c.APIVersion + path
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Transport: c.transport,
+		Timeout:   timeout + extraTime,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range okStatus {
+		if resp.StatusCode == s {
+			return resp, nil
+		}
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == 404 {
+		return nil, NoSuchContainerError
+	}
+
+	var body struct {
+		Message string
+	}
+	contents, _ := ioutil.ReadAll(
+		io.LimitReader(resp.Body, maxErrorBodySize),
+	)
+	if json.Unmarshal(contents, &body) != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(contents))
+	}
+
+	return nil, &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    body.Message,
+	}
+}
+
+func containerPath(container string, action string) string {
+	p := "/containers/" + url.PathEscape(container)
+	if action != "" {
+		p += "/" + action
+	}
+
+	return p
+}
+
+// Inspect gives the state of the named container.
+func (c *Client) Inspect(
+	ctx context.Context,
+	container string,
+) (*ContainerState, error) {
+	resp, err := c.do(
+		ctx,
+		"GET",
+		containerPath(container, "json"),
+		nil,
+		0,
+		200,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var body struct {
+		State ContainerState
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	return &body.State, nil
+}
+
+// action performs an action (such as start or stop) on the named container. A
+// 304 response indicates that the container was already in the requested
+// state, and so is not an error.
+func (c *Client) action(
+	ctx context.Context,
+	container string,
+	action string,
+	query url.Values,
+	extraTime time.Duration,
+) error {
+	resp, err := c.do(
+		ctx,
+		"POST",
+		containerPath(container, action),
+		query,
+		extraTime,
+		200,
+		204,
+		304,
+	)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Start starts the named container.
+func (c *Client) Start(ctx context.Context, container string) error {
+	return c.action(ctx, container, "start", nil, 0)
+}
+
+// Stop stops the named container, giving it the given amount of time to stop
+// before it is killed. If the timeout is negative, the default of the
+// container (or of the Docker Engine) is used.
+func (c *Client) Stop(
+	ctx context.Context,
+	container string,
+	timeout time.Duration,
+) error {
+	query := url.Values{}
+	extraTime := time.Duration(0)
+	if timeout >= 0 {
+		seconds := int(timeout.Seconds())
+		query.Set("t", strconv.Itoa(seconds))
+		extraTime = time.Duration(seconds) * time.Second
+	}
+
+	return c.action(ctx, container, "stop", query, extraTime)
+}
+
+// Pause pauses all the processes of the named container.
+func (c *Client) Pause(ctx context.Context, container string) error {
+	return c.action(ctx, container, "pause", nil, 0)
+}
+
+// Unpause resumes all the processes of the named container.
+func (c *Client) Unpause(ctx context.Context, container string) error {
+	return c.action(ctx, container, "unpause", nil, 0)
+}
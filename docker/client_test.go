@@ -0,0 +1,62 @@
+package docker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stuphlabs/pullcord/docker"
+	"github.com/stuphlabs/pullcord/docker/dockertest"
+)
+
+func TestClient(t *testing.T) {
+	e, err := dockertest.NewEngine()
+	require.NoError(t, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	e.SetContainer("wiki", docker.ContainerState{Status: "exited"})
+
+	c, err := docker.NewClient(e.Host, "1.41")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	state, err := c.Inspect(ctx, "wiki")
+	require.NoError(t, err)
+	assert.False(t, state.Running)
+
+	assert.NoError(t, c.Start(ctx, "wiki"))
+	assert.NoError(t, c.Start(ctx, "wiki"))
+	assert.NoError(t, c.Pause(ctx, "wiki"))
+	state, err = c.Inspect(ctx, "wiki")
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+
+	assert.Error(t, c.Pause(ctx, "wiki"))
+	assert.NoError(t, c.Unpause(ctx, "wiki"))
+	assert.NoError(t, c.Stop(ctx, "wiki", 5*time.Second))
+	assert.NoError(t, c.Stop(ctx, "wiki", -1))
+
+	_, err = c.Inspect(ctx, "nope")
+	assert.Equal(t, docker.NoSuchContainerError, err)
+	assert.Equal(t, docker.NoSuchContainerError, c.Start(ctx, "nope"))
+
+	assert.Equal(t, "GET /v1.41/containers/wiki/json", e.Requests[0])
+	assert.Equal(t, "POST /v1.41/containers/wiki/start", e.Requests[1])
+}
+
+func TestNewClient(t *testing.T) {
+	c, err := docker.NewClient("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, docker.DefaultHost, c.Host)
+
+	_, err = docker.NewClient("tcp://127.0.0.1:2375", "v1.41")
+	assert.NoError(t, err)
+
+	_, err = docker.NewClient("ftp://127.0.0.1", "")
+	assert.Error(t, err)
+}
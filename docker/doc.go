@@ -0,0 +1,3 @@
+// Package docker provides a minimal client for the Docker Engine API, enough
+// for containers to be managed as Pullcord services.
+package docker
@@ -0,0 +1,172 @@
+// Package dockertest provides a fake Docker Engine, served over a local unix
+// socket, against which Docker clients can be tested.
+package dockertest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/stuphlabs/pullcord/docker"
+)
+
+// Engine is a fake Docker Engine which knows of a set of containers, and which
+// implements enough of the Docker Engine API to inspect, start, stop, pause,
+// and unpause them.
+type Engine struct {
+	// Host is the address of the fake Docker Engine, suitable for
+	// docker.NewClient.
+	Host string
+
+	// Requests is the method and path of each request received, in order.
+	Requests []string
+
+	containers map[string]*docker.ContainerState
+	dir        string
+	server     *http.Server
+	mutex      sync.Mutex
+}
+
+// NewEngine starts a fake Docker Engine with no containers.
+func NewEngine() (*Engine, error) {
+	dir, err := ioutil.TempDir("", "pullcord-docker")
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	e := &Engine{
+		Host:       "unix://" + path,
+		containers: make(map[string]*docker.ContainerState),
+		dir:        dir,
+	}
+	e.server = &http.Server{Handler: e}
+	go func() {
+		_ = e.server.Serve(l)
+	}()
+
+	return e, nil
+}
+
+// Close stops the fake Docker Engine.
+func (e *Engine) Close() error {
+	err := e.server.Close()
+	_ = os.RemoveAll(e.dir)
+	return err
+}
+
+// SetContainer adds a container with the given state, or replaces the state
+// of an existing container.
+func (e *Engine) SetContainer(name string, state docker.ContainerState) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.containers[name] = &state
+}
+
+// Container gives the current state of the named container.
+func (e *Engine) Container(name string) (docker.ContainerState, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	state, present := e.containers[name]
+	if !present {
+		return docker.ContainerState{}, false
+	}
+
+	return *state, true
+}
+
+func writeMessage(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{message})
+}
+
+func (e *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.Requests = append(e.Requests, req.Method+" "+req.URL.Path)
+
+	path := req.URL.Path
+	if strings.HasPrefix(path, "/v") {
+		if i := strings.Index(path[1:], "/"); i >= 0 {
+			path = path[i+1:]
+		}
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "containers" {
+		writeMessage(w, 404, "page not found")
+		return
+	}
+
+	state, present := e.containers[parts[1]]
+	if !present {
+		writeMessage(w, 404, "No such container: "+parts[1])
+		return
+	}
+
+	if parts[2] == "json" && req.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Name  string
+			State *docker.ContainerState
+		}{"/" + parts[1], state})
+		return
+	} else if req.Method != "POST" {
+		writeMessage(w, 405, "method not allowed")
+		return
+	}
+
+	switch parts[2] {
+	case "start":
+		if state.Running {
+			w.WriteHeader(304)
+			return
+		}
+		state.Running = true
+		state.Status = "running"
+	case "stop":
+		if !state.Running {
+			w.WriteHeader(304)
+			return
+		}
+		state.Running = false
+		state.Paused = false
+		state.Status = "exited"
+	case "pause":
+		if !state.Running || state.Paused {
+			writeMessage(w, 409, "container is not running")
+			return
+		}
+		state.Paused = true
+		state.Status = "paused"
+	case "unpause":
+		if !state.Paused {
+			writeMessage(w, 409, "container is not paused")
+			return
+		}
+		state.Paused = false
+		state.Status = "running"
+	default:
+		writeMessage(w, 404, "page not found")
+		return
+	}
+
+	w.WriteHeader(204)
+}
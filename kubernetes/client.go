@@ -0,0 +1,280 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Deployment is the kind of a Kubernetes Deployment.
+	Deployment = "deployment"
+	// StatefulSet is the kind of a Kubernetes StatefulSet.
+	StatefulSet = "statefulset"
+)
+
+// DefaultNamespace is the namespace used if no other namespace has been
+// specified.
+const DefaultNamespace = "default"
+
+// DefaultTimeout is the amount of time a request to the Kubernetes API may
+// take if no other timeout has been specified.
+const DefaultTimeout = 30 * time.Second
+
+// maxBodySize is the most of the body of a response that will be read.
+const maxBodySize = 1 << 20
+
+// StatusError is an error returned by the Kubernetes API.
+type StatusError struct {
+	StatusCode int
+	Reason     string
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf(
+		"kubernetes API responded with status %d: %s: %s",
+		e.StatusCode,
+		e.Reason,
+		e.Message,
+	)
+}
+
+// WorkloadStatus is the number of replicas a workload (a Deployment or a
+// StatefulSet) should have, along with how many of them are ready.
+type WorkloadStatus struct {
+	Replicas          int32
+	ReadyReplicas     int32
+	AvailableReplicas int32
+}
+
+// Client is a client for the Kubernetes API. Requests are authenticated with
+// Token (or the contents of TokenFile, which is read again for each request so
+// that rotated service account tokens are picked up), or with the client
+// certificate of the transport. Workloads are looked for in Namespace (or
+// DefaultNamespace) unless another namespace is given.
+type Client struct {
+	Server    string
+	Token     string
+	TokenFile string
+	Namespace string
+	Timeout   time.Duration
+	transport http.RoundTripper
+}
+
+// NewClient creates a Client for the Kubernetes API server at the given
+// address, authenticated with the given bearer token (if any).
+func NewClient(server string, token string) *Client {
+	return &Client{
+		Server:    strings.TrimSuffix(server, "/"),
+		Token:     token,
+		Namespace: DefaultNamespace,
+		transport: http.DefaultTransport,
+	}
+}
+
+func (c *Client) token() (string, error) {
+	if c.TokenFile != "" {
+		token, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(token)), nil
+	}
+
+	return c.Token, nil
+}
+
+// do makes a request of the Kubernetes API, decoding the response into the
+// given value. The request is abandoned if the context is cancelled.
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	contentType string,
+	body []byte,
+	v interface{},
+) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		method,
+		c.Server+path,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	token, err := c.token()
+	if err != nil {
+		return err
+	} else if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	transport := c.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	contents, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var status struct {
+			Reason  string
+			Message string
+		}
+		if json.Unmarshal(contents, &status) != nil ||
+			status.Message == "" {
+			status.Message = strings.TrimSpace(string(contents))
+		}
+
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			Reason:     status.Reason,
+			Message:    status.Message,
+		}
+	}
+
+	return json.Unmarshal(contents, v)
+}
+
+// workloadPath gives the API path of the named workload of the given kind.
+func (c *Client) workloadPath(
+	kind string,
+	namespace string,
+	name string,
+) (string, error) {
+	var resource string
+	switch strings.ToLower(kind) {
+	case Deployment:
+		resource = "deployments"
+	case StatefulSet:
+		resource = "statefulsets"
+	default:
+		return "", fmt.Errorf(
+			"kubernetes workload kind must be deployment or"+
+				" statefulset, but was given: %s",
+			kind,
+		)
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("no kubernetes %s name given", kind)
+	}
+
+	if namespace == "" {
+		namespace = c.Namespace
+	}
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	return "/apis/apps/v1/namespaces/" + url.PathEscape(namespace) + "/" +
+		resource + "/" + url.PathEscape(name), nil
+}
+
+// Status gives the status of the named workload of the given kind.
+func (c *Client) Status(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	name string,
+) (*WorkloadStatus, error) {
+	path, err := c.workloadPath(kind, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var w struct {
+		Spec struct {
+			Replicas *int32
+		}
+		Status struct {
+			ReadyReplicas     int32
+			AvailableReplicas int32
+		}
+	}
+	if err = c.do(ctx, "GET", path, "", nil, &w); err != nil {
+		return nil, err
+	}
+
+	// A workload without a replica count in its spec has the default of
+	// one replica.
+	status := &WorkloadStatus{
+		Replicas:          1,
+		ReadyReplicas:     w.Status.ReadyReplicas,
+		AvailableReplicas: w.Status.AvailableReplicas,
+	}
+	if w.Spec.Replicas != nil {
+		status.Replicas = *w.Spec.Replicas
+	}
+
+	return status, nil
+}
+
+// Scale sets the number of replicas of the named workload of the given kind,
+// by patching its scale subresource.
+func (c *Client) Scale(
+	ctx context.Context,
+	kind string,
+	namespace string,
+	name string,
+	replicas int32,
+) error {
+	if replicas < 0 {
+		return fmt.Errorf(
+			"kubernetes replicas must not be negative, but was"+
+				" given: %d",
+			replicas,
+		)
+	}
+
+	path, err := c.workloadPath(kind, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	body := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	var scale struct{}
+
+	return c.do(
+		ctx,
+		"PATCH",
+		path+"/scale",
+		"application/merge-patch+json",
+		body,
+		&scale,
+	)
+}
@@ -0,0 +1,74 @@
+package kubernetes_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/kubernetes"
+	"github.com/stuphlabs/pullcord/kubernetes/kubetest"
+)
+
+func TestClientScale(t *testing.T) {
+	a := kubetest.NewAPIServer("secrettoken")
+	defer a.Close()
+	a.Transitions = 1
+	a.SetWorkload(kubernetes.Deployment, "apps", "wiki", 0)
+
+	c := kubernetes.NewClient(a.URL, "secrettoken")
+	c.Namespace = "apps"
+
+	ctx := context.Background()
+
+	s, err := c.Status(ctx, kubernetes.Deployment, "", "wiki")
+	require.NoError(t, err)
+	assert.Equal(t, kubernetes.WorkloadStatus{}, *s)
+
+	require.NoError(t, c.Scale(ctx, kubernetes.Deployment, "", "wiki", 2))
+	assert.Equal(
+		t,
+		"PATCH /apis/apps/v1/namespaces/apps/deployments/wiki/scale",
+		a.Requests[1],
+	)
+
+	s, err = c.Status(ctx, kubernetes.Deployment, "apps", "wiki")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), s.Replicas)
+	assert.Equal(t, int32(0), s.ReadyReplicas)
+
+	s, err = c.Status(ctx, kubernetes.Deployment, "apps", "wiki")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), s.ReadyReplicas)
+
+	assert.Error(t, c.Scale(ctx, kubernetes.Deployment, "", "wiki", -1))
+}
+
+func TestClientErrors(t *testing.T) {
+	a := kubetest.NewAPIServer("secrettoken")
+	defer a.Close()
+	a.SetWorkload(kubernetes.StatefulSet, "default", "db", 1)
+
+	c := kubernetes.NewClient(a.URL, "secrettoken")
+	ctx := context.Background()
+
+	_, err := c.Status(ctx, kubernetes.StatefulSet, "", "db")
+	assert.NoError(t, err)
+
+	_, err = c.Status(ctx, kubernetes.Deployment, "", "db")
+	require.Error(t, err)
+	statusErr, ok := err.(*kubernetes.StatusError)
+	require.True(t, ok)
+	assert.Equal(t, 404, statusErr.StatusCode)
+	assert.Equal(t, "NotFound", statusErr.Reason)
+
+	_, err = c.Status(ctx, "daemonset", "", "db")
+	assert.Error(t, err)
+
+	c.Token = "wrongtoken"
+	err = c.Scale(ctx, kubernetes.StatefulSet, "", "db", 0)
+	require.Error(t, err)
+	statusErr, ok = err.(*kubernetes.StatusError)
+	require.True(t, ok)
+	assert.Equal(t, 401, statusErr.StatusCode)
+}
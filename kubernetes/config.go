@@ -0,0 +1,311 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/proidiot/gone/errors"
+)
+
+// ServiceAccountDir is the directory in which Kubernetes mounts the token,
+// certificate authority, and namespace of the service account of a pod.
+const ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// NotInClusterError indicates that an in-cluster client was requested, but
+// Pullcord does not appear to be running in a Kubernetes pod.
+const NotInClusterError = errors.New("Not running in a Kubernetes cluster")
+
+// LoadClient creates a Client using the given kubeconfig file and context. If
+// neither is given, the service account of the pod is used when running in a
+// Kubernetes cluster, and the default kubeconfig file is used otherwise.
+func LoadClient(kubeconfig string, context string) (*Client, error) {
+	if kubeconfig == "" && context == "" &&
+		os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return NewInClusterClient("")
+	}
+
+	return NewKubeconfigClient(kubeconfig, context)
+}
+
+// NewInClusterClient creates a Client authenticated as the service account of
+// the pod, using the token, certificate authority, and namespace found in the
+// given directory (or ServiceAccountDir).
+func NewInClusterClient(dir string) (*Client, error) {
+	if dir == "" {
+		dir = ServiceAccountDir
+	}
+
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, NotInClusterError
+	}
+
+	tokenFile := filepath.Join(dir, "token")
+	if _, err := os.Stat(tokenFile); err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(ca, nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewClient("https://"+net.JoinHostPort(host, port), "")
+	c.TokenFile = tokenFile
+	c.transport = transport
+
+	if ns, err := ioutil.ReadFile(filepath.Join(dir, "namespace")); err == nil {
+		if namespace := strings.TrimSpace(string(ns)); namespace != "" {
+			c.Namespace = namespace
+		}
+	}
+
+	return c, nil
+}
+
+// DefaultKubeconfig gives the path of the first file named in the KUBECONFIG
+// environment variable, or ~/.kube/config if it is not set.
+func DefaultKubeconfig() string {
+	for _, path := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+		if path != "" {
+			return path
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".kube", "config")
+}
+
+// kubeconfig is the part of a kubeconfig file which is of interest.
+type kubeconfig struct {
+	CurrentContext string `json:"current-context"`
+	Clusters       []struct {
+		Name    string
+		Cluster struct {
+			Server                   string
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData string `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		}
+	}
+	Users []struct {
+		Name string
+		User struct {
+			Token                 string
+			TokenFile             string
+			ClientCertificate     string `json:"client-certificate"`
+			ClientCertificateData string `json:"client-certificate-data"`
+			ClientKey             string `json:"client-key"`
+			ClientKeyData         string `json:"client-key-data"`
+			Exec                  *json.RawMessage
+			AuthProvider          *json.RawMessage `json:"auth-provider"`
+		}
+	}
+	Contexts []struct {
+		Name    string
+		Context struct {
+			Cluster   string
+			User      string
+			Namespace string
+		}
+	}
+}
+
+// NewKubeconfigClient creates a Client from the given context (or the current
+// context) of the given kubeconfig file (or DefaultKubeconfig). Only
+// kubeconfig files in JSON form are understood, such as those written by
+// "kubectl config view --raw --flatten -o json". Users which authenticate with
+// exec or auth provider plugins are not supported.
+func NewKubeconfigClient(path string, context string) (*Client, error) {
+	if path == "" {
+		path = DefaultKubeconfig()
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config kubeconfig
+	if err = json.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf(
+			"unable to read kubeconfig %s (which must be in JSON"+
+				" form): %v",
+			path,
+			err,
+		)
+	}
+
+	if context == "" {
+		context = config.CurrentContext
+	}
+
+	var clusterName, userName, namespace string
+	found := false
+	for _, c := range config.Contexts {
+		if c.Name == context {
+			clusterName = c.Context.Cluster
+			userName = c.Context.User
+			namespace = c.Context.Namespace
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf(
+			"kubeconfig %s has no context named: %s",
+			path,
+			context,
+		)
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	c := NewClient("", "")
+	var ca, cert, key []byte
+	insecure := false
+
+	found = false
+	for _, cl := range config.Clusters {
+		if cl.Name != clusterName {
+			continue
+		}
+		found = true
+
+		c.Server = strings.TrimSuffix(cl.Cluster.Server, "/")
+		insecure = cl.Cluster.InsecureSkipTLSVerify
+		ca, err = readData(
+			cl.Cluster.CertificateAuthorityData,
+			resolve(cl.Cluster.CertificateAuthority),
+		)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf(
+			"kubeconfig %s has no cluster named: %s",
+			path,
+			clusterName,
+		)
+	}
+
+	for _, u := range config.Users {
+		if u.Name != userName {
+			continue
+		}
+
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, fmt.Errorf(
+				"kubeconfig user %s uses a credential plugin,"+
+					" which is not supported",
+				userName,
+			)
+		}
+
+		c.Token = u.User.Token
+		c.TokenFile = resolve(u.User.TokenFile)
+		cert, err = readData(
+			u.User.ClientCertificateData,
+			resolve(u.User.ClientCertificate),
+		)
+		if err != nil {
+			return nil, err
+		}
+		key, err = readData(
+			u.User.ClientKeyData,
+			resolve(u.User.ClientKey),
+		)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	if namespace != "" {
+		c.Namespace = namespace
+	}
+
+	if c.transport, err = newTransport(ca, cert, key, insecure); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// readData gives the base64 decoded data if given, or otherwise the contents
+// of the file (if named).
+func readData(data string, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	} else if file != "" {
+		return ioutil.ReadFile(file)
+	}
+
+	return nil, nil
+}
+
+// newTransport creates a transport which trusts the given PEM encoded
+// certificate authority (if any), and which presents the given PEM encoded
+// client certificate (if any).
+func newTransport(
+	ca []byte,
+	cert []byte,
+	key []byte,
+	insecure bool,
+) (http.RoundTripper, error) {
+	if ca == nil && cert == nil && !insecure {
+		return http.DefaultTransport, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: insecure}
+
+	if ca != nil {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf(
+				"no valid certificates in kubernetes" +
+					" certificate authority",
+			)
+		}
+	}
+
+	if cert != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+
+	return transport, nil
+}
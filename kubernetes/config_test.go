@@ -0,0 +1,201 @@
+package kubernetes_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/kubernetes"
+	"github.com/stuphlabs/pullcord/kubernetes/kubetest"
+)
+
+const testKubeconfig = `{
+	"apiVersion": "v1",
+	"kind": "Config",
+	"current-context": "dev",
+	"clusters": [
+		{
+			"name": "local",
+			"cluster": {
+				"server": "SERVER"
+			}
+		}
+	],
+	"users": [
+		{
+			"name": "pullcord",
+			"user": {
+				"tokenFile": "token"
+			}
+		},
+		{
+			"name": "plugin",
+			"user": {
+				"exec": {
+					"command": "aws"
+				}
+			}
+		}
+	],
+	"contexts": [
+		{
+			"name": "dev",
+			"context": {
+				"cluster": "local",
+				"user": "pullcord",
+				"namespace": "apps"
+			}
+		},
+		{
+			"name": "plugin",
+			"context": {
+				"cluster": "local",
+				"user": "plugin"
+			}
+		}
+	]
+}`
+
+func TestKubeconfigClient(t *testing.T) {
+	a := kubetest.NewAPIServer("secrettoken")
+	defer a.Close()
+	a.SetWorkload(kubernetes.Deployment, "apps", "wiki", 1)
+
+	dir, err := ioutil.TempDir("", "pullcord-kubeconfig")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "config")
+	require.NoError(
+		t,
+		ioutil.WriteFile(
+			path,
+			[]byte(
+				strings.Replace(
+					testKubeconfig,
+					"SERVER",
+					a.URL,
+					1,
+				),
+			),
+			0600,
+		),
+	)
+	require.NoError(
+		t,
+		ioutil.WriteFile(
+			filepath.Join(dir, "token"),
+			[]byte("secrettoken\n"),
+			0600,
+		),
+	)
+
+	c, err := kubernetes.NewKubeconfigClient(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, "apps", c.Namespace)
+
+	ctx := context.Background()
+
+	s, err := c.Status(ctx, kubernetes.Deployment, "", "wiki")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), s.ReadyReplicas)
+
+	_, err = kubernetes.NewKubeconfigClient(path, "plugin")
+	assert.Error(t, err)
+
+	_, err = kubernetes.NewKubeconfigClient(path, "prod")
+	assert.Error(t, err)
+
+	yaml := filepath.Join(dir, "yaml")
+	require.NoError(
+		t,
+		ioutil.WriteFile(yaml, []byte("apiVersion: v1\n"), 0600),
+	)
+	_, err = kubernetes.NewKubeconfigClient(yaml, "")
+	assert.Error(t, err)
+}
+
+func TestInClusterClient(t *testing.T) {
+	a := kubetest.NewAPIServer("podtoken")
+	defer a.Close()
+	a.SetWorkload(kubernetes.StatefulSet, "pullcord", "db", 3)
+
+	server := httptest.NewTLSServer(a)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "pullcord-serviceaccount")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for name, contents := range map[string][]byte{
+		"token":     []byte("podtoken"),
+		"namespace": []byte("pullcord\n"),
+		"ca.crt": pem.EncodeToMemory(
+			&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: server.Certificate().Raw,
+			},
+		),
+	} {
+		require.NoError(
+			t,
+			ioutil.WriteFile(filepath.Join(dir, name), contents, 0600),
+		)
+	}
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(u.Host)
+	require.NoError(t, err)
+
+	defer setEnv("KUBERNETES_SERVICE_HOST", "")()
+	defer setEnv("KUBERNETES_SERVICE_PORT", "")()
+
+	_, err = kubernetes.NewInClusterClient(dir)
+	assert.Equal(t, kubernetes.NotInClusterError, err)
+
+	_ = os.Setenv("KUBERNETES_SERVICE_HOST", host)
+	_ = os.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	c, err := kubernetes.NewInClusterClient(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "pullcord", c.Namespace)
+
+	ctx := context.Background()
+
+	s, err := c.Status(ctx, kubernetes.StatefulSet, "", "db")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), s.Replicas)
+}
+
+// setEnv sets an environment variable (unsetting it if the value is empty),
+// giving a function which restores its previous value.
+func setEnv(name string, value string) func() {
+	previous, present := os.LookupEnv(name)
+	if value == "" {
+		_ = os.Unsetenv(name)
+	} else {
+		_ = os.Setenv(name, value)
+	}
+
+	return func() {
+		if present {
+			_ = os.Setenv(name, previous)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package kubernetes provides a minimal client for the Kubernetes API, enough
+// for Deployments and StatefulSets to be scaled up and down as Pullcord
+// services.
+package kubernetes
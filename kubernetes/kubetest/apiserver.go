@@ -0,0 +1,217 @@
+// Package kubetest provides a fake Kubernetes API server against which
+// Kubernetes clients can be tested.
+package kubetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/stuphlabs/pullcord/kubernetes"
+)
+
+// APIServer is a fake Kubernetes API server which knows of a set of
+// Deployments and StatefulSets, and which implements enough of the Kubernetes
+// API to get and scale them. Workloads which are scaled have their number of
+// ready replicas catch up with their number of replicas after Transitions
+// requests for their status.
+type APIServer struct {
+	// URL is the address of the fake API server, suitable for
+	// kubernetes.NewClient.
+	URL string
+
+	// Token is the bearer token which requests must give.
+	Token string
+
+	// Transitions is the number of times a workload which is being scaled
+	// is requested before all of its replicas are ready.
+	Transitions int
+
+	// Requests is the method and path of each request received, in order.
+	Requests []string
+
+	workloads map[string]*workload
+	server    *httptest.Server
+	mutex     sync.Mutex
+}
+
+type workload struct {
+	status    kubernetes.WorkloadStatus
+	remaining int
+}
+
+// NewAPIServer starts a fake Kubernetes API server with no workloads, which
+// requires the given bearer token.
+func NewAPIServer(token string) *APIServer {
+	a := &APIServer{
+		Token:     token,
+		workloads: make(map[string]*workload),
+	}
+	a.server = httptest.NewServer(a)
+	a.URL = a.server.URL
+
+	return a
+}
+
+// Close stops the fake API server.
+func (a *APIServer) Close() {
+	a.server.Close()
+}
+
+func workloadKey(kind string, namespace string, name string) string {
+	resource := "deployments"
+	if strings.ToLower(kind) == kubernetes.StatefulSet {
+		resource = "statefulsets"
+	}
+
+	return "/apis/apps/v1/namespaces/" + namespace + "/" + resource + "/" +
+		name
+}
+
+// SetWorkload adds a workload of the given kind with the given number of
+// replicas, all of which are ready, or replaces an existing workload.
+func (a *APIServer) SetWorkload(
+	kind string,
+	namespace string,
+	name string,
+	replicas int32,
+) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.workloads[workloadKey(kind, namespace, name)] = &workload{
+		status: kubernetes.WorkloadStatus{
+			Replicas:          replicas,
+			ReadyReplicas:     replicas,
+			AvailableReplicas: replicas,
+		},
+	}
+}
+
+// Workload gives the current status of the given workload.
+func (a *APIServer) Workload(
+	kind string,
+	namespace string,
+	name string,
+) (kubernetes.WorkloadStatus, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	w, present := a.workloads[workloadKey(kind, namespace, name)]
+	if !present {
+		return kubernetes.WorkloadStatus{}, false
+	}
+
+	return w.status, true
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason string, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(
+		map[string]interface{}{
+			"kind":    "Status",
+			"status":  "Failure",
+			"reason":  reason,
+			"message": msg,
+			"code":    code,
+		},
+	)
+}
+
+func (a *APIServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.Requests = append(a.Requests, req.Method+" "+req.URL.Path)
+
+	if req.Header.Get("Authorization") != "Bearer "+a.Token {
+		writeStatus(w, 401, "Unauthorized", "Unauthorized")
+		return
+	}
+
+	path := strings.TrimSuffix(req.URL.Path, "/scale")
+	wl, present := a.workloads[path]
+	if !present {
+		writeStatus(
+			w,
+			404,
+			"NotFound",
+			fmt.Sprintf("%s not found", req.URL.Path),
+		)
+		return
+	}
+
+	switch {
+	case req.Method == "GET" && path == req.URL.Path:
+		if wl.remaining > 0 {
+			wl.remaining--
+		} else {
+			wl.status.ReadyReplicas = wl.status.Replicas
+			wl.status.AvailableReplicas = wl.status.Replicas
+		}
+	case req.Method == "PATCH" && path != req.URL.Path:
+		if req.Header.Get("Content-Type") !=
+			"application/merge-patch+json" {
+			writeStatus(
+				w,
+				415,
+				"UnsupportedMediaType",
+				"unsupported patch type",
+			)
+			return
+		}
+
+		var patch struct {
+			Spec struct {
+				Replicas *int32
+			}
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		if json.Unmarshal(body, &patch) != nil ||
+			patch.Spec.Replicas == nil || *patch.Spec.Replicas < 0 {
+			writeStatus(w, 422, "Invalid", "invalid scale patch")
+			return
+		}
+
+		wl.status.Replicas = *patch.Spec.Replicas
+		if wl.status.ReadyReplicas > wl.status.Replicas {
+			wl.status.ReadyReplicas = wl.status.Replicas
+			wl.status.AvailableReplicas = wl.status.Replicas
+		}
+		wl.remaining = a.Transitions
+
+		_ = json.NewEncoder(w).Encode(
+			map[string]interface{}{
+				"kind": "Scale",
+				"spec": map[string]int32{
+					"replicas": wl.status.Replicas,
+				},
+				"status": map[string]int32{
+					"replicas": wl.status.ReadyReplicas,
+				},
+			},
+		)
+		return
+	default:
+		writeStatus(w, 405, "MethodNotAllowed", "method not allowed")
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(
+		map[string]interface{}{
+			"spec": map[string]int32{
+				"replicas": wl.status.Replicas,
+			},
+			"status": map[string]int32{
+				"replicas":          wl.status.Replicas,
+				"readyReplicas":     wl.status.ReadyReplicas,
+				"availableReplicas": wl.status.AvailableReplicas,
+			},
+		},
+	)
+}
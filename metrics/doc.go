@@ -0,0 +1,4 @@
+// Package metrics provides counters, gauges, and histograms describing what
+// Pullcord is doing, along with a handler exposing them in the Prometheus text
+// format.
+package metrics
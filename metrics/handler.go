@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// TextContentType is the content type of the Prometheus text format.
+const TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler is a net/http.Handler which exposes the metrics of a Registry in the
+// Prometheus text format. If Registry is nil, the DefaultRegistry is exposed.
+type Handler struct {
+	Registry *Registry
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"metricshandler",
+		func() json.Unmarshaler {
+			return new(Handler)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler. There is currently
+// nothing to configure, so an empty object is expected.
+func (h *Handler) UnmarshalJSON(data []byte) error {
+	var t struct{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	h.Registry = nil
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r := h.Registry
+	if r == nil {
+		r = DefaultRegistry
+	}
+
+	w.Header().Set("Content-Type", TextContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	if req.Method == "HEAD" {
+		return
+	}
+
+	if e := r.WriteText(w); e != nil {
+		_ = log.Error(
+			fmt.Sprintf(
+				"error writing metrics: %s",
+				e.Error(),
+			),
+		)
+	}
+}
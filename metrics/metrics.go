@@ -0,0 +1,471 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/proidiot/gone/errors"
+	"github.com/proidiot/gone/log"
+)
+
+// DuplicateMetricError indicates that a metric with that name has already been
+// registered.
+const DuplicateMetricError = errors.New(
+	"A metric with this name has already been registered",
+)
+
+// DefaultBuckets are the histogram buckets (in seconds) suitable for
+// measuring the latency of requests and probes.
+var DefaultBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// StartupBuckets are the histogram buckets (in seconds) suitable for
+// measuring how long it takes a service to start.
+var StartupBuckets = []float64{
+	1, 5, 10, 30, 60, 120, 300, 600, 1200,
+}
+
+// Metric is a named set of time series which can be exposed in the Prometheus
+// text format. Counter, Gauge, and Histogram are the available Metrics.
+type Metric interface {
+	Name() string
+	writeText(w *bufio.Writer)
+}
+
+// Registry is a set of Metrics which are exposed together. A Registry is safe
+// for concurrent use.
+type Registry struct {
+	metrics map[string]Metric
+	mutex   sync.Mutex
+}
+
+// DefaultRegistry is the Registry into which the metrics of the rest of
+// Pullcord are registered, and which is exposed by a Handler by default.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]Metric),
+	}
+}
+
+// Register adds the given Metric to the Registry.
+func (r *Registry) Register(m Metric) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, present := r.metrics[m.Name()]; present {
+		_ = log.Err(
+			fmt.Sprintf(
+				"metrics cannot register metric: name \"%s\""+
+					" has already been used",
+				m.Name(),
+			),
+		)
+
+		return DuplicateMetricError
+	}
+
+	r.metrics[m.Name()] = m
+	return nil
+}
+
+// MustRegister is a convenience function around Register that panics on
+// error.
+func (r *Registry) MustRegister(ms ...Metric) {
+	for _, m := range ms {
+		if e := r.Register(m); e != nil {
+			panic(e)
+		}
+	}
+}
+
+// MustRegister registers the given Metrics with the DefaultRegistry, and
+// panics on error. It would typically be called from the init function of a
+// package which has been instrumented.
+func MustRegister(ms ...Metric) {
+	DefaultRegistry.MustRegister(ms...)
+}
+
+// WriteText writes all the Metrics of the Registry in the Prometheus text
+// format, in order of name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ms := make([]Metric, len(names))
+	for i, name := range names {
+		ms[i] = r.metrics[name]
+	}
+	r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range ms {
+		m.writeText(bw)
+	}
+
+	return bw.Flush()
+}
+
+// desc is the description common to every kind of Metric.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// Name gives the name of the Metric.
+func (d *desc) Name() string {
+	return d.name
+}
+
+// key gives the key of the time series with the given label values, or false
+// if the wrong number of label values was given.
+func (d *desc) key(labelValues []string) (string, bool) {
+	if len(labelValues) != len(d.labels) {
+		_ = log.Err(
+			fmt.Sprintf(
+				"metrics given %d label values for \"%s\", which"+
+					" has %d labels",
+				len(labelValues),
+				d.name,
+				len(d.labels),
+			),
+		)
+
+		return "", false
+	}
+
+	return strings.Join(labelValues, "\xff"), true
+}
+
+// sortedKeys gives the keys of a set of time series in order.
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, helpEscaper.Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// writeSample writes a single sample for the time series with the given key,
+// with any extra label (such as the "le" label of a histogram bucket) added.
+func (d *desc) writeSample(
+	w *bufio.Writer,
+	suffix string,
+	key string,
+	extra string,
+	extraValue string,
+	value float64,
+) {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(
+				pairs,
+				d.labels[i]+`="`+labelEscaper.Replace(v)+`"`,
+			)
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra+`="`+extraValue+`"`)
+	}
+
+	w.WriteString(d.name + suffix)
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a Metric whose time series only ever increase, such as a count of
+// requests.
+type Counter struct {
+	desc
+	values map[string]float64
+	mutex  sync.Mutex
+}
+
+// NewCounter creates a Counter with the given name, help text, and label
+// names. The Counter must still be registered before it will be exposed.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{
+		desc:   desc{name, help, "counter", labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Add adds the given (non-negative) amount to the time series with the given
+// label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		_ = log.Err(
+			fmt.Sprintf(
+				"metrics cannot decrease counter \"%s\"",
+				c.name,
+			),
+		)
+		return
+	}
+
+	key, ok := c.key(labelValues)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	c.values[key] += v
+	c.mutex.Unlock()
+}
+
+// Inc adds one to the time series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value gives the current value of the time series with the given label
+// values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key, _ := c.key(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.values[key]
+}
+
+func (c *Counter) writeText(w *bufio.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w)
+	if len(c.labels) == 0 {
+		c.writeSample(w, "", "", "", "", c.values[""])
+		return
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		c.writeSample(w, "", key, "", "", c.values[key])
+	}
+}
+
+// Gauge is a Metric whose time series can go up and down, such as the number
+// of sessions in a session table.
+type Gauge struct {
+	desc
+	values map[string]float64
+	mutex  sync.Mutex
+}
+
+// NewGauge creates a Gauge with the given name, help text, and label names.
+// The Gauge must still be registered before it will be exposed.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{
+		desc:   desc{name, help, "gauge", labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Set sets the time series with the given label values to the given value.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key, ok := g.key(labelValues)
+	if !ok {
+		return
+	}
+
+	g.mutex.Lock()
+	g.values[key] = v
+	g.mutex.Unlock()
+}
+
+// Add adds the given amount (which may be negative) to the time series with
+// the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	key, ok := g.key(labelValues)
+	if !ok {
+		return
+	}
+
+	g.mutex.Lock()
+	g.values[key] += v
+	g.mutex.Unlock()
+}
+
+// Value gives the current value of the time series with the given label
+// values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	key, _ := g.key(labelValues)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.values[key]
+}
+
+func (g *Gauge) writeText(w *bufio.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.writeHeader(w)
+	if len(g.labels) == 0 {
+		g.writeSample(w, "", "", "", "", g.values[""])
+		return
+	}
+
+	keys := make([]string, 0, len(g.values))
+	for key := range g.values {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		g.writeSample(w, "", key, "", "", g.values[key])
+	}
+}
+
+// histogramValue is a single time series of a Histogram.
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histogram is a Metric which counts observations (such as the latency of
+// requests) in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+	values  map[string]*histogramValue
+	mutex   sync.Mutex
+}
+
+// NewHistogram creates a Histogram with the given name, help text, bucket
+// upper bounds, and label names. If no buckets are given, DefaultBuckets are
+// used. The Histogram must still be registered before it will be exposed.
+func NewHistogram(
+	name string,
+	help string,
+	buckets []float64,
+	labels ...string,
+) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+
+	return &Histogram{
+		desc:    desc{name, help, "histogram", labels},
+		buckets: sorted,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+// Observe adds the given observation to the time series with the given label
+// values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key, ok := h.key(labelValues)
+	if !ok {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hv, present := h.values[key]
+	if !present {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Count gives the number of observations made for the time series with the
+// given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key, _ := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hv, present := h.values[key]; present {
+		return hv.count
+	}
+
+	return 0
+}
+
+func (h *Histogram) writeText(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	if len(h.labels) == 0 && len(keys) == 0 {
+		h.values[""] = &histogramValue{
+			counts: make([]uint64, len(h.buckets)),
+		}
+		keys = append(keys, "")
+	}
+
+	for _, key := range sortedKeys(keys) {
+		hv := h.values[key]
+		for i, upper := range h.buckets {
+			h.writeSample(
+				w,
+				"_bucket",
+				key,
+				"le",
+				formatFloat(upper),
+				float64(hv.counts[i]),
+			)
+		}
+		h.writeSample(w, "_bucket", key, "le", "+Inf", float64(hv.count))
+		h.writeSample(w, "_sum", key, "", "", hv.sum)
+		h.writeSample(w, "_count", key, "", "", float64(hv.count))
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_total", "A test counter.", "a", "b")
+	c.Inc("x", "y")
+	c.Add(2, "x", "y")
+	c.Inc("z", "q\"\n")
+	c.Add(-1, "x", "y")
+	c.Inc("wrong")
+
+	assert.Equal(t, float64(3), c.Value("x", "y"))
+
+	r := NewRegistry()
+	r.MustRegister(c)
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Equal(
+		t,
+		"# HELP test_total A test counter.\n"+
+			"# TYPE test_total counter\n"+
+			`test_total{a="x",b="y"} 3`+"\n"+
+			`test_total{a="z",b="q\"\n"} 1`+"\n",
+		buf.String(),
+	)
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("test_gauge", "A test gauge.")
+	g.Set(5)
+	g.Add(-2)
+
+	assert.Equal(t, float64(3), g.Value())
+
+	r := NewRegistry()
+	r.MustRegister(g)
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Equal(
+		t,
+		"# HELP test_gauge A test gauge.\n"+
+			"# TYPE test_gauge gauge\n"+
+			"test_gauge 3\n",
+		buf.String(),
+	)
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_seconds", "A test histogram.", []float64{1, 0.5}, "s")
+	h.Observe(0.25, "x")
+	h.Observe(0.75, "x")
+	h.Observe(2, "x")
+
+	assert.Equal(t, uint64(3), h.Count("x"))
+	assert.Equal(t, uint64(0), h.Count("y"))
+
+	r := NewRegistry()
+	r.MustRegister(h)
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Equal(
+		t,
+		"# HELP test_seconds A test histogram.\n"+
+			"# TYPE test_seconds histogram\n"+
+			`test_seconds_bucket{s="x",le="0.5"} 1`+"\n"+
+			`test_seconds_bucket{s="x",le="1"} 2`+"\n"+
+			`test_seconds_bucket{s="x",le="+Inf"} 3`+"\n"+
+			`test_seconds_sum{s="x"} 3`+"\n"+
+			`test_seconds_count{s="x"} 3`+"\n",
+		buf.String(),
+	)
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(NewCounter("dup", "")))
+	assert.Equal(t, DuplicateMetricError, r.Register(NewGauge("dup", "")))
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter("handler_total", "Handled.")
+	c.Inc()
+	r.MustRegister(c)
+
+	h := &Handler{Registry: r}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	response := w.Result()
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, TextContentType, response.Header.Get("Content-Type"))
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "handler_total 1\n")
+}
+
+func TestHandlerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "metricshandler",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data:        "{}",
+				Explanation: "empty object",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -0,0 +1,416 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/proidiot/gone/errors"
+	"github.com/proidiot/gone/log"
+
+	"github.com/stuphlabs/pullcord/authentication"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// MonitorAdmin is a net/http.Handler giving a JSON API with which the services
+// of a MinMonitor can be inspected and managed. Since anyone who can reach it
+// can start and stop services, it would typically be served on a separate
+// listener behind an authentication.LoginHandler.
+//
+// The paths below are relative to Prefix (which defaults to "/"):
+//
+//	GET  services                 lists the ServiceInfo of every service
+//	GET  services/{name}          gives the ServiceInfo of the named service
+//	POST services/{name}/reprobe  probes the service (see Reprobe)
+//	POST services/{name}/statusup marks the service as up (see SetStatusUp)
+//	POST services/{name}/start    starts the service (see Start)
+//	POST services/{name}/stop     stops the service (see Stop)
+//	POST services/{name}/cancel   cancels any pending delayed trigger (such as
+//	                              an idle shutdown, see CancelDelayed)
+//
+// Each of the POST endpoints responds with the ServiceInfo of the service
+// after the action has been taken. Errors are given as a JSON object with an
+// "error" field.
+//
+// Since a browser will send the session cookie of an administrator along with
+// a request made by any other site, each POST request is rejected unless any
+// Origin (or Referer) it has is the host being requested. In addition, when
+// the MonitorAdmin is given requests with a session (such as from a
+// .../authentication.CookiemaskFilter), every response to a GET request gives
+// an XSRF token for the session in the AdminXSRFHeader, and each POST request
+// must give that token back in either the AdminXSRFHeader or the
+// AdminXSRFField form field.
+type MonitorAdmin struct {
+	Monitor *MinMonitor
+	Prefix  string
+}
+
+// InvalidXSRFTokenError indicates that a request to change something through a
+// MonitorAdmin did not give the XSRF token for its session.
+const InvalidXSRFTokenError = errors.New(
+	"The request did not have the required XSRF token",
+)
+
+// AdminXSRFHeader is the header in which a MonitorAdmin gives the XSRF token
+// for a session, and in which the token may be given back.
+const AdminXSRFHeader = "X-XSRF-Token"
+
+// AdminXSRFField is the form field in which the XSRF token for a session may
+// be given to a MonitorAdmin.
+const AdminXSRFField = "xsrftoken"
+
+// adminXSRFTokenLength is the number of random bytes in an XSRF token.
+const adminXSRFTokenLength = 32
+
+func init() {
+	config.MustRegisterResourceType(
+		"monitoradmin",
+		func() json.Unmarshaler {
+			return new(MonitorAdmin)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler. The services to be
+// managed are given by name, and would typically be references to the same
+// minmonitorredservice resources used elsewhere in the configuration.
+func (a *MonitorAdmin) UnmarshalJSON(data []byte) error {
+	var t struct {
+		Prefix   string
+		Services map[string]*config.Resource
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	monitor := NewMinMonitor()
+	for name, rsc := range t.Services {
+		var s *MinMonitorredService
+		if rsc != nil {
+			s, _ = rsc.Unmarshalled.(*MinMonitorredService)
+		}
+		if s == nil {
+			_ = log.Err(
+				fmt.Sprintf(
+					"Registry value is not a"+
+						" MinMonitorredService: %#v",
+					rsc,
+				),
+			)
+			return config.UnexpectedResourceType
+		}
+
+		if e := monitor.Add(name, s); e != nil {
+			return e
+		}
+	}
+
+	a.Monitor = monitor
+	a.Prefix = t.Prefix
+	return nil
+}
+
+// NewMonitorAdmin creates a MonitorAdmin for the given monitor, served at the
+// given prefix.
+func NewMonitorAdmin(monitor *MinMonitor, prefix string) *MonitorAdmin {
+	return &MonitorAdmin{
+		Monitor: monitor,
+		Prefix:  prefix,
+	}
+}
+
+func (a *MonitorAdmin) prefix() string {
+	prefix := a.Prefix
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return prefix
+}
+
+func (a *MonitorAdmin) serveJSON(
+	w http.ResponseWriter,
+	code int,
+	value interface{},
+) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		_ = log.Error(
+			fmt.Sprintf(
+				"monitoradmin error writing response: %s",
+				err.Error(),
+			),
+		)
+	}
+}
+
+func (a *MonitorAdmin) serveError(
+	w http.ResponseWriter,
+	code int,
+	err error,
+) {
+	a.serveJSON(
+		w,
+		code,
+		struct {
+			Error string `json:"error"`
+		}{
+			Error: err.Error(),
+		},
+	)
+}
+
+func (a *MonitorAdmin) serveInfo(w http.ResponseWriter, name string) {
+	info, err := a.Monitor.Info(name)
+	if err != nil {
+		a.serveError(w, 404, err)
+		return
+	}
+
+	a.serveJSON(w, 200, info)
+}
+
+func (a *MonitorAdmin) serveMethodNotAllowed(
+	w http.ResponseWriter,
+	allowed string,
+) {
+	w.Header().Set("Allow", allowed)
+	a.serveError(
+		w,
+		405,
+		fmt.Errorf("method not allowed, use %s", allowed),
+	)
+}
+
+// xsrfKey gives the session key under which the XSRF token is kept, which is
+// specific to the prefix so that separate MonitorAdmins sharing a session do
+// not share a token.
+func (a *MonitorAdmin) xsrfKey() string {
+	return "xsrf-monitoradmin-" + a.prefix()
+}
+
+// xsrfToken gives the XSRF token for the session of the request, creating one
+// if the session does not yet have one. An empty token is given if the request
+// has no session.
+func (a *MonitorAdmin) xsrfToken(req *http.Request) (string, error) {
+	sesh, ok := authentication.SessionFromContext(req.Context())
+	if !ok {
+		return "", nil
+	}
+
+	stored, err := sesh.GetValue(a.xsrfKey())
+	if err == nil {
+		if token, ok := stored.(string); ok && token != "" {
+			return token, nil
+		}
+	} else if err != authentication.NoSuchSessionValueError {
+		return "", err
+	}
+
+	raw := make([]byte, adminXSRFTokenLength)
+	if _, err = rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	if err = sesh.SetValue(a.xsrfKey(), token); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sameOrigin determines if the Origin of the request (or its Referer, if it has
+// no Origin) is the host being requested. A request with neither did not come
+// from a browser, and so is allowed.
+func sameOrigin(req *http.Request) bool {
+	source := req.Header.Get("Origin")
+	if source == "" {
+		source = req.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+// checkXSRF ensures that a POST request was not forged by another site,
+// giving an error describing why it was rejected if it might have been.
+func (a *MonitorAdmin) checkXSRF(req *http.Request) error {
+	if !sameOrigin(req) {
+		return fmt.Errorf(
+			"cross-origin request rejected (origin %q, referer %q)",
+			req.Header.Get("Origin"),
+			req.Header.Get("Referer"),
+		)
+	}
+
+	if _, ok := authentication.SessionFromContext(req.Context()); !ok {
+		return nil
+	}
+
+	expected, err := a.xsrfToken(req)
+	if err != nil {
+		return err
+	}
+
+	received := req.Header.Get(AdminXSRFHeader)
+	if received == "" {
+		received = req.PostFormValue(AdminXSRFField)
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(received)) != 1 {
+		return InvalidXSRFTokenError
+	}
+
+	return nil
+}
+
+// action runs the named action against the named service.
+func (a *MonitorAdmin) action(name, action string) (found bool, err error) {
+	switch action {
+	case "reprobe":
+		_, err = a.Monitor.Reprobe(name)
+	case "statusup":
+		err = a.Monitor.SetStatusUp(name)
+	case "start":
+		err = a.Monitor.Start(name)
+	case "stop":
+		err = a.Monitor.Stop(name)
+	case "cancel":
+		_, err = a.Monitor.CancelDelayed(name)
+	default:
+		return false, nil
+	}
+
+	return true, err
+}
+
+func (a *MonitorAdmin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	_ = log.Debug(
+		fmt.Sprintf(
+			"monitoradmin request received: %s %s",
+			req.Method,
+			req.URL.Path,
+		),
+	)
+
+	if a.Monitor == nil {
+		a.serveError(w, 404, UnknownServiceError)
+		return
+	}
+
+	prefix := a.prefix()
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		a.serveError(w, 404, fmt.Errorf("not found: %s", req.URL.Path))
+		return
+	}
+
+	parts := strings.Split(
+		strings.Trim(strings.TrimPrefix(req.URL.Path, prefix), "/"),
+		"/",
+	)
+	if parts[0] != "services" || len(parts) > 3 {
+		a.serveError(w, 404, fmt.Errorf("not found: %s", req.URL.Path))
+		return
+	}
+
+	if req.Method == "POST" {
+		if err := a.checkXSRF(req); err != nil {
+			_ = log.Warning(
+				fmt.Sprintf(
+					"monitoradmin rejecting request for %s:"+
+						" %v",
+					req.URL.Path,
+					err,
+				),
+			)
+			a.serveError(w, 403, err)
+			return
+		}
+	} else if token, err := a.xsrfToken(req); err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"monitoradmin error getting xsrf token: %v",
+				err,
+			),
+		)
+		a.serveError(w, 500, err)
+		return
+	} else if token != "" {
+		w.Header().Set(AdminXSRFHeader, token)
+	}
+
+	switch len(parts) {
+	case 1:
+		if req.Method != "GET" && req.Method != "HEAD" {
+			a.serveMethodNotAllowed(w, "GET")
+			return
+		}
+
+		names := a.Monitor.Names()
+		infos := make([]ServiceInfo, 0, len(names))
+		for _, name := range names {
+			if info, err := a.Monitor.Info(name); err == nil {
+				infos = append(infos, info)
+			}
+		}
+		a.serveJSON(w, 200, infos)
+	case 2:
+		if req.Method != "GET" && req.Method != "HEAD" {
+			a.serveMethodNotAllowed(w, "GET")
+			return
+		}
+
+		a.serveInfo(w, parts[1])
+	case 3:
+		if req.Method != "POST" {
+			a.serveMethodNotAllowed(w, "POST")
+			return
+		}
+
+		if _, err := a.Monitor.Info(parts[1]); err != nil {
+			a.serveError(w, 404, err)
+			return
+		}
+
+		_ = log.Notice(
+			fmt.Sprintf(
+				"monitoradmin running %s on service: \"%s\"",
+				parts[2],
+				parts[1],
+			),
+		)
+		found, err := a.action(parts[1], parts[2])
+		if !found {
+			a.serveError(
+				w,
+				404,
+				fmt.Errorf("unknown action: %s", parts[2]),
+			)
+			return
+		} else if err != nil {
+			a.serveError(w, 500, err)
+			return
+		}
+
+		a.serveInfo(w, parts[1])
+	}
+}
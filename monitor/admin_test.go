@@ -0,0 +1,361 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/authentication"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/trigger"
+)
+
+func getAdmin(
+	t *testing.T,
+) (*MonitorAdmin, *scriptedProber, *counterTriggerrer, *counterTriggerrer) {
+	svc, p, onDown := getStateService(t, false)
+	onIdle := &counterTriggerrer{}
+	svc.OnIdle = onIdle
+
+	mon := NewMinMonitor()
+	require.NoError(t, mon.Add("svc", svc))
+
+	return NewMonitorAdmin(mon, "/admin"), p, onDown, onIdle
+}
+
+func serveAdminRequest(
+	t *testing.T,
+	a *MonitorAdmin,
+	method string,
+	path string,
+	value interface{},
+) int {
+	recorder := httptest.NewRecorder()
+	a.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	response := recorder.Result()
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	contents, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	if value != nil {
+		require.NoError(t, json.Unmarshal(contents, value))
+	}
+
+	return response.StatusCode
+}
+
+func TestMonitorAdminList(t *testing.T) {
+	a, _, _, _ := getAdmin(t)
+
+	var infos []ServiceInfo
+	code := serveAdminRequest(t, a, "GET", "/admin/services", &infos)
+	assert.Equal(t, 200, code)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "svc", infos[0].Name)
+	assert.Equal(t, StateDown, infos[0].State)
+	assert.Nil(t, infos[0].LastChecked)
+	assert.Empty(t, infos[0].Triggers)
+
+	var info ServiceInfo
+	code = serveAdminRequest(t, a, "GET", "/admin/services/svc", &info)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "svc", info.Name)
+
+	code = serveAdminRequest(t, a, "GET", "/admin/services/nope", nil)
+	assert.Equal(t, 404, code)
+
+	code = serveAdminRequest(t, a, "GET", "/elsewhere/services", nil)
+	assert.Equal(t, 404, code)
+
+	code = serveAdminRequest(t, a, "POST", "/admin/services", nil)
+	assert.Equal(t, 405, code)
+}
+
+func TestMonitorAdminActions(t *testing.T) {
+	a, p, onDown, onIdle := getAdmin(t)
+
+	var info ServiceInfo
+	code := serveAdminRequest(
+		t,
+		a,
+		"POST",
+		"/admin/services/svc/reprobe",
+		&info,
+	)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 1, p.probes())
+	assert.NotNil(t, info.LastChecked)
+
+	code = serveAdminRequest(t, a, "POST", "/admin/services/svc/start", &info)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 1, onDown.count)
+	assert.Equal(t, StateStarting, info.State)
+	require.Len(t, info.Triggers, 1)
+	assert.Equal(t, "ondown", info.Triggers[0].Trigger)
+
+	code = serveAdminRequest(
+		t,
+		a,
+		"POST",
+		"/admin/services/svc/statusup",
+		&info,
+	)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, StateUp, info.State)
+
+	code = serveAdminRequest(t, a, "POST", "/admin/services/svc/stop", &info)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 1, onIdle.count)
+	assert.Equal(t, StateStopping, info.State)
+	require.Len(t, info.Triggers, 2)
+	assert.Equal(t, "onidle", info.Triggers[1].Trigger)
+
+	code = serveAdminRequest(t, a, "GET", "/admin/services/svc/stop", nil)
+	assert.Equal(t, 405, code)
+
+	code = serveAdminRequest(t, a, "POST", "/admin/services/svc/nope", nil)
+	assert.Equal(t, 404, code)
+
+	code = serveAdminRequest(t, a, "POST", "/admin/services/nope/stop", nil)
+	assert.Equal(t, 404, code)
+}
+
+func TestMonitorAdminCrossOrigin(t *testing.T) {
+	a, _, onDown, _ := getAdmin(t)
+
+	for _, header := range []string{"Origin", "Referer"} {
+		req := httptest.NewRequest(
+			"POST",
+			"http://pullcord.example.com/admin/services/svc/start",
+			nil,
+		)
+		req.Header.Set(header, "http://evil.example.com/page")
+		recorder := httptest.NewRecorder()
+		a.ServeHTTP(recorder, req)
+		assert.Equal(t, 403, recorder.Result().StatusCode, header)
+		assert.Equal(t, 0, onDown.count)
+	}
+
+	req := httptest.NewRequest(
+		"POST",
+		"http://pullcord.example.com/admin/services/svc/start",
+		nil,
+	)
+	req.Header.Set("Origin", "http://pullcord.example.com")
+	recorder := httptest.NewRecorder()
+	a.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Result().StatusCode)
+	assert.Equal(t, 1, onDown.count)
+}
+
+func TestMonitorAdminXSRFToken(t *testing.T) {
+	a, _, onDown, _ := getAdmin(t)
+	sesh, err := authentication.NewMinSessionHandler(
+		"test",
+		"/",
+		"",
+	).GetSession()
+	require.NoError(t, err)
+
+	serve := func(req *http.Request) *http.Response {
+		recorder := httptest.NewRecorder()
+		a.ServeHTTP(
+			recorder,
+			req.WithContext(
+				authentication.NewSessionContext(
+					req.Context(),
+					sesh,
+				),
+			),
+		)
+		return recorder.Result()
+	}
+
+	// A POST without the token is rejected.
+	response := serve(
+		httptest.NewRequest("POST", "/admin/services/svc/start", nil),
+	)
+	assert.Equal(t, 403, response.StatusCode)
+	assert.Equal(t, 0, onDown.count)
+
+	response = serve(httptest.NewRequest("GET", "/admin/services", nil))
+	assert.Equal(t, 200, response.StatusCode)
+	token := response.Header.Get(AdminXSRFHeader)
+	require.NotEqual(t, "", token)
+
+	req := httptest.NewRequest("POST", "/admin/services/svc/start", nil)
+	req.Header.Set(AdminXSRFHeader, "not"+token)
+	assert.Equal(t, 403, serve(req).StatusCode)
+	assert.Equal(t, 0, onDown.count)
+
+	req = httptest.NewRequest("POST", "/admin/services/svc/start", nil)
+	req.Header.Set(AdminXSRFHeader, token)
+	assert.Equal(t, 200, serve(req).StatusCode)
+	assert.Equal(t, 1, onDown.count)
+
+	req = httptest.NewRequest(
+		"POST",
+		"/admin/services/svc/reprobe",
+		strings.NewReader(AdminXSRFField+"="+token),
+	)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, 200, serve(req).StatusCode)
+
+	// The token stays the same for the session.
+	response = serve(httptest.NewRequest("GET", "/admin/services", nil))
+	assert.Equal(t, token, response.Header.Get(AdminXSRFHeader))
+}
+
+func TestMonitorAdminTriggerError(t *testing.T) {
+	a, _, onDown, _ := getAdmin(t)
+	onDown.count = -1
+
+	var e struct {
+		Error string
+	}
+	code := serveAdminRequest(t, a, "POST", "/admin/services/svc/start", &e)
+	assert.Equal(t, 500, code)
+	assert.NotEqual(t, "", e.Error)
+
+	var info ServiceInfo
+	code = serveAdminRequest(t, a, "GET", "/admin/services/svc", &info)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, StateDown, info.State)
+	assert.Equal(t, e.Error, info.LastError)
+	require.Len(t, info.Triggers, 1)
+	assert.Equal(t, e.Error, info.Triggers[0].Error)
+}
+
+func TestMonitorAdminCancel(t *testing.T) {
+	a, _, onDown, _ := getAdmin(t)
+	s, _ := a.Monitor.lookup("svc")
+	delayed := trigger.NewDelayTrigger(onDown, time.Hour)
+	s.Always = delayed
+
+	var info ServiceInfo
+	code := serveAdminRequest(t, a, "GET", "/admin/services/svc", &info)
+	assert.Equal(t, 200, code)
+	require.Contains(t, info.DelayedTriggers, "always")
+	assert.Nil(t, info.DelayedTriggers["always"].Scheduled)
+
+	_, err := delayed.Trigger(context.Background(), trigger.Event{})
+	require.NoError(t, err)
+	code = serveAdminRequest(t, a, "GET", "/admin/services/svc", &info)
+	assert.Equal(t, 200, code)
+	assert.NotNil(t, info.DelayedTriggers["always"].Scheduled)
+
+	code = serveAdminRequest(t, a, "POST", "/admin/services/svc/cancel", &info)
+	assert.Equal(t, 200, code)
+	assert.Nil(t, info.DelayedTriggers["always"].Scheduled)
+	assert.False(t, s.CancelDelayed())
+
+	_, err = a.Monitor.CancelDelayed("nope")
+	assert.Equal(t, UnknownServiceError, err)
+}
+
+func TestMinMonitorStopNoTrigger(t *testing.T) {
+	svc, _, _ := getStateService(t, true)
+	mon := NewMinMonitor()
+	require.NoError(t, mon.Add("svc", svc))
+
+	assert.Equal(t, NoTriggerError, mon.Stop("svc"))
+	assert.Equal(t, UnknownServiceError, mon.Stop("nope"))
+	assert.Equal(t, UnknownServiceError, mon.Start("nope"))
+}
+
+func TestTriggerHistoryLength(t *testing.T) {
+	svc, _, onDown := getStateService(t, false)
+	for i := 0; i < TriggerHistoryLength+5; i++ {
+		assert.NoError(t, svc.runTrigger("ondown", onDown, nil))
+	}
+
+	assert.Len(t, svc.Info().Triggers, TriggerHistoryLength)
+}
+
+// eventTriggerrer is a Triggerrer which remembers the last event it was
+// given.
+type eventTriggerrer struct {
+	event trigger.Event
+}
+
+func (e *eventTriggerrer) Trigger(
+	ctx context.Context,
+	ev trigger.Event,
+) (string, error) {
+	e.event = ev
+	return "started " + ev.Service, nil
+}
+
+func TestTriggerHistoryOutput(t *testing.T) {
+	svc, _, _ := getStateService(t, false)
+	svc.Name = "wiki"
+	onDown := &eventTriggerrer{}
+	svc.OnDown = onDown
+
+	code, _ := serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+
+	assert.Equal(t, "wiki", onDown.event.Service)
+	assert.Equal(t, "ondown", onDown.event.Trigger)
+	assert.Equal(t, "GET", onDown.event.Request.Method)
+	assert.Equal(t, "/", onDown.event.Request.Path)
+
+	triggers := svc.Info().Triggers
+	require.Len(t, triggers, 1)
+	assert.Equal(t, "started wiki", triggers[0].Output)
+}
+
+func TestMonitorAdminFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "monitoradmin",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"services": {
+						"svc": {
+							"type": "compoundtrigger",
+							"data": {}
+						}
+					}
+				}`,
+				Explanation: "non-service as service",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data:        "{}",
+				Explanation: "no services",
+			},
+			{
+				Data: `{
+					"prefix": "/admin",
+					"services": {
+						"svc": {
+							"type": "minmonitorredservice",
+							"data": {
+								"url": "http://127.0.0.1:8080/",
+								"graceperiod": "1s"
+							}
+						}
+					}
+				}`,
+				Explanation: "single service",
+			},
+		},
+	}
+	test.Run(t)
+}
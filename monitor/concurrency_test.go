@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingProber is a probe.Prober which holds each probe until it is released,
+// counting how many probes were started.
+type blockingProber struct {
+	mutex   sync.Mutex
+	count   int
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingProber() *blockingProber {
+	return &blockingProber{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (p *blockingProber) Probe(*url.URL) (bool, error) {
+	p.mutex.Lock()
+	p.count++
+	p.mutex.Unlock()
+
+	select {
+	case p.started <- struct{}{}:
+	default:
+	}
+	<-p.release
+
+	return true, nil
+}
+
+func (p *blockingProber) probes() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.count
+}
+
+// TestConcurrentStatusSingleProbe verifies that a burst of concurrent status
+// requests for a service results in a single probe.
+func TestConcurrentStatusSingleProbe(t *testing.T) {
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	svc, err := NewMinMonitorredService(u, time.Minute, nil, nil, nil)
+	require.NoError(t, err)
+	p := newBlockingProber()
+	svc.Prober = p
+
+	var wg sync.WaitGroup
+	var arrived sync.WaitGroup
+	results := make(chan bool, 500)
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		arrived.Add(1)
+		go func() {
+			defer wg.Done()
+			arrived.Done()
+			up, err := svc.Status()
+			assert.NoError(t, err)
+			results <- up
+		}()
+	}
+
+	// The probe is only released once every goroutine is about to ask for
+	// the status. Any which have not yet joined the probe by then will be
+	// given the result of the probe within the grace period instead, so
+	// either way there must only be one probe.
+	<-p.started
+	arrived.Wait()
+	close(p.release)
+	wg.Wait()
+	close(results)
+
+	for up := range results {
+		assert.True(t, up)
+	}
+	assert.Equal(t, 1, p.probes())
+}
+
+// TestConcurrentServeHTTP verifies that concurrent requests can be handled by a
+// service (including the lazy creation of its passthru) while the service is
+// being probed in the background and queried through its monitor.
+func TestConcurrentServeHTTP(t *testing.T) {
+	u, s, err := getUpService(t)
+	require.NoError(t, err)
+	defer recycleUpService(s)
+
+	svc, err := NewMinMonitorredService(u, time.Minute, nil, nil, nil)
+	require.NoError(t, err)
+	p := &scriptedProber{}
+	p.set(true)
+	svc.Prober = p
+	svc.ProbeInterval = time.Millisecond
+
+	monitor := NewMinMonitor()
+	require.NoError(t, monitor.StartBackground())
+	defer func() {
+		assert.NoError(t, monitor.StopBackground())
+	}()
+	require.NoError(t, monitor.Add("test", svc))
+	waitForProbes(p, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			svc.ServeHTTP(
+				recorder,
+				httptest.NewRequest("GET", "/", nil),
+			)
+			assert.Equal(t, 200, recorder.Result().StatusCode)
+		}()
+		go func() {
+			defer wg.Done()
+			up, err := monitor.Status("test")
+			assert.NoError(t, err)
+			assert.True(t, up)
+			_, err = monitor.State("test")
+			assert.NoError(t, err)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			other, err := NewMinMonitorredService(
+				u,
+				time.Minute,
+				nil,
+				nil,
+				nil,
+			)
+			assert.NoError(t, err)
+			assert.NoError(
+				t,
+				monitor.Add(fmt.Sprintf("other%d", i), other),
+			)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,304 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/proidiot/gone/errors"
+	"github.com/proidiot/gone/log"
+
+	"github.com/stuphlabs/pullcord/trigger"
+)
+
+// DependencyCycleError indicates that a service depends on itself, either
+// directly or through its dependencies.
+const DependencyCycleError = errors.New(
+	"The service has a cyclic dependency on itself",
+)
+
+// checkDependencies ensures that neither the service nor any of its
+// dependencies depends on itself, and then records each service (the service
+// itself included) as a dependent of each of its dependencies (see
+// addDependent), so that a dependency is not stopped while something which
+// depends on it is up, even if pullcord did not start it.
+func (s *MinMonitorredService) checkDependencies() error {
+	// A service is mapped to true while its dependencies are being
+	// checked, and to false once they have been.
+	checking := make(map[*MinMonitorredService]bool)
+
+	var check func(*MinMonitorredService) error
+	check = func(svc *MinMonitorredService) error {
+		if inProgress, seen := checking[svc]; seen {
+			if inProgress {
+				_ = log.Err(
+					fmt.Sprintf(
+						"minmonitor found that \"%s\""+
+							" depends on itself",
+						svc.displayName(),
+					),
+				)
+				return DependencyCycleError
+			}
+			return nil
+		}
+
+		checking[svc] = true
+		for _, d := range svc.DependsOn {
+			if err := check(d); err != nil {
+				return err
+			}
+		}
+		checking[svc] = false
+
+		return nil
+	}
+
+	if err := check(s); err != nil {
+		return err
+	}
+
+	for svc := range checking {
+		for _, d := range svc.DependsOn {
+			d.addDependent(svc)
+		}
+	}
+
+	return nil
+}
+
+// addDependent records that the given service depends on this one, so that
+// this service is not stopped while the other service is up.
+func (s *MinMonitorredService) addDependent(d *MinMonitorredService) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, existing := range s.dependents {
+		if existing == d {
+			return
+		}
+	}
+	s.dependents = append(s.dependents, d)
+}
+
+// dependentsUp determines if any of the services which depend on this one are
+// up (or are starting or stopping). Whether a dependent is up is checked with
+// Status, since it may have come up (or gone down) without pullcord starting
+// (or stopping) it.
+func (s *MinMonitorredService) dependentsUp() bool {
+	s.mutex.Lock()
+	dependents := make([]*MinMonitorredService, len(s.dependents))
+	copy(dependents, s.dependents)
+	s.mutex.Unlock()
+
+	for _, d := range dependents {
+		switch d.State() {
+		case StateStarting, StateStopping:
+			return true
+		}
+
+		if up, err := d.Status(); err == nil && up {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startWithDependencies starts the dependencies of a service which has just
+// been moved to starting (due to the given request, if any), and once they
+// are all up, runs the OnDown trigger of the service. This is all done in the
+// background, and is cancelled once the service has been stopped (see
+// StopBackground). If a dependency cannot be started, the service is moved
+// back to down so that the next attempt to start the service will try again.
+func (s *MinMonitorredService) startWithDependencies(req *http.Request) {
+	lifetime := s.lifetimeContext()
+	ctx := lifetime
+	if req != nil {
+		ctx = trigger.Detach(trigger.WithLifetime(req.Context(), lifetime))
+		req = req.WithContext(ctx)
+	}
+
+	go func() {
+		if err := s.startDependencies(ctx); err != nil {
+			s.recordError(err)
+			_ = log.Err(
+				fmt.Sprintf(
+					"minmonitor was unable to start the"+
+						" dependencies of \"%s\": %v",
+					s.URL.String(),
+					err,
+				),
+			)
+
+			s.mutex.Lock()
+			if s.state == StateStarting {
+				s.setState(StateDown)
+			}
+			s.mutex.Unlock()
+			return
+		}
+
+		s.mutex.Lock()
+		starting := s.state == StateStarting
+		s.mutex.Unlock()
+		if !starting {
+			// The service has since failed to start or been
+			// stopped.
+			return
+		}
+
+		_ = s.runOnDownTrigger(req)
+	}()
+}
+
+// startDependencies starts each of the dependencies of the service (each of
+// which will first start its own dependencies), and waits for them all to
+// come up.
+func (s *MinMonitorredService) startDependencies(ctx context.Context) error {
+	for _, d := range s.DependsOn {
+		// A service which was never added to a MinMonitor (or
+		// configured) has not yet been recorded as a dependent.
+		d.addDependent(s)
+
+		_ = log.Debug(
+			fmt.Sprintf(
+				"minmonitor making sure that \"%s\" is started"+
+					" as a dependency of \"%s\"",
+				d.URL.String(),
+				s.URL.String(),
+			),
+		)
+		if err := d.Start(); err != nil {
+			return fmt.Errorf(
+				"unable to start \"%s\": %v",
+				d.displayName(),
+				err,
+			)
+		}
+	}
+
+	for _, d := range s.DependsOn {
+		if err := d.awaitUp(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// awaitUp waits for the service to come up (starting it again if it has gone
+// down in the meantime) for as long as the given context allows, checking the
+// status of the service every WaitPollInterval (or every
+// DefaultWaitPollInterval if no interval was given). An error is given if the
+// service fails to start.
+func (s *MinMonitorredService) awaitUp(ctx context.Context) error {
+	interval := s.WaitPollInterval
+	if interval <= 0 {
+		interval = DefaultWaitPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		switch s.State() {
+		case StateFailed:
+			return fmt.Errorf("\"%s\" failed to start", s.displayName())
+		case StateDown:
+			if err := s.Start(); err != nil {
+				return fmt.Errorf(
+					"unable to start \"%s\": %v",
+					s.displayName(),
+					err,
+				)
+			}
+		}
+
+		if up, err := s.Status(); err == nil && up {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf(
+				"gave up waiting for \"%s\": %v",
+				s.displayName(),
+				ctx.Err(),
+			)
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseDependencies waits for a service which is stopping to finish
+// stopping, and then stops each of its dependencies which is no longer needed
+// (see stopIfUnneeded). Nothing is stopped if the service is started again in
+// the meantime.
+func (s *MinMonitorredService) releaseDependencies() {
+	ctx := s.lifetimeContext()
+
+	interval := s.WaitPollInterval
+	if interval <= 0 {
+		interval = DefaultWaitPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = s.Status()
+		switch s.State() {
+		case StateStopping:
+		case StateDown:
+			for i := len(s.DependsOn) - 1; i >= 0; i-- {
+				s.DependsOn[i].stopIfUnneeded()
+			}
+			return
+		default:
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopIfUnneeded stops the service once nothing which depends on it is up,
+// provided that it would otherwise be allowed to become idle: it must have an
+// OnIdle trigger and an IdleTimeout, must not have had any requests of its own
+// within that IdleTimeout, and must not be in any of its KeepWarm windows.
+func (s *MinMonitorredService) stopIfUnneeded() {
+	if s.OnIdle == nil || s.IdleTimeout <= 0 || s.dependentsUp() {
+		return
+	}
+
+	now := time.Now()
+	s.mutex.Lock()
+	busy := s.inFlight > 0 || now.Sub(s.lastActive) < s.IdleTimeout
+	s.mutex.Unlock()
+	if warm, _ := s.keepWarm(now); busy || warm {
+		return
+	}
+
+	_ = log.Notice(
+		fmt.Sprintf(
+			"minmonitor is stopping \"%s\" as nothing which depends"+
+				" on it is still up",
+			s.URL.String(),
+		),
+	)
+	if err := s.Stop(); err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"minmonitor was unable to stop \"%s\": %v",
+				s.URL.String(),
+				err,
+			),
+		)
+	}
+}
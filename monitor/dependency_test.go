@@ -0,0 +1,270 @@
+package monitor
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// dependencyLog records the order in which the triggers of several services
+// are run.
+type dependencyLog struct {
+	mutex   sync.Mutex
+	entries []string
+}
+
+func (l *dependencyLog) add(entry string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = append(l.entries, entry)
+}
+
+func (l *dependencyLog) get() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]string(nil), l.entries...)
+}
+
+// getDependencyService gives a service whose OnDown and OnIdle triggers bring
+// it up and down (as far as its prober is concerned), recording each run in
+// the given log.
+func getDependencyService(
+	t *testing.T,
+	name string,
+	l *dependencyLog,
+	dependsOn ...*MinMonitorredService,
+) *MinMonitorredService {
+	svc, p, _ := getStateService(t, false)
+	svc.Name = name
+	svc.WaitPollInterval = 5 * time.Millisecond
+	svc.IdleTimeout = time.Millisecond
+	svc.DependsOn = dependsOn
+	svc.OnDown = funcTriggerrer(
+		func() error {
+			l.add(name + " started")
+			p.set(true)
+			return nil
+		},
+	)
+	svc.OnIdle = funcTriggerrer(
+		func() error {
+			l.add(name + " stopped")
+			p.set(false)
+			return nil
+		},
+	)
+
+	return svc
+}
+
+func waitForLog(l *dependencyLog, n int) []string {
+	for i := 0; i < 200 && len(l.get()) < n; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return l.get()
+}
+
+// TestDependencyStart verifies that starting a service starts its
+// dependencies in order, waiting for each of them to come up first.
+func TestDependencyStart(t *testing.T) {
+	l := &dependencyLog{}
+	storage := getDependencyService(t, "storage", l)
+	db := getDependencyService(t, "db", l, storage)
+	cache := getDependencyService(t, "cache", l)
+	app := getDependencyService(t, "app", l, cache, db)
+
+	require.NoError(t, app.Start())
+	assert.Equal(
+		t,
+		[]string{
+			"cache started",
+			"storage started",
+			"db started",
+			"app started",
+		},
+		waitForLog(l, 4),
+	)
+	assert.Equal(t, StateStarting, app.State())
+	assert.Equal(t, StateUp, db.State())
+	assert.Equal(t, []string{"cache", "db"}, app.Info().DependsOn)
+
+	// Nothing is started again for a service which is already up.
+	up, err := app.Status()
+	require.NoError(t, err)
+	assert.True(t, up)
+	require.NoError(t, app.Start())
+	assert.Equal(t, 4, len(l.get()))
+}
+
+// TestDependencyStartError verifies that a service whose dependency cannot be
+// started is not started either, and is left down to be started again.
+func TestDependencyStartError(t *testing.T) {
+	l := &dependencyLog{}
+	db := getDependencyService(t, "db", l)
+	db.OnDown = funcTriggerrer(
+		func() error {
+			return errors.New("the database would not start")
+		},
+	)
+	app := getDependencyService(t, "app", l, db)
+
+	require.NoError(t, app.Start())
+	for i := 0; i < 200 && app.Info().LastError == ""; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Contains(t, app.Info().LastError, "the database would not start")
+	assert.Equal(t, StateDown, app.State())
+	assert.Equal(t, 0, len(l.get()))
+}
+
+// TestDependencyShutdown verifies that a dependency is only stopped once
+// every service which depends on it has stopped.
+func TestDependencyShutdown(t *testing.T) {
+	l := &dependencyLog{}
+	db := getDependencyService(t, "db", l)
+	wiki := getDependencyService(t, "wiki", l, db)
+	blog := getDependencyService(t, "blog", l, db)
+	// The services depending on the database are only stopped explicitly.
+	wiki.IdleTimeout = time.Hour
+	blog.IdleTimeout = time.Hour
+
+	require.NoError(t, wiki.Start())
+	require.NoError(t, blog.Start())
+	waitForLog(l, 3)
+	for _, svc := range []*MinMonitorredService{wiki, blog} {
+		up, err := svc.Status()
+		require.NoError(t, err)
+		require.True(t, up)
+	}
+
+	// The database may not become idle while anything depending on it
+	// is up.
+	time.Sleep(2 * db.IdleTimeout)
+	db.idle()
+	assert.Equal(t, StateUp, db.State())
+
+	require.NoError(t, wiki.Stop())
+	waitForState(wiki, StateDown)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, StateUp, db.State())
+
+	require.NoError(t, blog.Stop())
+	assert.Equal(
+		t,
+		[]string{"wiki stopped", "blog stopped", "db stopped"},
+		waitForLog(l, 6)[3:],
+	)
+}
+
+// TestDependencyAlreadyUp verifies that a dependency does not become idle while
+// a service which depends on it is up, even if that service came up without
+// pullcord starting it.
+func TestDependencyAlreadyUp(t *testing.T) {
+	l := &dependencyLog{}
+	db := getDependencyService(t, "db", l)
+	wiki := getDependencyService(t, "wiki", l, db)
+	blog := getDependencyService(t, "blog", l, db)
+	wiki.IdleTimeout = time.Hour
+	blog.IdleTimeout = time.Hour
+
+	m := NewMinMonitor()
+	require.NoError(t, m.Add("db", db))
+	require.NoError(t, m.Add("wiki", wiki))
+	require.NoError(t, m.Add("blog", blog))
+
+	// The wiki is up as far as its prober is concerned, but has not yet
+	// been probed, while the blog has also been explicitly set as up.
+	wiki.Prober.(*scriptedProber).set(true)
+	blog.Prober.(*scriptedProber).set(true)
+	require.NoError(t, m.SetStatusUp("blog"))
+
+	// The database coming up arms its idle timer.
+	db.Prober.(*scriptedProber).set(true)
+	up, err := db.Status()
+	require.NoError(t, err)
+	require.True(t, up)
+
+	time.Sleep(2 * db.IdleTimeout)
+	db.idle()
+	assert.Equal(t, StateUp, db.State())
+	assert.Equal(t, StateUp, wiki.State())
+
+	// Once nothing which depends on it is up, the database is stopped.
+	wiki.Prober.(*scriptedProber).set(false)
+	require.NoError(t, blog.Stop())
+	assert.Equal(
+		t,
+		[]string{"blog stopped", "db stopped"},
+		waitForLog(l, 2),
+	)
+}
+
+func TestDependencyCycle(t *testing.T) {
+	l := &dependencyLog{}
+	a := getDependencyService(t, "a", l)
+	b := getDependencyService(t, "b", l, a)
+	c := getDependencyService(t, "c", l, b, a)
+	assert.NoError(t, c.checkDependencies())
+
+	a.DependsOn = []*MinMonitorredService{c}
+	assert.Equal(t, DependencyCycleError, a.checkDependencies())
+	assert.Equal(t, DependencyCycleError, b.checkDependencies())
+	assert.Equal(t, DependencyCycleError, NewMinMonitor().Add("b", b))
+
+	a.DependsOn = []*MinMonitorredService{a}
+	assert.Equal(t, DependencyCycleError, a.checkDependencies())
+}
+
+func TestDependencyCycleFromConfig(t *testing.T) {
+	parser := config.Parser{
+		Reader: strings.NewReader(`{
+			"resources": {
+				"db": {
+					"type": "minmonitorredservice",
+					"data": {
+						"url": "http://127.0.0.1:5432/",
+						"graceperiod": "1s",
+						"dependson": [
+							{"type": "ref", "data": "app"}
+						]
+					}
+				},
+				"app": {
+					"type": "minmonitorredservice",
+					"data": {
+						"url": "http://127.0.0.1:8080/",
+						"graceperiod": "1s",
+						"dependson": [
+							{"type": "ref", "data": "db"}
+						]
+					}
+				}
+			},
+			"server": {
+				"type": "httpserver",
+				"data": {
+					"handler": {"type": "ref", "data": "app"},
+					"listener": {
+						"type": "basiclistener",
+						"data": {"proto": "tcp", "laddr": ":0"}
+					}
+				}
+			}
+		}`),
+	}
+
+	_, err := parser.Server()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cyclic dependency")
+}
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/proidiot/gone/log"
+)
+
+// beginRequest records that a request is being forwarded to the service, which
+// keeps the service from being considered idle until the corresponding call to
+// endRequest.
+func (s *MinMonitorredService) beginRequest() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.inFlight++
+	s.lastActive = time.Now()
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+}
+
+// endRequest records that a request has finished being forwarded to the
+// service, and starts the idle timer if no other requests are in flight.
+func (s *MinMonitorredService) endRequest() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.inFlight--
+	s.lastActive = time.Now()
+	if s.inFlight > 0 {
+		return
+	}
+
+	s.armIdleTimer(s.IdleTimeout)
+}
+
+// armIdleTimer (re)starts the idle timer so that the service will be checked
+// for idleness after the given duration, unless the service cannot become
+// idle. The mutex must be held.
+func (s *MinMonitorredService) armIdleTimer(d time.Duration) {
+	if s.IdleTimeout <= 0 || s.OnIdle == nil {
+		return
+	}
+
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	s.idleTimer = time.AfterFunc(d, s.idle)
+}
+
+// idle runs the OnIdle trigger if the service has had no requests in flight
+// for at least IdleTimeout (and is not in any of its KeepWarm windows, and
+// nothing which depends on it is up), with the service stopping from then on.
+func (s *MinMonitorredService) idle() {
+	if s.dependentsUp() {
+		// The service will be stopped once nothing which depends on
+		// it is up (see releaseDependencies), though something which
+		// depends on it may also go down without pullcord stopping
+		// it, so the service is checked again later.
+		s.mutex.Lock()
+		if s.state == StateUp {
+			s.armIdleTimer(s.IdleTimeout)
+		}
+		s.mutex.Unlock()
+		return
+	}
+
+	s.mutex.Lock()
+	if s.inFlight > 0 || time.Since(s.lastActive) < s.IdleTimeout {
+		// A request arrived after the timer fired, so the service is
+		// no longer idle.
+		s.mutex.Unlock()
+		return
+	}
+	if warm, end := s.keepWarm(time.Now()); warm {
+		// The service may only become idle once the window has ended.
+		s.armIdleTimer(time.Until(end))
+		s.mutex.Unlock()
+		return
+	}
+	s.idleTimer = nil
+	if s.state != StateUp {
+		s.mutex.Unlock()
+		return
+	}
+	s.setState(StateStopping)
+	s.mutex.Unlock()
+
+	_ = log.Notice(
+		fmt.Sprintf(
+			"minmonitor has seen no requests for \"%s\" in %s,"+
+				" running the onIdle trigger",
+			s.URL.String(),
+			s.IdleTimeout.String(),
+		),
+	)
+
+	_ = s.runOnIdle(StateUp)
+}
+
+// runOnIdle runs the OnIdle trigger for a service which has just been moved to
+// stopping from the given state, moving it back to that state if the trigger
+// fails.
+func (s *MinMonitorredService) runOnIdle(previous ServiceState) error {
+	if err := s.runTrigger("onidle", s.OnIdle, nil); err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"minmonitor received an error while running"+
+					" the onIdle trigger for \"%s\": %v",
+				s.URL.String(),
+				err,
+			),
+		)
+
+		s.mutex.Lock()
+		if s.state == StateStopping {
+			s.setState(previous)
+		}
+		s.mutex.Unlock()
+		return err
+	}
+
+	s.mutex.Lock()
+	s.successes = 0
+	s.failures = 0
+	s.mutex.Unlock()
+
+	if len(s.DependsOn) > 0 {
+		go s.releaseDependencies()
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package monitor
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getIdleService(
+	t *testing.T,
+	u *url.URL,
+	onIdle func() error,
+) *MinMonitorredService {
+	svc, err := NewMinMonitorredService(
+		u,
+		time.Minute,
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	p := &scriptedProber{}
+	p.set(true)
+	svc.Prober = p
+	svc.IdleTimeout = 50 * time.Millisecond
+	svc.OnIdle = funcTriggerrer(onIdle)
+
+	return svc
+}
+
+func waitForState(s *MinMonitorredService, state ServiceState) {
+	for i := 0; i < 200 && s.State() != state; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestIdleShutdown verifies that the onIdle trigger is run once a service has
+// not been sent any requests for the idle timeout, and that the service is
+// then considered to be stopping.
+func TestIdleShutdown(t *testing.T) {
+	u, s, err := getUpService(t)
+	require.NoError(t, err)
+	defer recycleUpService(s)
+
+	idled := make(chan struct{}, 1)
+	svc := getIdleService(
+		t,
+		u,
+		func() error {
+			idled <- struct{}{}
+			return nil
+		},
+	)
+
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 200, recorder.Result().StatusCode)
+	assert.Equal(t, StateUp, svc.State())
+
+	select {
+	case <-idled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the onIdle trigger was never run")
+	}
+
+	assert.Equal(t, StateStopping, svc.State())
+}
+
+// TestIdleWithoutRequests verifies that a service which is started without any
+// request being forwarded to it (such as from the admin API) still has its
+// onIdle trigger run once it has been up for the idle timeout.
+func TestIdleWithoutRequests(t *testing.T) {
+	u, s, err := getUpService(t)
+	require.NoError(t, err)
+	defer recycleUpService(s)
+
+	idled := make(chan struct{}, 1)
+	svc := getIdleService(
+		t,
+		u,
+		func() error {
+			idled <- struct{}{}
+			return nil
+		},
+	)
+	p := svc.Prober.(*scriptedProber)
+	p.set(false)
+	svc.OnDown = funcTriggerrer(
+		func() error {
+			p.set(true)
+			return nil
+		},
+	)
+
+	require.NoError(t, svc.Start())
+	up, err := svc.Status()
+	require.NoError(t, err)
+	require.True(t, up)
+
+	select {
+	case <-idled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the onIdle trigger was never run")
+	}
+
+	assert.Equal(t, StateStopping, svc.State())
+}
+
+// TestIdleInFlight verifies that a request which is still being forwarded to
+// the service keeps the service from being considered idle.
+func TestIdleInFlight(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+				w.(http.Flusher).Flush()
+				<-release
+			},
+		),
+	)
+	defer backend.Close()
+	u, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	idled := make(chan struct{}, 1)
+	svc := getIdleService(
+		t,
+		u,
+		func() error {
+			idled <- struct{}{}
+			return nil
+		},
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.ServeHTTP(
+			httptest.NewRecorder(),
+			httptest.NewRequest("GET", "/download", nil),
+		)
+	}()
+
+	select {
+	case <-idled:
+		t.Fatal("the onIdle trigger was run during a request")
+	case <-time.After(4 * svc.IdleTimeout):
+	}
+
+	close(release)
+	<-done
+
+	select {
+	case <-idled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the onIdle trigger was never run")
+	}
+}
+
+// TestIdleTriggerError verifies that a service is still considered to be up if
+// the onIdle trigger fails.
+func TestIdleTriggerError(t *testing.T) {
+	u, s, err := getUpService(t)
+	require.NoError(t, err)
+	defer recycleUpService(s)
+
+	idled := make(chan struct{}, 1)
+	svc := getIdleService(
+		t,
+		u,
+		func() error {
+			idled <- struct{}{}
+			return errors.New("this trigger always errors")
+		},
+	)
+
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 200, recorder.Result().StatusCode)
+
+	select {
+	case <-idled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the onIdle trigger was never run")
+	}
+
+	waitForState(svc, StateUp)
+	assert.Equal(t, StateUp, svc.State())
+}
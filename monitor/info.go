@@ -0,0 +1,276 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/proidiot/gone/log"
+
+	"github.com/stuphlabs/pullcord/trigger"
+)
+
+// TriggerHistoryLength is the number of trigger runs remembered for each
+// service.
+const TriggerHistoryLength = 20
+
+// TriggerEvent records a single run of one of the triggers of a service.
+type TriggerEvent struct {
+	Trigger string    `json:"trigger"`
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error,omitempty"`
+	Output  string    `json:"output,omitempty"`
+}
+
+// ServiceInfo is a snapshot of what is known about a monitored service. Times
+// which are not yet known (such as LastChecked for a service which has never
+// been probed) are omitted from the JSON form. KeepWarm indicates that the
+// service is currently in one of its KeepWarm windows, and NextWarmUp is when
+// the next of those windows begins. DependsOn gives the names of the services
+// which the service depends on, and DelayedTriggers gives the status of any of
+// the triggers of the service which are run after a delay (such as a
+// .../trigger.DelayTrigger used as the OnIdle trigger), including when any
+// pending run is scheduled (see CancelDelayed).
+type ServiceInfo struct {
+	Name            string                         `json:"name"`
+	URL             string                         `json:"url"`
+	State           ServiceState                   `json:"state"`
+	StateSince      *time.Time                     `json:"statesince,omitempty"`
+	LastChecked     *time.Time                     `json:"lastchecked,omitempty"`
+	LastError       string                         `json:"lasterror,omitempty"`
+	LastErrorTime   *time.Time                     `json:"lasterrortime,omitempty"`
+	InFlight        uint                           `json:"inflight"`
+	Triggers        []TriggerEvent                 `json:"triggers"`
+	AsyncTriggers   map[string]trigger.AsyncStatus `json:"asynctriggers,omitempty"`
+	KeepWarm        bool                           `json:"keepwarm,omitempty"`
+	NextWarmUp      *time.Time                     `json:"nextwarmup,omitempty"`
+	DependsOn       []string                       `json:"dependson,omitempty"`
+	DelayedTriggers map[string]trigger.DelayStatus `json:"delayedtriggers,omitempty"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// Names gives the names of all the services in the monitor, in sorted order.
+func (monitor *MinMonitor) Names() []string {
+	monitor.mutex.RLock()
+	defer monitor.mutex.RUnlock()
+
+	names := make([]string, 0, len(monitor.table))
+	for name := range monitor.table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Info gives a snapshot of what is known about the named service.
+func (monitor *MinMonitor) Info(name string) (ServiceInfo, error) {
+	s, entryExists := monitor.lookup(name)
+	if !entryExists {
+		_ = log.Err(
+			fmt.Sprintf(
+				"minmonitor cannot get information about unknown"+
+					" service: \"%s\"",
+				name,
+			),
+		)
+
+		return ServiceInfo{}, UnknownServiceError
+	}
+
+	return s.Info(), nil
+}
+
+// Info gives a snapshot of what is known about the service. Like State, this
+// never probes the service.
+func (s *MinMonitorredService) Info() ServiceInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checkTimeouts()
+
+	triggers := make([]TriggerEvent, len(s.triggerHistory))
+	copy(triggers, s.triggerHistory)
+
+	var async map[string]trigger.AsyncStatus
+	var delayed map[string]trigger.DelayStatus
+	for name, t := range s.namedTriggers() {
+		if r, ok := t.(trigger.StatusReporter); ok {
+			if async == nil {
+				async = make(map[string]trigger.AsyncStatus)
+			}
+			async[name] = r.Status()
+		}
+		if r, ok := t.(trigger.DelayReporter); ok {
+			if delayed == nil {
+				delayed = make(map[string]trigger.DelayStatus)
+			}
+			delayed[name] = r.DelayStatus()
+		}
+	}
+
+	now := time.Now()
+	warm, _ := s.keepWarm(now)
+
+	var dependsOn []string
+	for _, d := range s.DependsOn {
+		dependsOn = append(dependsOn, d.displayName())
+	}
+
+	return ServiceInfo{
+		Name:            s.Name,
+		URL:             s.URL.String(),
+		State:           s.state,
+		StateSince:      optionalTime(s.stateSince),
+		LastChecked:     optionalTime(s.lastChecked),
+		LastError:       s.lastError,
+		LastErrorTime:   optionalTime(s.lastErrorTime),
+		InFlight:        s.inFlight,
+		Triggers:        triggers,
+		AsyncTriggers:   async,
+		KeepWarm:        warm,
+		NextWarmUp:      optionalTime(s.nextWarmUp(now)),
+		DependsOn:       dependsOn,
+		DelayedTriggers: delayed,
+	}
+}
+
+// namedTriggers gives the triggers of the service which have been given, by
+// the name used for them in the trigger history.
+func (s *MinMonitorredService) namedTriggers() map[string]trigger.Triggerrer {
+	triggers := make(map[string]trigger.Triggerrer)
+	for name, t := range map[string]trigger.Triggerrer{
+		"always": s.Always,
+		"ondown": s.OnDown,
+		"onup":   s.OnUp,
+		"onidle": s.OnIdle,
+	} {
+		if t != nil {
+			triggers[name] = t
+		}
+	}
+
+	return triggers
+}
+
+// CancelDelayed cancels the pending run of any of the triggers of the named
+// service which are run after a delay (see the CancelDelayed method of
+// MinMonitorredService).
+func (monitor *MinMonitor) CancelDelayed(name string) (bool, error) {
+	s, entryExists := monitor.lookup(name)
+	if !entryExists {
+		_ = log.Err(
+			fmt.Sprintf(
+				"minmonitor cannot cancel the delayed triggers of"+
+					" unknown service: \"%s\"",
+				name,
+			),
+		)
+
+		return false, UnknownServiceError
+	}
+
+	return s.CancelDelayed(), nil
+}
+
+// CancelDelayed cancels the pending run of any of the triggers of the service
+// which are run after a delay (such as an idle shutdown by a
+// .../trigger.DelayTrigger), reporting whether any run was pending. A delayed
+// trigger which is already running is not affected.
+func (s *MinMonitorredService) CancelDelayed() bool {
+	s.mutex.Lock()
+	triggers := s.namedTriggers()
+	s.mutex.Unlock()
+
+	cancelled := false
+	for name, t := range triggers {
+		if r, ok := t.(trigger.DelayReporter); ok && r.Cancel() {
+			_ = log.Notice(
+				fmt.Sprintf(
+					"minmonitor cancelled the pending %s trigger"+
+						" for \"%s\"",
+					name,
+					s.URL.String(),
+				),
+			)
+			cancelled = true
+		}
+	}
+
+	return cancelled
+}
+
+// recordError remembers an error encountered while probing or triggering the
+// service so that it can be reported by Info.
+func (s *MinMonitorredService) recordError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now()
+}
+
+// runTrigger runs the given trigger of the service for the given request
+// (which is nil for triggers not caused by a request), remembering the run
+// (along with any error or output) in the trigger history of the service.
+//
+// The trigger is cancelled along with the request (such as when the client
+// disconnects or the server shuts down), while a trigger not caused by a
+// request is cancelled once the service has been stopped (see
+// StopBackground). Any part of a trigger which keeps running in the background
+// can outlive the request, but not the service (see .../trigger.Detach).
+func (s *MinMonitorredService) runTrigger(
+	name string,
+	t trigger.Triggerrer,
+	req *http.Request,
+) error {
+	lifetime := s.lifetimeContext()
+	ctx := lifetime
+	if req != nil {
+		ctx = req.Context()
+	}
+
+	output, err := t.Trigger(
+		trigger.WithLifetime(ctx, lifetime),
+		trigger.Event{
+			Service: s.displayName(),
+			Trigger: name,
+			Time:    time.Now(),
+			Request: trigger.NewRequestInfo(req),
+		},
+	)
+
+	event := TriggerEvent{
+		Trigger: name,
+		Time:    time.Now(),
+		Output:  output,
+	}
+
+	triggerRuns.Inc(s.displayName(), name)
+	if err != nil {
+		triggerErrors.Inc(s.displayName(), name)
+	}
+
+	s.mutex.Lock()
+	if err != nil {
+		event.Error = err.Error()
+		s.lastError = event.Error
+		s.lastErrorTime = event.Time
+	}
+	s.triggerHistory = append(s.triggerHistory, event)
+	if len(s.triggerHistory) > TriggerHistoryLength {
+		s.triggerHistory = s.triggerHistory[len(s.triggerHistory)-
+			TriggerHistoryLength:]
+	}
+	s.mutex.Unlock()
+
+	return err
+}
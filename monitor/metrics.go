@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/stuphlabs/pullcord/metrics"
+)
+
+var (
+	requests = metrics.NewCounter(
+		"pullcord_monitor_requests_total",
+		"Requests handled for each service, by response status code.",
+		"service",
+		"code",
+	)
+	proxyDuration = metrics.NewHistogram(
+		"pullcord_monitor_proxy_duration_seconds",
+		"Time spent forwarding requests to each service.",
+		metrics.DefaultBuckets,
+		"service",
+	)
+	probes = metrics.NewCounter(
+		"pullcord_monitor_probes_total",
+		"Probes of each service, by result (up, down, or error).",
+		"service",
+		"result",
+	)
+	probeDuration = metrics.NewHistogram(
+		"pullcord_monitor_probe_duration_seconds",
+		"Time spent probing each service.",
+		metrics.DefaultBuckets,
+		"service",
+	)
+	triggerRuns = metrics.NewCounter(
+		"pullcord_monitor_trigger_runs_total",
+		"Runs of the triggers of each service.",
+		"service",
+		"trigger",
+	)
+	triggerErrors = metrics.NewCounter(
+		"pullcord_monitor_trigger_errors_total",
+		"Runs of the triggers of each service which gave an error.",
+		"service",
+		"trigger",
+	)
+	timeToReady = metrics.NewHistogram(
+		"pullcord_monitor_time_to_ready_seconds",
+		"Time taken for each service to come up after being started.",
+		metrics.StartupBuckets,
+		"service",
+	)
+)
+
+func init() {
+	metrics.MustRegister(
+		requests,
+		proxyDuration,
+		probes,
+		probeDuration,
+		triggerRuns,
+		triggerErrors,
+		timeToReady,
+	)
+}
+
+// probe runs a single probe of the service, recording the result and how long
+// the probe took.
+func (s *MinMonitorredService) probe() (up bool, err error) {
+	start := time.Now()
+	up, err = s.prober().Probe(s.URL)
+	probeDuration.Observe(time.Since(start).Seconds(), s.displayName())
+
+	result := "down"
+	if err != nil {
+		result = "error"
+	} else if up {
+		result = "up"
+	}
+	probes.Inc(s.displayName(), result)
+
+	return up, err
+}
+
+// statusRecorder is a net/http.ResponseWriter which remembers the status code
+// of the response so that the request can be counted.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements net/http.Flusher if the underlying ResponseWriter does, so
+// that streamed responses from a service are not held up.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives the underlying ResponseWriter to net/http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// count counts the request for the given service by the status code of its
+// response.
+func (r *statusRecorder) count(service string) {
+	code := r.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	requests.Inc(service, strconv.Itoa(code))
+}
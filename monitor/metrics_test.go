@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorMetrics(t *testing.T) {
+	svc, p, onDown := getStateService(t, false)
+	svc.Name = "metricsapp"
+
+	code, _ := serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, float64(1), requests.Value("metricsapp", "503"))
+	assert.Equal(t, float64(1), probes.Value("metricsapp", "down"))
+	assert.Equal(t, uint64(1), probeDuration.Count("metricsapp"))
+	assert.Equal(t, float64(1), triggerRuns.Value("metricsapp", "ondown"))
+	assert.Equal(t, 1, onDown.count)
+
+	p.set(true)
+	_, err := svc.Reprobe()
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), probes.Value("metricsapp", "up"))
+	assert.Equal(t, uint64(1), timeToReady.Count("metricsapp"))
+
+	onDown.count = -1
+	require.NoError(t, svc.SetStatusUp())
+	svc.mutex.Lock()
+	svc.setState(StateDown)
+	svc.mutex.Unlock()
+	assert.Error(t, svc.Start())
+	assert.Equal(t, float64(1), triggerErrors.Value("metricsapp", "ondown"))
+}
@@ -2,20 +2,23 @@ package monitor
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
 	"net/url"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/proidiot/gone/errors"
 	"github.com/proidiot/gone/log"
 
 	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/probe"
 	"github.com/stuphlabs/pullcord/proxy"
+	"github.com/stuphlabs/pullcord/schedule"
 	"github.com/stuphlabs/pullcord/trigger"
+	"github.com/stuphlabs/pullcord/util"
 )
 
 // DuplicateServiceRegistrationError indicates that a service with that name
@@ -30,16 +33,161 @@ const UnknownServiceError = errors.New(
 	"No service has been registered with the requested name",
 )
 
+// NoTriggerError indicates that a service has no trigger with which to perform
+// the requested action.
+const NoTriggerError = errors.New(
+	"The service has no trigger for the requested action",
+)
+
+// DefaultWaitPollInterval is how often the status of a service is checked while
+// a request is being held until that service is up, if no other interval has
+// been specified.
+const DefaultWaitPollInterval = time.Second
+
+// DefaultStartTimeout is how long a service created by NewMinMonitorredService
+// (or from a config) may be starting before it is marked as failed, if no
+// other timeout has been specified.
+const DefaultStartTimeout = 5 * time.Minute
+
+// DefaultStopTimeout is how long a service created by NewMinMonitorredService
+// (or from a config) may be stopping before it is treated as down (or as up,
+// if it is still found to be up), if no other timeout has been specified.
+const DefaultStopTimeout = 5 * time.Minute
+
+// DefaultFailedTimeout is how long a service created by
+// NewMinMonitorredService (or from a config) remains failed before it is
+// treated as down (and so is started again by the next request), if no other
+// timeout has been specified.
+const DefaultFailedTimeout = time.Minute
+
 // MinMonitorredService holds the information for a single service definition.
+// The Prober determines how the status of the service is checked, and if it is
+// nil then probe.DefaultProber will be used.
+//
+// If a ProbeInterval is given, the service will also be actively probed in the
+// background at that interval for as long as the background checks are
+// running (see StartBackground). In that case, the service will only be
+// considered up after Rise consecutive successful probes, and will only be
+// considered down after Fall consecutive unsuccessful probes (both of which
+// are treated as 1 if left as 0), and requests will be handled according to
+// the cached status rather than waiting on a new probe.
+//
+// By default, a request for a service which is down will immediately be given
+// a page indicating that the service is not yet ready (once the onDown trigger
+// has been run). If a MaxWait is given, the request will instead be held until
+// the service comes up (in which case the request will be forwarded as normal)
+// or until MaxWait has passed. A MaxWaiting can be given to limit the number
+// of requests being held at once, with any further requests receiving the not
+// yet ready page immediately.
+//
+// The not yet ready page shown to browsers includes the Name of the service
+// and reloads once the service is up (polling the status of the service at
+// StatusPath, or DefaultStatusPath if none is given). The status is only given
+// at that path while the service is not up, after which requests for that path
+// are forwarded to the service like any other. Other clients receive a JSON or
+// plain text response. All clients are asked to retry after RetryAfter (or
+// DefaultRetryAfter if none is given), or after however long the OnDown
+// trigger (or any trigger it runs) is being rate limited for if that is
+// longer (see .../trigger.RateLimitTrigger), and a client whose request could
+// not start the service due to the rate limit is also given the not yet ready
+// page. The not yet ready page and any error pages are rendered using Pages
+// (or the built-in defaults if Pages is nil).
+//
+// If an IdleTimeout is given, the OnIdle trigger will be run (presumably to
+// shut the service down) once no request has been forwarded to the service for
+// that long (or, for a service which came up without any request being
+// forwarded to it, once it has been up for that long). Requests that are still
+// being forwarded (including long downloads, streaming responses, and upgraded
+// websocket connections) keep the service from being considered idle until
+// they complete.
+//
+// The service moves through the states described by ServiceState. The OnDown
+// trigger is only run for a service which is down, so requests which arrive
+// while the service is already starting do not run it again. A service which
+// has not come up within StartTimeout of being started is marked as failed,
+// and requests for it receive an error page until FailedTimeout has passed (at
+// which point it is treated as down, and will be started again by the next
+// request). A service which is stopping is treated as down once a probe no
+// longer finds it up, or once StopTimeout has passed, unless a probe still
+// finds it up after StopTimeout (or its OnIdle trigger fails in the
+// background), in which case it is treated as up again. A timeout which is 0
+// never expires, though NewMinMonitorredService (and a config which does not
+// give them) sets StartTimeout to DefaultStartTimeout, StopTimeout to
+// DefaultStopTimeout, and FailedTimeout to DefaultFailedTimeout, so that a
+// service which never comes up (such as one which crashes as it boots) is
+// eventually started again, and a service which never stops is not left
+// stopping forever.
+//
+// If any KeepWarm windows are given, the service is started (as if a request
+// had arrived for it) as each window begins, for as long as the background
+// checks are running, and the service is not considered idle until every
+// window it is in has ended.
+//
+// A service can depend on other services (such as an application server
+// which needs its database), which are given in DependsOn. Starting the
+// service first starts its dependencies (each of which first starts its own
+// dependencies) and waits until they are all up before running the OnDown
+// trigger, all of which is done in the background. Once the service has been
+// stopped (and has been found to be down), each of its dependencies is stopped
+// as well, but only if nothing else which depends on it is up (whether or not
+// pullcord started it), and only if it has an OnIdle trigger and would
+// otherwise be idle (see IdleTimeout). A service which depends on itself (even
+// indirectly) is rejected.
+//
+// A MinMonitorredService is safe for concurrent use, but its exported fields
+// must not be changed once it has started handling requests.
 type MinMonitorredService struct {
-	URL         *url.URL
-	GracePeriod time.Duration
-	OnDown      trigger.Triggerrer
-	OnUp        trigger.Triggerrer
-	Always      trigger.Triggerrer
-	lastChecked time.Time
-	up          bool
-	passthru    http.Handler
+	Name             string
+	URL              *url.URL
+	GracePeriod      time.Duration
+	Prober           probe.Prober
+	ProbeInterval    time.Duration
+	Rise             uint
+	Fall             uint
+	MaxWait          time.Duration
+	MaxWaiting       uint
+	WaitPollInterval time.Duration
+	RetryAfter       time.Duration
+	StatusPath       string
+	Pages            *util.PageTemplate
+	IdleTimeout      time.Duration
+	OnIdle           trigger.Triggerrer
+	StartTimeout     time.Duration
+	StopTimeout      time.Duration
+	FailedTimeout    time.Duration
+	OnDown           trigger.Triggerrer
+	OnUp             trigger.Triggerrer
+	Always           trigger.Triggerrer
+	KeepWarm         []*schedule.Window
+	DependsOn        []*MinMonitorredService
+	lastChecked      time.Time
+	state            ServiceState
+	stateSince       time.Time
+	passthru         http.Handler
+	mutex            sync.Mutex
+	successes        uint
+	failures         uint
+	waiting          uint
+	inFlight         uint
+	lastActive       time.Time
+	idleTimer        *time.Timer
+	probing          *probeCall
+	lastError        string
+	lastErrorTime    time.Time
+	triggerHistory   []TriggerEvent
+	stopChan         chan struct{}
+	doneChan         chan struct{}
+	lifetime         context.Context
+	endLifetime      context.CancelFunc
+	dependents       []*MinMonitorredService
+}
+
+// probeCall is a probe of a service which is in progress, the result of which
+// is shared with any other callers waiting on the same probe.
+type probeCall struct {
+	done chan struct{}
+	up   bool
+	err  error
 }
 
 func init() {
@@ -54,11 +202,29 @@ func init() {
 // UnmarshalJSON implements encoding/json.Unmarshaler.
 func (s *MinMonitorredService) UnmarshalJSON(data []byte) error {
 	var t struct {
-		URL         string
-		GracePeriod string
-		OnDown      *config.Resource
-		OnUp        *config.Resource
-		Always      *config.Resource
+		Name             string
+		URL              string
+		GracePeriod      string
+		Probe            *config.Resource
+		ProbeInterval    string
+		Rise             uint
+		Fall             uint
+		MaxWait          string
+		MaxWaiting       uint
+		WaitPollInterval string
+		RetryAfter       string
+		StatusPath       string
+		Pages            *config.Resource
+		IdleTimeout      string
+		OnIdle           *config.Resource
+		StartTimeout     string
+		StopTimeout      string
+		FailedTimeout    string
+		OnDown           *config.Resource
+		OnUp             *config.Resource
+		Always           *config.Resource
+		KeepWarm         []*schedule.Window
+		DependsOn        []*config.Resource
 	}
 
 	dec := json.NewDecoder(bytes.NewReader(data))
@@ -73,43 +239,182 @@ func (s *MinMonitorredService) UnmarshalJSON(data []byte) error {
 
 	s.GracePeriod = g
 
-	if t.OnDown != nil {
-		d := t.OnDown.Unmarshalled
-		switch d := d.(type) {
-		case trigger.Triggerrer:
-			s.OnDown = d
+	if t.Probe != nil {
+		p := t.Probe.Unmarshalled
+		switch p := p.(type) {
+		case probe.Prober:
+			s.Prober = p
+		default:
+			return config.UnexpectedResourceType
+		}
+	} else {
+		s.Prober = nil
+	}
+
+	s.ProbeInterval = 0
+	if t.ProbeInterval != "" {
+		i, e := time.ParseDuration(t.ProbeInterval)
+		if e != nil {
+			return e
+		}
+		if i < 0 {
+			return fmt.Errorf(
+				"minmonitorredservice probe interval must not"+
+					" be negative, but was given: %s",
+				t.ProbeInterval,
+			)
+		}
+		s.ProbeInterval = i
+	}
+
+	s.Rise = t.Rise
+	s.Fall = t.Fall
+
+	s.MaxWait = 0
+	if t.MaxWait != "" {
+		w, e := time.ParseDuration(t.MaxWait)
+		if e != nil {
+			return e
+		}
+		s.MaxWait = w
+	}
+
+	s.MaxWaiting = t.MaxWaiting
+
+	s.WaitPollInterval = 0
+	if t.WaitPollInterval != "" {
+		i, e := time.ParseDuration(t.WaitPollInterval)
+		if e != nil {
+			return e
+		}
+		s.WaitPollInterval = i
+	}
+
+	s.RetryAfter = 0
+	if t.RetryAfter != "" {
+		r, e := time.ParseDuration(t.RetryAfter)
+		if e != nil {
+			return e
+		}
+		s.RetryAfter = r
+	}
+
+	s.Name = t.Name
+	s.StatusPath = t.StatusPath
+
+	if t.Pages != nil && t.Pages.Unmarshalled != nil {
+		p := t.Pages.Unmarshalled
+		switch p := p.(type) {
+		case *util.PageTemplate:
+			s.Pages = p
 		default:
 			return config.UnexpectedResourceType
 		}
+	} else {
+		s.Pages = nil
+	}
+
+	s.IdleTimeout = 0
+	if t.IdleTimeout != "" {
+		i, e := time.ParseDuration(t.IdleTimeout)
+		if e != nil {
+			return e
+		}
+		if i < 0 {
+			return fmt.Errorf(
+				"minmonitorredservice idle timeout must not be"+
+					" negative, but was given: %s",
+				t.IdleTimeout,
+			)
+		}
+		s.IdleTimeout = i
+	}
+
+	if t.OnIdle != nil {
+		i, ok := trigger.FromResource(t.OnIdle.Unmarshalled)
+		if !ok {
+			return config.UnexpectedResourceType
+		}
+		s.OnIdle = i
+	} else {
+		s.OnIdle = nil
+	}
+
+	if s.StartTimeout, e = parseTimeout(
+		"start timeout",
+		t.StartTimeout,
+	); e != nil {
+		return e
+	} else if t.StartTimeout == "" {
+		s.StartTimeout = DefaultStartTimeout
+	}
+
+	if s.StopTimeout, e = parseTimeout(
+		"stop timeout",
+		t.StopTimeout,
+	); e != nil {
+		return e
+	} else if t.StopTimeout == "" {
+		s.StopTimeout = DefaultStopTimeout
+	}
+
+	if s.FailedTimeout, e = parseTimeout(
+		"failed timeout",
+		t.FailedTimeout,
+	); e != nil {
+		return e
+	} else if t.FailedTimeout == "" {
+		s.FailedTimeout = DefaultFailedTimeout
+	}
+
+	if t.OnDown != nil {
+		d, ok := trigger.FromResource(t.OnDown.Unmarshalled)
+		if !ok {
+			return config.UnexpectedResourceType
+		}
+		s.OnDown = d
 	} else {
 		// TODO test null values for these as well
 		s.OnDown = nil
 	}
 
 	if t.OnUp != nil {
-		u := t.OnUp.Unmarshalled
-		switch u := u.(type) {
-		case trigger.Triggerrer:
-			s.OnUp = u
-		default:
+		u, ok := trigger.FromResource(t.OnUp.Unmarshalled)
+		if !ok {
 			return config.UnexpectedResourceType
 		}
+		s.OnUp = u
 	} else {
 		s.OnUp = nil
 	}
 
 	if t.Always != nil {
-		a := t.Always.Unmarshalled
-		switch a := a.(type) {
-		case trigger.Triggerrer:
-			s.Always = a
-		default:
+		a, ok := trigger.FromResource(t.Always.Unmarshalled)
+		if !ok {
 			return config.UnexpectedResourceType
 		}
+		s.Always = a
 	} else {
 		s.Always = nil
 	}
 
+	s.KeepWarm = t.KeepWarm
+
+	s.DependsOn = nil
+	for _, rsc := range t.DependsOn {
+		var d *MinMonitorredService
+		if rsc != nil {
+			d, _ = rsc.Unmarshalled.(*MinMonitorredService)
+		}
+		if d == nil {
+			return config.UnexpectedResourceType
+		}
+		s.DependsOn = append(s.DependsOn, d)
+	}
+	if e := s.checkDependencies(); e != nil {
+		return e
+	}
+
 	u, e := url.Parse(t.URL)
 	if e != nil {
 		return e
@@ -120,6 +425,30 @@ func (s *MinMonitorredService) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// parseTimeout parses an optional, non-negative duration from a config, with
+// the name of the duration being used to describe any error.
+func parseTimeout(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, e := time.ParseDuration(value)
+	if e != nil {
+		return 0, e
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf(
+			"minmonitorredservice %s must not be negative, but was"+
+				" given: %s",
+			name,
+			value,
+		)
+	}
+
+	return d, nil
+}
+
 // NewMinMonitorredService creates an initialized MinMonitorredService.
 func NewMinMonitorredService(
 	u *url.URL,
@@ -129,27 +458,248 @@ func NewMinMonitorredService(
 	always trigger.Triggerrer,
 ) (service *MinMonitorredService, err error) {
 	result := MinMonitorredService{
-		URL:         u,
-		GracePeriod: gracePeriod,
-		OnDown:      onDown,
-		OnUp:        onUp,
-		Always:      always,
-		lastChecked: time.Time{},
-		up:          false,
-		passthru:    nil,
+		URL:           u,
+		GracePeriod:   gracePeriod,
+		Prober:        nil,
+		OnDown:        onDown,
+		OnUp:          onUp,
+		Always:        always,
+		lastChecked:   time.Time{},
+		state:         StateDown,
+		passthru:      nil,
+		StartTimeout:  DefaultStartTimeout,
+		StopTimeout:   DefaultStopTimeout,
+		FailedTimeout: DefaultFailedTimeout,
 	}
 
 	return &result, nil
 }
 
+// StartBackground begins actively probing the service in the background if it
+// has a ProbeInterval, and begins watching for the start of its KeepWarm
+// windows if it has any. It implements .../config.Backgrounder, so a service
+// created from a config will be actively probed (and kept warm) for as long as
+// the server is running.
+func (s *MinMonitorredService) StartBackground() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if (s.ProbeInterval <= 0 && len(s.KeepWarm) == 0) ||
+		s.stopChan != nil {
+		return nil
+	}
+
+	s.stopChan = make(chan struct{})
+	s.doneChan = make(chan struct{})
+
+	var wg sync.WaitGroup
+	if s.ProbeInterval > 0 {
+		_ = log.Info(
+			fmt.Sprintf(
+				"minmonitor starting background probes every %s"+
+					" for: \"%s\"",
+				s.ProbeInterval.String(),
+				s.URL.String(),
+			),
+		)
+
+		wg.Add(1)
+		go func(stopChan <-chan struct{}) {
+			defer wg.Done()
+			s.probeLoop(stopChan)
+		}(s.stopChan)
+	}
+
+	if len(s.KeepWarm) > 0 {
+		_ = log.Info(
+			fmt.Sprintf(
+				"minmonitor keeping \"%s\" warm during %d"+
+					" windows",
+				s.URL.String(),
+				len(s.KeepWarm),
+			),
+		)
+
+		wg.Add(1)
+		go func(stopChan <-chan struct{}) {
+			defer wg.Done()
+			s.warmLoop(stopChan)
+		}(s.stopChan)
+	}
+
+	go func(doneChan chan<- struct{}) {
+		wg.Wait()
+		close(doneChan)
+	}(s.doneChan)
+
+	return nil
+}
+
+// StopBackground stops any background probes of the service (and stops keeping
+// it warm), and does not return until any probe already in progress has
+// completed. Any triggers of the service which are still running (including
+// those running in the background) are cancelled. It implements
+// .../config.Backgrounder.
+func (s *MinMonitorredService) StopBackground() error {
+	s.mutex.Lock()
+	stopChan := s.stopChan
+	doneChan := s.doneChan
+	endLifetime := s.endLifetime
+	s.stopChan = nil
+	s.doneChan = nil
+	s.lifetime = nil
+	s.endLifetime = nil
+	s.mutex.Unlock()
+
+	if endLifetime != nil {
+		endLifetime()
+	}
+
+	if stopChan == nil {
+		return nil
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"minmonitor stopping background checks for: \"%s\"",
+			s.URL.String(),
+		),
+	)
+
+	close(stopChan)
+	<-doneChan
+
+	return nil
+}
+
+// lifetimeContext gives the context for the lifetime of the service, which is
+// cancelled by StopBackground.
+func (s *MinMonitorredService) lifetimeContext() context.Context {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.lifetime == nil {
+		s.lifetime, s.endLifetime = context.WithCancel(
+			context.Background(),
+		)
+	}
+
+	return s.lifetime
+}
+
+func (s *MinMonitorredService) probeLoop(stopChan <-chan struct{}) {
+	ticker := time.NewTicker(s.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		s.backgroundProbe()
+
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *MinMonitorredService) prober() probe.Prober {
+	if s.Prober == nil {
+		return probe.DefaultProber
+	}
+
+	return s.Prober
+}
+
+// backgroundProbe runs a single probe of the service, only changing the cached
+// status once the rise or fall threshold has been reached.
+func (s *MinMonitorredService) backgroundProbe() {
+	up, err := s.probe()
+	if err != nil {
+		s.recordError(err)
+		_ = log.Warning(
+			fmt.Sprintf(
+				"minmonitor background probe encountered an"+
+					" error while probing \"%s\": %v",
+				s.URL.String(),
+				err,
+			),
+		)
+	}
+
+	rise := s.Rise
+	if rise == 0 {
+		rise = 1
+	}
+	fall := s.Fall
+	if fall == 0 {
+		fall = 1
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastChecked = time.Now()
+	if up {
+		s.failures = 0
+		s.successes++
+		if s.state != StateUp && s.state != StateStopping &&
+			s.successes >= rise {
+			_ = log.Notice(
+				fmt.Sprintf(
+					"minmonitor background probes"+
+						" indicate that \"%s\" is now"+
+						" up",
+					s.URL.String(),
+				),
+			)
+			s.observe(true)
+		}
+	} else {
+		s.successes = 0
+		s.failures++
+		if s.state == StateStopping ||
+			(s.state == StateUp && s.failures >= fall) {
+			_ = log.Notice(
+				fmt.Sprintf(
+					"minmonitor background probes"+
+						" indicate that \"%s\" is now"+
+						" down",
+					s.URL.String(),
+				),
+			)
+			s.observe(false)
+		}
+	}
+}
+
 // MinMonitor is a minimal service monitor not intended to be used in
 // production. Named services will have an up status cached for a time, while a
 // down status will never be cached. It is possible to explicitly set a service
 // as being up (which will be cached as with a normal probe). It is also
 // possible to explicitly re-probe a service regardless of the status of the
 // cache.
+//
+// Any services with a ProbeInterval will be actively probed in the background
+// (and any services with KeepWarm windows will be kept warm) once
+// StartBackground has been called on the monitor, and until StopBackground is
+// called.
+//
+// A MinMonitor (and each of its services) is safe for concurrent use.
 type MinMonitor struct {
-	table map[string]*MinMonitorredService
+	table   map[string]*MinMonitorredService
+	running bool
+	mutex   sync.RWMutex
+}
+
+// lookup finds the named service.
+func (monitor *MinMonitor) lookup(
+	name string,
+) (s *MinMonitorredService, entryExists bool) {
+	monitor.mutex.RLock()
+	defer monitor.mutex.RUnlock()
+
+	s, entryExists = monitor.table[name]
+	return s, entryExists
 }
 
 // Add adds a named service to the monitor. The named service is associated
@@ -159,19 +709,19 @@ type MinMonitor struct {
 // This function also allows the initial probe to either begin immediately or
 // to be deferred until the first status request.
 //
-// At this time, it is suggested that only TCP services be probed as the
-// current version of MinMonitor only checks to see that net.Dial() does not
-// fail, which would not be enough information to make a determination of the
-// status of a service that communicates over UDP. As the inability to interact
-// beyond an attempt to open a connection is a handicap in determining even the
-// status of some TCP-based services, future monitor implementations (including
-// any intended to be used in a production environment) should allow service
-// status to be determined by some amount of specified interaction (perhaps
-// involving regular expressions or callback functions).
+// The status of a service is determined by its Prober. By default, only a
+// check that net.Dial() does not fail is performed, which would not be enough
+// information to make a determination of the status of a service that
+// communicates over UDP, nor of a service which opens its port well before it
+// is ready to handle requests. Such services should be given a more
+// appropriate Prober (i.e. a probe.HTTPProbe).
 func (monitor *MinMonitor) Add(
 	name string,
 	service *MinMonitorredService,
 ) (err error) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
 	osvc, previousEntryExists := monitor.table[name]
 	if previousEntryExists {
 		_ = log.Err(
@@ -188,11 +738,25 @@ func (monitor *MinMonitor) Add(
 		return DuplicateServiceRegistrationError
 	}
 
+	if err = service.checkDependencies(); err != nil {
+		return err
+	}
+
 	if monitor.table == nil {
 		monitor.table = make(map[string]*MinMonitorredService)
 	}
 
 	monitor.table[name] = service
+	if service.Name == "" {
+		service.Name = name
+	}
+
+	if monitor.running {
+		if err = service.StartBackground(); err != nil {
+			delete(monitor.table, name)
+			return err
+		}
+	}
 
 	_ = log.Info(
 		fmt.Sprintf(
@@ -203,11 +767,61 @@ func (monitor *MinMonitor) Add(
 	return err
 }
 
+// StartBackground begins the background probes for each of the services in the
+// monitor which have a ProbeInterval (and keeps warm each of those which have
+// KeepWarm windows), as well as any such services which are added later. It
+// implements .../config.Backgrounder.
+func (monitor *MinMonitor) StartBackground() error {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	for name, s := range monitor.table {
+		if err := s.StartBackground(); err != nil {
+			_ = log.Err(
+				fmt.Sprintf(
+					"minmonitor was unable to start"+
+						" background probes for \"%s\":"+
+						" %v",
+					name,
+					err,
+				),
+			)
+			_ = monitor.stopBackground()
+			return err
+		}
+	}
+
+	monitor.running = true
+	return nil
+}
+
+// StopBackground stops the background probes for all of the services in the
+// monitor. It implements .../config.Backgrounder.
+func (monitor *MinMonitor) StopBackground() error {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	return monitor.stopBackground()
+}
+
+// stopBackground stops the background probes for all of the services in the
+// monitor. The mutex must be held.
+func (monitor *MinMonitor) stopBackground() (err error) {
+	monitor.running = false
+	for _, s := range monitor.table {
+		if e := s.StopBackground(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
 // Reprobe forces the status of the named service to be checked immediately
 // without regard to a possible previously cached up status. The result of this
 // probe will automatically be cached by the monitor.
 func (monitor *MinMonitor) Reprobe(name string) (up bool, err error) {
-	s, entryExists := monitor.table[name]
+	s, entryExists := monitor.lookup(name)
 	if !entryExists {
 		_ = log.Err(
 			fmt.Sprintf(
@@ -225,81 +839,84 @@ func (monitor *MinMonitor) Reprobe(name string) (up bool, err error) {
 
 // Reprobe forces the status of the service to be checked immediately without
 // regard to a possible previously cached up status. The result of this probe
-// will automatically be cached by the monitor.
+// will automatically be cached by the monitor. A service which is stopping is
+// not reported as up, even if the probe finds that it has not stopped yet.
+//
+// If a probe of the service is already in progress, Reprobe waits for that
+// probe and reports its result rather than starting another, so a burst of
+// requests for a service results in a single probe.
 func (s *MinMonitorredService) Reprobe() (up bool, err error) {
-	hostname := s.URL.Hostname()
-	socktypefam := "tcp"
-	if strings.Index(hostname, ":") > 0 {
-		hostname = fmt.Sprintf("//[%s]", hostname)
-		socktypefam = "tcp6"
-	}
-	port := s.URL.Port()
-	if port == "" {
-		port = s.URL.Scheme
+	s.mutex.Lock()
+	if call := s.probing; call != nil {
+		s.mutex.Unlock()
+		_ = log.Debug(
+			fmt.Sprintf(
+				"minmonitor waiting on the probe already in"+
+					" progress for: \"%s\"",
+				s.URL.String(),
+			),
+		)
+		<-call.done
+		return call.up, call.err
 	}
+	call := &probeCall{done: make(chan struct{})}
+	s.probing = call
+	s.mutex.Unlock()
 
-	addr := fmt.Sprintf("%s:%s", hostname, port)
-	conn, err := net.Dial(socktypefam, addr)
-	s.lastChecked = time.Now()
-	if err != nil {
-		s.up = false
-		// TODO check what the error was
+	call.up, call.err = s.reprobe()
 
-		switch castErr := err.(type) {
-		case *net.OpError:
-			if castErr.Addr != nil {
-				_ = log.Info(
-					fmt.Sprintf(
-						"minmonitor received a"+
-							" connection refused"+
-							" (interpereted as a"+
-							" down status) from"+
-							" \"%s\"",
-						s.URL.String(),
-					),
-				)
+	s.mutex.Lock()
+	s.probing = nil
+	s.mutex.Unlock()
+	close(call.done)
 
-				return false, nil
-			}
+	return call.up, call.err
+}
 
-			_ = log.Warning(
-				fmt.Sprintf(
-					"minmonitor encountered an error while"+
-						" probing \"%s\": %v",
-					s.URL.String(),
-					err,
-				),
-			)
+// reprobe runs a single probe of the service and caches the result.
+func (s *MinMonitorredService) reprobe() (up bool, err error) {
+	up, err = s.probe()
 
-			return false, err
-		default:
-			_ = log.Warning(
-				fmt.Sprintf(
-					"minmonitor encountered an unknown"+
-						" error while probing"+
-						" \"%s\": %v",
-					s.URL.String(),
-					err,
-				),
-			)
+	s.mutex.Lock()
+	s.lastChecked = time.Now()
+	s.observe(up)
+	up = s.state == StateUp
+	s.successes = 0
+	s.failures = 0
+	s.mutex.Unlock()
 
-			return false, err
-		}
-	} else {
-		defer func() {
-			_ = conn.Close()
-		}()
-		s.up = true
+	if err != nil {
+		s.recordError(err)
+		_ = log.Warning(
+			fmt.Sprintf(
+				"minmonitor encountered an error while probing"+
+					" \"%s\": %v",
+				s.URL.String(),
+				err,
+			),
+		)
+
+		return false, err
+	}
 
+	if up {
 		_ = log.Info(
 			fmt.Sprintf(
 				"minmonitor successfully probed: \"%s\"",
 				s.URL.String(),
 			),
 		)
-
-		return true, nil
+	} else {
+		_ = log.Info(
+			fmt.Sprintf(
+				"minmonitor probe indicated a down status for:"+
+					" \"%s\"",
+				s.URL.String(),
+			),
+		)
 	}
+
+	return up, nil
 }
 
 // Status returns true if the status of the named service is currently believed
@@ -314,7 +931,7 @@ func (s *MinMonitorredService) Reprobe() (up bool, err error) {
 // down, then it necessarily means that a probe has just occurred and the
 // service was unable to be reached.
 func (monitor *MinMonitor) Status(name string) (up bool, err error) {
-	s, entryExists := monitor.table[name]
+	s, entryExists := monitor.lookup(name)
 	if !entryExists {
 		_ = log.Err(
 			fmt.Sprintf(
@@ -341,9 +958,32 @@ func (monitor *MinMonitor) Status(name string) (up bool, err error) {
 // assignment). However, if the status of the service is reported as being down,
 // then it necessarily means that a probe has just occurred and the service was
 // unable to be reached.
+//
+// The exception is a service which is being actively probed in the background,
+// in which case the status determined by the background probes is reported
+// without any new probe (unless no probe has completed yet).
 func (s *MinMonitorredService) Status() (up bool, err error) {
-	if (!s.up) || time.Now().After(
-		s.lastChecked.Add(s.GracePeriod),
+	s.mutex.Lock()
+	s.checkTimeouts()
+	up = s.state == StateUp
+	lastChecked := s.lastChecked
+	background := s.stopChan != nil && s.ProbeInterval > 0
+	s.mutex.Unlock()
+
+	if background && !lastChecked.IsZero() {
+		_ = log.Debug(
+			fmt.Sprintf(
+				"minmonitor is using the status from the"+
+					" background probes of: \"%s\"",
+				s.URL.String(),
+			),
+		)
+
+		return up, nil
+	}
+
+	if (!up) || time.Now().After(
+		lastChecked.Add(s.GracePeriod),
 	) {
 		_ = log.Info(
 			fmt.Sprintf(
@@ -373,7 +1013,7 @@ func (s *MinMonitorredService) Status() (up bool, err error) {
 // SetStatusUp explicitly sets the status of a named service as being up. This
 // up status will be cached just as if it were the result of a normal probe.
 func (monitor *MinMonitor) SetStatusUp(name string) (err error) {
-	s, entryExists := monitor.table[name]
+	s, entryExists := monitor.lookup(name)
 	if !entryExists {
 		_ = log.Err(
 			fmt.Sprintf(
@@ -399,8 +1039,12 @@ func (s *MinMonitorredService) SetStatusUp() error {
 			s.URL.String(),
 		),
 	)
+	s.mutex.Lock()
 	s.lastChecked = time.Now()
-	s.up = true
+	s.setState(StateUp)
+	s.successes = 0
+	s.failures = 0
+	s.mutex.Unlock()
 
 	return nil
 }
@@ -413,7 +1057,7 @@ func (s *MinMonitorredService) SetStatusUp() error {
 func (monitor *MinMonitor) NewMinMonitorFilter(
 	name string,
 ) (http.Handler, error) {
-	s, serviceExists := monitor.table[name]
+	s, serviceExists := monitor.lookup(name)
 	if !serviceExists {
 		_ = log.Err(
 			fmt.Sprintf(
@@ -429,84 +1073,62 @@ func (monitor *MinMonitor) NewMinMonitorFilter(
 	return s, nil
 }
 
+// serveInternalServerError writes the error page given after something has
+// gone wrong while handling a request, with a description of what that
+// something was being given for the logs.
+func (s *MinMonitorredService) serveInternalServerError(
+	w http.ResponseWriter,
+	req *http.Request,
+	description string,
+	err error,
+) {
+	_ = log.Warning(
+		fmt.Sprintf(
+			"minmonitor filter received an error while %s on"+
+				" \"%s\": %v",
+			description,
+			s.URL.String(),
+			err,
+		),
+	)
+	s.Pages.ServeError(w, req, 500)
+}
+
 func (s *MinMonitorredService) ServeHTTP(
 	w http.ResponseWriter,
 	req *http.Request,
 ) {
 	_ = log.Debug("running minmonitor filter")
+	recorder := &statusRecorder{ResponseWriter: w}
+	defer recorder.count(s.displayName())
+	w = recorder
 
 	up, err := s.Status()
 	if err != nil {
-		_ = log.Warning(
-			fmt.Sprintf(
-				"minmonitor filter received an error"+
-					" while requesting the status for"+
-					" \"%s\": %v",
-				s.URL.String(),
-				err,
-			),
-		)
-		w.WriteHeader(500)
-		_, err = fmt.Fprint(
+		s.serveInternalServerError(
 			w,
-			"<html><head><title>Pullcord - Internal"+
-				" Server Error</title></head><body><h1>"+
-				"Pullcord - Internal Server Error</h1><p>An"+
-				" internal server error has occurred, but it"+
-				" might not be serious. However, If the"+
-				" problem persists, the site administrator"+
-				" should be contacted.</p></body></html>",
+			req,
+			"requesting the status",
+			err,
 		)
-		if err != nil {
-			_ = log.Error(
-				fmt.Sprintf(
-					"error writing page after error with"+
-						" monitor status: %s",
-					err.Error(),
-				),
-			)
-		}
+		return
+	}
+
+	if !up && req.URL.Path == s.statusPath() {
+		s.serveStatus(w, req)
 		return
 	}
 
 	if s.Always != nil {
 		_ = log.Debug("minmonitor running always trigger")
-		err = s.Always.Trigger()
+		err = s.runTrigger("always", s.Always, req)
 		if err != nil {
-			_ = log.Warning(
-				fmt.Sprintf(
-					"minmonitor filter received"+
-						" an error while running the"+
-						" always trigger on \"%s\":"+
-						" %v",
-					s.URL.String(),
-					err,
-				),
-			)
-			w.WriteHeader(500)
-			_, err = fmt.Fprint(
+			s.serveInternalServerError(
 				w,
-				"<html><head><title>Pullcord -"+
-					" Internal Server Error</title>"+
-					"</head><body><h1>Pullcord -"+
-					" Internal Server Error</h1><p>"+
-					"An internal server error has"+
-					" occurred, but it might not be"+
-					" serious. However, if the problem"+
-					" persists, the site administrator"+
-					" should be contacted.</p></body>"+
-					"</html>",
+				req,
+				"running the always trigger",
+				err,
 			)
-			if err != nil {
-				_ = log.Error(
-					fmt.Sprintf(
-						"error writing page after"+
-							" error with always"+
-							" trigger: %s",
-						err.Error(),
-					),
-				)
-			}
 			return
 		}
 		_ = log.Debug("minmonitor completed always trigger")
@@ -514,140 +1136,203 @@ func (s *MinMonitorredService) ServeHTTP(
 
 	if up {
 		_ = log.Debug("minmonitor determined service is up")
-		if s.OnUp != nil {
-			_ = log.Debug("minmonitor running up trigger")
-			err = s.OnUp.Trigger()
-			if err != nil {
-				_ = log.Warning(
-					fmt.Sprintf(
-						"minmonitor filter"+
-							" received an error"+
-							" while running the"+
-							" onDown trigger on"+
-							" \"%s\": %v",
-						s.URL.String(),
-						err,
-					),
-				)
-				w.WriteHeader(500)
-				_, err = fmt.Fprint(
-					w,
-					"<html><head><title>Pullcord"+
-						" - Internal Server Error"+
-						"</title></head><body><h1>"+
-						"Pullcord - Internal Server"+
-						" Error</h1><p>An internal"+
-						" server error has occurred,"+
-						" but it might not be"+
-						" serious. However, if the"+
-						" problem persists, the site"+
-						" administrator should be"+
-						" contacted.</p></body></html>",
-				)
-				if err != nil {
-					_ = log.Error(
-						fmt.Sprintf(
-							"error writing page"+
-								" after error"+
-								" with onup"+
-								" trigger: %s",
-							err.Error(),
-						),
-					)
-				}
-				return
-			}
-			_ = log.Debug("minmonitor completed up trigger")
-		}
-
-		if s.passthru == nil {
-			_ = log.Debug(
-				"minmonitor filter passthru creation started",
-			)
-			s.passthru = proxy.NewPassthruFilter(s.URL)
-			_ = log.Debug(
-				"minmonitor filter passthru creation completed",
-			)
-		}
-
-		_ = log.Debug("minmonitor filter passthru starting")
-		s.passthru.ServeHTTP(w, req)
-		_ = log.Debug("minmonitor filter passthru completed")
+		s.serveUp(w, req)
 		return
 	}
 
 	_ = log.Debug("minmonitor determined service is down")
-	if s.OnDown != nil {
-		_ = log.Debug("minmonitor running down trigger")
-		err = s.OnDown.Trigger()
-		if err != nil {
+
+	s.mutex.Lock()
+	s.checkTimeouts()
+	state := s.state
+	if state == StateDown {
+		s.setState(StateStarting)
+	}
+	s.mutex.Unlock()
+
+	switch state {
+	case StateDown:
+		if err = s.runOnDown(req); rateLimited(err) {
 			_ = log.Warning(
 				fmt.Sprintf(
-					"minmonitor filter received"+
-						" an error while running the"+
-						" onDown trigger on \"%s\": %v",
+					"minmonitor filter was unable to start"+
+						" \"%s\" due to a rate limit",
 					s.URL.String(),
-					err,
 				),
 			)
-			w.WriteHeader(500)
-			_, err = fmt.Fprint(
+			s.serveNotReady(w, req)
+			return
+		} else if err != nil {
+			s.serveInternalServerError(
 				w,
-				"<html><head><title>Pullcord -"+
-					" Internal Server Error</title>"+
-					"</head><body><h1>Pullcord -"+
-					" Internal Server Error</h1><p>"+
-					"An internal server error has"+
-					" occurred, but it might not be"+
-					" serious. However, If the problem"+
-					" persists, the site administrator"+
-					" should be contacted.</p></body>"+
-					"</html>",
+				req,
+				"running the onDown trigger",
+				err,
 			)
-			if err != nil {
-				_ = log.Error(
-					fmt.Sprintf(
-						"error writing page after"+
-							" error with ondown"+
-							" trigger: %s",
-						err.Error(),
-					),
-				)
-			}
 			return
 		}
-		_ = log.Debug("minmonitor completed down trigger")
+	case StateFailed:
+		_ = log.Warning(
+			fmt.Sprintf(
+				"minmonitor filter has reached a service"+
+					" which failed to start: \"%s\"",
+				s.URL.String(),
+			),
+		)
+		s.Pages.ServeError(w, req, 503)
+		return
+	default:
+		_ = log.Debug(
+			fmt.Sprintf(
+				"minmonitor not running down trigger for a"+
+					" service which is %s",
+				state.String(),
+			),
+		)
 	}
 
-	_ = log.Info(
-		fmt.Sprintf(
-			"minmonitor filter has reached a down"+
-				" service (\"%s\"), but any triggers have"+
-				" fired successfully",
-			s.URL.String(),
-		),
-	)
-	w.WriteHeader(503)
-	_, err = fmt.Fprint(
-		w,
-		"<html><head><title>Pullcord - Service Not Ready"+
-			"</title></head><body><h1>Pullcord - Service Not"+
-			" Ready</h1><p>The requested service is not yet"+
-			" ready, but any trigger to start the service has"+
-			" been started successfully, so hopefully the"+
-			" service will be up in a few minutes.</p><p>If you"+
-			" would like further information, please contact the"+
-			" site administrator.</p></body></html>",
+	if s.waitForUp(req) {
+		_ = log.Debug(
+			"minmonitor determined service came up while waiting",
+		)
+		s.serveUp(w, req)
+		return
+	}
+
+	s.serveNotReady(w, req)
+}
+
+// serveUp handles a request for a service that is up by running the onUp
+// trigger and then forwarding the request to the service.
+func (s *MinMonitorredService) serveUp(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	if s.OnUp != nil {
+		_ = log.Debug("minmonitor running up trigger")
+		if err := s.runTrigger("onup", s.OnUp, req); err != nil {
+			s.serveInternalServerError(
+				w,
+				req,
+				"running the onUp trigger",
+				err,
+			)
+			return
+		}
+		_ = log.Debug("minmonitor completed up trigger")
+	}
+
+	s.mutex.Lock()
+	if s.passthru == nil {
+		_ = log.Debug(
+			"minmonitor filter passthru creation started",
+		)
+		s.passthru = proxy.NewPassthruFilter(s.URL)
+		_ = log.Debug(
+			"minmonitor filter passthru creation completed",
+		)
+	}
+	passthru := s.passthru
+	s.mutex.Unlock()
+
+	_ = log.Debug("minmonitor filter passthru starting")
+	s.beginRequest()
+	defer s.endRequest()
+	start := time.Now()
+	passthru.ServeHTTP(w, req)
+	proxyDuration.Observe(
+		time.Since(start).Seconds(),
+		s.displayName(),
 	)
-	if err != nil {
-		_ = log.Error(
+	_ = log.Debug("minmonitor filter passthru completed")
+}
+
+// waitForUp holds a request for a service that is down until the service comes
+// up, returning true if it did so. The request will be held for no longer than
+// MaxWait (and not at all if MaxWait is not positive), and no more than
+// MaxWaiting requests will be held at any one time (if MaxWaiting is
+// positive). The status of the service is checked every WaitPollInterval (or
+// every DefaultWaitPollInterval if no interval was given).
+func (s *MinMonitorredService) waitForUp(req *http.Request) bool {
+	if s.MaxWait <= 0 {
+		return false
+	}
+
+	s.mutex.Lock()
+	if s.MaxWaiting > 0 && s.waiting >= s.MaxWaiting {
+		s.mutex.Unlock()
+		_ = log.Info(
 			fmt.Sprintf(
-				"error writing page after status down: %s",
-				err.Error(),
+				"minmonitor already has the maximum number of"+
+					" requests waiting for \"%s\"",
+				s.URL.String(),
 			),
 		)
+		return false
+	}
+	s.waiting++
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.waiting--
+		s.mutex.Unlock()
+	}()
+
+	interval := s.WaitPollInterval
+	if interval <= 0 {
+		interval = DefaultWaitPollInterval
+	}
+
+	_ = log.Debug(
+		fmt.Sprintf(
+			"minmonitor holding request for up to %s while"+
+				" waiting for \"%s\"",
+			s.MaxWait.String(),
+			s.URL.String(),
+		),
+	)
+
+	deadline := time.NewTimer(s.MaxWait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			_ = log.Debug(
+				"minmonitor request was cancelled while" +
+					" waiting",
+			)
+			return false
+		case <-deadline.C:
+			_ = log.Info(
+				fmt.Sprintf(
+					"minmonitor gave up waiting for"+
+						" \"%s\" after %s",
+					s.URL.String(),
+					s.MaxWait.String(),
+				),
+			)
+			return false
+		case <-ticker.C:
+			up, err := s.Status()
+			if err != nil {
+				_ = log.Warning(
+					fmt.Sprintf(
+						"minmonitor received an error"+
+							" while waiting for"+
+							" \"%s\": %v",
+						s.URL.String(),
+						err,
+					),
+				)
+			} else if up {
+				return true
+			}
+		}
 	}
-	return
 }
 
 // NewMinMonitor constructs a new MinMonitor.
@@ -2,6 +2,7 @@ package monitor
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,6 +22,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/probe"
+	"github.com/stuphlabs/pullcord/trigger"
 	"github.com/stuphlabs/pullcord/util"
 )
 
@@ -421,6 +425,177 @@ func TestMinMonitorTrueNegative(t *testing.T) {
 	assert.False(t, up)
 }
 
+// TestMinMonitorProberDown verifies that a MinMonitor will use the Prober of a
+// service rather than only checking that the port is open.
+func TestMinMonitorProberDown(t *testing.T) {
+	testServiceName := "test"
+
+	u, s, err := getUpService(t)
+	require.NoError(t, err)
+	defer recycleUpService(s)
+
+	service, err := NewMinMonitorredService(
+		u,
+		time.Duration(0),
+		nil,
+		nil,
+		nil,
+	)
+	assert.NoError(t, err)
+	service.Prober = &probe.HTTPProbe{
+		BodyContains: "this is not on the landing page",
+	}
+	mon := MinMonitor{}
+	err = mon.Add(
+		testServiceName,
+		service,
+	)
+	assert.NoError(t, err)
+
+	up, err := mon.Status(testServiceName)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	service.Prober = &probe.HTTPProbe{
+		BodyContains: "Pullcord Landing Page",
+	}
+
+	up, err = mon.Status(testServiceName)
+	assert.NoError(t, err)
+	assert.True(t, up)
+}
+
+type scriptedProber struct {
+	mutex sync.Mutex
+	up    bool
+	count int
+}
+
+func (p *scriptedProber) Probe(*url.URL) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.count++
+	return p.up, nil
+}
+
+func (p *scriptedProber) set(up bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.up = up
+}
+
+func (p *scriptedProber) probes() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.count
+}
+
+func waitForProbes(p *scriptedProber, n int) {
+	for i := 0; i < 200 && p.probes() < n; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestMinMonitorBackgroundProbes verifies that a service with a probe interval
+// is probed in the background once the monitor has been started, that the
+// rise and fall thresholds are respected, and that the probes stop once the
+// monitor has been stopped.
+func TestMinMonitorBackgroundProbes(t *testing.T) {
+	testServiceName := "test"
+
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	p := &scriptedProber{up: true}
+	svc, err := NewMinMonitorredService(
+		u,
+		time.Duration(0),
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	svc.Prober = p
+	svc.ProbeInterval = 20 * time.Millisecond
+	svc.Rise = 3
+	svc.Fall = 2
+
+	mon := NewMinMonitor()
+	err = mon.Add(testServiceName, svc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, p.probes())
+
+	err = mon.StartBackground()
+	assert.NoError(t, err)
+
+	waitForProbes(p, 1)
+	up, err := mon.Status(testServiceName)
+	assert.NoError(t, err)
+	assert.False(t, up, "a single success should not reach the rise")
+
+	waitForProbes(p, 4)
+	up, err = mon.Status(testServiceName)
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	p.set(false)
+	n := p.probes()
+	waitForProbes(p, n+1)
+	up, err = mon.Status(testServiceName)
+	assert.NoError(t, err)
+	assert.True(t, up, "a single failure should not reach the fall")
+
+	waitForProbes(p, n+3)
+	up, err = mon.Status(testServiceName)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	err = mon.StopBackground()
+	assert.NoError(t, err)
+
+	n = p.probes()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, n, p.probes())
+}
+
+// TestMinMonitorBackgroundProbesNoInterval verifies that a service without a
+// probe interval is not probed in the background, even once the monitor has
+// been started.
+func TestMinMonitorBackgroundProbesNoInterval(t *testing.T) {
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	p := &scriptedProber{up: true}
+	svc, err := NewMinMonitorredService(
+		u,
+		time.Duration(0),
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	svc.Prober = p
+
+	mon := NewMinMonitor()
+	err = mon.StartBackground()
+	assert.NoError(t, err)
+	err = mon.Add("test", svc)
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, p.probes())
+
+	up, err := mon.Status("test")
+	assert.NoError(t, err)
+	assert.True(t, up)
+	assert.Equal(t, 1, p.probes())
+
+	assert.NoError(t, mon.StopBackground())
+}
+
 // TestMinMonitorNonExistantStatus verifies that a MinMonitor generated by
 // NewMinMonitor will give the expected status for a service that is
 // unspecified.
@@ -605,13 +780,16 @@ type counterTriggerrer struct {
 	count int
 }
 
-func (th *counterTriggerrer) Trigger() error {
+func (th *counterTriggerrer) Trigger(
+	context.Context,
+	trigger.Event,
+) (string, error) {
 	if th.count < 0 {
-		return errors.New("this trigger always errors")
+		return "", errors.New("this trigger always errors")
 	}
 
 	th.count++
-	return nil
+	return "", nil
 }
 
 func TestMonitorFilterUpTriggers(t *testing.T) {
@@ -870,6 +1048,156 @@ func TestMonitorFilterDownAlwaysTriggerError(t *testing.T) {
 	assert.Equal(t, -1, always.count)
 }
 
+type funcTriggerrer func() error
+
+func (f funcTriggerrer) Trigger(
+	context.Context,
+	trigger.Event,
+) (string, error) {
+	return "", f()
+}
+
+func getWaitingService(
+	t *testing.T,
+	u *url.URL,
+	p *scriptedProber,
+	onDown trigger.Triggerrer,
+) *MinMonitorredService {
+	svc, err := NewMinMonitorredService(
+		u,
+		time.Duration(0),
+		onDown,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	svc.Prober = p
+	svc.MaxWait = 2 * time.Second
+	svc.WaitPollInterval = 10 * time.Millisecond
+
+	return svc
+}
+
+// TestMonitorFilterWaitForUp verifies that a request for a down service is
+// held until the service comes up, and is then forwarded to the service.
+func TestMonitorFilterWaitForUp(t *testing.T) {
+	u, s, err := getUpService(t)
+	require.NoError(t, err)
+	defer recycleUpService(s)
+
+	p := &scriptedProber{}
+	svc := getWaitingService(
+		t,
+		u,
+		p,
+		funcTriggerrer(
+			func() error {
+				time.AfterFunc(
+					100*time.Millisecond,
+					func() {
+						p.set(true)
+					},
+				)
+				return nil
+			},
+		),
+	)
+
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	response := recorder.Result()
+
+	assert.Equal(t, 200, response.StatusCode)
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "Pullcord Landing Page")
+	assert.True(t, p.probes() > 1)
+}
+
+// TestMonitorFilterWaitTimeout verifies that a request for a down service which
+// does not come up within the maximum wait receives the usual not ready page.
+func TestMonitorFilterWaitTimeout(t *testing.T) {
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	onDown := &counterTriggerrer{}
+	svc := getWaitingService(t, u, &scriptedProber{}, onDown)
+	svc.MaxWait = 100 * time.Millisecond
+
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	response := recorder.Result()
+
+	assert.True(t, time.Since(start) >= svc.MaxWait)
+	assert.Equal(t, 503, response.StatusCode)
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "Service Not Ready")
+	assert.Equal(t, 1, onDown.count)
+}
+
+// TestMonitorFilterMaxWaiting verifies that no more than the maximum number of
+// requests are held at once.
+func TestMonitorFilterMaxWaiting(t *testing.T) {
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	svc := getWaitingService(t, u, &scriptedProber{}, nil)
+	svc.MaxWait = time.Second
+	svc.MaxWaiting = 1
+
+	done := make(chan int)
+	go func() {
+		recorder := httptest.NewRecorder()
+		svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		done <- recorder.Result().StatusCode
+	}()
+
+	for i := 0; i < 100; i++ {
+		svc.mutex.Lock()
+		waiting := svc.waiting
+		svc.mutex.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.True(t, time.Since(start) < svc.MaxWait)
+	assert.Equal(t, 503, recorder.Result().StatusCode)
+
+	assert.Equal(t, 503, <-done)
+}
+
+// TestMonitorFilterWaitCancelled verifies that a held request is released once
+// the client has gone away.
+func TestMonitorFilterWaitCancelled(t *testing.T) {
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	svc := getWaitingService(t, u, &scriptedProber{}, nil)
+	svc.MaxWait = time.Minute
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		100*time.Millisecond,
+	)
+	defer cancel()
+
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(
+		recorder,
+		httptest.NewRequest("GET", "/", nil).WithContext(ctx),
+	)
+	assert.True(t, time.Since(start) < svc.MaxWait)
+	assert.Equal(t, 503, recorder.Result().StatusCode)
+}
+
 func TestMinMonitorFromConfig(t *testing.T) {
 	test := configutil.ConfigTest{
 		ResourceType: "minmonitorredservice",
@@ -890,6 +1218,141 @@ func TestMinMonitorFromConfig(t *testing.T) {
 				Data:        "42",
 				Explanation: "numeric config",
 			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"probe": {
+						"type": "compoundtrigger",
+						"data": {}
+					}
+				}`,
+				Explanation: "non-probe as probe",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"probeinterval": "42q"
+				}`,
+				Explanation: "nonsensical probe interval",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"probeinterval": "-5s"
+				}`,
+				Explanation: "negative probe interval",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"probeinterval": "5s",
+					"rise": -2
+				}`,
+				Explanation: "negative rise",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"maxwait": "42q"
+				}`,
+				Explanation: "nonsensical max wait",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"retryafter": "42q"
+				}`,
+				Explanation: "nonsensical retry after",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"pages": {
+						"type": "standardresponse",
+						"data": 404
+					}
+				}`,
+				Explanation: "pages of the wrong type",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"idletimeout": "42q"
+				}`,
+				Explanation: "nonsensical idle timeout",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"idletimeout": "-1s"
+				}`,
+				Explanation: "negative idle timeout",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"starttimeout": "-5m"
+				}`,
+				Explanation: "negative start timeout",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"failedtimeout": "42q"
+				}`,
+				Explanation: "nonsensical failed timeout",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"keepwarm": [
+						{
+							"schedule": "0 9 * * 1-5",
+							"duration": "8h",
+							"timezone": "Mars/Olympus_Mons"
+						}
+					]
+				}`,
+				Explanation: "keep-warm window with unknown time zone",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"keepwarm": [
+						{
+							"schedule": "0 25 * * *",
+							"duration": "8h"
+						}
+					]
+				}`,
+				Explanation: "keep-warm window with bad schedule",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"dependson": [
+						{
+							"type": "compoundtrigger",
+							"data": {}
+						}
+					]
+				}`,
+				Explanation: "non-service as dependency",
+			},
 		},
 		Good: []configutil.ConfigTestData{
 			{
@@ -901,6 +1364,130 @@ func TestMinMonitorFromConfig(t *testing.T) {
 				}`,
 				Explanation: "basic valid monitor config",
 			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"probe": {
+						"type": "httpprobe",
+						"data": {
+							"path": "/healthz",
+							"expectedstatus": [200]
+						}
+					}
+				}`,
+				Explanation: "monitor config with probe",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"probeinterval": "5s",
+					"rise": 2,
+					"fall": 3
+				}`,
+				Explanation: "monitor config with background probes",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"maxwait": "90s",
+					"maxwaiting": 50,
+					"waitpollinterval": "2s"
+				}`,
+				Explanation: "monitor config with hold and wait",
+			},
+			{
+				Data: `{
+					"name": "Wiki",
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"retryafter": "10s",
+					"statuspath": "/_pullcord"
+				}`,
+				Explanation: "monitor config with not ready page",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"pages": {
+						"type": "pagetemplate",
+						"data": {
+							"inline": {
+								"notready": "<p>Soon</p>"
+							}
+						}
+					}
+				}`,
+				Explanation: "monitor config with page template",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"idletimeout": "10m",
+					"onidle": {
+						"type": "shelltrigger",
+						"data": {
+							"command": "true"
+						}
+					}
+				}`,
+				Explanation: "monitor config with idle shutdown",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"starttimeout": "5m",
+					"stoptimeout": "2m",
+					"failedtimeout": "10m"
+				}`,
+				Explanation: "monitor config with state timeouts",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"idletimeout": "10m",
+					"onidle": {
+						"type": "shelltrigger",
+						"data": {
+							"command": "true"
+						}
+					},
+					"keepwarm": [
+						{
+							"schedule": "45 8 * * mon-fri",
+							"duration": "9h15m",
+							"timezone": "America/New_York"
+						},
+						{
+							"schedule": "@daily",
+							"duration": "30m"
+						}
+					]
+				}`,
+				Explanation: "monitor config with keep-warm windows",
+			},
+			{
+				Data: `{
+					"url": "http://127.0.0.1:8080/",
+					"graceperiod": "1s",
+					"dependson": [
+						{
+							"type": "minmonitorredservice",
+							"data": {
+								"url": "http://127.0.0.1:5432/",
+								"graceperiod": "1s"
+							}
+						}
+					]
+				}`,
+				Explanation: "monitor config with a dependency",
+			},
 		},
 	}
 	test.Run(t)
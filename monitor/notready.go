@@ -0,0 +1,208 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/proidiot/gone/log"
+
+	"github.com/stuphlabs/pullcord/trigger"
+	"github.com/stuphlabs/pullcord/util"
+)
+
+// DefaultRetryAfter is how long a client is asked to wait before retrying a
+// request for a service that is not yet ready, if no other duration has been
+// specified. Browsers shown the warming up page will refresh after this long.
+const DefaultRetryAfter = 5 * time.Second
+
+// DefaultStatusPath is the path at which the status of a service which is not
+// yet up is made available (for the warming up page to poll) if no other path
+// has been specified. Once the service is up, requests for this path are
+// forwarded to the service.
+const DefaultStatusPath = "/.pullcord/status"
+
+// StatusHeader is the header giving the state of the service in a response
+// giving the status of a service which is not yet ready.
+const StatusHeader = "X-Pullcord-State"
+
+// notReadyStatus is the information given about a service that is not yet
+// ready, both to the warming up page and to clients requesting JSON.
+type notReadyStatus struct {
+	Name       string       `json:"service"`
+	Up         bool         `json:"up"`
+	State      ServiceState `json:"state"`
+	Elapsed    int64        `json:"elapsed"`
+	RetryAfter int64        `json:"retryafter"`
+	StatusPath string       `json:"-"`
+}
+
+func acceptsMediaType(req *http.Request, mediaTypes ...string) bool {
+	for _, accept := range req.Header["Accept"] {
+		for _, part := range strings.Split(accept, ",") {
+			mt := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+			for _, m := range mediaTypes {
+				if strings.EqualFold(mt, m) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *MinMonitorredService) displayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return s.URL.Host
+}
+
+func (s *MinMonitorredService) statusPath() string {
+	if s.StatusPath != "" {
+		return s.StatusPath
+	}
+
+	return DefaultStatusPath
+}
+
+// rateLimited determines if the given error is due to a trigger which was
+// refused by a rate limit.
+func rateLimited(err error) bool {
+	return errors.Is(err, trigger.ErrRateLimitExceeded)
+}
+
+// retryAfterSeconds gives how long a client should wait before retrying a
+// request, which is the RetryAfter of the service unless the OnDown trigger (or
+// any trigger it runs) is being rate limited for longer than that.
+func (s *MinMonitorredService) retryAfterSeconds() int64 {
+	retryAfter := s.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+	if s.OnDown != nil {
+		if limited := trigger.RetryAfter(s.OnDown); limited > retryAfter {
+			retryAfter = limited
+		}
+	}
+
+	return int64(math.Ceil(retryAfter.Seconds()))
+}
+
+func (s *MinMonitorredService) notReadyStatus(up bool) notReadyStatus {
+	s.mutex.Lock()
+	s.checkTimeouts()
+	state := s.state
+	stateSince := s.stateSince
+	s.mutex.Unlock()
+
+	var elapsed int64
+	if !up && state == StateStarting {
+		elapsed = int64(time.Since(stateSince).Seconds())
+	}
+
+	return notReadyStatus{
+		Name:       s.displayName(),
+		Up:         up,
+		State:      state,
+		Elapsed:    elapsed,
+		RetryAfter: s.retryAfterSeconds(),
+		StatusPath: s.statusPath(),
+	}
+}
+
+// serveNotReady handles a request for a service that is down (after any
+// triggers have fired successfully). Clients which accept HTML are given a
+// page which will reload once the service is up, clients which accept JSON
+// are given the status of the service, and any other clients are given a
+// plain text message. In all cases, a Retry-After header is included.
+func (s *MinMonitorredService) serveNotReady(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	_ = log.Info(
+		fmt.Sprintf(
+			"minmonitor filter has reached a down"+
+				" service (\"%s\"), but any triggers have"+
+				" fired successfully",
+			s.URL.String(),
+		),
+	)
+
+	status := s.notReadyStatus(false)
+	w.Header().Set(
+		"Retry-After",
+		strconv.FormatInt(status.RetryAfter, 10),
+	)
+	w.Header().Set("Cache-Control", "no-store")
+
+	var err error
+	if acceptsMediaType(req, "text/html", "application/xhtml+xml") {
+		s.Pages.ServePage(
+			w,
+			req,
+			util.NotReadyPage,
+			util.PageContext{
+				ServiceName: status.Name,
+				StatusCode:  503,
+				Data:        status,
+			},
+		)
+	} else if acceptsMediaType(req, "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(503)
+		err = json.NewEncoder(w).Encode(status)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(503)
+		_, err = fmt.Fprintf(
+			w,
+			"Service Not Ready: the requested service (%s) is"+
+				" not yet ready, please retry in %d seconds.\n",
+			status.Name,
+			status.RetryAfter,
+		)
+	}
+
+	if err != nil {
+		_ = log.Error(
+			fmt.Sprintf(
+				"error writing page after status down: %s",
+				err.Error(),
+			),
+		)
+	}
+}
+
+// serveStatus gives the current status of a service which is not up as JSON,
+// which the warming up page polls in order to know when it should reload. The
+// response is marked with the StatusHeader, so that the warming up page can
+// tell that any other response to its poll must have come from the service
+// itself (since requests are only forwarded to a service which is up).
+func (s *MinMonitorredService) serveStatus(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	status := s.notReadyStatus(false)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(StatusHeader, status.State.String())
+	w.WriteHeader(200)
+	err := json.NewEncoder(w).Encode(status)
+	if err != nil {
+		_ = log.Error(
+			fmt.Sprintf(
+				"error writing status of \"%s\": %s",
+				s.URL.String(),
+				err.Error(),
+			),
+		)
+	}
+}
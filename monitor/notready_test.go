@@ -0,0 +1,252 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stuphlabs/pullcord/trigger"
+	"github.com/stuphlabs/pullcord/util"
+)
+
+func getNotReadyService(t *testing.T) (*MinMonitorredService, *counterTriggerrer) {
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	onDown := &counterTriggerrer{}
+	svc, err := NewMinMonitorredService(
+		u,
+		time.Duration(0),
+		onDown,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	svc.Name = "testapp"
+	svc.Prober = &scriptedProber{}
+
+	return svc, onDown
+}
+
+func TestNotReadyHTML(t *testing.T) {
+	svc, onDown := getNotReadyService(t)
+	svc.RetryAfter = 3 * time.Second
+
+	req := httptest.NewRequest("GET", "/some/page", nil)
+	req.Header.Set(
+		"Accept",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	)
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, req)
+	response := recorder.Result()
+
+	assert.Equal(t, 503, response.StatusCode)
+	assert.Equal(t, "3", response.Header.Get("Retry-After"))
+	assert.Contains(t, response.Header.Get("Content-Type"), "text/html")
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "Service Not Ready")
+	assert.Contains(t, string(contents), "testapp")
+	assert.Contains(
+		t,
+		strings.Replace(string(contents), `\/`, "/", -1),
+		`"/.pullcord/status"`,
+	)
+	assert.Contains(t, string(contents), `http-equiv="refresh" content="3"`)
+	assert.Equal(t, 1, onDown.count)
+}
+
+func TestNotReadyPageTemplate(t *testing.T) {
+	svc, _ := getNotReadyService(t)
+	svc.Pages = util.MustNewPageTemplate(
+		map[string]string{
+			util.NotReadyPage: "{{.ServiceName}} is warming up" +
+				" ({{.StatusCode}}, retry in {{.Data.RetryAfter}})",
+		},
+		nil,
+	)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html")
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, req)
+	response := recorder.Result()
+
+	assert.Equal(t, 503, response.StatusCode)
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"testapp is warming up (503, retry in 5)",
+		string(contents),
+	)
+}
+
+func TestNotReadyJSON(t *testing.T) {
+	svc, _ := getNotReadyService(t)
+
+	req := httptest.NewRequest("POST", "/api/hook", nil)
+	req.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, req)
+	response := recorder.Result()
+
+	assert.Equal(t, 503, response.StatusCode)
+	assert.Equal(t, "5", response.Header.Get("Retry-After"))
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+	var status struct {
+		Service    string
+		Up         bool
+		RetryAfter int
+	}
+	err := json.NewDecoder(response.Body).Decode(&status)
+	assert.NoError(t, err)
+	assert.Equal(t, "testapp", status.Service)
+	assert.False(t, status.Up)
+	assert.Equal(t, 5, status.RetryAfter)
+}
+
+func TestNotReadyPlain(t *testing.T) {
+	svc, _ := getNotReadyService(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "*/*")
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, req)
+	response := recorder.Result()
+
+	assert.Equal(t, 503, response.StatusCode)
+	assert.Equal(t, "5", response.Header.Get("Retry-After"))
+	assert.Contains(t, response.Header.Get("Content-Type"), "text/plain")
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "Service Not Ready")
+}
+
+func TestNotReadyStatusEndpoint(t *testing.T) {
+	svc, onDown := getNotReadyService(t)
+	svc.StatusPath = "/_status"
+
+	getStatus := func() (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/_status", nil)
+		recorder := httptest.NewRecorder()
+		svc.ServeHTTP(recorder, req)
+		response := recorder.Result()
+
+		var status map[string]interface{}
+		if response.Header.Get(StatusHeader) != "" {
+			err := json.NewDecoder(response.Body).Decode(&status)
+			assert.NoError(t, err)
+		}
+
+		return response.StatusCode, status
+	}
+
+	code, status := getStatus()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, false, status["up"])
+	assert.Equal(t, "testapp", status["service"])
+	assert.Equal(t, "down", status["state"])
+	assert.Equal(t, float64(0), status["elapsed"])
+	assert.Equal(t, 0, onDown.count)
+
+	svc.mutex.Lock()
+	svc.state = StateStarting
+	svc.stateSince = time.Now().Add(-42 * time.Second)
+	svc.mutex.Unlock()
+
+	_, status = getStatus()
+	assert.Equal(t, false, status["up"])
+	assert.Equal(t, "starting", status["state"])
+	assert.True(t, status["elapsed"].(float64) >= 42)
+
+	// Once the service is up, the status path belongs to the service.
+	svc.Prober.(*scriptedProber).set(true)
+
+	code, status = getStatus()
+	assert.NotEqual(t, 200, code)
+	assert.Nil(t, status)
+	assert.Equal(t, 0, onDown.count)
+}
+
+func TestNotReadyElapsed(t *testing.T) {
+	svc, _ := getNotReadyService(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/json")
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+
+	svc.mutex.Lock()
+	state := svc.state
+	svc.stateSince = svc.stateSince.Add(-time.Minute)
+	svc.mutex.Unlock()
+	assert.Equal(t, StateStarting, state)
+
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, req)
+
+	var status struct {
+		Elapsed int
+	}
+	err := json.NewDecoder(recorder.Result().Body).Decode(&status)
+	assert.NoError(t, err)
+	assert.True(t, status.Elapsed >= 60)
+}
+
+func TestAcceptsMediaType(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, acceptsMediaType(req, "text/html"))
+
+	req.Header.Set("Accept", "text/html;q=0.9, application/json")
+	assert.True(t, acceptsMediaType(req, "text/html"))
+	assert.True(t, acceptsMediaType(req, "application/json"))
+	assert.False(t, acceptsMediaType(req, "text/plain"))
+
+	req.Header = http.Header{}
+	req.Header.Add("Accept", "text/plain")
+	req.Header.Add("Accept", "Application/XHTML+XML")
+	assert.True(t, acceptsMediaType(req, "application/xhtml+xml"))
+}
+
+// TestNotReadyRateLimited verifies that a client whose request could not start
+// the service due to a rate limit is asked to retry once the limit allows the
+// service to be started again.
+func TestNotReadyRateLimited(t *testing.T) {
+	svc, onDown := getNotReadyService(t)
+	limit := trigger.NewRateLimitTrigger(onDown, 1, time.Minute)
+	svc.OnDown = &trigger.RetryTrigger{
+		Wrapped:     limit,
+		MaxAttempts: 1,
+	}
+
+	require.NoError(t, svc.Start())
+	assert.Equal(t, 1, onDown.count)
+	svc.mutex.Lock()
+	svc.setState(StateDown)
+	svc.mutex.Unlock()
+
+	req := httptest.NewRequest("GET", "/some/page", nil)
+	req.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, req)
+	response := recorder.Result()
+
+	assert.Equal(t, 503, response.StatusCode)
+	assert.Equal(t, 1, onDown.count)
+	assert.Equal(t, StateDown, svc.State())
+	retryAfter := response.Header.Get("Retry-After")
+	assert.True(t, retryAfter == "60" || retryAfter == "59", retryAfter)
+
+	var status notReadyStatus
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	assert.True(t, status.RetryAfter > 55)
+}
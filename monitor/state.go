@@ -0,0 +1,375 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/proidiot/gone/log"
+
+	"github.com/stuphlabs/pullcord/trigger"
+)
+
+// ServiceState is the point in its lifecycle that a monitored service is
+// believed to be at.
+type ServiceState int
+
+const (
+	// StateDown indicates that the service is not running, and that
+	// nothing has yet been done to start it.
+	StateDown ServiceState = iota
+	// StateStarting indicates that the onDown trigger has been run to
+	// start the service, but that the service is not yet up.
+	StateStarting
+	// StateUp indicates that the service is up.
+	StateUp
+	// StateStopping indicates that the onIdle trigger has been run to stop
+	// the service, but that the service may not yet be down.
+	StateStopping
+	// StateFailed indicates that the service did not come up within the
+	// StartTimeout after being started.
+	StateFailed
+)
+
+var stateNames = map[ServiceState]string{
+	StateDown:     "down",
+	StateStarting: "starting",
+	StateUp:       "up",
+	StateStopping: "stopping",
+	StateFailed:   "failed",
+}
+
+// String implements fmt.Stringer.
+func (state ServiceState) String() string {
+	if name, present := stateNames[state]; present {
+		return name
+	}
+
+	return fmt.Sprintf("unknown (%d)", int(state))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (state ServiceState) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (state *ServiceState) UnmarshalText(text []byte) error {
+	for s, name := range stateNames {
+		if name == string(text) {
+			*state = s
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown service state: %s", string(text))
+}
+
+// State returns the current state of the named service.
+func (monitor *MinMonitor) State(name string) (ServiceState, error) {
+	s, entryExists := monitor.lookup(name)
+	if !entryExists {
+		_ = log.Err(
+			fmt.Sprintf(
+				"minmonitor cannot get the state of unknown"+
+					" service: \"%s\"",
+				name,
+			),
+		)
+
+		return StateDown, UnknownServiceError
+	}
+
+	return s.State(), nil
+}
+
+// State returns the current state of the service. Unlike Status, this never
+// probes the service, so it only reflects what is already known.
+func (s *MinMonitorredService) State() ServiceState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checkTimeouts()
+	return s.state
+}
+
+// setState moves the service to the given state, starting the idle timer for
+// a service which has come up with no requests in flight. The mutex must be
+// held.
+func (s *MinMonitorredService) setState(state ServiceState) {
+	if s.state == state {
+		return
+	}
+
+	_ = log.Debug(
+		fmt.Sprintf(
+			"minmonitor moving \"%s\" from %s to %s",
+			s.URL.String(),
+			s.state.String(),
+			state.String(),
+		),
+	)
+	if s.state == StateStarting && state == StateUp {
+		timeToReady.Observe(
+			time.Since(s.stateSince).Seconds(),
+			s.displayName(),
+		)
+	}
+	s.state = state
+	s.stateSince = time.Now()
+
+	if state == StateUp && s.inFlight == 0 {
+		// A service which comes up without any request being forwarded
+		// to it (such as one started from the admin API, or as a
+		// dependency) must still become idle eventually.
+		s.lastActive = s.stateSince
+		s.armIdleTimer(s.IdleTimeout)
+	}
+}
+
+// checkTimeouts moves the service out of any state it has been in for longer
+// than that state's timeout allows. A service which has been starting for
+// longer than StartTimeout (or whose OnDown trigger has failed in the
+// background) has failed, a service which has been stopping for longer than
+// StopTimeout is assumed to be down, a service whose OnIdle trigger has failed
+// in the background is assumed to still be up, and a service which has been
+// failed for longer than FailedTimeout is treated as down so that it can be
+// started again. A timeout which is not positive never expires. The mutex must
+// be held.
+func (s *MinMonitorredService) checkTimeouts() {
+	elapsed := time.Since(s.stateSince)
+
+	switch s.state {
+	case StateStarting:
+		if s.asyncStartFailed() {
+			s.setState(StateFailed)
+		} else if s.StartTimeout > 0 && elapsed >= s.StartTimeout {
+			_ = log.Warning(
+				fmt.Sprintf(
+					"minmonitor has not seen \"%s\" come"+
+						" up within %s, marking it as"+
+						" failed",
+					s.URL.String(),
+					s.StartTimeout.String(),
+				),
+			)
+			s.setState(StateFailed)
+		}
+	case StateStopping:
+		if s.asyncStopFailed() {
+			s.setState(StateUp)
+		} else if s.StopTimeout > 0 && elapsed >= s.StopTimeout {
+			s.setState(StateDown)
+		}
+	case StateFailed:
+		if s.FailedTimeout > 0 && elapsed >= s.FailedTimeout {
+			s.setState(StateDown)
+		}
+	}
+}
+
+// asyncStartFailed determines if the OnDown trigger runs in the background
+// (such as an AsyncTrigger) and has failed since the service started starting,
+// in which case the error is recorded. The mutex must be held.
+func (s *MinMonitorredService) asyncStartFailed() bool {
+	return s.asyncFailed("onDown", s.OnDown, "marking it as failed")
+}
+
+// asyncStopFailed determines if the OnIdle trigger runs in the background
+// (such as an AsyncTrigger) and has failed since the service started stopping,
+// in which case the error is recorded. The mutex must be held.
+func (s *MinMonitorredService) asyncStopFailed() bool {
+	return s.asyncFailed("onIdle", s.OnIdle, "treating it as up")
+}
+
+// asyncFailed determines if the given trigger (with the given name) runs in
+// the background and has failed since the service moved to its current state,
+// in which case the error is recorded and logged along with the consequence.
+// The mutex must be held.
+func (s *MinMonitorredService) asyncFailed(
+	name string,
+	t trigger.Triggerrer,
+	consequence string,
+) bool {
+	r, ok := t.(trigger.StatusReporter)
+	if !ok {
+		return false
+	}
+
+	status := r.Status()
+	if status.State != trigger.AsyncFailed || status.Finished == nil ||
+		status.Finished.Before(s.stateSince) {
+		return false
+	}
+
+	_ = log.Warning(
+		fmt.Sprintf(
+			"minmonitor saw the %s trigger for \"%s\" fail in"+
+				" the background, %s: %s",
+			name,
+			s.URL.String(),
+			consequence,
+			status.Error,
+		),
+	)
+	s.lastError = status.Error
+	s.lastErrorTime = *status.Finished
+
+	return true
+}
+
+// observe updates the state of the service according to the result of a probe.
+// A service which is stopping is not considered to be up again just because it
+// has not finished stopping, unless it is still up once StopTimeout has passed
+// (in which case the OnIdle trigger evidently did not stop it). A service which
+// is starting (or has failed) is not considered to be down just because it is
+// not yet up. The mutex must be held.
+func (s *MinMonitorredService) observe(up bool) {
+	if up && s.state == StateStopping && s.StopTimeout > 0 &&
+		time.Since(s.stateSince) >= s.StopTimeout {
+		_ = log.Warning(
+			fmt.Sprintf(
+				"minmonitor still found \"%s\" up %s after"+
+					" stopping it, treating it as up",
+				s.URL.String(),
+				s.StopTimeout.String(),
+			),
+		)
+		s.setState(StateUp)
+	}
+	s.checkTimeouts()
+
+	if up {
+		if s.state != StateStopping {
+			s.setState(StateUp)
+		}
+	} else if s.state == StateUp || s.state == StateStopping {
+		s.setState(StateDown)
+	}
+}
+
+// Start starts the named service by running its OnDown trigger (see
+// MinMonitorredService.Start).
+func (monitor *MinMonitor) Start(name string) error {
+	s, entryExists := monitor.lookup(name)
+	if !entryExists {
+		_ = log.Err(
+			fmt.Sprintf(
+				"minmonitor cannot start unknown service: \"%s\"",
+				name,
+			),
+		)
+
+		return UnknownServiceError
+	}
+
+	return s.Start()
+}
+
+// Stop stops the named service by running its OnIdle trigger (see
+// MinMonitorredService.Stop).
+func (monitor *MinMonitor) Stop(name string) error {
+	s, entryExists := monitor.lookup(name)
+	if !entryExists {
+		_ = log.Err(
+			fmt.Sprintf(
+				"minmonitor cannot stop unknown service: \"%s\"",
+				name,
+			),
+		)
+
+		return UnknownServiceError
+	}
+
+	return s.Stop()
+}
+
+// Start runs the OnDown trigger to start the service if it is down (or has
+// failed to start), in which case the service will be starting. Nothing is
+// done for a service which is in any other state.
+func (s *MinMonitorredService) Start() error {
+	s.mutex.Lock()
+	s.checkTimeouts()
+	if s.state != StateDown && s.state != StateFailed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.setState(StateStarting)
+	s.mutex.Unlock()
+
+	_ = log.Notice(
+		fmt.Sprintf(
+			"minmonitor has been explicitly asked to start: \"%s\"",
+			s.URL.String(),
+		),
+	)
+
+	return s.runOnDown(nil)
+}
+
+// Stop runs the OnIdle trigger to stop the service if it is up (or starting),
+// in which case the service will be stopping. Nothing is done for a service
+// which is in any other state, and NoTriggerError is returned if the service
+// has no OnIdle trigger.
+func (s *MinMonitorredService) Stop() error {
+	if s.OnIdle == nil {
+		return NoTriggerError
+	}
+
+	s.mutex.Lock()
+	s.checkTimeouts()
+	previous := s.state
+	if previous != StateUp && previous != StateStarting {
+		s.mutex.Unlock()
+		return nil
+	}
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	s.setState(StateStopping)
+	s.mutex.Unlock()
+
+	_ = log.Notice(
+		fmt.Sprintf(
+			"minmonitor has been explicitly asked to stop: \"%s\"",
+			s.URL.String(),
+		),
+	)
+
+	return s.runOnIdle(previous)
+}
+
+// runOnDown runs the OnDown trigger for a service which has just been moved to
+// starting (due to the given request, if any), moving it back to down if the
+// trigger fails so that the next attempt to start the service will run the
+// trigger again. A service with dependencies is instead started in the
+// background (see startWithDependencies).
+func (s *MinMonitorredService) runOnDown(req *http.Request) error {
+	if len(s.DependsOn) > 0 {
+		s.startWithDependencies(req)
+		return nil
+	}
+
+	return s.runOnDownTrigger(req)
+}
+
+// runOnDownTrigger runs the OnDown trigger as described for runOnDown.
+func (s *MinMonitorredService) runOnDownTrigger(req *http.Request) error {
+	if s.OnDown == nil {
+		return nil
+	}
+
+	_ = log.Debug("minmonitor running down trigger")
+	if err := s.runTrigger("ondown", s.OnDown, req); err != nil {
+		s.mutex.Lock()
+		if s.state == StateStarting {
+			s.setState(StateDown)
+		}
+		s.mutex.Unlock()
+		return err
+	}
+	_ = log.Debug("minmonitor completed down trigger")
+
+	return nil
+}
@@ -0,0 +1,365 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stuphlabs/pullcord/trigger"
+)
+
+func getStateService(
+	t *testing.T,
+	up bool,
+) (*MinMonitorredService, *scriptedProber, *counterTriggerrer) {
+	u, err := getDownService(t)
+	require.NoError(t, err)
+
+	onDown := &counterTriggerrer{}
+	svc, err := NewMinMonitorredService(
+		u,
+		time.Duration(0),
+		onDown,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	p := &scriptedProber{}
+	p.set(up)
+	svc.Prober = p
+
+	return svc, p, onDown
+}
+
+func serveStateRequest(t *testing.T, svc *MinMonitorredService) (int, string) {
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	response := recorder.Result()
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+
+	return response.StatusCode, string(contents)
+}
+
+// TestStateOnDownDeduplicated verifies that the onDown trigger is only run once
+// while a service is starting, no matter how many requests arrive.
+func TestStateOnDownDeduplicated(t *testing.T) {
+	svc, _, onDown := getStateService(t, false)
+	assert.Equal(t, StateDown, svc.State())
+
+	for i := 0; i < 3; i++ {
+		code, _ := serveStateRequest(t, svc)
+		assert.Equal(t, 503, code)
+	}
+
+	assert.Equal(t, 1, onDown.count)
+	assert.Equal(t, StateStarting, svc.State())
+}
+
+// TestStateOnDownError verifies that a service whose onDown trigger fails is
+// still considered down, so that the next request tries to start it again.
+func TestStateOnDownError(t *testing.T) {
+	svc, _, onDown := getStateService(t, false)
+	onDown.count = -1
+
+	code, _ := serveStateRequest(t, svc)
+	assert.Equal(t, 500, code)
+	assert.Equal(t, StateDown, svc.State())
+}
+
+// TestStateAsyncOnDownFailure verifies that a service whose onDown trigger
+// fails in the background is marked as failed, with the error (and the status
+// of the trigger) reported by Info.
+func TestStateAsyncOnDownFailure(t *testing.T) {
+	svc, _, onDown := getStateService(t, false)
+	onDown.count = -1
+	async := trigger.NewAsyncTrigger(onDown)
+	svc.OnDown = async
+
+	code, _ := serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	async.Wait()
+
+	assert.Equal(t, StateFailed, svc.State())
+	info := svc.Info()
+	assert.Equal(t, "this trigger always errors", info.LastError)
+	require.Contains(t, info.AsyncTriggers, "ondown")
+	assert.Equal(t, trigger.AsyncFailed, info.AsyncTriggers["ondown"].State)
+}
+
+// cancelledTriggerrer is a Triggerrer which does not finish until its context
+// has been cancelled.
+type cancelledTriggerrer struct {
+	started chan struct{}
+}
+
+func (c *cancelledTriggerrer) Trigger(
+	ctx context.Context,
+	e trigger.Event,
+) (string, error) {
+	close(c.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// TestStateStopBackgroundCancelsTriggers verifies that stopping a service
+// cancels any of its triggers which are still running.
+func TestStateStopBackgroundCancelsTriggers(t *testing.T) {
+	svc, _, _ := getStateService(t, false)
+	onDown := &cancelledTriggerrer{started: make(chan struct{})}
+	svc.OnDown = onDown
+
+	result := make(chan error)
+	go func() {
+		result <- svc.Start()
+	}()
+
+	<-onDown.started
+	assert.Equal(t, StateStarting, svc.State())
+	require.NoError(t, svc.StopBackground())
+	assert.Equal(t, context.Canceled, <-result)
+	assert.Equal(t, StateDown, svc.State())
+}
+
+// TestStateStartTimeout verifies that a service which does not come up within
+// the start timeout is marked as failed, and that it is started again once the
+// failed timeout has passed.
+func TestStateStartTimeout(t *testing.T) {
+	svc, p, onDown := getStateService(t, false)
+	svc.StartTimeout = 20 * time.Millisecond
+	svc.FailedTimeout = 100 * time.Millisecond
+
+	code, _ := serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, StateStarting, svc.State())
+
+	time.Sleep(2 * svc.StartTimeout)
+	assert.Equal(t, StateFailed, svc.State())
+
+	code, contents := serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Contains(t, contents, "Service Unavailable")
+	assert.Equal(t, 1, onDown.count)
+
+	time.Sleep(svc.FailedTimeout)
+	assert.Equal(t, StateDown, svc.State())
+
+	code, _ = serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, 2, onDown.count)
+	assert.Equal(t, StateStarting, svc.State())
+
+	p.set(true)
+	up, err := svc.Status()
+	assert.NoError(t, err)
+	assert.True(t, up)
+	assert.Equal(t, StateUp, svc.State())
+}
+
+// TestStateDefaultStartTimeout verifies that a service whose OnDown trigger
+// succeeds but which never comes up is not left starting forever when no
+// timeouts have been given, but is instead started again eventually.
+func TestStateDefaultStartTimeout(t *testing.T) {
+	svc, _, onDown := getStateService(t, false)
+	assert.Equal(t, DefaultStartTimeout, svc.StartTimeout)
+	assert.Equal(t, DefaultStopTimeout, svc.StopTimeout)
+	assert.Equal(t, DefaultFailedTimeout, svc.FailedTimeout)
+
+	code, _ := serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, 1, onDown.count)
+	assert.Equal(t, StateStarting, svc.State())
+
+	// Requests while the service is starting do not start it again.
+	code, _ = serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, 1, onDown.count)
+
+	svc.mutex.Lock()
+	svc.stateSince = svc.stateSince.Add(-DefaultStartTimeout)
+	svc.mutex.Unlock()
+	assert.Equal(t, StateFailed, svc.State())
+
+	svc.mutex.Lock()
+	svc.stateSince = svc.stateSince.Add(-DefaultFailedTimeout)
+	svc.mutex.Unlock()
+	assert.Equal(t, StateDown, svc.State())
+
+	code, _ = serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, 2, onDown.count)
+	assert.Equal(t, StateStarting, svc.State())
+
+	var fromConfig MinMonitorredService
+	require.NoError(
+		t,
+		json.Unmarshal(
+			[]byte(`{
+				"url": "http://127.0.0.1:8080/",
+				"graceperiod": "1s"
+			}`),
+			&fromConfig,
+		),
+	)
+	assert.Equal(t, DefaultStartTimeout, fromConfig.StartTimeout)
+	assert.Equal(t, DefaultStopTimeout, fromConfig.StopTimeout)
+	assert.Equal(t, DefaultFailedTimeout, fromConfig.FailedTimeout)
+
+	require.NoError(
+		t,
+		json.Unmarshal(
+			[]byte(`{
+				"url": "http://127.0.0.1:8080/",
+				"graceperiod": "1s",
+				"starttimeout": "0s",
+				"stoptimeout": "0s",
+				"failedtimeout": "0s"
+			}`),
+			&fromConfig,
+		),
+	)
+	assert.Equal(t, time.Duration(0), fromConfig.StartTimeout)
+	assert.Equal(t, time.Duration(0), fromConfig.StopTimeout)
+	assert.Equal(t, time.Duration(0), fromConfig.FailedTimeout)
+}
+
+// TestStateStopping verifies that a service which is stopping is not treated as
+// up even if it still responds to probes, and that it is treated as down once
+// it no longer does.
+func TestStateStopping(t *testing.T) {
+	svc, p, onDown := getStateService(t, true)
+
+	up, err := svc.Status()
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	svc.mutex.Lock()
+	svc.setState(StateStopping)
+	svc.mutex.Unlock()
+
+	up, err = svc.Reprobe()
+	assert.NoError(t, err)
+	assert.False(t, up)
+	assert.Equal(t, StateStopping, svc.State())
+
+	code, _ := serveStateRequest(t, svc)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, 0, onDown.count)
+
+	p.set(false)
+	up, err = svc.Reprobe()
+	assert.NoError(t, err)
+	assert.False(t, up)
+	assert.Equal(t, StateDown, svc.State())
+}
+
+// TestStateStopTimeout verifies that a service which has been stopping for
+// longer than the stop timeout is treated as down.
+func TestStateStopTimeout(t *testing.T) {
+	svc, _, _ := getStateService(t, true)
+	svc.StopTimeout = 20 * time.Millisecond
+
+	svc.mutex.Lock()
+	svc.setState(StateStopping)
+	svc.mutex.Unlock()
+	assert.Equal(t, StateStopping, svc.State())
+
+	time.Sleep(2 * svc.StopTimeout)
+	assert.Equal(t, StateDown, svc.State())
+}
+
+// TestStateStopIneffective verifies that a service which is still up once it
+// has been stopping for longer than the stop timeout (such as one whose OnIdle
+// trigger did nothing) is treated as up again, rather than as down.
+func TestStateStopIneffective(t *testing.T) {
+	svc, _, _ := getStateService(t, true)
+	svc.StopTimeout = 20 * time.Millisecond
+
+	up, err := svc.Status()
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	svc.mutex.Lock()
+	svc.setState(StateStopping)
+	svc.mutex.Unlock()
+
+	up, err = svc.Reprobe()
+	assert.NoError(t, err)
+	assert.False(t, up)
+	assert.Equal(t, StateStopping, svc.State())
+
+	time.Sleep(2 * svc.StopTimeout)
+	up, err = svc.Reprobe()
+	assert.NoError(t, err)
+	assert.True(t, up)
+	assert.Equal(t, StateUp, svc.State())
+}
+
+// TestStateAsyncOnIdleFailure verifies that a service whose OnIdle trigger
+// fails in the background is treated as up again, with the error (and the
+// status of the trigger) reported by Info.
+func TestStateAsyncOnIdleFailure(t *testing.T) {
+	svc, _, _ := getStateService(t, true)
+	onIdle := &counterTriggerrer{count: -1}
+	async := trigger.NewAsyncTrigger(onIdle)
+	svc.OnIdle = async
+
+	up, err := svc.Status()
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	svc.mutex.Lock()
+	svc.setState(StateStopping)
+	svc.mutex.Unlock()
+	require.NoError(t, svc.runOnIdle(StateUp))
+	async.Wait()
+
+	assert.Equal(t, StateUp, svc.State())
+	info := svc.Info()
+	assert.Equal(t, "this trigger always errors", info.LastError)
+	require.Contains(t, info.AsyncTriggers, "onidle")
+	assert.Equal(t, trigger.AsyncFailed, info.AsyncTriggers["onidle"].State)
+}
+
+func TestMinMonitorState(t *testing.T) {
+	svc, _, _ := getStateService(t, true)
+
+	monitor := NewMinMonitor()
+	assert.NoError(t, monitor.Add("test", svc))
+
+	state, err := monitor.State("test")
+	assert.NoError(t, err)
+	assert.Equal(t, StateDown, state)
+
+	_, err = monitor.Status("test")
+	assert.NoError(t, err)
+	state, err = monitor.State("test")
+	assert.NoError(t, err)
+	assert.Equal(t, StateUp, state)
+
+	_, err = monitor.State("nonexistent")
+	assert.Equal(t, UnknownServiceError, err)
+}
+
+func TestServiceStateString(t *testing.T) {
+	assert.Equal(t, "starting", StateStarting.String())
+	assert.Equal(t, "unknown (42)", ServiceState(42).String())
+
+	b, err := json.Marshal(StateFailed)
+	assert.NoError(t, err)
+	assert.Equal(t, `"failed"`, string(b))
+}
+
+func TestServiceStateUnmarshal(t *testing.T) {
+	var state ServiceState
+	assert.NoError(t, json.Unmarshal([]byte(`"stopping"`), &state))
+	assert.Equal(t, StateStopping, state)
+
+	assert.Error(t, json.Unmarshal([]byte(`"sideways"`), &state))
+}
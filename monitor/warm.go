@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/proidiot/gone/log"
+)
+
+// keepWarm determines if the given time is in any of the KeepWarm windows of
+// the service, along with when the last of those windows ends.
+func (s *MinMonitorredService) keepWarm(
+	t time.Time,
+) (warm bool, end time.Time) {
+	for _, w := range s.KeepWarm {
+		if active, e := w.Active(t); active {
+			warm = true
+			if e.After(end) {
+				end = e
+			}
+		}
+	}
+
+	return warm, end
+}
+
+// nextWarmUp gives the first time after the given time that any of the
+// KeepWarm windows of the service begins, or the zero time if none of them
+// will ever begin.
+func (s *MinMonitorredService) nextWarmUp(after time.Time) (next time.Time) {
+	for _, w := range s.KeepWarm {
+		n := w.NextStart(after)
+		if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+
+	return next
+}
+
+// warmLoop starts the service each time one of its KeepWarm windows begins
+// (including a window which has already begun), and allows the service to
+// become idle again each time the windows end, until stopChan is closed.
+func (s *MinMonitorredService) warmLoop(stopChan <-chan struct{}) {
+	wasWarm := false
+	for {
+		now := time.Now()
+		warm, wake := s.keepWarm(now)
+		if warm {
+			s.warmUp()
+		} else {
+			if wasWarm {
+				s.coolDown()
+			}
+			wake = s.nextWarmUp(now)
+		}
+		wasWarm = warm
+
+		if wake.IsZero() {
+			<-stopChan
+			return
+		}
+
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// warmUp starts the service for one of its KeepWarm windows unless it is
+// already up. Since the service may then have no requests until after the
+// window has ended, it is checked for idleness later as if it had just
+// finished a request.
+func (s *MinMonitorredService) warmUp() {
+	up, err := s.Status()
+	if err != nil {
+		_ = log.Warning(
+			fmt.Sprintf(
+				"minmonitor could not determine the status of"+
+					" \"%s\" to keep it warm: %v",
+				s.URL.String(),
+				err,
+			),
+		)
+		return
+	}
+
+	if !up {
+		_ = log.Notice(
+			fmt.Sprintf(
+				"minmonitor is starting \"%s\" to keep it warm",
+				s.URL.String(),
+			),
+		)
+
+		if err = s.Start(); err != nil {
+			_ = log.Err(
+				fmt.Sprintf(
+					"minmonitor received an error while"+
+						" starting \"%s\" to keep it"+
+						" warm: %v",
+					s.URL.String(),
+					err,
+				),
+			)
+		}
+	}
+
+	s.coolDown()
+}
+
+// coolDown starts the idle timer of the service unless a request is in
+// flight, so that the service will be stopped if it stays idle once it is no
+// longer being kept warm.
+func (s *MinMonitorredService) coolDown() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.inFlight == 0 {
+		s.armIdleTimer(s.IdleTimeout)
+	}
+}
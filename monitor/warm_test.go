@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stuphlabs/pullcord/schedule"
+)
+
+func getWindow(
+	t *testing.T,
+	expr string,
+	duration time.Duration,
+) *schedule.Window {
+	s, err := schedule.NewSchedule(expr, "")
+	require.NoError(t, err)
+
+	return &schedule.Window{Schedule: s, Duration: duration}
+}
+
+// TestKeepWarmStart verifies that a service is started through the usual
+// states once one of its keep-warm windows has begun.
+func TestKeepWarmStart(t *testing.T) {
+	svc, p, _ := getStateService(t, false)
+	started := make(chan struct{}, 1)
+	svc.OnDown = funcTriggerrer(
+		func() error {
+			started <- struct{}{}
+			return nil
+		},
+	)
+	// A window begins every minute and lasts for an hour, so the service
+	// is always being kept warm.
+	svc.KeepWarm = []*schedule.Window{getWindow(t, "* * * * *", time.Hour)}
+
+	require.NoError(t, svc.StartBackground())
+	defer func() {
+		assert.NoError(t, svc.StopBackground())
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the onDown trigger was never run")
+	}
+
+	assert.Equal(t, StateStarting, svc.State())
+	assert.True(t, p.probes() > 0)
+
+	info := svc.Info()
+	assert.True(t, info.KeepWarm)
+	assert.NotNil(t, info.NextWarmUp)
+}
+
+// TestKeepWarmUnused verifies that a service is not started while it is not in
+// any of its keep-warm windows.
+func TestKeepWarmUnused(t *testing.T) {
+	svc, _, onDown := getStateService(t, false)
+	svc.KeepWarm = []*schedule.Window{
+		getWindow(t, "0 0 30 2 *", time.Hour),
+	}
+
+	require.NoError(t, svc.StartBackground())
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, svc.StopBackground())
+
+	assert.Equal(t, 0, onDown.count)
+	assert.Equal(t, StateDown, svc.State())
+
+	info := svc.Info()
+	assert.False(t, info.KeepWarm)
+	assert.Nil(t, info.NextWarmUp)
+}
+
+// TestKeepWarmIdle verifies that a service is not considered idle until its
+// keep-warm window has ended.
+func TestKeepWarmIdle(t *testing.T) {
+	u, s, err := getUpService(t)
+	require.NoError(t, err)
+	defer recycleUpService(s)
+
+	idled := make(chan time.Time, 1)
+	svc := getIdleService(
+		t,
+		u,
+		func() error {
+			idled <- time.Now()
+			return nil
+		},
+	)
+
+	// The window began at the start of this minute, and ends shortly.
+	now := time.Now().UTC()
+	start := now.Truncate(time.Minute)
+	end := now.Add(8 * svc.IdleTimeout)
+	svc.KeepWarm = []*schedule.Window{
+		getWindow(
+			t,
+			fmt.Sprintf("%d %d * * *", start.Minute(), start.Hour()),
+			end.Sub(start),
+		),
+	}
+
+	recorder := httptest.NewRecorder()
+	svc.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 200, recorder.Result().StatusCode)
+
+	select {
+	case when := <-idled:
+		assert.False(t, when.Before(end), "idle before the window ended")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the onIdle trigger was never run")
+	}
+
+	assert.Equal(t, StateStopping, svc.State())
+}
@@ -0,0 +1,179 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// DefaultBannerProbeTimeout is the amount of time a BannerProbe will wait for
+// the expected banner if no other timeout has been specified.
+const DefaultBannerProbeTimeout = 10 * time.Second
+
+// maxBannerSize is the most a BannerProbe will read while looking for the
+// expected banner.
+const maxBannerSize = 64 * 1024
+
+// BannerProbe is a Prober that opens a TCP connection to the host and port of
+// the target (in the same way as a TCPProbe), optionally sends some data, and
+// then waits for the service to respond with an expected banner. The service
+// is considered up once the data received contains Expect and matches
+// ExpectRegexp (whichever of the two have been given). This is useful for
+// services such as SSH, SMTP, or FTP which greet a new connection, as well as
+// for simple line-based health checks.
+type BannerProbe struct {
+	Send         string
+	Expect       string
+	ExpectRegexp *regexp.Regexp
+	Timeout      time.Duration
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"bannerprobe",
+		func() json.Unmarshaler {
+			return new(BannerProbe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *BannerProbe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Send         string
+		Expect       string
+		ExpectRegexp string
+		Timeout      string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Expect == "" && t.ExpectRegexp == "" {
+		return errors.New(
+			"bannerprobe requires at least one of expect or" +
+				" expectregexp",
+		)
+	}
+
+	p.Send = t.Send
+	p.Expect = t.Expect
+
+	p.ExpectRegexp = nil
+	if t.ExpectRegexp != "" {
+		r, e := regexp.Compile(t.ExpectRegexp)
+		if e != nil {
+			return e
+		}
+		p.ExpectRegexp = r
+	}
+
+	p.Timeout = 0
+	if t.Timeout != "" {
+		d, e := time.ParseDuration(t.Timeout)
+		if e != nil {
+			return e
+		}
+		p.Timeout = d
+	}
+
+	return nil
+}
+
+func (p *BannerProbe) matches(banner []byte) bool {
+	if p.Expect != "" && !bytes.Contains(banner, []byte(p.Expect)) {
+		return false
+	}
+
+	if p.ExpectRegexp != nil && !p.ExpectRegexp.Match(banner) {
+		return false
+	}
+
+	return true
+}
+
+// Probe implements Prober.
+func (p *BannerProbe) Probe(target *url.URL) (up bool, err error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultBannerProbeTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	conn, err := dial(target, timeout)
+	if conn == nil {
+		return false, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if err = conn.SetDeadline(deadline); err != nil {
+		return false, err
+	}
+
+	if p.Send != "" {
+		if _, err = conn.Write([]byte(p.Send)); err != nil {
+			_ = log.Info(
+				fmt.Sprintf(
+					"bannerprobe was unable to send to"+
+						" \"%s\" (interpereted as a"+
+						" down status): %v",
+					target.String(),
+					err,
+				),
+			)
+			return false, nil
+		}
+	}
+
+	var banner []byte
+	buf := make([]byte, 4096)
+	for len(banner) < maxBannerSize {
+		n, rerr := conn.Read(buf)
+		banner = append(banner, buf[:n]...)
+		if p.matches(banner) {
+			_ = log.Info(
+				fmt.Sprintf(
+					"bannerprobe successfully probed:"+
+						" \"%s\"",
+					target.String(),
+				),
+			)
+			return true, nil
+		}
+
+		if rerr != nil {
+			_ = log.Info(
+				fmt.Sprintf(
+					"bannerprobe did not receive the"+
+						" expected banner from \"%s\""+
+						" (interpereted as a down"+
+						" status): %v",
+					target.String(),
+					rerr,
+				),
+			)
+			return false, nil
+		}
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"bannerprobe received too much data without the"+
+				" expected banner from \"%s\" (interpereted as"+
+				" a down status)",
+			target.String(),
+		),
+	)
+	return false, nil
+}
@@ -0,0 +1,149 @@
+package probe
+
+import (
+	"bufio"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+func serveBanner(l net.Listener, banner string) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(c net.Conn) {
+			defer func() {
+				_ = c.Close()
+			}()
+
+			if banner != "" {
+				_, _ = c.Write([]byte(banner))
+				return
+			}
+
+			line, err := bufio.NewReader(c).ReadString('\n')
+			if err == nil {
+				_, _ = c.Write([]byte("echo " + line))
+			}
+		}(c)
+	}
+}
+
+func TestBannerProbeGreeting(t *testing.T) {
+	l, u := getListener(t)
+	defer func() {
+		_ = l.Close()
+	}()
+	go serveBanner(l, "SSH-2.0-OpenSSH_7.4\r\n")
+
+	p := &BannerProbe{Expect: "SSH-2.0"}
+	up, err := p.Probe(u)
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	p = &BannerProbe{ExpectRegexp: regexp.MustCompile("^220 ")}
+	up, err = p.Probe(u)
+	assert.NoError(t, err)
+	assert.False(t, up)
+}
+
+func TestBannerProbeSend(t *testing.T) {
+	l, u := getListener(t)
+	defer func() {
+		_ = l.Close()
+	}()
+	go serveBanner(l, "")
+
+	p := &BannerProbe{
+		Send:         "PING\n",
+		ExpectRegexp: regexp.MustCompile("^echo PING"),
+	}
+	up, err := p.Probe(u)
+	assert.NoError(t, err)
+	assert.True(t, up)
+}
+
+func TestBannerProbeSilent(t *testing.T) {
+	l, u := getListener(t)
+	defer func() {
+		_ = l.Close()
+	}()
+
+	p := &BannerProbe{
+		Expect:  "anything",
+		Timeout: 200 * time.Millisecond,
+	}
+	up, err := p.Probe(u)
+	assert.NoError(t, err)
+	assert.False(t, up)
+}
+
+func TestBannerProbeDown(t *testing.T) {
+	p := &BannerProbe{Expect: "anything", Timeout: time.Second}
+	up, err := p.Probe(getDownTarget(t))
+	assert.NoError(t, err)
+	assert.False(t, up)
+}
+
+func TestBannerProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "bannerprobe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "{}",
+				Explanation: "empty object",
+			},
+			{
+				Data:        "null",
+				Explanation: "null config",
+			},
+			{
+				Data: `{
+					"expect": 42
+				}`,
+				Explanation: "numeric expect",
+			},
+			{
+				Data: `{
+					"expectregexp": "("
+				}`,
+				Explanation: "invalid regexp",
+			},
+			{
+				Data: `{
+					"expect": "+OK",
+					"timeout": "42q"
+				}`,
+				Explanation: "nonsensical timeout",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"expect": "SSH-2.0"
+				}`,
+				Explanation: "basic banner probe",
+			},
+			{
+				Data: `{
+					"send": "PING\r\n",
+					"expectregexp": "^\\+PONG",
+					"timeout": "3s"
+				}`,
+				Explanation: "valid banner probe",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -0,0 +1,3 @@
+// Package probe provides mechanisms for determining whether a remote service
+// is ready to handle requests
+package probe
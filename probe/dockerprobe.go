@@ -0,0 +1,126 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/docker"
+)
+
+// DockerProbe is a Prober that asks the Docker Engine for the state of a
+// container rather than checking the target itself. The service is considered
+// up if the container is running (and is neither paused nor restarting), and,
+// if the container has a health check, the container is healthy (unless
+// IgnoreHealth is set). A container which does not exist is considered down,
+// while a Docker Engine which cannot be reached results in an error.
+type DockerProbe struct {
+	Client       *docker.Client
+	Container    string
+	IgnoreHealth bool
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"dockerprobe",
+		func() json.Unmarshaler {
+			return new(DockerProbe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *DockerProbe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Host         string
+		APIVersion   string
+		Container    string
+		IgnoreHealth bool
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Container == "" {
+		return errors.New("dockerprobe requires a container")
+	}
+
+	c, e := docker.NewClient(t.Host, t.APIVersion)
+	if e != nil {
+		return e
+	}
+
+	p.Client = c
+	p.Container = t.Container
+	p.IgnoreHealth = t.IgnoreHealth
+
+	return nil
+}
+
+// Probe implements Prober.
+func (p *DockerProbe) Probe(target *url.URL) (up bool, err error) {
+	state, err := p.Client.Inspect(
+		context.Background(),
+		p.Container,
+	)
+	if err == docker.NoSuchContainerError {
+		_ = log.Info(
+			fmt.Sprintf(
+				"dockerprobe found no container (interpereted"+
+					" as a down status): %s",
+				p.Container,
+			),
+		)
+		return false, nil
+	} else if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"dockerprobe was unable to inspect container"+
+					" %s: %v",
+				p.Container,
+				err,
+			),
+		)
+		return false, err
+	}
+
+	if !state.Running || state.Paused || state.Restarting {
+		_ = log.Info(
+			fmt.Sprintf(
+				"dockerprobe found container %s in state"+
+					" (interpereted as a down status): %s",
+				p.Container,
+				state.Status,
+			),
+		)
+		return false, nil
+	}
+
+	if !p.IgnoreHealth && state.Health != nil &&
+		state.Health.Status != "healthy" {
+		_ = log.Info(
+			fmt.Sprintf(
+				"dockerprobe found container %s with health"+
+					" (interpereted as a down status): %s",
+				p.Container,
+				state.Health.Status,
+			),
+		)
+		return false, nil
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"dockerprobe found container running: %s",
+			p.Container,
+		),
+	)
+	return true, nil
+}
@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/docker"
+	"github.com/stuphlabs/pullcord/docker/dockertest"
+)
+
+func TestDockerProbe(t *testing.T) {
+	e, err := dockertest.NewEngine()
+	require.NoError(t, err)
+	defer func() {
+		_ = e.Close()
+	}()
+
+	c, err := docker.NewClient(e.Host, "")
+	require.NoError(t, err)
+	p := &DockerProbe{Client: c, Container: "wiki"}
+
+	up, err := p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	e.SetContainer("wiki", docker.ContainerState{Status: "exited"})
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	e.SetContainer(
+		"wiki",
+		docker.ContainerState{Status: "running", Running: true},
+	)
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	e.SetContainer(
+		"wiki",
+		docker.ContainerState{
+			Status:  "running",
+			Running: true,
+			Paused:  true,
+		},
+	)
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	e.SetContainer(
+		"wiki",
+		docker.ContainerState{
+			Status:  "running",
+			Running: true,
+			Health:  &docker.Health{Status: "starting"},
+		},
+	)
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	p.IgnoreHealth = true
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	require.NoError(t, e.Close())
+	_, err = p.Probe(nil)
+	assert.Error(t, err)
+}
+
+func TestDockerProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "dockerprobe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "{}",
+				Explanation: "missing container",
+			},
+			{
+				Data: `{
+					"host": "ftp://127.0.0.1",
+					"container": "wiki"
+				}`,
+				Explanation: "unsupported host",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"container": "wiki"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"host": "unix:///run/docker.sock",
+					"apiversion": "1.41",
+					"container": "wiki",
+					"ignorehealth": true
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
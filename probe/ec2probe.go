@@ -0,0 +1,138 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// EC2Probe is a Prober that asks the EC2 API (or an EC2-compatible API) for the
+// state of an instance rather than checking the target itself. The service is
+// considered up if the instance is running. If a Next Prober is given, a
+// running instance is only considered up if Next also finds the target to be
+// up (such as an HTTPProbe of a service which takes time to start after its
+// instance is running), and Next is not run at all while the instance is not
+// running.
+type EC2Probe struct {
+	Client   *aws.EC2
+	Instance string
+	Next     Prober
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"ec2probe",
+		func() json.Unmarshaler {
+			return new(EC2Probe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *EC2Probe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Region           string
+		Endpoint         string
+		AccessKeyID      string
+		SecretAccessKey  string
+		SessionToken     string
+		MetadataEndpoint string
+		Instance         string
+		Next             *config.Resource
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Instance == "" {
+		return errors.New("ec2probe requires an instance")
+	}
+
+	if (t.AccessKeyID == "") != (t.SecretAccessKey == "") {
+		return errors.New(
+			"ec2probe requires an access key ID and secret access" +
+				" key to be given together",
+		)
+	}
+
+	p.Next = nil
+	if t.Next != nil && t.Next.Unmarshalled != nil {
+		next, ok := t.Next.Unmarshalled.(Prober)
+		if !ok {
+			_ = log.Err(
+				fmt.Sprintf(
+					"Registry value is not a Prober: %#v",
+					t.Next,
+				),
+			)
+			return config.UnexpectedResourceType
+		}
+		p.Next = next
+	}
+
+	c := aws.NewEC2(t.Region)
+	c.Endpoint = t.Endpoint
+	c.Credentials = aws.Credentials{
+		AccessKeyID:     t.AccessKeyID,
+		SecretAccessKey: t.SecretAccessKey,
+		SessionToken:    t.SessionToken,
+	}
+	c.Metadata = aws.NewInstanceMetadata(t.MetadataEndpoint)
+
+	p.Client = c
+	p.Instance = t.Instance
+
+	return nil
+}
+
+// Probe implements Prober.
+func (p *EC2Probe) Probe(target *url.URL) (up bool, err error) {
+	states, err := p.Client.DescribeInstances(
+		context.Background(),
+		p.Instance,
+	)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"ec2probe was unable to describe instance %s:"+
+					" %v",
+				p.Instance,
+				err,
+			),
+		)
+		return false, err
+	}
+
+	if state := states[p.Instance]; state != aws.InstanceRunning {
+		_ = log.Info(
+			fmt.Sprintf(
+				"ec2probe found instance %s in state"+
+					" (interpereted as a down status): %s",
+				p.Instance,
+				state,
+			),
+		)
+		return false, nil
+	}
+
+	if p.Next != nil {
+		return p.Next.Probe(target)
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"ec2probe found instance running: %s",
+			p.Instance,
+		),
+	)
+	return true, nil
+}
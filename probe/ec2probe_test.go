@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/aws/awstest"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+// fixedProbe is a Prober which always gives the same result, counting the
+// number of times it has been run.
+type fixedProbe struct {
+	up   bool
+	runs int
+}
+
+func (f *fixedProbe) Probe(_ *url.URL) (bool, error) {
+	f.runs++
+	return f.up, nil
+}
+
+func TestEC2Probe(t *testing.T) {
+	f := awstest.NewEC2()
+	defer f.Close()
+	f.SetInstance("i-0123", aws.InstanceStopped)
+
+	c := aws.NewEC2("us-west-2")
+	c.Endpoint = f.URL
+	c.Credentials = aws.Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	}
+	c.Metadata = nil
+	p := &EC2Probe{Client: c, Instance: "i-0123"}
+
+	up, err := p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	f.SetInstance("i-0123", aws.InstanceRunning)
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	next := &fixedProbe{}
+	p.Next = next
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+	next.up = true
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.True(t, up)
+	assert.Equal(t, 2, next.runs)
+
+	f.SetInstance("i-0123", aws.InstanceStopping)
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+	assert.Equal(t, 2, next.runs)
+
+	p.Instance = "i-4567"
+	up, err = p.Probe(nil)
+	require.Error(t, err)
+	assert.False(t, up)
+}
+
+func TestEC2ProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "ec2probe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data:        `{}`,
+				Explanation: "missing instance",
+			},
+			{
+				Data: `{
+					"instance": "i-0123",
+					"accesskeyid": "x"
+				}`,
+				Explanation: "access key without secret",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"instance": "i-0123"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"region": "us-east-1",
+					"endpoint": "http://localhost:4566/",
+					"metadataendpoint": "http://localhost:1338",
+					"accesskeyid": "x",
+					"secretaccesskey": "y",
+					"instance": "i-0123",
+					"next": {
+						"type": "httpprobe",
+						"data": {}
+					}
+				}`,
+				Explanation: "full config with next prober",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// DefaultExecProbeTimeout is the amount of time an ExecProbe will allow its
+// command to run if no other timeout has been specified.
+const DefaultExecProbeTimeout = 30 * time.Second
+
+// ExecProbe is a Prober that runs a command (along with arguments) and
+// considers the service to be up if the command exits successfully. A
+// command which exits with a non-zero status (or which runs longer than the
+// timeout) indicates that the service is down, while a command which cannot be
+// run at all results in an error.
+//
+// The URL of the target is given to the command in the PULLCORD_PROBE_TARGET
+// environment variable.
+type ExecProbe struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"execprobe",
+		func() json.Unmarshaler {
+			return new(ExecProbe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *ExecProbe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Command string
+		Args    []string
+		Timeout string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Command == "" {
+		return errors.New("execprobe requires a command")
+	}
+
+	p.Command = t.Command
+	p.Args = t.Args
+
+	p.Timeout = 0
+	if t.Timeout != "" {
+		d, e := time.ParseDuration(t.Timeout)
+		if e != nil {
+			return e
+		}
+		p.Timeout = d
+	}
+
+	return nil
+}
+
+// Probe implements Prober.
+func (p *ExecProbe) Probe(target *url.URL) (up bool, err error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExecProbeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Env = append(
+		os.Environ(),
+		"PULLCORD_PROBE_TARGET="+target.String(),
+	)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	_ = log.Debug(
+		fmt.Sprintf(
+			"execprobe command wrote: %s",
+			output.String(),
+		),
+	)
+
+	if err == nil {
+		_ = log.Info(
+			fmt.Sprintf(
+				"execprobe successfully probed: \"%s\"",
+				target.String(),
+			),
+		)
+		return true, nil
+	}
+
+	if _, ok := err.(*exec.ExitError); ok || ctx.Err() != nil {
+		_ = log.Info(
+			fmt.Sprintf(
+				"execprobe command failed for \"%s\""+
+					" (interpereted as a down status): %v",
+				target.String(),
+				err,
+			),
+		)
+		return false, nil
+	}
+
+	_ = log.Err(
+		fmt.Sprintf(
+			"execprobe was unable to run command for \"%s\": %v",
+			target.String(),
+			err,
+		),
+	)
+	return false, err
+}
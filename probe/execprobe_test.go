@@ -0,0 +1,129 @@
+package probe
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+func TestExecProbe(t *testing.T) {
+	u, err := url.Parse("http://127.0.0.1:8080/")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		p           *ExecProbe
+		up          bool
+		explanation string
+	}{
+		{
+			p: &ExecProbe{
+				Command: "/bin/sh",
+				Args:    []string{"-c", "exit 0"},
+			},
+			up:          true,
+			explanation: "successful command",
+		},
+		{
+			p: &ExecProbe{
+				Command: "/bin/sh",
+				Args:    []string{"-c", "exit 3"},
+			},
+			up:          false,
+			explanation: "failing command",
+		},
+		{
+			p: &ExecProbe{
+				Command: "/bin/sh",
+				Args: []string{
+					"-c",
+					`[ "${PULLCORD_PROBE_TARGET}" =` +
+						` "http://127.0.0.1:8080/" ]`,
+				},
+			},
+			up:          true,
+			explanation: "target in environment",
+		},
+		{
+			p: &ExecProbe{
+				Command: "/bin/sh",
+				Args:    []string{"-c", "sleep 5"},
+				Timeout: 100 * time.Millisecond,
+			},
+			up:          false,
+			explanation: "timeout",
+		},
+	}
+
+	for _, c := range testCases {
+		up, err := c.p.Probe(u)
+		assert.NoError(t, err, c.explanation)
+		assert.Equal(t, c.up, up, c.explanation)
+	}
+}
+
+func TestExecProbeMissingCommand(t *testing.T) {
+	u, err := url.Parse("http://127.0.0.1:8080/")
+	require.NoError(t, err)
+
+	p := &ExecProbe{Command: "/nonexistent/pullcord/probe"}
+	up, err := p.Probe(u)
+	assert.Error(t, err)
+	assert.False(t, up)
+}
+
+func TestExecProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "execprobe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "{}",
+				Explanation: "empty object",
+			},
+			{
+				Data: `{
+					"command": 7
+				}`,
+				Explanation: "numeric command",
+			},
+			{
+				Data: `{
+					"command": "true",
+					"args": "hello"
+				}`,
+				Explanation: "non-array string args",
+			},
+			{
+				Data: `{
+					"command": "true",
+					"timeout": "42q"
+				}`,
+				Explanation: "nonsensical timeout",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"command": "true"
+				}`,
+				Explanation: "missing args",
+			},
+			{
+				Data: `{
+					"command": "pg_isready",
+					"args": ["-h", "db.example.com"],
+					"timeout": "5s"
+				}`,
+				Explanation: "valid exec probe",
+			},
+		},
+	}
+	test.Run(t)
+}
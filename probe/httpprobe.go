@@ -0,0 +1,281 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// DefaultHTTPProbeTimeout is the amount of time an HTTPProbe will wait for a
+// response if no other timeout has been specified.
+const DefaultHTTPProbeTimeout = 10 * time.Second
+
+// maxHTTPProbeBodySize is the most of a response body an HTTPProbe will read
+// while looking for an expected body.
+const maxHTTPProbeBodySize = 1 << 20
+
+// HTTPProbe is a Prober that sends an HTTP request to a service and checks the
+// response. The service is considered up if the status code of the response is
+// one of the expected status codes (or any 2xx or 3xx status if none are
+// specified) and, if BodyContains or BodyRegexp are given, the response body
+// contains the expected substring and matches the expected regular expression.
+//
+// The request is sent to the target URL, though Path can be used to replace the
+// path of the target (i.e. to use a dedicated health check endpoint), and URL
+// can be used to replace the target entirely. Redirects are not followed.
+type HTTPProbe struct {
+	Method         string
+	URL            *url.URL
+	Path           string
+	Headers        map[string]string
+	ExpectedStatus []int
+	BodyContains   string
+	BodyRegexp     *regexp.Regexp
+	Timeout        time.Duration
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"httpprobe",
+		func() json.Unmarshaler {
+			return new(HTTPProbe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *HTTPProbe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Method         string
+		URL            string
+		Path           string
+		Headers        map[string]string
+		ExpectedStatus []int
+		BodyContains   string
+		BodyRegexp     string
+		Timeout        string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	p.Method = t.Method
+	p.Path = t.Path
+	p.Headers = t.Headers
+	p.ExpectedStatus = t.ExpectedStatus
+	p.BodyContains = t.BodyContains
+
+	for _, s := range t.ExpectedStatus {
+		if s < 100 || s > 999 {
+			return fmt.Errorf(
+				"httpprobe expected status must be a valid"+
+					" HTTP status code, but was given: %d",
+				s,
+			)
+		}
+	}
+
+	p.URL = nil
+	if t.URL != "" {
+		u, e := url.Parse(t.URL)
+		if e != nil {
+			return e
+		}
+		p.URL = u
+	}
+
+	p.BodyRegexp = nil
+	if t.BodyRegexp != "" {
+		r, e := regexp.Compile(t.BodyRegexp)
+		if e != nil {
+			return e
+		}
+		p.BodyRegexp = r
+	}
+
+	p.Timeout = 0
+	if t.Timeout != "" {
+		d, e := time.ParseDuration(t.Timeout)
+		if e != nil {
+			return e
+		}
+		p.Timeout = d
+	}
+
+	return nil
+}
+
+func (p *HTTPProbe) requestURL(target *url.URL) *url.URL {
+	var u url.URL
+	if p.URL != nil {
+		u = *p.URL
+	} else {
+		u = *target
+		if p.Path != "" {
+			u.Path = p.Path
+			u.RawPath = ""
+			u.RawQuery = ""
+		}
+	}
+
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+
+	return &u
+}
+
+func (p *HTTPProbe) statusExpected(status int) bool {
+	if len(p.ExpectedStatus) == 0 {
+		return status >= 200 && status < 400
+	}
+
+	for _, s := range p.ExpectedStatus {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Probe implements Prober.
+func (p *HTTPProbe) Probe(target *url.URL) (up bool, err error) {
+	u := p.requestURL(target)
+
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"httpprobe was unable to create a request for"+
+					" \"%s\": %v",
+				u.String(),
+				err,
+			),
+		)
+		return false, err
+	}
+
+	for k, v := range p.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPProbeTimeout
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		_ = log.Info(
+			fmt.Sprintf(
+				"httpprobe did not receive a response"+
+					" (interpereted as a down status) from"+
+					" \"%s\": %v",
+				u.String(),
+				err,
+			),
+		)
+		return false, nil
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if !p.statusExpected(resp.StatusCode) {
+		_ = log.Info(
+			fmt.Sprintf(
+				"httpprobe received an unexpected status"+
+					" (interpereted as a down status) from"+
+					" \"%s\": %d",
+				u.String(),
+				resp.StatusCode,
+			),
+		)
+		return false, nil
+	}
+
+	if p.BodyContains != "" || p.BodyRegexp != nil {
+		body, err := ioutil.ReadAll(
+			io.LimitReader(resp.Body, maxHTTPProbeBodySize),
+		)
+		if err != nil {
+			_ = log.Info(
+				fmt.Sprintf(
+					"httpprobe was unable to read the"+
+						" response body (interpereted"+
+						" as a down status) from"+
+						" \"%s\": %v",
+					u.String(),
+					err,
+				),
+			)
+			return false, nil
+		}
+
+		if p.BodyContains != "" && !bytes.Contains(
+			body,
+			[]byte(p.BodyContains),
+		) {
+			_ = log.Info(
+				fmt.Sprintf(
+					"httpprobe did not find the expected"+
+						" body content (interpereted as"+
+						" a down status) from \"%s\"",
+					u.String(),
+				),
+			)
+			return false, nil
+		}
+
+		if p.BodyRegexp != nil && !p.BodyRegexp.Match(body) {
+			_ = log.Info(
+				fmt.Sprintf(
+					"httpprobe response body did not"+
+						" match the expected regexp"+
+						" (interpereted as a down"+
+						" status) from \"%s\"",
+					u.String(),
+				),
+			)
+			return false, nil
+		}
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"httpprobe successfully probed: \"%s\"",
+			u.String(),
+		),
+	)
+
+	return true, nil
+}
@@ -0,0 +1,256 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+func getHTTPTarget(t *testing.T) (*httptest.Server, *url.URL) {
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/health":
+					if r.Header.Get("X-Probe") != "yes" {
+						w.WriteHeader(401)
+						return
+					}
+					_, _ = w.Write([]byte("status: ok"))
+				case "/booting":
+					w.WriteHeader(502)
+					_, _ = w.Write([]byte("starting"))
+				case "/moved":
+					http.Redirect(w, r, "/booting", 302)
+				case "/slow":
+					time.Sleep(2 * time.Second)
+				default:
+					_, _ = w.Write([]byte("hello"))
+				}
+			},
+		),
+	)
+
+	u, err := url.Parse(s.URL + "/index.html")
+	require.NoError(t, err)
+
+	return s, u
+}
+
+func TestHTTPProbe(t *testing.T) {
+	s, u := getHTTPTarget(t)
+	defer s.Close()
+
+	testCases := []struct {
+		p           *HTTPProbe
+		up          bool
+		explanation string
+	}{
+		{
+			p:           &HTTPProbe{},
+			up:          true,
+			explanation: "default probe of target",
+		},
+		{
+			p:           &HTTPProbe{Path: "/booting"},
+			up:          false,
+			explanation: "bad gateway status",
+		},
+		{
+			p: &HTTPProbe{
+				Path:           "/booting",
+				ExpectedStatus: []int{502},
+			},
+			up:          true,
+			explanation: "explicitly expected status",
+		},
+		{
+			p:           &HTTPProbe{Path: "/health"},
+			up:          false,
+			explanation: "missing header",
+		},
+		{
+			p: &HTTPProbe{
+				Path:         "/health",
+				Headers:      map[string]string{"X-Probe": "yes"},
+				BodyContains: "ok",
+			},
+			up:          true,
+			explanation: "header and body substring",
+		},
+		{
+			p: &HTTPProbe{
+				Path:         "/health",
+				Headers:      map[string]string{"X-Probe": "yes"},
+				BodyContains: "ready",
+			},
+			up:          false,
+			explanation: "missing body substring",
+		},
+		{
+			p: &HTTPProbe{
+				Path:    "/health",
+				Headers: map[string]string{"X-Probe": "yes"},
+				BodyRegexp: regexp.MustCompile(
+					"^status: (ok|ready)$",
+				),
+			},
+			up:          true,
+			explanation: "body regexp",
+		},
+		{
+			p: &HTTPProbe{
+				Path:       "/",
+				BodyRegexp: regexp.MustCompile("^status"),
+			},
+			up:          false,
+			explanation: "body regexp mismatch",
+		},
+		{
+			p:           &HTTPProbe{Path: "/moved"},
+			up:          true,
+			explanation: "redirect is not followed",
+		},
+		{
+			p: &HTTPProbe{
+				Path:           "/moved",
+				ExpectedStatus: []int{200},
+			},
+			up:          false,
+			explanation: "unexpected redirect",
+		},
+		{
+			p: &HTTPProbe{
+				Path:    "/slow",
+				Timeout: 100 * time.Millisecond,
+			},
+			up:          false,
+			explanation: "timeout",
+		},
+	}
+
+	for _, c := range testCases {
+		up, err := c.p.Probe(u)
+		assert.NoError(t, err, c.explanation)
+		assert.Equal(t, c.up, up, c.explanation)
+	}
+}
+
+func TestHTTPProbeURLOverride(t *testing.T) {
+	s, u := getHTTPTarget(t)
+	defer s.Close()
+
+	override, err := url.Parse(s.URL + "/booting")
+	require.NoError(t, err)
+
+	p := &HTTPProbe{URL: override}
+	up, err := p.Probe(getDownTarget(t))
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	p.ExpectedStatus = []int{502}
+	up, err = p.Probe(u)
+	assert.NoError(t, err)
+	assert.True(t, up)
+}
+
+func TestHTTPProbeDown(t *testing.T) {
+	p := &HTTPProbe{Timeout: time.Second}
+	up, err := p.Probe(getDownTarget(t))
+	assert.NoError(t, err)
+	assert.False(t, up)
+}
+
+func TestHTTPProbeBadMethod(t *testing.T) {
+	s, u := getHTTPTarget(t)
+	defer s.Close()
+
+	p := &HTTPProbe{Method: "BAD METHOD"}
+	up, err := p.Probe(u)
+	assert.Error(t, err)
+	assert.False(t, up)
+}
+
+func TestHTTPProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "httpprobe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"timeout": "42q"
+				}`,
+				Explanation: "nonsensical timeout",
+			},
+			{
+				Data: `{
+					"expectedstatus": 200
+				}`,
+				Explanation: "non-array expected status",
+			},
+			{
+				Data: `{
+					"expectedstatus": [42]
+				}`,
+				Explanation: "invalid expected status",
+			},
+			{
+				Data: `{
+					"bodyregexp": "("
+				}`,
+				Explanation: "invalid regexp",
+			},
+			{
+				Data: `{
+					"headers": ["X-Probe"]
+				}`,
+				Explanation: "array headers",
+			},
+			{
+				Data: `{
+					"url": ":"
+				}`,
+				Explanation: "invalid url",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data:        "{}",
+				Explanation: "empty object",
+			},
+			{
+				Data:        "null",
+				Explanation: "null config",
+			},
+			{
+				Data: `{
+					"method": "HEAD",
+					"path": "/healthz",
+					"headers": {
+						"Host": "app.example.com"
+					},
+					"expectedstatus": [200, 204],
+					"bodycontains": "ok",
+					"bodyregexp": "^ok$",
+					"timeout": "5s"
+				}`,
+				Explanation: "valid http probe",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -0,0 +1,152 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/kubernetes"
+)
+
+// KubernetesProbe is a Prober that asks the Kubernetes API for the status of a
+// Deployment (or StatefulSet) rather than checking the target itself. The
+// service is considered up once at least MinReady replicas are ready, or once
+// all of its replicas are ready if MinReady is not given. A workload which has
+// been scaled to zero replicas is always considered down.
+type KubernetesProbe struct {
+	Client    *kubernetes.Client
+	Kind      string
+	Namespace string
+	Name      string
+	MinReady  int32
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"kubernetesprobe",
+		func() json.Unmarshaler {
+			return new(KubernetesProbe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *KubernetesProbe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Server     string
+		Token      string
+		Kubeconfig string
+		Context    string
+		Kind       string
+		Namespace  string
+		Name       string
+		MinReady   int32
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Kind == "" {
+		t.Kind = kubernetes.Deployment
+	}
+	switch strings.ToLower(t.Kind) {
+	case kubernetes.Deployment, kubernetes.StatefulSet:
+	default:
+		return fmt.Errorf(
+			"kubernetesprobe kind must be deployment or"+
+				" statefulset, but was given: %s",
+			t.Kind,
+		)
+	}
+
+	if t.Name == "" {
+		return errors.New("kubernetesprobe requires a name")
+	}
+
+	if t.MinReady < 0 {
+		return fmt.Errorf(
+			"kubernetesprobe minimum ready replicas must not be"+
+				" negative, but was given: %d",
+			t.MinReady,
+		)
+	}
+
+	var c *kubernetes.Client
+	if t.Server != "" {
+		c = kubernetes.NewClient(t.Server, t.Token)
+	} else {
+		var e error
+		if c, e = kubernetes.LoadClient(t.Kubeconfig, t.Context); e != nil {
+			return e
+		}
+	}
+
+	p.Client = c
+	p.Kind = t.Kind
+	p.Namespace = t.Namespace
+	p.Name = t.Name
+	p.MinReady = t.MinReady
+
+	return nil
+}
+
+// Probe implements Prober.
+func (p *KubernetesProbe) Probe(_ *url.URL) (bool, error) {
+	status, err := p.Client.Status(
+		context.Background(),
+		p.Kind,
+		p.Namespace,
+		p.Name,
+	)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"kubernetesprobe was unable to get the status of"+
+					" %s %s: %v",
+				p.Kind,
+				p.Name,
+				err,
+			),
+		)
+		return false, err
+	}
+
+	want := p.MinReady
+	if want <= 0 {
+		want = status.Replicas
+	}
+
+	if status.Replicas == 0 || status.ReadyReplicas < want {
+		_ = log.Info(
+			fmt.Sprintf(
+				"kubernetesprobe found %d of %d replicas of %s"+
+					" %s ready (interpereted as a down"+
+					" status)",
+				status.ReadyReplicas,
+				status.Replicas,
+				p.Kind,
+				p.Name,
+			),
+		)
+		return false, nil
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"kubernetesprobe found %d of %d replicas of %s %s ready",
+			status.ReadyReplicas,
+			status.Replicas,
+			p.Kind,
+			p.Name,
+		),
+	)
+	return true, nil
+}
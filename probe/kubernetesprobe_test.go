@@ -0,0 +1,128 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/kubernetes"
+	"github.com/stuphlabs/pullcord/kubernetes/kubetest"
+)
+
+func TestKubernetesProbe(t *testing.T) {
+	a := kubetest.NewAPIServer("secrettoken")
+	defer a.Close()
+	a.Transitions = 1
+	a.SetWorkload(kubernetes.Deployment, "default", "wiki", 0)
+
+	c := kubernetes.NewClient(a.URL, "secrettoken")
+	p := &KubernetesProbe{
+		Client: c,
+		Kind:   kubernetes.Deployment,
+		Name:   "wiki",
+	}
+
+	up, err := p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	ctx := context.Background()
+
+	require.NoError(t, c.Scale(ctx, kubernetes.Deployment, "", "wiki", 2))
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.True(t, up)
+
+	p.Name = "other"
+	up, err = p.Probe(nil)
+	assert.Error(t, err)
+	assert.False(t, up)
+}
+
+func TestKubernetesProbeMinReady(t *testing.T) {
+	a := kubetest.NewAPIServer("secrettoken")
+	defer a.Close()
+	a.SetWorkload(kubernetes.StatefulSet, "default", "db", 3)
+
+	c := kubernetes.NewClient(a.URL, "secrettoken")
+	p := &KubernetesProbe{
+		Client:   c,
+		Kind:     kubernetes.StatefulSet,
+		Name:     "db",
+		MinReady: 4,
+	}
+
+	up, err := p.Probe(nil)
+	assert.NoError(t, err)
+	assert.False(t, up)
+
+	p.MinReady = 2
+	up, err = p.Probe(nil)
+	assert.NoError(t, err)
+	assert.True(t, up)
+}
+
+func TestKubernetesProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "kubernetesprobe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"server": "http://localhost:8001"
+				}`,
+				Explanation: "missing name",
+			},
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"kind": "job",
+					"name": "wiki"
+				}`,
+				Explanation: "unsupported kind",
+			},
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"name": "wiki",
+					"minready": -1
+				}`,
+				Explanation: "negative minimum ready replicas",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"name": "wiki"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"server": "https://kubernetes.example.com",
+					"token": "secrettoken",
+					"kind": "statefulset",
+					"namespace": "apps",
+					"name": "db",
+					"minready": 1
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
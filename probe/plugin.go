@@ -0,0 +1,5 @@
+package probe
+
+// LoadPlugin being called forces the package to be loaded in order to ensure
+// that the resource types are registered during the package's Init.
+func LoadPlugin() {}
@@ -0,0 +1,25 @@
+package probe
+
+import (
+	"net/url"
+)
+
+// Prober is an abstract interface describing a system which can determine
+// whether a remote service is currently able to handle requests. The target
+// given is the URL of the service being probed, though any particular Prober
+// may choose to check something other than the target itself (a health check
+// endpoint on another port, a container engine, a cloud API, etc.).
+//
+// A service that can be reached but is not (yet) ready, or that cannot be
+// reached at all (i.e. a connection is refused), is considered down, in which
+// case up will be false but no error will be returned. An error indicates
+// that the probe itself could not be carried out, and so nothing definitive
+// could be learned about the status of the service.
+type Prober interface {
+	Probe(target *url.URL) (up bool, err error)
+}
+
+// DefaultProber is the Prober used by a monitor when no other Prober has been
+// specified for a service. It only checks that a TCP connection can be
+// opened to the host and port of the target.
+var DefaultProber Prober = new(TCPProbe)
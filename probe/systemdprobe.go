@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/systemd"
+)
+
+// SystemdProbe is a Prober that asks systemd (over the system D-Bus) for the
+// active state of a unit rather than checking the target itself. The service
+// is considered up if the unit is active (or reloading).
+type SystemdProbe struct {
+	Client *systemd.Client
+	Unit   string
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"systemdprobe",
+		func() json.Unmarshaler {
+			return new(SystemdProbe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *SystemdProbe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Address string
+		Unit    string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Unit == "" {
+		return errors.New("systemdprobe requires a unit")
+	}
+
+	p.Client = systemd.NewClient(t.Address)
+	p.Unit = t.Unit
+
+	return nil
+}
+
+// Probe implements Prober.
+func (p *SystemdProbe) Probe(_ *url.URL) (bool, error) {
+	state, err := p.Client.ActiveState(
+		context.Background(),
+		p.Unit,
+	)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"systemdprobe was unable to get the state of"+
+					" unit %s: %v",
+				p.Unit,
+				err,
+			),
+		)
+		return false, err
+	}
+
+	if state != "active" && state != "reloading" {
+		_ = log.Info(
+			fmt.Sprintf(
+				"systemdprobe found unit %s in state"+
+					" (interpereted as a down status): %s",
+				p.Unit,
+				state,
+			),
+		)
+		return false, nil
+	}
+
+	_ = log.Info(fmt.Sprintf("systemdprobe found unit %s active", p.Unit))
+	return true, nil
+}
@@ -0,0 +1,78 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/systemd"
+	"github.com/stuphlabs/pullcord/systemd/systemdtest"
+)
+
+func TestSystemdProbe(t *testing.T) {
+	b, err := systemdtest.NewBus()
+	require.NoError(t, err)
+	defer func() {
+		_ = b.Close()
+	}()
+
+	p := &SystemdProbe{
+		Client: systemd.NewClient(b.Address),
+		Unit:   "wiki.service",
+	}
+
+	up, err := p.Probe(nil)
+	assert.Error(t, err)
+	assert.False(t, up)
+
+	for state, expected := range map[string]bool{
+		"inactive":     false,
+		"activating":   false,
+		"active":       true,
+		"reloading":    true,
+		"deactivating": false,
+		"failed":       false,
+	} {
+		b.SetUnit("wiki.service", state, false)
+		up, err = p.Probe(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, up, state)
+	}
+}
+
+func TestSystemdProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "systemdprobe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data:        `{}`,
+				Explanation: "missing unit",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"unit": "wiki.service"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"address": "unix:path=/run/dbus/system_bus_socket",
+					"unit": "wiki.service"
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// TCPProbe is a Prober that only checks that a TCP connection can be opened to
+// the host and port of the target. If the target URL does not specify a port,
+// the scheme of the URL is used as the service name for the port instead.
+//
+// It is worth noting that a service which has opened its port but which is
+// still initializing would be reported as being up, so a TCPProbe is mostly
+// useful for services that do not accept connections until they are ready.
+type TCPProbe struct {
+	Timeout time.Duration
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"tcpprobe",
+		func() json.Unmarshaler {
+			return new(TCPProbe)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *TCPProbe) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Timeout string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	p.Timeout = 0
+	if t.Timeout != "" {
+		d, e := time.ParseDuration(t.Timeout)
+		if e != nil {
+			return e
+		}
+		p.Timeout = d
+	}
+
+	return nil
+}
+
+// targetAddr gives the host:port address that should be dialed for the given
+// URL.
+func targetAddr(target *url.URL) string {
+	port := target.Port()
+	if port == "" {
+		port = target.Scheme
+	}
+
+	return net.JoinHostPort(target.Hostname(), port)
+}
+
+// dial opens a TCP connection to the target. A nil connection with a nil
+// error indicates that the target refused the connection (which is
+// interpereted as a down status).
+func dial(target *url.URL, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", targetAddr(target), timeout)
+	if err == nil {
+		return conn, nil
+	}
+
+	if castErr, ok := err.(*net.OpError); ok && castErr.Addr != nil {
+		_ = log.Info(
+			fmt.Sprintf(
+				"probe received a connection refused"+
+					" (interpereted as a down status) from"+
+					" \"%s\": %v",
+				target.String(),
+				err,
+			),
+		)
+
+		return nil, nil
+	}
+
+	_ = log.Warning(
+		fmt.Sprintf(
+			"probe encountered an error while dialing \"%s\": %v",
+			target.String(),
+			err,
+		),
+	)
+
+	return nil, err
+}
+
+// Probe implements Prober.
+func (p *TCPProbe) Probe(target *url.URL) (up bool, err error) {
+	conn, err := dial(target, p.Timeout)
+	if conn == nil {
+		return false, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"tcpprobe successfully probed: \"%s\"",
+			target.String(),
+		),
+	)
+
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package probe
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+func getListener(t *testing.T) (net.Listener, *url.URL) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	u, err := url.Parse("tcp://" + l.Addr().String())
+	require.NoError(t, err)
+
+	return l, u
+}
+
+func getDownTarget(t *testing.T) *url.URL {
+	u, err := url.Parse("//127.0.0.1:2")
+	require.NoError(t, err)
+
+	return u
+}
+
+func TestTCPProbeUp(t *testing.T) {
+	l, u := getListener(t)
+	defer func() {
+		_ = l.Close()
+	}()
+
+	p := new(TCPProbe)
+	up, err := p.Probe(u)
+	assert.NoError(t, err)
+	assert.True(t, up)
+}
+
+func TestTCPProbeDown(t *testing.T) {
+	p := &TCPProbe{Timeout: time.Second}
+	up, err := p.Probe(getDownTarget(t))
+	assert.NoError(t, err)
+	assert.False(t, up)
+}
+
+func TestTCPProbeInvalid(t *testing.T) {
+	u, err := url.Parse("//127.0.0.1:80")
+	require.NoError(t, err)
+	u.Host = "256.256.256.256.256:65536"
+
+	p := new(TCPProbe)
+	up, err := p.Probe(u)
+	assert.Error(t, err)
+	assert.False(t, up)
+}
+
+func TestTCPProbeFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "tcpprobe",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"timeout": 42
+				}`,
+				Explanation: "numeric timeout",
+			},
+			{
+				Data: `{
+					"timeout": "42q"
+				}`,
+				Explanation: "nonsensical timeout",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data:        "{}",
+				Explanation: "empty object",
+			},
+			{
+				Data:        "null",
+				Explanation: "null config",
+			},
+			{
+				Data: `{
+					"timeout": "5s"
+				}`,
+				Explanation: "valid tcp probe",
+			},
+		},
+	}
+	test.Run(t)
+}
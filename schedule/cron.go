@@ -0,0 +1,299 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch is how far into the future Next will look for a matching time
+// before concluding that a Cron will never match (such as for the 30th of
+// February).
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// field describes one of the fields of a cron expression.
+type field struct {
+	name  string
+	min   uint
+	max   uint
+	names map[string]uint
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{
+		name: "month",
+		min:  1,
+		max:  12,
+		names: map[string]uint{
+			"jan": 1,
+			"feb": 2,
+			"mar": 3,
+			"apr": 4,
+			"may": 5,
+			"jun": 6,
+			"jul": 7,
+			"aug": 8,
+			"sep": 9,
+			"oct": 10,
+			"nov": 11,
+			"dec": 12,
+		},
+	}
+	// Sunday may be given as either 0 or 7.
+	dowField = field{
+		name: "day of week",
+		min:  0,
+		max:  7,
+		names: map[string]uint{
+			"sun": 0,
+			"mon": 1,
+			"tue": 2,
+			"wed": 3,
+			"thu": 4,
+			"fri": 5,
+			"sat": 6,
+		},
+	}
+)
+
+// macros are the named schedules which may be given instead of five fields.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron is a parsed cron expression, giving the minutes at which something is
+// scheduled to happen.
+type Cron struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// If either the day of the month or the day of the week is
+	// restricted (not "*"), a day matches if it matches either of them,
+	// as with the traditional cron.
+	domStar bool
+	dowStar bool
+}
+
+// ParseCron parses a standard five-field cron expression (minute, hour, day
+// of month, month, and day of week). Each field may be "*", a number, a range
+// ("1-5"), a step ("*/15" or "0-30/10"), or a comma-separated list of any of
+// these. Months and days of the week may be given by their three-letter
+// English names, and Sunday may be given as either 0 or 7. The macros
+// @yearly, @annually, @monthly, @weekly, @daily, @midnight, and @hourly may
+// be given instead.
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, present := macros[strings.ToLower(spec)]; present {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf(
+			"cron expression must have five fields, but was given:"+
+				" %q",
+			expr,
+		)
+	}
+
+	c := &Cron{
+		expr:    expr,
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+
+	for i, dest := range []struct {
+		f    field
+		bits *uint64
+	}{
+		{minuteField, &c.minute},
+		{hourField, &c.hour},
+		{domField, &c.dom},
+		{monthField, &c.month},
+		{dowField, &c.dow},
+	} {
+		bits, err := dest.f.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"invalid cron expression %q: %v",
+				expr,
+				err,
+			)
+		}
+		*dest.bits = bits
+	}
+
+	// Day 7 is another name for Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	return c, nil
+}
+
+// value parses a single value of the field, which may be a name.
+func (f field) value(s string) (uint, error) {
+	if v, present := f.names[strings.ToLower(s)]; present {
+		return v, nil
+	}
+
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || uint(v) < f.min || uint(v) > f.max {
+		return 0, fmt.Errorf(
+			"%s must be between %d and %d, but was given: %q",
+			f.name,
+			f.min,
+			f.max,
+			s,
+		)
+	}
+
+	return uint(v), nil
+}
+
+// parse parses the field, giving a bit set of the values it matches.
+func (f field) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng := part
+		step := uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			v, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || v == 0 {
+				return 0, fmt.Errorf(
+					"%s has an invalid step: %q",
+					f.name,
+					part,
+				)
+			}
+			step = uint(v)
+		}
+
+		var low, high uint
+		switch i := strings.Index(rng, "-"); {
+		case rng == "*":
+			low, high = f.min, f.max
+		case i > 0:
+			var err error
+			if low, err = f.value(rng[:i]); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(rng[i+1:]); err != nil {
+				return 0, err
+			}
+			if high < low {
+				return 0, fmt.Errorf(
+					"%s has a backwards range: %q",
+					f.name,
+					part,
+				)
+			}
+		default:
+			var err error
+			if low, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			high = low
+			if step > 1 {
+				// As with many crons, "5/15" means every 15
+				// starting from 5.
+				high = f.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+// String gives the cron expression as it was given to ParseCron.
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// matchesDay determines if the cron matches the day of the given time.
+func (c *Cron) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// Next gives the first minute after the given time that the cron matches,
+// in the location of the given time. The zero time is given if the cron will
+// never match.
+//
+// A time which does not exist in the location (such as during the hour
+// skipped when daylight saving time begins) never matches, and a time which
+// happens twice (such as during the hour repeated when daylight saving time
+// ends) matches both times.
+func (c *Cron) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(maxSearch)
+
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchesDay(t):
+			next = time.Date(
+				t.Year(),
+				t.Month(),
+				t.Day()+1,
+				0,
+				0,
+				0,
+				0,
+				loc,
+			)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			next = time.Date(
+				t.Year(),
+				t.Month(),
+				t.Day(),
+				t.Hour()+1,
+				0,
+				0,
+				0,
+				loc,
+			)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		// Normalizing a time across a change of the offset of the
+		// location can go backwards, in which case simply moving on
+		// by a minute will still make progress.
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+
+	return time.Time{}
+}
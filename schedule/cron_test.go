@@ -0,0 +1,138 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronBad(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * smarch *",
+		"@fortnightly",
+		"a b c d e",
+	} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, "%q", expr)
+	}
+}
+
+func TestCronString(t *testing.T) {
+	c, err := ParseCron("@daily")
+	require.NoError(t, err)
+	assert.Equal(t, "@daily", c.String())
+}
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2021, time.March, 3, 10, 30, 15, 0, time.UTC)
+
+	for _, test := range []struct {
+		expr string
+		next time.Time
+	}{
+		{
+			"* * * * *",
+			time.Date(2021, time.March, 3, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			"*/15 * * * *",
+			time.Date(2021, time.March, 3, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			"5/20 * * * *",
+			time.Date(2021, time.March, 3, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			"0 9 * * 1-5",
+			time.Date(2021, time.March, 4, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			"0 9 * * mon",
+			time.Date(2021, time.March, 8, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			"0 0 * * 7",
+			time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"30 8,17 * * *",
+			time.Date(2021, time.March, 3, 17, 30, 0, 0, time.UTC),
+		},
+		{
+			"0 0 1 jan *",
+			time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"@monthly",
+			time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"0 0 29 2 *",
+			time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// Either the 15th or a Friday.
+			"0 0 15 * fri",
+			time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// Only Fridays, since the day of the month is "*".
+			"0 0 * * 5",
+			time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"0 0 30 2 *",
+			time.Time{},
+		},
+	} {
+		c, err := ParseCron(test.expr)
+		require.NoError(t, err, test.expr)
+		assert.True(
+			t,
+			test.next.Equal(c.Next(from)),
+			"%q gave %s",
+			test.expr,
+			c.Next(from),
+		)
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// 2:30 does not exist on the day daylight saving time begins.
+	c, err := ParseCron("30 2 * * *")
+	require.NoError(t, err)
+	next := c.Next(time.Date(2021, time.March, 13, 12, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2021, time.March, 15, 2, 30, 0, 0, loc), next)
+
+	// 1:30 happens twice on the day daylight saving time ends.
+	c, err = ParseCron("30 1 * * *")
+	require.NoError(t, err)
+	first := c.Next(time.Date(2021, time.November, 7, 0, 0, 0, 0, loc))
+	second := c.Next(first)
+	assert.Equal(t, time.Hour, second.Sub(first))
+	assert.Equal(t, 1, second.Hour())
+
+	// Business hours follow the local clock across the change.
+	c, err = ParseCron("0 9 * * *")
+	require.NoError(t, err)
+	before := c.Next(time.Date(2021, time.March, 13, 0, 0, 0, 0, loc))
+	after := c.Next(before)
+	assert.Equal(t, 9, after.Hour())
+	assert.Equal(t, 23*time.Hour, after.Sub(before))
+}
@@ -0,0 +1,3 @@
+// Package schedule provides cron schedules, recurring windows of time, and a
+// trigger which is run on a schedule.
+package schedule
@@ -0,0 +1,209 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/proidiot/gone/log"
+
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/trigger"
+)
+
+// ScheduleTrigger runs another trigger each time its Schedule matches, for as
+// long as its background work is running (see StartBackground). The event
+// given to the other trigger names the Service, if one was given, and has
+// "schedule" as the name of the trigger.
+//
+// A ScheduleTrigger knows nothing of the state of any monitored service, so
+// it should not be used to run the triggers of a service which is being
+// monitored (the keep-warm windows of a .../monitor.MinMonitorredService
+// should be used instead to start such a service on a schedule).
+type ScheduleTrigger struct {
+	Schedule Schedule
+	Service  string
+	Wrapped  trigger.Triggerrer
+	stop     context.CancelFunc
+	done     chan struct{}
+	mutex    sync.Mutex
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"scheduletrigger",
+		func() json.Unmarshaler {
+			return new(ScheduleTrigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (st *ScheduleTrigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Schedule string
+		Timezone string
+		Service  string
+		Trigger  config.Resource
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Schedule == "" {
+		return errors.New("scheduletrigger requires a schedule")
+	}
+
+	s, e := NewSchedule(t.Schedule, t.Timezone)
+	if e != nil {
+		return e
+	}
+
+	wrapped, ok := trigger.FromResource(t.Trigger.Unmarshalled)
+	if !ok {
+		return config.UnexpectedResourceType
+	}
+
+	st.Schedule = s
+	st.Service = t.Service
+	st.Wrapped = wrapped
+	return nil
+}
+
+// NewScheduleTrigger initializes a ScheduleTrigger which runs the given
+// trigger each time the given schedule matches.
+func NewScheduleTrigger(
+	schedule Schedule,
+	wrapped trigger.Triggerrer,
+) *ScheduleTrigger {
+	return &ScheduleTrigger{Schedule: schedule, Wrapped: wrapped}
+}
+
+// StartBackground begins running the other trigger on the schedule. It
+// implements .../config.Backgrounder, so a ScheduleTrigger created from a
+// config will run for as long as the server is running.
+func (st *ScheduleTrigger) StartBackground() error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if st.stop != nil {
+		return nil
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"scheduletrigger starting with schedule: \"%s\"",
+			st.Schedule.Cron.String(),
+		),
+	)
+
+	var ctx context.Context
+	ctx, st.stop = context.WithCancel(context.Background())
+	st.done = make(chan struct{})
+	go st.run(ctx, st.done)
+
+	return nil
+}
+
+// StopBackground stops running the other trigger on the schedule, cancelling
+// it if it is running (including any part of it which is running in the
+// background), and does not return until it has finished. It implements
+// .../config.Backgrounder.
+func (st *ScheduleTrigger) StopBackground() error {
+	st.mutex.Lock()
+	stop := st.stop
+	done := st.done
+	st.stop = nil
+	st.done = nil
+	st.mutex.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"scheduletrigger stopping with schedule: \"%s\"",
+			st.Schedule.Cron.String(),
+		),
+	)
+
+	stop()
+	<-done
+
+	return nil
+}
+
+// Next gives the next time that the other trigger will be run, or the zero
+// time if the schedule will never match.
+func (st *ScheduleTrigger) Next() time.Time {
+	return st.Schedule.Next(time.Now())
+}
+
+func (st *ScheduleTrigger) run(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		next := st.Next()
+		if next.IsZero() {
+			_ = log.Warning(
+				fmt.Sprintf(
+					"scheduletrigger schedule will never"+
+						" match: \"%s\"",
+					st.Schedule.Cron.String(),
+				),
+			)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		st.fire(ctx, next)
+	}
+}
+
+// fire runs the other trigger for the scheduled time.
+func (st *ScheduleTrigger) fire(ctx context.Context, scheduled time.Time) {
+	_ = log.Debug(
+		fmt.Sprintf(
+			"scheduletrigger running the trigger scheduled for %s",
+			scheduled.String(),
+		),
+	)
+
+	_, err := st.Wrapped.Trigger(
+		trigger.WithLifetime(ctx, ctx),
+		trigger.Event{
+			Service: st.Service,
+			Trigger: "schedule",
+			Time:    scheduled,
+		},
+	)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"scheduletrigger received an error while running"+
+					" the trigger scheduled for %s: %v",
+				scheduled.String(),
+				err,
+			),
+		)
+	}
+}
+
+// Unwrap implements .../trigger.Wrapper.
+func (s *ScheduleTrigger) Unwrap() []trigger.Triggerrer {
+	return []trigger.Triggerrer{s.Wrapped}
+}
@@ -0,0 +1,149 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/trigger"
+)
+
+// eventTriggerrer is a Triggerrer which remembers the events it was run for.
+type eventTriggerrer struct {
+	events []trigger.Event
+	ctx    context.Context
+}
+
+func (e *eventTriggerrer) Trigger(
+	ctx context.Context,
+	ev trigger.Event,
+) (string, error) {
+	e.events = append(e.events, ev)
+	e.ctx = ctx
+	return "", nil
+}
+
+func TestScheduleTriggerFire(t *testing.T) {
+	s, err := NewSchedule("0 9 * * *", "")
+	require.NoError(t, err)
+	e := &eventTriggerrer{}
+	st := NewScheduleTrigger(s, e)
+	st.Service = "wiki"
+
+	lifetime, stop := context.WithCancel(context.Background())
+	scheduled := time.Date(2021, time.March, 3, 9, 0, 0, 0, time.UTC)
+	st.fire(lifetime, scheduled)
+
+	require.Equal(t, 1, len(e.events))
+	assert.Equal(t, "wiki", e.events[0].Service)
+	assert.Equal(t, "schedule", e.events[0].Trigger)
+	assert.Equal(t, scheduled, e.events[0].Time)
+
+	// Any part of the trigger running in the background lasts only as
+	// long as the ScheduleTrigger.
+	detached := trigger.Detach(e.ctx)
+	assert.NoError(t, detached.Err())
+	stop()
+	assert.Equal(t, context.Canceled, detached.Err())
+}
+
+func TestScheduleTriggerBackground(t *testing.T) {
+	s, err := NewSchedule("0 0 1 1 *", "")
+	require.NoError(t, err)
+	e := &eventTriggerrer{}
+	st := NewScheduleTrigger(s, e)
+
+	assert.True(t, st.Next().After(time.Now()))
+
+	require.NoError(t, st.StartBackground())
+	require.NoError(t, st.StartBackground())
+	require.NoError(t, st.StopBackground())
+	require.NoError(t, st.StopBackground())
+	assert.Equal(t, 0, len(e.events))
+
+	// A schedule which will never match simply stops.
+	s, err = NewSchedule("0 0 30 2 *", "")
+	require.NoError(t, err)
+	st = NewScheduleTrigger(s, e)
+	assert.True(t, st.Next().IsZero())
+	require.NoError(t, st.StartBackground())
+	require.NoError(t, st.StopBackground())
+}
+
+func TestScheduleTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "scheduletrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "shelltrigger",
+						"data": {
+							"command": "/usr/local/bin/start"
+						}
+					}
+				}`,
+				Explanation: "missing schedule",
+			},
+			{
+				Data: `{
+					"schedule": "0 9 * * 1-5"
+				}`,
+				Explanation: "missing trigger",
+			},
+			{
+				Data: `{
+					"schedule": "0 9 * * 1-5 *",
+					"trigger": {
+						"type": "shelltrigger",
+						"data": {
+							"command": "/usr/local/bin/start"
+						}
+					}
+				}`,
+				Explanation: "bad schedule",
+			},
+			{
+				Data: `{
+					"schedule": "0 9 * * 1-5",
+					"timezone": "Mars/Olympus_Mons",
+					"trigger": {
+						"type": "shelltrigger",
+						"data": {
+							"command": "/usr/local/bin/start"
+						}
+					}
+				}`,
+				Explanation: "bad timezone",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"schedule": "45 8 * * mon-fri",
+					"timezone": "America/New_York",
+					"service": "wiki",
+					"trigger": {
+						"type": "shelltrigger",
+						"data": {
+							"command": "/usr/local/bin/start"
+						}
+					}
+				}`,
+				Explanation: "basic config",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -0,0 +1,113 @@
+package schedule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Schedule is a Cron which is evaluated in a particular time zone.
+type Schedule struct {
+	Cron     *Cron
+	Location *time.Location
+}
+
+// NewSchedule parses the given cron expression (see ParseCron), which will be
+// evaluated in the time zone with the given IANA name (such as
+// "America/New_York"), or in UTC if no name is given.
+func NewSchedule(expr string, timezone string) (Schedule, error) {
+	c, err := ParseCron(expr)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Schedule{}, fmt.Errorf(
+			"unable to load the time zone %q: %v",
+			timezone,
+			err,
+		)
+	}
+
+	return Schedule{Cron: c, Location: loc}, nil
+}
+
+// Next gives the first time after the given time that the schedule matches,
+// or the zero time if the schedule will never match.
+func (s Schedule) Next(after time.Time) time.Time {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return s.Cron.Next(after.In(loc))
+}
+
+// Window is a period of time which begins each time its Schedule matches and
+// lasts for its Duration, such as business hours (which could be a Schedule
+// of "0 9 * * 1-5" with a Duration of 8 hours).
+type Window struct {
+	Schedule Schedule
+	Duration time.Duration
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (w *Window) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Schedule string
+		Duration string
+		Timezone string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Schedule == "" {
+		return errors.New("window requires a schedule")
+	}
+
+	s, e := NewSchedule(t.Schedule, t.Timezone)
+	if e != nil {
+		return e
+	}
+
+	d, e := time.ParseDuration(t.Duration)
+	if e != nil {
+		return e
+	} else if d <= 0 {
+		return fmt.Errorf(
+			"window duration must be positive, but was given: %s",
+			t.Duration,
+		)
+	}
+
+	w.Schedule = s
+	w.Duration = d
+
+	return nil
+}
+
+// Active determines if the given time is within the window, along with when
+// that occurrence of the window ends. If occurrences of the window overlap,
+// the end of the latest of them is given.
+func (w *Window) Active(t time.Time) (active bool, end time.Time) {
+	for start := w.Schedule.Next(
+		t.Add(-w.Duration),
+	); !start.IsZero() && !start.After(t); start = w.Schedule.Next(start) {
+		active = true
+		end = start.Add(w.Duration)
+	}
+
+	return active, end
+}
+
+// NextStart gives the first time after the given time that the window
+// begins, or the zero time if it will never begin.
+func (w *Window) NextStart(after time.Time) time.Time {
+	return w.Schedule.Next(after)
+}
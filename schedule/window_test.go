@@ -0,0 +1,90 @@
+package schedule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowActive(t *testing.T) {
+	var w Window
+	require.NoError(
+		t,
+		json.Unmarshal(
+			[]byte(`{
+				"schedule": "0 9 * * 1-5",
+				"duration": "8h",
+				"timezone": "America/New_York"
+			}`),
+			&w,
+		),
+	)
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// A Wednesday.
+	active, end := w.Active(time.Date(2021, time.March, 3, 10, 0, 0, 0, loc))
+	assert.True(t, active)
+	assert.True(
+		t,
+		time.Date(2021, time.March, 3, 17, 0, 0, 0, loc).Equal(end),
+	)
+
+	active, _ = w.Active(time.Date(2021, time.March, 3, 9, 0, 0, 0, loc))
+	assert.True(t, active)
+
+	active, _ = w.Active(time.Date(2021, time.March, 3, 17, 0, 0, 0, loc))
+	assert.False(t, active)
+
+	active, _ = w.Active(time.Date(2021, time.March, 3, 8, 59, 0, 0, loc))
+	assert.False(t, active)
+
+	// The time zone of the window applies regardless of the time zone of
+	// the time being checked.
+	active, _ = w.Active(time.Date(2021, time.March, 3, 14, 30, 0, 0, time.UTC))
+	assert.True(t, active)
+	active, _ = w.Active(time.Date(2021, time.March, 3, 13, 30, 0, 0, time.UTC))
+	assert.False(t, active)
+
+	// A Saturday.
+	active, _ = w.Active(time.Date(2021, time.March, 6, 10, 0, 0, 0, loc))
+	assert.False(t, active)
+	assert.True(
+		t,
+		time.Date(2021, time.March, 8, 9, 0, 0, 0, loc).Equal(
+			w.NextStart(time.Date(2021, time.March, 6, 10, 0, 0, 0, loc)),
+		),
+	)
+}
+
+func TestWindowOverlapping(t *testing.T) {
+	s, err := NewSchedule("0 * * * *", "")
+	require.NoError(t, err)
+	w := Window{Schedule: s, Duration: 90 * time.Minute}
+
+	active, end := w.Active(time.Date(2021, time.March, 3, 10, 15, 0, 0, time.UTC))
+	assert.True(t, active)
+	assert.True(
+		t,
+		time.Date(2021, time.March, 3, 11, 30, 0, 0, time.UTC).Equal(end),
+	)
+}
+
+func TestWindowUnmarshalBad(t *testing.T) {
+	for _, data := range []string{
+		`42`,
+		`{}`,
+		`{"duration": "1h"}`,
+		`{"schedule": "0 9 * * *"}`,
+		`{"schedule": "0 9 * * *", "duration": "-1h"}`,
+		`{"schedule": "0 9 * *", "duration": "1h"}`,
+		`{"schedule": "0 9 * * *", "duration": "1h", "timezone": "Mars/Olympus_Mons"}`,
+	} {
+		var w Window
+		assert.Error(t, json.Unmarshal([]byte(data), &w), data)
+	}
+}
@@ -0,0 +1,278 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stuphlabs/pullcord/dbus"
+)
+
+const (
+	// Start is the action which starts a unit.
+	Start = "start"
+	// Stop is the action which stops a unit.
+	Stop = "stop"
+	// Restart is the action which restarts a unit (starting it if it is
+	// not already running).
+	Restart = "restart"
+)
+
+// DefaultMode is the job mode used if no other mode has been specified,
+// which replaces any conflicting job already queued for the unit.
+const DefaultMode = "replace"
+
+// DefaultTimeout is how long to wait for a job to finish if no other timeout
+// has been specified.
+const DefaultTimeout = 2 * time.Minute
+
+const (
+	busName          = "org.freedesktop.systemd1"
+	managerPath      = "/org/freedesktop/systemd1"
+	managerInterface = "org.freedesktop.systemd1.Manager"
+	unitInterface    = "org.freedesktop.systemd1.Unit"
+)
+
+// JobError indicates that a job did not finish successfully, giving the
+// result of the job as reported by systemd (such as failed, canceled,
+// timeout, or dependency).
+type JobError struct {
+	Action string
+	Unit   string
+	Result string
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf(
+		"systemd job to %s %s finished with result: %s",
+		e.Action,
+		e.Unit,
+		e.Result,
+	)
+}
+
+// Client is a client for the systemd manager on the bus at Address (or the
+// system bus if no address is given). A new connection is made for each
+// request. Unless the process is running as root, managing units requires
+// that polkit authorize the user of the process to do so.
+type Client struct {
+	Address string
+	Timeout time.Duration
+}
+
+// NewClient creates a Client for the systemd manager on the bus at the given
+// address (or the system bus if no address is given).
+func NewClient(address string) *Client {
+	return &Client{Address: address}
+}
+
+// dial connects to the bus, closing the connection if the context is
+// cancelled so that any call (or wait) on it gives up. The given function must
+// be called once the connection is no longer needed.
+func (c *Client) dial(ctx context.Context) (*dbus.Conn, func(), error) {
+	address := c.Address
+	if address == "" {
+		address = dbus.SystemBusAddress()
+	}
+
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	return conn, func() {
+		close(done)
+		_ = conn.Close()
+	}, nil
+}
+
+// contextErr gives the error of the context if it has been cancelled (since
+// the connection will have been closed out from under whatever gave err), or
+// err otherwise.
+func contextErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+
+	return c.Timeout
+}
+
+// Run performs the given action (Start, Stop, or Restart) on the given unit,
+// queueing a job with the given mode (or DefaultMode). If wait is set, Run
+// does not return until the job has finished, giving a *JobError if the job
+// was not successful. If the context is cancelled first, Run gives up and
+// gives the error of the context, though the job is not cancelled.
+func (c *Client) Run(
+	ctx context.Context,
+	action string,
+	unit string,
+	mode string,
+	wait bool,
+) (err error) {
+	var method string
+	switch action {
+	case Start:
+		method = "StartUnit"
+	case Stop:
+		method = "StopUnit"
+	case Restart:
+		method = "RestartUnit"
+	default:
+		return fmt.Errorf("unknown systemd unit action: %s", action)
+	}
+
+	if mode == "" {
+		mode = DefaultMode
+	}
+
+	conn, closeConn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeConn()
+		err = contextErr(ctx, err)
+	}()
+
+	if wait {
+		// The signal must be subscribed to before the job is queued,
+		// lest it finish before the subscription is in place.
+		if _, err = conn.Call(
+			"org.freedesktop.DBus",
+			"/org/freedesktop/DBus",
+			"org.freedesktop.DBus",
+			"AddMatch",
+			"s",
+			"type='signal',sender='"+busName+"',interface='"+
+				managerInterface+"',member='JobRemoved'",
+		); err != nil {
+			return err
+		}
+		if _, err = conn.Call(
+			busName,
+			managerPath,
+			managerInterface,
+			"Subscribe",
+			"",
+		); err != nil {
+			return err
+		}
+	}
+
+	reply, err := conn.Call(
+		busName,
+		managerPath,
+		managerInterface,
+		method,
+		"ss",
+		unit,
+		mode,
+	)
+	if err != nil {
+		return err
+	} else if len(reply) != 1 {
+		return fmt.Errorf("unexpected reply to %s: %v", method, reply)
+	}
+	job, ok := reply[0].(dbus.ObjectPath)
+	if !ok {
+		return fmt.Errorf("unexpected reply to %s: %v", method, reply)
+	}
+
+	if !wait {
+		return nil
+	}
+
+	// JobRemoved has the job ID, job path, unit, and result.
+	signal, err := conn.WaitSignal(
+		func(m *dbus.Message) bool {
+			return m.Interface == managerInterface &&
+				m.Member == "JobRemoved" &&
+				len(m.Body) == 4 &&
+				m.Body[1] == job
+		},
+		c.timeout(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if result, _ := signal.Body[3].(string); result != "done" {
+		return &JobError{Action: action, Unit: unit, Result: result}
+	}
+
+	return nil
+}
+
+// ActiveState gives the active state of the given unit (such as active,
+// inactive, activating, deactivating, or failed).
+func (c *Client) ActiveState(
+	ctx context.Context,
+	unit string,
+) (state string, err error) {
+	conn, closeConn, err := c.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		closeConn()
+		err = contextErr(ctx, err)
+	}()
+
+	// LoadUnit (unlike GetUnit) succeeds for units which exist but are
+	// not currently loaded.
+	reply, err := conn.Call(
+		busName,
+		managerPath,
+		managerInterface,
+		"LoadUnit",
+		"s",
+		unit,
+	)
+	if err != nil {
+		return "", err
+	} else if len(reply) != 1 {
+		return "", fmt.Errorf("unexpected reply to LoadUnit: %v", reply)
+	}
+	path, ok := reply[0].(dbus.ObjectPath)
+	if !ok {
+		return "", fmt.Errorf("unexpected reply to LoadUnit: %v", reply)
+	}
+
+	reply, err = conn.Call(
+		busName,
+		path,
+		"org.freedesktop.DBus.Properties",
+		"Get",
+		"ss",
+		unitInterface,
+		"ActiveState",
+	)
+	if err != nil {
+		return "", err
+	} else if len(reply) == 1 {
+		if v, ok := reply[0].(dbus.Variant); ok {
+			if state, ok = v.Value.(string); ok {
+				return state, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unexpected ActiveState of %s: %v", unit, reply)
+}
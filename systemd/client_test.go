@@ -0,0 +1,77 @@
+package systemd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/dbus"
+	"github.com/stuphlabs/pullcord/systemd"
+	"github.com/stuphlabs/pullcord/systemd/systemdtest"
+)
+
+func TestClient(t *testing.T) {
+	b, err := systemdtest.NewBus()
+	require.NoError(t, err)
+	defer func() {
+		_ = b.Close()
+	}()
+	b.SetUnit("wiki.service", "inactive", false)
+
+	c := systemd.NewClient(b.Address)
+
+	ctx := context.Background()
+
+	state, err := c.ActiveState(ctx, "wiki.service")
+	require.NoError(t, err)
+	assert.Equal(t, "inactive", state)
+
+	require.NoError(t, c.Run(ctx, systemd.Start, "wiki.service", "", true))
+	state, err = c.ActiveState(ctx, "wiki.service")
+	require.NoError(t, err)
+	assert.Equal(t, "active", state)
+	assert.Contains(t, b.Calls, "StartUnit wiki.service replace")
+
+	require.NoError(
+		t,
+		c.Run(ctx, systemd.Stop, "wiki.service", "fail", false),
+	)
+	state, _ = b.Unit("wiki.service")
+	assert.Equal(t, "inactive", state)
+	assert.Contains(t, b.Calls, "StopUnit wiki.service fail")
+}
+
+func TestClientErrors(t *testing.T) {
+	b, err := systemdtest.NewBus()
+	require.NoError(t, err)
+	defer func() {
+		_ = b.Close()
+	}()
+	b.SetUnit("broken.service", "inactive", true)
+
+	c := systemd.NewClient(b.Address)
+
+	ctx := context.Background()
+
+	err = c.Run(ctx, systemd.Restart, "broken.service", "", true)
+	require.Error(t, err)
+	jobErr, ok := err.(*systemd.JobError)
+	require.True(t, ok)
+	assert.Equal(t, "failed", jobErr.Result)
+
+	err = c.Run(ctx, systemd.Start, "missing.service", "", true)
+	require.Error(t, err)
+	dbusErr, ok := err.(*dbus.Error)
+	require.True(t, ok)
+	assert.Equal(t, "org.freedesktop.systemd1.NoSuchUnit", dbusErr.Name)
+
+	_, err = c.ActiveState(ctx, "missing.service")
+	assert.Error(t, err)
+
+	assert.Error(t, c.Run(ctx, "reload", "broken.service", "", true))
+
+	c = systemd.NewClient("unix:path=/nonexistent/system_bus_socket")
+	_, err = c.ActiveState(ctx, "broken.service")
+	assert.Error(t, err)
+}
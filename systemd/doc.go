@@ -0,0 +1,4 @@
+// Package systemd provides a minimal client for the systemd manager on the
+// system D-Bus, enough for units to be managed as Pullcord services without
+// needing to run systemctl.
+package systemd
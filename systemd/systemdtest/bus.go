@@ -0,0 +1,335 @@
+// Package systemdtest provides a fake system bus, served over a local unix
+// socket, with a fake systemd manager against which systemd clients can be
+// tested.
+package systemdtest
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stuphlabs/pullcord/dbus"
+)
+
+// Bus is a fake system bus on which a fake systemd manager knows of a set of
+// units. Jobs finish as soon as they are queued, with starting (or
+// restarting) a unit leaving it active (or failed, if the unit has been set
+// to fail), and stopping a unit leaving it inactive. Jobs for a unit which has
+// been stalled never finish.
+type Bus struct {
+	// Address is the address of the fake bus, suitable for dbus.Dial.
+	Address string
+
+	// Calls is the member and arguments of each method call received, in
+	// order.
+	Calls []string
+
+	units   map[string]*unit
+	dir     string
+	l       net.Listener
+	jobs    uint32
+	clients int
+	mutex   sync.Mutex
+}
+
+type unit struct {
+	state   string
+	failing bool
+	stalled bool
+}
+
+// NewBus starts a fake system bus with no units.
+func NewBus() (*Bus, error) {
+	dir, err := ioutil.TempDir("", "pullcord-dbus")
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "system_bus_socket")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	b := &Bus{
+		Address: "unix:path=" + path,
+		units:   make(map[string]*unit),
+		dir:     dir,
+		l:       l,
+	}
+	go b.serve()
+
+	return b, nil
+}
+
+// Close stops the fake bus.
+func (b *Bus) Close() error {
+	err := b.l.Close()
+	_ = os.RemoveAll(b.dir)
+
+	return err
+}
+
+// SetUnit adds a unit in the given active state, or replaces the state of an
+// existing unit. If failing is set, jobs which start the unit fail.
+func (b *Bus) SetUnit(name string, state string, failing bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.units[name] = &unit{state: state, failing: failing}
+}
+
+// StallUnit keeps any job queued for the given unit from finishing, as if the
+// unit were hanging while it starts or stops.
+func (b *Bus) StallUnit(name string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if u, present := b.units[name]; present {
+		u.stalled = true
+	}
+}
+
+// Unit gives the active state of the given unit.
+func (b *Bus) Unit(name string) (string, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	u, present := b.units[name]
+	if !present {
+		return "", false
+	}
+
+	return u.state, true
+}
+
+func (b *Bus) serve() {
+	for {
+		conn, err := b.l.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+// unitPath gives the object path of a unit, escaped as systemd does.
+func unitPath(name string) dbus.ObjectPath {
+	var s strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9' && i > 0) {
+			s.WriteByte(c)
+		} else {
+			fmt.Fprintf(&s, "_%02x", c)
+		}
+	}
+
+	return dbus.ObjectPath("/org/freedesktop/systemd1/unit/" + s.String())
+}
+
+func (b *Bus) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	if nul, err := r.ReadByte(); err != nil || nul != 0 {
+		return
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, "AUTH EXTERNAL ") {
+			fmt.Fprint(conn, "OK 0123456789abcdef0123456789abcdef\r\n")
+		} else if strings.HasPrefix(line, "BEGIN") {
+			break
+		} else {
+			fmt.Fprint(conn, "ERROR\r\n")
+		}
+	}
+
+	b.mutex.Lock()
+	b.clients++
+	name := ":1." + strconv.Itoa(b.clients)
+	b.mutex.Unlock()
+
+	var serial uint32
+	subscribed := false
+	send := func(m *dbus.Message) bool {
+		serial++
+		m.Serial = serial
+		data, err := m.Encode()
+		if err != nil {
+			return false
+		}
+		_, err = conn.Write(data)
+		return err == nil
+	}
+
+	for {
+		call, err := dbus.ReadMessage(r)
+		if err != nil {
+			return
+		}
+		if call.Type != dbus.TypeMethodCall {
+			continue
+		}
+
+		reply, signal := b.call(call, name, subscribed)
+		if call.Member == "Subscribe" {
+			subscribed = true
+		}
+		reply.ReplySerial = call.Serial
+		reply.Destination = name
+		if !send(reply) {
+			return
+		}
+		if signal != nil && !send(signal) {
+			return
+		}
+	}
+}
+
+// call handles a method call, giving the reply and any signal to be sent
+// after it.
+func (b *Bus) call(
+	call *dbus.Message,
+	client string,
+	subscribed bool,
+) (*dbus.Message, *dbus.Message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	args := make([]string, 0, len(call.Body))
+	for _, arg := range call.Body {
+		args = append(args, fmt.Sprint(arg))
+	}
+	b.Calls = append(
+		b.Calls,
+		strings.TrimSpace(call.Member+" "+strings.Join(args, " ")),
+	)
+
+	ok := func(sig dbus.Signature, body ...interface{}) *dbus.Message {
+		return &dbus.Message{
+			Type:      dbus.TypeMethodReturn,
+			Sender:    call.Destination,
+			Signature: sig,
+			Body:      body,
+		}
+	}
+	fail := func(name string, msg string) *dbus.Message {
+		return &dbus.Message{
+			Type:      dbus.TypeError,
+			Sender:    call.Destination,
+			ErrorName: name,
+			Signature: "s",
+			Body:      []interface{}{msg},
+		}
+	}
+
+	switch call.Interface + "." + call.Member {
+	case "org.freedesktop.DBus.Hello":
+		return ok("s", client), nil
+	case "org.freedesktop.DBus.AddMatch":
+		return ok(""), nil
+	case "org.freedesktop.systemd1.Manager.Subscribe":
+		return ok(""), nil
+	case "org.freedesktop.systemd1.Manager.StartUnit",
+		"org.freedesktop.systemd1.Manager.StopUnit",
+		"org.freedesktop.systemd1.Manager.RestartUnit":
+		if call.Signature != "ss" {
+			return fail(
+				"org.freedesktop.DBus.Error.InvalidArgs",
+				"invalid arguments",
+			), nil
+		}
+		name := call.Body[0].(string)
+		u, present := b.units[name]
+		if !present {
+			return fail(
+				"org.freedesktop.systemd1.NoSuchUnit",
+				"Unit "+name+" not found.",
+			), nil
+		}
+
+		b.jobs++
+		job := dbus.ObjectPath(
+			"/org/freedesktop/systemd1/job/" +
+				strconv.FormatUint(uint64(b.jobs), 10),
+		)
+		if u.stalled {
+			return ok("o", job), nil
+		}
+
+		result := "done"
+		if call.Member == "StopUnit" {
+			u.state = "inactive"
+		} else if u.failing {
+			u.state = "failed"
+			result = "failed"
+		} else {
+			u.state = "active"
+		}
+
+		var signal *dbus.Message
+		if subscribed {
+			signal = &dbus.Message{
+				Type:      dbus.TypeSignal,
+				Sender:    call.Destination,
+				Path:      "/org/freedesktop/systemd1",
+				Interface: "org.freedesktop.systemd1.Manager",
+				Member:    "JobRemoved",
+				Signature: "uoss",
+				Body:      []interface{}{b.jobs, job, name, result},
+			}
+		}
+
+		return ok("o", job), signal
+	case "org.freedesktop.systemd1.Manager.LoadUnit":
+		if call.Signature != "s" {
+			return fail(
+				"org.freedesktop.DBus.Error.InvalidArgs",
+				"invalid arguments",
+			), nil
+		}
+		name := call.Body[0].(string)
+		if _, present := b.units[name]; !present {
+			return fail(
+				"org.freedesktop.systemd1.NoSuchUnit",
+				"Unit "+name+" not found.",
+			), nil
+		}
+		return ok("o", unitPath(name)), nil
+	case "org.freedesktop.DBus.Properties.Get":
+		for name, u := range b.units {
+			if unitPath(name) == call.Path && call.Signature == "ss" &&
+				call.Body[0] == "org.freedesktop.systemd1.Unit" &&
+				call.Body[1] == "ActiveState" {
+				return ok(
+					"v",
+					dbus.Variant{Signature: "s", Value: u.state},
+				), nil
+			}
+		}
+		return fail(
+			"org.freedesktop.DBus.Error.UnknownProperty",
+			"unknown property",
+		), nil
+	}
+
+	return fail(
+		"org.freedesktop.DBus.Error.UnknownMethod",
+		"unknown method "+call.Member,
+	), nil
+}
@@ -0,0 +1,226 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// AsyncState is the state of the most recent run of an AsyncTrigger.
+type AsyncState int
+
+const (
+	// AsyncIdle indicates that the trigger has never been run.
+	AsyncIdle AsyncState = iota
+	// AsyncRunning indicates that the trigger is running.
+	AsyncRunning
+	// AsyncSucceeded indicates that the most recent run of the trigger
+	// succeeded.
+	AsyncSucceeded
+	// AsyncFailed indicates that the most recent run of the trigger
+	// failed.
+	AsyncFailed
+)
+
+var asyncStateNames = []string{
+	"idle",
+	"running",
+	"succeeded",
+	"failed",
+}
+
+func (a AsyncState) String() string {
+	if a < 0 || int(a) >= len(asyncStateNames) {
+		return "unknown"
+	}
+
+	return asyncStateNames[a]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a AsyncState) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *AsyncState) UnmarshalText(text []byte) error {
+	for i, name := range asyncStateNames {
+		if name == string(text) {
+			*a = AsyncState(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown async trigger state: %s", text)
+}
+
+// AsyncStatus is a snapshot of the status of an AsyncTrigger. Times which are
+// not yet known (such as Finished for a run which is still going) are omitted
+// from the JSON form.
+type AsyncStatus struct {
+	State    AsyncState `json:"state"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Output   string     `json:"output,omitempty"`
+}
+
+// StatusReporter is implemented by triggers which run in the background, so
+// that the status of their most recent run can be found.
+type StatusReporter interface {
+	Status() AsyncStatus
+}
+
+// AsyncTrigger is a Triggerrer that runs another trigger in the background, so
+// that a slow trigger (such as a script which takes minutes to start a
+// service) does not hold up the request which caused it. If the other trigger
+// is still running, triggering the AsyncTrigger again does nothing, so that
+// the other trigger is only ever running once at a time.
+//
+// Since an AsyncTrigger gives no error of its own, the result of the other
+// trigger is found with Status instead.
+type AsyncTrigger struct {
+	Wrapped Triggerrer
+	status  AsyncStatus
+	done    chan struct{}
+	mutex   sync.Mutex
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"asynctrigger",
+		func() json.Unmarshaler {
+			return new(AsyncTrigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (a *AsyncTrigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Trigger config.Resource
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	wrapped, ok := FromResource(t.Trigger.Unmarshalled)
+	if !ok {
+		return config.UnexpectedResourceType
+	}
+
+	a.Wrapped = wrapped
+	return nil
+}
+
+// NewAsyncTrigger initializes an AsyncTrigger which runs the given trigger in
+// the background.
+func NewAsyncTrigger(wrapped Triggerrer) *AsyncTrigger {
+	return &AsyncTrigger{Wrapped: wrapped}
+}
+
+// Status gives the status of the most recent run of the other trigger.
+func (a *AsyncTrigger) Status() AsyncStatus {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	status := a.status
+	if status.Started != nil {
+		started := *status.Started
+		status.Started = &started
+	}
+	if status.Finished != nil {
+		finished := *status.Finished
+		status.Finished = &finished
+	}
+
+	return status
+}
+
+// Wait waits until the other trigger is not running.
+func (a *AsyncTrigger) Wait() {
+	a.mutex.Lock()
+	done := a.done
+	a.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Trigger starts the other trigger in the background for the given event
+// unless it is already running. No output is given, since the other trigger
+// will not yet have finished.
+//
+// The other trigger is not cancelled along with the context (which would
+// otherwise happen as soon as the request which caused it had finished), but
+// is cancelled along with the lifetime of the context (see Detach).
+func (a *AsyncTrigger) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	defer countInvocation("asynctrigger", &err)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.status.State == AsyncRunning {
+		_ = log.Debug(
+			"asynctrigger not starting a trigger which is already" +
+				" running",
+		)
+		return "", nil
+	}
+
+	started := time.Now()
+	a.status = AsyncStatus{
+		State:   AsyncRunning,
+		Started: &started,
+	}
+	done := make(chan struct{})
+	a.done = done
+	ctx = Detach(ctx)
+
+	_ = log.Debug("asynctrigger starting trigger in the background")
+	go func() {
+		defer close(done)
+
+		output, err := a.Wrapped.Trigger(ctx, e)
+		finished := time.Now()
+
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		a.status.Finished = &finished
+		a.status.Output = output
+		if err != nil {
+			_ = log.Err(
+				fmt.Sprintf(
+					"asynctrigger received an error from the"+
+						" background trigger: %v",
+					err,
+				),
+			)
+			a.status.State = AsyncFailed
+			a.status.Error = err.Error()
+		} else {
+			_ = log.Info("asynctrigger background trigger completed")
+			a.status.State = AsyncSucceeded
+		}
+	}()
+
+	return "", nil
+}
+
+// Unwrap implements Wrapper.
+func (a *AsyncTrigger) Unwrap() []Triggerrer {
+	return []Triggerrer{a.Wrapped}
+}
@@ -0,0 +1,172 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+// blockingTriggerrer is a Triggerrer which does not finish until it is
+// released, counting the number of times it has been run.
+type blockingTriggerrer struct {
+	release chan error
+	runs    int
+	mutex   sync.Mutex
+}
+
+func (b *blockingTriggerrer) Trigger(
+	ctx context.Context,
+	e Event,
+) (string, error) {
+	b.mutex.Lock()
+	b.runs++
+	b.mutex.Unlock()
+
+	select {
+	case err := <-b.release:
+		return "", err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (b *blockingTriggerrer) count() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.runs
+}
+
+func TestAsyncTrigger(t *testing.T) {
+	b := &blockingTriggerrer{release: make(chan error)}
+	a := NewAsyncTrigger(b)
+	assert.Equal(t, AsyncIdle, a.Status().State)
+
+	require.NoError(t, fire(a))
+	status := a.Status()
+	assert.Equal(t, AsyncRunning, status.State)
+	assert.NotNil(t, status.Started)
+	assert.Nil(t, status.Finished)
+
+	require.NoError(t, fire(a))
+	require.NoError(t, fire(a))
+
+	b.release <- nil
+	a.Wait()
+	assert.Equal(t, 1, b.count())
+	status = a.Status()
+	assert.Equal(t, AsyncSucceeded, status.State)
+	assert.NotNil(t, status.Finished)
+
+	require.NoError(t, fire(a))
+	b.release <- errors.New("the service would not start")
+	a.Wait()
+	assert.Equal(t, 2, b.count())
+	status = a.Status()
+	assert.Equal(t, AsyncFailed, status.State)
+	assert.Equal(t, "the service would not start", status.Error)
+}
+
+func TestAsyncTriggerOutput(t *testing.T) {
+	a := NewAsyncTrigger(
+		NewShellTriggerrer("/bin/sh", []string{"-c", "echo {{.Service}}"}),
+	)
+
+	output, err := a.Trigger(context.Background(), Event{Service: "wiki"})
+	require.NoError(t, err)
+	assert.Equal(t, "", output)
+
+	a.Wait()
+	assert.Equal(t, "wiki\n", a.Status().Output)
+}
+
+func TestAsyncTriggerLifetime(t *testing.T) {
+	b := &blockingTriggerrer{release: make(chan error)}
+	a := NewAsyncTrigger(b)
+
+	lifetime, stop := context.WithCancel(context.Background())
+	defer stop()
+	req, done := context.WithCancel(context.Background())
+	_, err := a.Trigger(WithLifetime(req, lifetime), Event{})
+	require.NoError(t, err)
+
+	// The request finishing does not cancel the trigger, but the end of
+	// its lifetime does.
+	done()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, AsyncRunning, a.Status().State)
+
+	stop()
+	a.Wait()
+	status := a.Status()
+	assert.Equal(t, AsyncFailed, status.State)
+	assert.Equal(t, context.Canceled.Error(), status.Error)
+}
+
+func TestAsyncStateText(t *testing.T) {
+	for _, state := range []AsyncState{
+		AsyncIdle,
+		AsyncRunning,
+		AsyncSucceeded,
+		AsyncFailed,
+	} {
+		text, err := state.MarshalText()
+		require.NoError(t, err)
+
+		var parsed AsyncState
+		require.NoError(t, parsed.UnmarshalText(text))
+		assert.Equal(t, state, parsed)
+	}
+
+	var parsed AsyncState
+	assert.Error(t, parsed.UnmarshalText([]byte("sleeping")))
+}
+
+func TestAsyncTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "asynctrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data:        `{}`,
+				Explanation: "missing trigger",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "asynctrigger",
+						"data": 42
+					}
+				}`,
+				Explanation: "bad wrapped trigger",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"trigger": {
+						"type": "shelltrigger",
+						"data": {
+							"command": "/usr/local/bin/start"
+						}
+					}
+				}`,
+				Explanation: "basic config",
+			},
+		},
+	}
+	test.Run(t)
+}
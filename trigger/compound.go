@@ -2,18 +2,115 @@ package trigger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/proidiot/gone/log"
 	"github.com/stuphlabs/pullcord/config"
 )
 
+// CompoundMode is the way in which a CompoundTrigger runs its child triggers.
+type CompoundMode int
+
+const (
+	// CompoundSequential runs the child triggers one after another,
+	// stopping after the first which fails.
+	CompoundSequential CompoundMode = iota
+	// CompoundParallelAll runs the child triggers all at once, and fails
+	// if any of them fail (but only once they have all finished).
+	CompoundParallelAll
+	// CompoundParallelAny runs the child triggers all at once, and
+	// succeeds as soon as any of them succeeds (at which point the rest
+	// are cancelled). It only fails if all of them fail.
+	CompoundParallelAny
+	// CompoundBestEffort runs the child triggers one after another, and
+	// fails if any of them fail (but only once they have all been run).
+	CompoundBestEffort
+)
+
+var compoundModeNames = []string{
+	"sequential",
+	"parallel-all",
+	"parallel-any",
+	"best-effort",
+}
+
+func (m CompoundMode) String() string {
+	if m < 0 || int(m) >= len(compoundModeNames) {
+		return "unknown"
+	}
+
+	return compoundModeNames[m]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m CompoundMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *CompoundMode) UnmarshalText(text []byte) error {
+	for i, name := range compoundModeNames {
+		if name == string(text) {
+			*m = CompoundMode(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown compound trigger mode: %s", text)
+}
+
+// CompoundError is the error given by a CompoundTrigger when more than one of
+// its child triggers may have failed. Errors has an entry for each child
+// trigger, which is nil for those which succeeded (or were never run).
+type CompoundError struct {
+	Errors []error
+}
+
+func (c *CompoundError) Error() string {
+	var failures []string
+	for i, err := range c.Errors {
+		if err != nil {
+			failures = append(
+				failures,
+				fmt.Sprintf("trigger %d: %v", i+1, err),
+			)
+		}
+	}
+
+	return fmt.Sprintf(
+		"%d of %d triggers failed: %s",
+		len(failures),
+		len(c.Errors),
+		strings.Join(failures, "; "),
+	)
+}
+
+// Unwrap gives the errors of the child triggers which failed.
+func (c *CompoundError) Unwrap() []error {
+	var errs []error
+	for _, err := range c.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
 // CompoundTrigger is a Triggerrer that allows more than one trigger to be
-// fired off at a time. It any trigger returns an error, it isn't guaranteed
-// that all triggers will fire.
+// fired off at a time. The Mode determines how the child triggers are run (and
+// so which of them are guaranteed to be run if any of them fail), and each
+// child trigger is cancelled if it has not finished within the ChildTimeout
+// (if one is given).
 type CompoundTrigger struct {
-	Triggers []Triggerrer
+	Triggers     []Triggerrer
+	Mode         CompoundMode
+	ChildTimeout time.Duration
 }
 
 func init() {
@@ -28,7 +125,9 @@ func init() {
 // UnmarshalJSON implements encoding/json.Unmarshaler.
 func (c *CompoundTrigger) UnmarshalJSON(input []byte) error {
 	var t struct {
-		Triggers []config.Resource
+		Triggers     []config.Resource
+		Mode         CompoundMode
+		ChildTimeout string
 	}
 
 	dec := json.NewDecoder(bytes.NewReader(input))
@@ -36,37 +135,178 @@ func (c *CompoundTrigger) UnmarshalJSON(input []byte) error {
 		return e
 	}
 
-	c.Triggers = make([]Triggerrer, len(t.Triggers))
-
+	c.Triggers = make([]Triggerrer, 0, len(t.Triggers))
 	for _, i := range t.Triggers {
-		th := i.Unmarshalled
-		switch th := th.(type) {
-		case Triggerrer:
-			c.Triggers = append(c.Triggers, th)
-		default:
-			_ = log.Err(
-				fmt.Sprintf(
-					"Registry value is not a"+
-						" RequestFilter: %s",
-					th,
-				),
-			)
+		th, ok := FromResource(i.Unmarshalled)
+		if !ok {
 			return config.UnexpectedResourceType
 		}
+		c.Triggers = append(c.Triggers, th)
+	}
+
+	c.Mode = t.Mode
+
+	c.ChildTimeout = 0
+	if t.ChildTimeout != "" {
+		d, e := time.ParseDuration(t.ChildTimeout)
+		if e != nil {
+			return e
+		}
+		if d < 0 {
+			return fmt.Errorf(
+				"compoundtrigger child timeout must not be"+
+					" negative, but was given: %s",
+				t.ChildTimeout,
+			)
+		}
+		c.ChildTimeout = d
 	}
 
 	return nil
 }
 
-// Trigger executes all the child triggers, exiting immediately after a single
-// failure.
-func (c *CompoundTrigger) Trigger() error {
-	_ = log.Debug("compound trigger initiated")
-	for _, t := range c.Triggers {
-		if err := t.Trigger(); err != nil {
-			return err
-		}
+// Trigger executes all the child triggers according to the Mode (or until the
+// context has been cancelled). The output of each child trigger is given, one
+// after another in the order of the child triggers. In the sequential mode,
+// the error of the child trigger which failed is given as is, while in the
+// other modes a *CompoundError is given.
+func (c *CompoundTrigger) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	defer countInvocation("compoundtrigger", &err)
+
+	_ = log.Debug(
+		fmt.Sprintf(
+			"compound trigger initiated in %s mode",
+			c.Mode.String(),
+		),
+	)
+	switch c.Mode {
+	case CompoundSequential:
+		output, err = c.sequential(ctx, e, false)
+	case CompoundBestEffort:
+		output, err = c.sequential(ctx, e, true)
+	case CompoundParallelAll:
+		output, err = c.parallel(ctx, e, false)
+	case CompoundParallelAny:
+		output, err = c.parallel(ctx, e, true)
+	default:
+		return "", fmt.Errorf(
+			"unknown compound trigger mode: %d",
+			int(c.Mode),
+		)
 	}
 	_ = log.Debug("compound trigger completed")
-	return nil
+
+	return output, err
+}
+
+// child runs the child trigger at the given index, applying the
+// ChildTimeout.
+func (c *CompoundTrigger) child(
+	ctx context.Context,
+	e Event,
+	i int,
+) (string, error) {
+	if c.ChildTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ChildTimeout)
+		defer cancel()
+	}
+
+	return c.Triggers[i].Trigger(ctx, e)
+}
+
+// sequential runs the child triggers one after another, either stopping after
+// the first failure or carrying on regardless.
+func (c *CompoundTrigger) sequential(
+	ctx context.Context,
+	e Event,
+	carryOn bool,
+) (output string, err error) {
+	errs := make([]error, len(c.Triggers))
+	failed := false
+	for i := range c.Triggers {
+		if err = ctx.Err(); err != nil {
+			if !failed {
+				return output, err
+			}
+			errs[i] = err
+			break
+		}
+
+		var o string
+		o, errs[i] = c.child(ctx, e, i)
+		output += o
+		if errs[i] != nil {
+			if !carryOn {
+				return output, errs[i]
+			}
+			failed = true
+		}
+	}
+
+	if failed {
+		return output, &CompoundError{Errors: errs}
+	}
+
+	return output, nil
+}
+
+// parallel runs the child triggers all at once, either waiting for all of them
+// to finish or only until one of them succeeds (cancelling the rest).
+func (c *CompoundTrigger) parallel(
+	ctx context.Context,
+	e Event,
+	first bool,
+) (output string, err error) {
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outputs := make([]string, len(c.Triggers))
+	errs := make([]error, len(c.Triggers))
+	var wg sync.WaitGroup
+	var once sync.Once
+	succeeded := false
+	for i := range c.Triggers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			outputs[i], errs[i] = c.child(ctx, e, i)
+			if first && errs[i] == nil {
+				once.Do(func() {
+					succeeded = true
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	output = strings.Join(outputs, "")
+	if first {
+		if succeeded || len(c.Triggers) == 0 {
+			return output, nil
+		}
+		return output, &CompoundError{Errors: errs}
+	}
+
+	for _, err = range errs {
+		if err != nil {
+			return output, &CompoundError{Errors: errs}
+		}
+	}
+
+	return output, nil
+}
+
+// Unwrap implements Wrapper.
+func (c *CompoundTrigger) Unwrap() []Triggerrer {
+	return c.Triggers
 }
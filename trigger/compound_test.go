@@ -1,8 +1,11 @@
 package trigger
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	configutil "github.com/stuphlabs/pullcord/config/util"
@@ -13,25 +16,25 @@ type counterTriggerrer struct {
 	count int
 }
 
-func (th *counterTriggerrer) Trigger() error {
+func (th *counterTriggerrer) Trigger(context.Context, Event) (string, error) {
 	if th.count >= 0 {
 		th.count++
-		return nil
+		return "", nil
 	}
 
-	return errors.New("this trigger always errors")
+	return "", errors.New("this trigger always errors")
 }
 
 func TestCompoundTriggerNoErrors(t *testing.T) {
 	th1 := &counterTriggerrer{}
 	th2 := &counterTriggerrer{}
 
-	ct := CompoundTrigger{[]Triggerrer{th1, th2}}
+	ct := CompoundTrigger{Triggers: []Triggerrer{th1, th2}}
 
-	err := ct.Trigger()
+	err := fire(&ct)
 	assert.NoError(t, err)
 
-	err = ct.Trigger()
+	err = fire(&ct)
 	assert.NoError(t, err)
 
 	assert.Equal(t, 2, th1.count)
@@ -42,9 +45,9 @@ func TestCompoundTriggerAllErrors(t *testing.T) {
 	th1 := &counterTriggerrer{-1}
 	th2 := &counterTriggerrer{-1}
 
-	ct := CompoundTrigger{[]Triggerrer{th1, th2}}
+	ct := CompoundTrigger{Triggers: []Triggerrer{th1, th2}}
 
-	err := ct.Trigger()
+	err := fire(&ct)
 	assert.Error(t, err)
 
 	assert.Equal(t, -1, th1.count)
@@ -55,15 +58,200 @@ func TestCompoundTriggerSomeErrors(t *testing.T) {
 	th1 := &counterTriggerrer{}
 	th2 := &counterTriggerrer{-1}
 
-	ct := CompoundTrigger{[]Triggerrer{th1, th2}}
+	ct := CompoundTrigger{Triggers: []Triggerrer{th1, th2}}
 
-	err := ct.Trigger()
+	err := fire(&ct)
 	assert.Error(t, err)
 
 	assert.Equal(t, 1, th1.count)
 	assert.Equal(t, -1, th2.count)
 }
 
+// slowTriggerrer is a Triggerrer which gives its output and error after its
+// delay, unless it is cancelled first.
+type slowTriggerrer struct {
+	delay  time.Duration
+	output string
+	err    error
+}
+
+func (s *slowTriggerrer) Trigger(ctx context.Context, _ Event) (string, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.output, s.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestCompoundTriggerBestEffort(t *testing.T) {
+	th1 := &counterTriggerrer{-1}
+	th2 := &counterTriggerrer{}
+	th3 := &counterTriggerrer{-1}
+
+	ct := CompoundTrigger{
+		Triggers: []Triggerrer{th1, th2, th3},
+		Mode:     CompoundBestEffort,
+	}
+
+	err := fire(&ct)
+	assert.Equal(t, 1, th2.count)
+
+	var ce *CompoundError
+	if assert.True(t, errors.As(err, &ce)) {
+		assert.Equal(t, 3, len(ce.Errors))
+		assert.Error(t, ce.Errors[0])
+		assert.NoError(t, ce.Errors[1])
+		assert.Error(t, ce.Errors[2])
+		assert.Equal(t, 2, len(ce.Unwrap()))
+	}
+	assert.Equal(
+		t,
+		"2 of 3 triggers failed: trigger 1: this trigger always errors;"+
+			" trigger 3: this trigger always errors",
+		err.Error(),
+	)
+}
+
+func TestCompoundTriggerParallelAll(t *testing.T) {
+	ct := CompoundTrigger{
+		Triggers: []Triggerrer{
+			&slowTriggerrer{delay: 200 * time.Millisecond, output: "a"},
+			&slowTriggerrer{delay: 200 * time.Millisecond, output: "b"},
+			&slowTriggerrer{delay: 200 * time.Millisecond, output: "c"},
+		},
+		Mode: CompoundParallelAll,
+	}
+
+	start := time.Now()
+	output, err := ct.Trigger(context.Background(), Event{})
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", output)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	failure := errors.New("the worker would not start")
+	ct.Triggers[0] = &slowTriggerrer{err: failure}
+	_, err = ct.Trigger(context.Background(), Event{})
+	var ce *CompoundError
+	if assert.True(t, errors.As(err, &ce)) {
+		assert.Equal(t, []error{failure}, ce.Unwrap())
+	}
+	assert.True(t, errors.Is(err, failure))
+}
+
+func TestCompoundTriggerParallelAny(t *testing.T) {
+	slow := &slowTriggerrer{delay: 10 * time.Second, output: "slow"}
+	ct := CompoundTrigger{
+		Triggers: []Triggerrer{
+			&slowTriggerrer{err: errors.New("no capacity")},
+			slow,
+			&slowTriggerrer{delay: 50 * time.Millisecond, output: "fast"},
+		},
+		Mode: CompoundParallelAny,
+	}
+
+	start := time.Now()
+	output, err := ct.Trigger(context.Background(), Event{})
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", output)
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	ct.Triggers = []Triggerrer{
+		&slowTriggerrer{err: errors.New("no capacity")},
+		&slowTriggerrer{err: errors.New("no capacity either")},
+	}
+	_, err = ct.Trigger(context.Background(), Event{})
+	var ce *CompoundError
+	if assert.True(t, errors.As(err, &ce)) {
+		assert.Equal(t, 2, len(ce.Unwrap()))
+	}
+}
+
+func TestCompoundTriggerChildTimeout(t *testing.T) {
+	for _, mode := range []CompoundMode{
+		CompoundSequential,
+		CompoundParallelAll,
+		CompoundParallelAny,
+		CompoundBestEffort,
+	} {
+		ct := CompoundTrigger{
+			Triggers: []Triggerrer{
+				&slowTriggerrer{delay: 10 * time.Second},
+			},
+			Mode:         mode,
+			ChildTimeout: 50 * time.Millisecond,
+		}
+
+		start := time.Now()
+		err := fire(&ct)
+		assert.True(
+			t,
+			errors.Is(err, context.DeadlineExceeded),
+			"%s: %v",
+			mode,
+			err,
+		)
+		assert.True(t, time.Since(start) < 5*time.Second, mode.String())
+	}
+}
+
+func TestCompoundModeText(t *testing.T) {
+	for _, mode := range []CompoundMode{
+		CompoundSequential,
+		CompoundParallelAll,
+		CompoundParallelAny,
+		CompoundBestEffort,
+	} {
+		text, err := mode.MarshalText()
+		assert.NoError(t, err)
+
+		var parsed CompoundMode
+		assert.NoError(t, parsed.UnmarshalText(text))
+		assert.Equal(t, mode, parsed)
+	}
+
+	var parsed CompoundMode
+	assert.Error(t, parsed.UnmarshalText([]byte("quorum")))
+
+	_, err := (&CompoundTrigger{Mode: 42}).Trigger(
+		context.Background(),
+		Event{},
+	)
+	assert.Error(t, err)
+}
+
+func TestCompoundTriggerUnmarshal(t *testing.T) {
+	var ct CompoundTrigger
+	assert.NoError(
+		t,
+		json.Unmarshal(
+			[]byte(`{
+				"mode": "parallel-all",
+				"childtimeout": "30s",
+				"triggers": [
+					{
+						"type": "compoundtrigger",
+						"data": {}
+					},
+					{
+						"type": "compoundtrigger",
+						"data": {}
+					}
+				]
+			}`),
+			&ct,
+		),
+	)
+
+	assert.Equal(t, CompoundParallelAll, ct.Mode)
+	assert.Equal(t, 30*time.Second, ct.ChildTimeout)
+	assert.Equal(t, 2, len(ct.Triggers))
+	for _, th := range ct.Triggers {
+		assert.NotNil(t, th)
+	}
+	assert.NoError(t, fire(&ct))
+}
+
 func TestCompoundTriggerFromConfig(t *testing.T) {
 	util.LoadPlugin()
 	test := configutil.ConfigTest{
@@ -101,6 +289,30 @@ func TestCompoundTriggerFromConfig(t *testing.T) {
 				Data:        "42",
 				Explanation: "numeric config",
 			},
+			{
+				Data: `{
+					"mode": "quorum"
+				}`,
+				Explanation: "unknown mode",
+			},
+			{
+				Data: `{
+					"mode": 2
+				}`,
+				Explanation: "numeric mode",
+			},
+			{
+				Data: `{
+					"childtimeout": "42q"
+				}`,
+				Explanation: "nonsensical child timeout",
+			},
+			{
+				Data: `{
+					"childtimeout": "-5s"
+				}`,
+				Explanation: "negative child timeout",
+			},
 		},
 		Good: []configutil.ConfigTestData{
 			{
@@ -126,6 +338,17 @@ func TestCompoundTriggerFromConfig(t *testing.T) {
 				}`,
 				Explanation: "basic valid compound trigger",
 			},
+			{
+				Data: `{
+					"mode": "best-effort",
+					"childtimeout": "2m",
+					"triggers": [{
+						"type": "compoundtrigger",
+						"data": {}
+					}]
+				}`,
+				Explanation: "compound trigger with a mode",
+			},
 		},
 	}
 	test.Run(t)
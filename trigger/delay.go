@@ -2,22 +2,62 @@ package trigger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/proidiot/gone/log"
 	"github.com/stuphlabs/pullcord/config"
 )
 
+// ErrDelayStopped indicates that a DelayTrigger has been stopped, and so will
+// not run its delayed trigger again until it has been started again.
+var ErrDelayStopped = errors.New("delaytrigger has been stopped")
+
+// DelayStatus is a snapshot of the status of a DelayTrigger. Times which are
+// not known (such as Scheduled when nothing is pending) are omitted from the
+// JSON form.
+type DelayStatus struct {
+	Scheduled *time.Time `json:"scheduled,omitempty"`
+	Running   bool       `json:"running"`
+	LastRun   *time.Time `json:"lastrun,omitempty"`
+	LastError string     `json:"lasterror,omitempty"`
+}
+
+// DelayReporter is implemented by triggers which run another trigger after a
+// delay, so that a pending run can be inspected and cancelled.
+type DelayReporter interface {
+	DelayStatus() DelayStatus
+	Cancel() bool
+}
+
 // DelayTrigger is a Triggerrer that delays the execution of another
 // trigger for at least a minimum amount of time after the most recent request.
 // The obvious analogy would be a screen saver, which will start after a
 // certain period has elapsed, but the timer is reset quite often.
+//
+// A pending run of the delayed trigger can be seen with DelayStatus and
+// cancelled with Cancel. Stop (or StopBackground, which is called when the
+// server shuts down for a DelayTrigger created from a config) cancels any
+// pending run, cancels the delayed trigger if it is running, and keeps the
+// delayed trigger from being run again.
 type DelayTrigger struct {
 	DelayedTrigger Triggerrer
 	Delay          time.Duration
-	c              chan<- interface{}
+	mutex          sync.Mutex
+	timer          *time.Timer
+	pending        uint64
+	event          Event
+	ctx            context.Context
+	scheduled      time.Time
+	stopped        bool
+	cancelRun      context.CancelFunc
+	done           chan struct{}
+	lastRun        time.Time
+	lastError      string
 }
 
 func init() {
@@ -41,19 +81,11 @@ func (d *DelayTrigger) UnmarshalJSON(input []byte) error {
 		return e
 	}
 
-	dt := t.DelayedTrigger.Unmarshalled
-	switch dt := dt.(type) {
-	case Triggerrer:
-		d.DelayedTrigger = dt
-	default:
-		_ = log.Err(
-			fmt.Sprintf(
-				"Registry value is not a Trigger: %s",
-				dt,
-			),
-		)
+	dt, ok := FromResource(t.DelayedTrigger.Unmarshalled)
+	if !ok {
 		return config.UnexpectedResourceType
 	}
+	d.DelayedTrigger = dt
 
 	dp, e := time.ParseDuration(t.Delay)
 	if e != nil {
@@ -64,70 +96,195 @@ func (d *DelayTrigger) UnmarshalJSON(input []byte) error {
 	return nil
 }
 
-// NewDelayTrigger initializes a DelayTrigger. It might not be strictly
-// necessary anymore.
+// NewDelayTrigger initializes a DelayTrigger.
 func NewDelayTrigger(
 	delayedTrigger Triggerrer,
 	delay time.Duration,
 ) *DelayTrigger {
 	return &DelayTrigger{
-		delayedTrigger,
-		delay,
-		nil,
-	}
-}
-
-func delaytrigger(
-	tr Triggerrer,
-	dla time.Duration,
-	ac <-chan interface{},
-) {
-	tmr := time.NewTimer(dla)
-	for {
-		select {
-		case _, ok := <-ac:
-			if tmr != nil && !tmr.Stop() {
-				<-tmr.C
-			}
-			if !ok {
-				return
-			}
-
-			tmr.Reset(dla)
-			_ = log.Debug("delaytrigger has been reset")
-		case <-tmr.C:
-			_ = log.Debug("delaytrigger has expired")
-			if err := tr.Trigger(); err != nil {
-				_ = log.Err(
-					fmt.Sprintf(
-						"delaytrigger received an"+
-							" error: %#v",
-						err,
-					),
-				)
-			}
-			tmr.Stop()
-		}
+		DelayedTrigger: delayedTrigger,
+		Delay:          delay,
 	}
 }
 
 // Trigger sets or resets the delay after which it will execute the child
-// trigger. The child trigger will be executed no sooner than the delay time
-// after any particular call, but subsequent calls may extend that time out
-// further (possibly indefinitely).
-func (d *DelayTrigger) Trigger() error {
-	_ = log.Debug("delaytrigger initiated")
-	if d.c == nil {
-		_ = log.Debug("creating delay timer")
-		fc := make(chan interface{})
-		d.c = fc
-
-		go delaytrigger(d.DelayedTrigger, d.Delay, fc)
+// trigger, without waiting on the child trigger (even if it is running). The
+// child trigger will be executed no sooner than the delay time after any
+// particular call, but subsequent calls may extend that time out further
+// (possibly indefinitely). The child trigger is given the event of the most
+// recent call, and a context which is only cancelled along with the lifetime
+// of the context of that call (see Detach), since the context of the call
+// itself will likely have been cancelled long before then.
+func (d *DelayTrigger) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	defer countInvocation("delaytrigger", &err)
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.stopped {
+		return "", ErrDelayStopped
+	}
+
+	if d.timer != nil {
+		_ = log.Debug("delaytrigger resetting delay timer")
+		d.timer.Stop()
 	} else {
-		_ = log.Debug("resetting delay timer")
-		d.c <- nil
+		_ = log.Debug("delaytrigger creating delay timer")
 	}
 
-	_ = log.Debug("delaytrigger completed")
+	d.pending++
+	pending := d.pending
+	d.event = e
+	d.ctx = Detach(ctx)
+	d.scheduled = time.Now().Add(d.Delay)
+	d.timer = time.AfterFunc(
+		d.Delay,
+		func() {
+			d.fire(pending)
+		},
+	)
+
+	return "", nil
+}
+
+// fire runs the delayed trigger, unless the given pending run has since been
+// reset or cancelled.
+func (d *DelayTrigger) fire(pending uint64) {
+	d.mutex.Lock()
+	if pending != d.pending || d.timer == nil {
+		d.mutex.Unlock()
+		return
+	}
+	_ = log.Debug("delaytrigger has expired")
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	e := d.event
+	done := make(chan struct{})
+	defer close(done)
+	d.timer = nil
+	d.ctx = nil
+	d.scheduled = time.Time{}
+	d.cancelRun = cancel
+	d.done = done
+	d.mutex.Unlock()
+
+	_, err := d.DelayedTrigger.Trigger(ctx, e)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"delaytrigger received an error: %#v",
+				err,
+			),
+		)
+	}
+
+	d.mutex.Lock()
+	d.lastRun = time.Now()
+	d.lastError = ""
+	if err != nil {
+		d.lastError = err.Error()
+	}
+	if d.done == done {
+		d.cancelRun = nil
+		d.done = nil
+	}
+	d.mutex.Unlock()
+}
+
+// Cancel cancels any pending run of the delayed trigger, reporting whether
+// there was one. A delayed trigger which is already running is not affected,
+// and the DelayTrigger can still be triggered again.
+func (d *DelayTrigger) Cancel() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.cancel()
+}
+
+// cancel cancels any pending run of the delayed trigger. The mutex must be
+// held.
+func (d *DelayTrigger) cancel() bool {
+	if d.timer == nil {
+		return false
+	}
+
+	_ = log.Info("delaytrigger cancelling the pending delayed trigger")
+	d.timer.Stop()
+	d.timer = nil
+	d.pending++
+	d.ctx = nil
+	d.scheduled = time.Time{}
+
+	return true
+}
+
+// Stop cancels any pending run of the delayed trigger, and cancels the delayed
+// trigger if it is running (waiting for it to finish). Until Start is called,
+// the DelayTrigger gives ErrDelayStopped rather than setting the delay.
+func (d *DelayTrigger) Stop() {
+	d.mutex.Lock()
+	d.stopped = true
+	d.cancel()
+	cancelRun := d.cancelRun
+	done := d.done
+	d.mutex.Unlock()
+
+	if cancelRun != nil {
+		cancelRun()
+		<-done
+	}
+}
+
+// Start allows a DelayTrigger which has been stopped to be triggered again.
+func (d *DelayTrigger) Start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.stopped = false
+}
+
+// StartBackground implements .../config.Backgrounder (see Start).
+func (d *DelayTrigger) StartBackground() error {
+	d.Start()
 	return nil
 }
+
+// StopBackground implements .../config.Backgrounder (see Stop).
+func (d *DelayTrigger) StopBackground() error {
+	d.Stop()
+	return nil
+}
+
+// DelayStatus gives a snapshot of the status of the DelayTrigger, including
+// when the delayed trigger is scheduled to run.
+func (d *DelayTrigger) DelayStatus() DelayStatus {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var status DelayStatus
+	if d.timer != nil {
+		scheduled := d.scheduled
+		status.Scheduled = &scheduled
+	}
+	status.Running = d.done != nil
+	if !d.lastRun.IsZero() {
+		lastRun := d.lastRun
+		status.LastRun = &lastRun
+	}
+	status.LastError = d.lastError
+
+	return status
+}
+
+// Unwrap implements Wrapper.
+func (d *DelayTrigger) Unwrap() []Triggerrer {
+	return []Triggerrer{d.DelayedTrigger}
+}
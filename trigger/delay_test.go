@@ -1,132 +1,314 @@
 package trigger
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	configutil "github.com/stuphlabs/pullcord/config/util"
 	"github.com/stuphlabs/pullcord/util"
 )
 
+// syncCounter is a counterTriggerrer which may be safely checked (and
+// changed) while a DelayTrigger runs it in the background, and which reports
+// each time it is run so that the tests can wait for it rather than guessing
+// how long to sleep.
+type syncCounter struct {
+	mutex sync.Mutex
+	count int
+	runs  chan time.Time
+}
+
+func newSyncCounter(count int) *syncCounter {
+	return &syncCounter{
+		count: count,
+		runs:  make(chan time.Time, 16),
+	}
+}
+
+func (c *syncCounter) Trigger(context.Context, Event) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	defer func() {
+		select {
+		case c.runs <- time.Now():
+		default:
+		}
+	}()
+
+	if c.count >= 0 {
+		c.count++
+		return "", nil
+	}
+
+	return "", errors.New("this trigger always errors")
+}
+
+func (c *syncCounter) get() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.count
+}
+
+func (c *syncCounter) set(count int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.count = count
+}
+
+// wait waits for the counter to be run, giving the time at which it was run.
+// The test fails if the counter is not run within waitTimeout.
+func (c *syncCounter) wait(t *testing.T) time.Time {
+	select {
+	case ran := <-c.runs:
+		return ran
+	case <-time.After(waitTimeout):
+		t.Fatal("the delayed trigger was never run")
+		return time.Time{}
+	}
+}
+
+// The delays in these tests are given in units of tick. Since a delayed
+// trigger can never run early, the tests only check that it ran no sooner
+// than it should have, and wait up to waitTimeout (which is far longer than
+// any of the delays) for it to run at all, so that a slow machine cannot make
+// them fail.
+const (
+	tick        = 100 * time.Millisecond
+	waitTimeout = 10 * time.Second
+)
+
+// waitForLastRun waits for the delayed trigger of the given DelayTrigger to
+// have finished running, giving the status from then.
+func waitForLastRun(t *testing.T, dt *DelayTrigger) DelayStatus {
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		status := dt.DelayStatus()
+		if status.LastRun != nil && !status.Running {
+			return status
+		}
+		require.True(
+			t,
+			time.Now().Before(deadline),
+			"the delayed trigger never finished running",
+		)
+		time.Sleep(tick / 10)
+	}
+}
+
 func TestDelayTriggerSingleDelay(t *testing.T) {
-	cth := &counterTriggerrer{}
+	cth := newSyncCounter(0)
 
-	dt := NewDelayTrigger(cth, time.Second)
+	dt := NewDelayTrigger(cth, 2*tick)
 
-	err := dt.Trigger()
+	start := time.Now()
+	err := fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, 0, cth.count)
-
-	time.Sleep(2 * time.Second)
 
-	assert.Equal(t, 1, cth.count)
+	ran := cth.wait(t)
+	assert.False(t, ran.Before(start.Add(2*tick)))
+	assert.Equal(t, 1, cth.get())
 }
 
 func TestDelayTriggerDoubleDelay(t *testing.T) {
-	cth := &counterTriggerrer{}
+	cth := newSyncCounter(0)
 
 	dt := NewDelayTrigger(
 		cth,
-		3*time.Second,
+		10*tick,
 	)
 
-	err := dt.Trigger()
+	err := fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, 0, cth.count)
 
-	time.Sleep(2 * time.Second)
-	assert.Equal(t, 0, cth.count)
-	err = dt.Trigger()
+	time.Sleep(tick)
+	second := time.Now()
+	err = fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, 0, cth.count)
 
-	time.Sleep(2 * time.Second)
-	// the trigger would have definitely fired by now if the second delay
+	// the trigger would have run sooner than this if the second delay
 	// hadn't occurred when it did
-	assert.Equal(t, 0, cth.count)
-
-	time.Sleep(2 * time.Second)
-	assert.Equal(t, 1, cth.count)
+	ran := cth.wait(t)
+	assert.False(t, ran.Before(second.Add(10*tick)))
+	assert.Equal(t, 1, cth.get())
 }
 
 func TestDelayTriggerErrorMasking(t *testing.T) {
-	cth := &counterTriggerrer{-1}
+	cth := newSyncCounter(-1)
 
 	dt := NewDelayTrigger(
 		cth,
-		time.Second,
+		2*tick,
 	)
 
-	err := dt.Trigger()
+	err := fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, -1, cth.count)
 
-	time.Sleep(2 * time.Second)
-
-	assert.Equal(t, -1, cth.count)
+	cth.wait(t)
+	status := waitForLastRun(t, dt)
+	assert.Equal(t, -1, cth.get())
+	assert.Equal(t, "this trigger always errors", status.LastError)
 }
 
 func TestDelayTriggerReplaceError(t *testing.T) {
-	cth := &counterTriggerrer{-1}
+	cth := newSyncCounter(-1)
 
 	dt := NewDelayTrigger(
 		cth,
-		3*time.Second,
+		10*tick,
 	)
 
-	err := dt.Trigger()
+	err := fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, -1, cth.count)
 
-	time.Sleep(2 * time.Second)
-	assert.Equal(t, -1, cth.count)
-	err = dt.Trigger()
+	time.Sleep(tick)
+	second := time.Now()
+	err = fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, -1, cth.count)
-
-	time.Sleep(2 * time.Second)
-	// the trigger would have definitely fired by now if the second delay
-	// hadn't occurred when it did
-	assert.Equal(t, -1, cth.count)
 
 	// removes error situation
-	cth.count = 0
-	assert.Equal(t, 0, cth.count)
+	cth.set(0)
+	assert.Equal(t, 0, cth.get())
 
-	time.Sleep(2 * time.Second)
-	assert.Equal(t, 1, cth.count)
+	ran := cth.wait(t)
+	assert.False(t, ran.Before(second.Add(10*tick)))
+	assert.Equal(t, 1, cth.get())
+	assert.Equal(t, "", waitForLastRun(t, dt).LastError)
 }
 
 func TestDelayTriggerIntroduceError(t *testing.T) {
-	cth := &counterTriggerrer{}
+	cth := newSyncCounter(0)
 
 	dt := NewDelayTrigger(
 		cth,
-		3*time.Second,
+		10*tick,
 	)
 
-	err := dt.Trigger()
+	err := fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, 0, cth.count)
 
-	time.Sleep(2 * time.Second)
-	assert.Equal(t, 0, cth.count)
-	err = dt.Trigger()
+	time.Sleep(tick)
+	second := time.Now()
+	err = fire(dt)
 	assert.NoError(t, err)
-	assert.Equal(t, 0, cth.count)
 
 	// introduces error situation
-	cth.count = -1
-	assert.Equal(t, -1, cth.count)
+	cth.set(-1)
+	assert.Equal(t, -1, cth.get())
+
+	ran := cth.wait(t)
+	assert.False(t, ran.Before(second.Add(10*tick)))
+	assert.Equal(t, -1, cth.get())
+	assert.Equal(
+		t,
+		"this trigger always errors",
+		waitForLastRun(t, dt).LastError,
+	)
+}
 
-	time.Sleep(2 * time.Second)
-	// the trigger would have definitely fired by now if the second delay
-	// hadn't occurred when it did
-	assert.Equal(t, -1, cth.count)
+func TestDelayTriggerResetDoesNotBlock(t *testing.T) {
+	cth := newSyncCounter(0)
+	dt := NewDelayTrigger(cth, 2*tick)
+
+	// Waiting on the delay for each of the calls would take minutes.
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, fire(dt))
+	}
+	last := time.Now()
+	assert.True(t, last.Sub(start) < waitTimeout)
+
+	ran := cth.wait(t)
+	assert.False(t, ran.Before(last.Add(2*tick)))
+
+	time.Sleep(4 * tick)
+	assert.Equal(t, 1, cth.get())
+}
+
+func TestDelayTriggerStatus(t *testing.T) {
+	cth := newSyncCounter(0)
+	dt := NewDelayTrigger(cth, 2*tick)
+
+	status := dt.DelayStatus()
+	assert.Nil(t, status.Scheduled)
+	assert.Nil(t, status.LastRun)
+	assert.False(t, status.Running)
+
+	before := time.Now()
+	require.NoError(t, fire(dt))
+	status = dt.DelayStatus()
+	require.NotNil(t, status.Scheduled)
+	assert.False(t, status.Scheduled.Before(before.Add(2*tick)))
+	assert.False(t, status.Scheduled.After(time.Now().Add(2*tick)))
+
+	status = waitForLastRun(t, dt)
+	assert.Nil(t, status.Scheduled)
+	assert.NotNil(t, status.LastRun)
+	assert.Equal(t, "", status.LastError)
+}
 
-	time.Sleep(2 * time.Second)
-	assert.Equal(t, -1, cth.count)
+func TestDelayTriggerCancel(t *testing.T) {
+	cth := newSyncCounter(0)
+	dt := NewDelayTrigger(cth, 2*tick)
+
+	assert.False(t, dt.Cancel())
+
+	require.NoError(t, fire(dt))
+	assert.True(t, dt.Cancel())
+	assert.False(t, dt.Cancel())
+	assert.Nil(t, dt.DelayStatus().Scheduled)
+
+	time.Sleep(4 * tick)
+	assert.Equal(t, 0, cth.get())
+
+	// The delay can still be set again after having been cancelled.
+	require.NoError(t, fire(dt))
+	cth.wait(t)
+	assert.Equal(t, 1, cth.get())
+}
+
+func TestDelayTriggerStop(t *testing.T) {
+	cth := newSyncCounter(0)
+	dt := NewDelayTrigger(cth, 2*tick)
+
+	require.NoError(t, fire(dt))
+	require.NoError(t, dt.StopBackground())
+	assert.Nil(t, dt.DelayStatus().Scheduled)
+	assert.Equal(t, ErrDelayStopped, fire(dt))
+
+	time.Sleep(4 * tick)
+	assert.Equal(t, 0, cth.get())
+
+	require.NoError(t, dt.StartBackground())
+	require.NoError(t, fire(dt))
+	cth.wait(t)
+	assert.Equal(t, 1, cth.get())
+}
+
+func TestDelayTriggerStopRunning(t *testing.T) {
+	b := &blockingTriggerrer{release: make(chan error)}
+	dt := NewDelayTrigger(b, tick)
+
+	require.NoError(t, fire(dt))
+	deadline := time.Now().Add(waitTimeout)
+	for b.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(tick / 10)
+	}
+	require.Equal(t, 1, b.count())
+	assert.True(t, dt.DelayStatus().Running)
+
+	// Stop must cancel the running trigger and wait for it to finish.
+	dt.Stop()
+	status := dt.DelayStatus()
+	assert.False(t, status.Running)
+	assert.Equal(t, context.Canceled.Error(), status.LastError)
 }
 
 func TestDelayTriggerFromConfig(t *testing.T) {
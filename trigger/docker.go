@@ -0,0 +1,167 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/docker"
+)
+
+const (
+	// DockerStart is the DockerTrigger action which starts a container.
+	DockerStart = "start"
+	// DockerStop is the DockerTrigger action which stops a container.
+	DockerStop = "stop"
+	// DockerPause is the DockerTrigger action which pauses a container.
+	DockerPause = "pause"
+	// DockerUnpause is the DockerTrigger action which unpauses a
+	// container.
+	DockerUnpause = "unpause"
+)
+
+// DockerTrigger is a Triggerrer that starts, stops, pauses, or unpauses a
+// container using the Docker Engine API. A container which is already in the
+// requested state is left as it is.
+//
+// When stopping a container, the container is given StopTimeout to stop
+// before it is killed, or the default of the container if StopTimeout is
+// negative.
+type DockerTrigger struct {
+	Client      *docker.Client
+	Container   string
+	Action      string
+	StopTimeout time.Duration
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"dockertrigger",
+		func() json.Unmarshaler {
+			return new(DockerTrigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (d *DockerTrigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Host        string
+		APIVersion  string
+		Container   string
+		Action      string
+		StopTimeout string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Container == "" {
+		return fmt.Errorf("dockertrigger requires a container")
+	}
+
+	switch t.Action {
+	case DockerStart, DockerStop, DockerPause, DockerUnpause:
+	default:
+		return fmt.Errorf(
+			"dockertrigger action must be one of start, stop,"+
+				" pause, or unpause, but was given: %s",
+			t.Action,
+		)
+	}
+
+	d.StopTimeout = -1
+	if t.StopTimeout != "" {
+		dur, e := time.ParseDuration(t.StopTimeout)
+		if e != nil {
+			return e
+		}
+		d.StopTimeout = dur
+	}
+
+	c, e := docker.NewClient(t.Host, t.APIVersion)
+	if e != nil {
+		return e
+	}
+
+	d.Client = c
+	d.Container = t.Container
+	d.Action = t.Action
+
+	return nil
+}
+
+// NewDockerTrigger initializes a DockerTrigger which performs the given action
+// on the given container.
+func NewDockerTrigger(
+	client *docker.Client,
+	container string,
+	action string,
+) *DockerTrigger {
+	return &DockerTrigger{
+		Client:      client,
+		Container:   container,
+		Action:      action,
+		StopTimeout: -1,
+	}
+}
+
+// Trigger performs the action on the container.
+func (d *DockerTrigger) Trigger(
+	ctx context.Context,
+	_ Event,
+) (output string, err error) {
+	defer countInvocation("dockertrigger", &err)
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	_ = log.Debug(
+		fmt.Sprintf(
+			"dockertrigger running %s on container: %s",
+			d.Action,
+			d.Container,
+		),
+	)
+
+	switch d.Action {
+	case DockerStart:
+		err = d.Client.Start(ctx, d.Container)
+	case DockerStop:
+		err = d.Client.Stop(ctx, d.Container, d.StopTimeout)
+	case DockerPause:
+		err = d.Client.Pause(ctx, d.Container)
+	case DockerUnpause:
+		err = d.Client.Unpause(ctx, d.Container)
+	default:
+		err = fmt.Errorf("dockertrigger unknown action: %s", d.Action)
+	}
+
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"dockertrigger failed to %s container %s: %v",
+				d.Action,
+				d.Container,
+				err,
+			),
+		)
+		return "", err
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"dockertrigger ran %s on container: %s",
+			d.Action,
+			d.Container,
+		),
+	)
+	return "", nil
+}
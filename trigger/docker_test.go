@@ -0,0 +1,138 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/docker"
+	"github.com/stuphlabs/pullcord/docker/dockertest"
+)
+
+func TestDockerTrigger(t *testing.T) {
+	e, err := dockertest.NewEngine()
+	require.NoError(t, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	e.SetContainer("wiki", docker.ContainerState{Status: "exited"})
+
+	c, err := docker.NewClient(e.Host, "")
+	require.NoError(t, err)
+
+	state := func() docker.ContainerState {
+		s, present := e.Container("wiki")
+		require.True(t, present)
+		return s
+	}
+
+	assert.NoError(t, fire(NewDockerTrigger(c, "wiki", DockerStart)))
+	assert.True(t, state().Running)
+
+	assert.NoError(t, fire(NewDockerTrigger(c, "wiki", DockerPause)))
+	assert.True(t, state().Paused)
+
+	assert.NoError(t, fire(NewDockerTrigger(c, "wiki", DockerUnpause)))
+	assert.False(t, state().Paused)
+
+	assert.NoError(t, fire(NewDockerTrigger(c, "wiki", DockerStop)))
+	assert.False(t, state().Running)
+
+	assert.Error(t, fire(NewDockerTrigger(c, "nope", DockerStart)))
+	assert.Error(t, fire(NewDockerTrigger(c, "wiki", "explode")))
+}
+
+func TestDockerTriggerCancelled(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(_ http.ResponseWriter, _ *http.Request) {
+				<-release
+			},
+		),
+	)
+	defer s.Close()
+	defer close(release)
+
+	c, err := docker.NewClient(s.URL, "")
+	require.NoError(t, err)
+	c.Timeout = time.Hour
+
+	elapsed, err := fireCancelled(
+		NewDockerTrigger(c, "wiki", DockerStart),
+		200*time.Millisecond,
+	)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.True(t, elapsed < 5*time.Second, elapsed.String())
+}
+
+func TestDockerTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "dockertrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"action": "start"
+				}`,
+				Explanation: "missing container",
+			},
+			{
+				Data: `{
+					"container": "wiki",
+					"action": "explode"
+				}`,
+				Explanation: "unknown action",
+			},
+			{
+				Data: `{
+					"host": "ftp://127.0.0.1",
+					"container": "wiki",
+					"action": "start"
+				}`,
+				Explanation: "unsupported host",
+			},
+			{
+				Data: `{
+					"container": "wiki",
+					"action": "stop",
+					"stoptimeout": "42q"
+				}`,
+				Explanation: "nonsensical stop timeout",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"container": "wiki",
+					"action": "start"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"host": "tcp://127.0.0.1:2375",
+					"apiversion": "1.41",
+					"container": "wiki",
+					"action": "stop",
+					"stoptimeout": "30s"
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -0,0 +1,227 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+const (
+	// EC2Start is the EC2Trigger action which starts instances.
+	EC2Start = "start"
+	// EC2Stop is the EC2Trigger action which stops instances.
+	EC2Stop = "stop"
+	// EC2Describe is the EC2Trigger action which only checks that the
+	// instances exist, logging their state.
+	EC2Describe = "describe"
+)
+
+// DefaultEC2WaitTimeout is how long an EC2Trigger will wait for its instances
+// to reach the requested state, if no other timeout has been specified.
+const DefaultEC2WaitTimeout = 5 * time.Minute
+
+// DefaultEC2PollInterval is how often an EC2Trigger checks the state of its
+// instances while waiting, if no other interval has been specified.
+const DefaultEC2PollInterval = 5 * time.Second
+
+// EC2Trigger is a Triggerrer that starts or stops EC2 instances (or instances
+// of any EC2-compatible API). Unless NoWait is set, the trigger does not
+// return until the instances are running (or stopped), or until WaitTimeout
+// (or DefaultEC2WaitTimeout) has passed, in which case an error is given.
+type EC2Trigger struct {
+	Client       *aws.EC2
+	Instances    []string
+	Action       string
+	NoWait       bool
+	WaitTimeout  time.Duration
+	PollInterval time.Duration
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"ec2trigger",
+		func() json.Unmarshaler {
+			return new(EC2Trigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (e *EC2Trigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Region           string
+		Endpoint         string
+		AccessKeyID      string
+		SecretAccessKey  string
+		SessionToken     string
+		MetadataEndpoint string
+		Instances        []string
+		Action           string
+		NoWait           bool
+		WaitTimeout      string
+		PollInterval     string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if err := dec.Decode(&t); err != nil {
+		return err
+	}
+
+	if len(t.Instances) == 0 {
+		return fmt.Errorf("ec2trigger requires at least one instance")
+	}
+
+	if (t.AccessKeyID == "") != (t.SecretAccessKey == "") {
+		return fmt.Errorf(
+			"ec2trigger requires an access key ID and secret access" +
+				" key to be given together",
+		)
+	}
+
+	switch t.Action {
+	case EC2Start, EC2Stop, EC2Describe:
+	default:
+		return fmt.Errorf(
+			"ec2trigger action must be one of start, stop, or"+
+				" describe, but was given: %s",
+			t.Action,
+		)
+	}
+
+	e.WaitTimeout = 0
+	if t.WaitTimeout != "" {
+		d, err := time.ParseDuration(t.WaitTimeout)
+		if err != nil {
+			return err
+		}
+		e.WaitTimeout = d
+	}
+
+	e.PollInterval = 0
+	if t.PollInterval != "" {
+		d, err := time.ParseDuration(t.PollInterval)
+		if err != nil {
+			return err
+		}
+		e.PollInterval = d
+	}
+
+	c := aws.NewEC2(t.Region)
+	c.Endpoint = t.Endpoint
+	c.Credentials = aws.Credentials{
+		AccessKeyID:     t.AccessKeyID,
+		SecretAccessKey: t.SecretAccessKey,
+		SessionToken:    t.SessionToken,
+	}
+	c.Metadata = aws.NewInstanceMetadata(t.MetadataEndpoint)
+
+	e.Client = c
+	e.Instances = t.Instances
+	e.Action = t.Action
+	e.NoWait = t.NoWait
+
+	return nil
+}
+
+// NewEC2Trigger initializes an EC2Trigger which performs the given action on
+// the given instances.
+func NewEC2Trigger(
+	client *aws.EC2,
+	action string,
+	instances ...string,
+) *EC2Trigger {
+	return &EC2Trigger{
+		Client:    client,
+		Instances: instances,
+		Action:    action,
+	}
+}
+
+func (e *EC2Trigger) wait(ctx context.Context, state string) error {
+	if e.NoWait {
+		return nil
+	}
+
+	timeout := e.WaitTimeout
+	if timeout <= 0 {
+		timeout = DefaultEC2WaitTimeout
+	}
+	interval := e.PollInterval
+	if interval <= 0 {
+		interval = DefaultEC2PollInterval
+	}
+
+	return e.Client.WaitForState(
+		ctx,
+		state,
+		timeout,
+		interval,
+		e.Instances...,
+	)
+}
+
+// Trigger performs the action on the instances, giving up (without waiting
+// any further) if the context is cancelled.
+func (e *EC2Trigger) Trigger(
+	ctx context.Context,
+	_ Event,
+) (output string, err error) {
+	defer countInvocation("ec2trigger", &err)
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	_ = log.Debug(
+		fmt.Sprintf(
+			"ec2trigger running %s on instances: %v",
+			e.Action,
+			e.Instances,
+		),
+	)
+
+	var states map[string]string
+	switch e.Action {
+	case EC2Start:
+		states, err = e.Client.StartInstances(ctx, e.Instances...)
+		if err == nil {
+			err = e.wait(ctx, aws.InstanceRunning)
+		}
+	case EC2Stop:
+		states, err = e.Client.StopInstances(ctx, e.Instances...)
+		if err == nil {
+			err = e.wait(ctx, aws.InstanceStopped)
+		}
+	case EC2Describe:
+		states, err = e.Client.DescribeInstances(ctx, e.Instances...)
+	default:
+		err = fmt.Errorf("ec2trigger unknown action: %s", e.Action)
+	}
+
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"ec2trigger failed to %s instances %v: %v",
+				e.Action,
+				e.Instances,
+				err,
+			),
+		)
+		return "", err
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"ec2trigger ran %s on instances: %v",
+			e.Action,
+			states,
+		),
+	)
+	return "", nil
+}
@@ -0,0 +1,170 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/aws/awstest"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+func getEC2Trigger(action string) (*EC2Trigger, *awstest.EC2) {
+	f := awstest.NewEC2()
+	f.Transitions = 2
+	f.SetInstance("i-0123", aws.InstanceStopped)
+	f.SetInstance("i-4567", aws.InstanceStopped)
+
+	c := aws.NewEC2("us-west-2")
+	c.Endpoint = f.URL
+	c.Credentials = aws.Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	}
+	c.Metadata = nil
+
+	e := NewEC2Trigger(c, action, "i-0123", "i-4567")
+	e.WaitTimeout = time.Second
+	e.PollInterval = time.Millisecond
+
+	return e, f
+}
+
+func TestEC2TriggerStart(t *testing.T) {
+	e, f := getEC2Trigger(EC2Start)
+	defer f.Close()
+
+	require.NoError(t, fire(e))
+	for _, id := range []string{"i-0123", "i-4567"} {
+		state, _ := f.Instance(id)
+		assert.Equal(t, aws.InstanceRunning, state)
+	}
+	assert.Equal(t, "StartInstances", f.Actions[0])
+	assert.Equal(t, "DescribeInstances", f.Actions[len(f.Actions)-1])
+
+	e.Action = EC2Stop
+	require.NoError(t, fire(e))
+	for _, id := range []string{"i-0123", "i-4567"} {
+		state, _ := f.Instance(id)
+		assert.Equal(t, aws.InstanceStopped, state)
+	}
+}
+
+func TestEC2TriggerNoWait(t *testing.T) {
+	e, f := getEC2Trigger(EC2Start)
+	defer f.Close()
+
+	e.NoWait = true
+	require.NoError(t, fire(e))
+	assert.Equal(t, []string{"StartInstances"}, f.Actions)
+	state, _ := f.Instance("i-0123")
+	assert.Equal(t, aws.InstancePending, state)
+}
+
+func TestEC2TriggerWaitTimeout(t *testing.T) {
+	e, f := getEC2Trigger(EC2Start)
+	defer f.Close()
+
+	f.Transitions = 1000
+	e.WaitTimeout = 5 * time.Millisecond
+	assert.Error(t, fire(e))
+}
+
+func TestEC2TriggerCancelled(t *testing.T) {
+	e, f := getEC2Trigger(EC2Start)
+	defer f.Close()
+
+	f.Transitions = 1000
+	e.WaitTimeout = time.Hour
+	e.PollInterval = time.Minute
+	elapsed, err := fireCancelled(e, 200*time.Millisecond)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.True(t, elapsed < 5*time.Second, elapsed.String())
+	assert.Contains(t, f.Actions, "DescribeInstances")
+}
+
+func TestEC2TriggerDescribe(t *testing.T) {
+	e, f := getEC2Trigger(EC2Describe)
+	defer f.Close()
+
+	require.NoError(t, fire(e))
+	assert.Equal(t, []string{"DescribeInstances"}, f.Actions)
+
+	e.Instances = append(e.Instances, "i-89ab")
+	assert.Error(t, fire(e))
+}
+
+func TestEC2TriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "ec2trigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"action": "start"
+				}`,
+				Explanation: "missing instances",
+			},
+			{
+				Data: `{
+					"instances": ["i-0123"],
+					"action": "reboot"
+				}`,
+				Explanation: "unknown action",
+			},
+			{
+				Data: `{
+					"instances": ["i-0123"],
+					"action": "start",
+					"waittimeout": "42q"
+				}`,
+				Explanation: "nonsensical wait timeout",
+			},
+			{
+				Data: `{
+					"instances": ["i-0123"],
+					"action": "start",
+					"secretaccesskey": "y"
+				}`,
+				Explanation: "secret without access key",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"instances": ["i-0123"],
+					"action": "start"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"region": "us-east-1",
+					"endpoint": "http://localhost:4566/",
+					"metadataendpoint": "http://localhost:1338",
+					"accesskeyid": "x",
+					"secretaccesskey": "y",
+					"sessiontoken": "z",
+					"instances": ["i-0123", "i-4567"],
+					"action": "stop",
+					"nowait": false,
+					"waittimeout": "10m",
+					"pollinterval": "10s"
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
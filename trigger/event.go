@@ -0,0 +1,100 @@
+package trigger
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// sensitiveHeaders are the request headers which are left out of a
+// RequestInfo, so that credentials are not handed to triggers (where they
+// might end up in command lines or logs).
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+}
+
+// RequestInfo describes the request which caused a trigger to be run.
+type RequestInfo struct {
+	Method     string
+	Host       string
+	Path       string
+	Query      string
+	RemoteAddr string
+	Header     http.Header
+}
+
+// NewRequestInfo gives a description of the given request (which may be
+// nil), leaving out any credentials in its headers.
+func NewRequestInfo(req *http.Request) RequestInfo {
+	if req == nil {
+		return RequestInfo{}
+	}
+
+	header := make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	for _, k := range sensitiveHeaders {
+		header.Del(k)
+	}
+
+	return RequestInfo{
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       req.URL.Path,
+		Query:      req.URL.RawQuery,
+		RemoteAddr: req.RemoteAddr,
+		Header:     header,
+	}
+}
+
+// Event describes the occasion on which a trigger is run: the service it is
+// run for, which of the triggers of the service it is (such as ondown or
+// onidle), and the request which caused it (which is empty for triggers not
+// caused by a request, such as onidle).
+type Event struct {
+	Service string
+	Trigger string
+	Time    time.Time
+	Request RequestInfo
+}
+
+// lifetimeKey is the key of the context value holding the context given to
+// WithLifetime.
+type lifetimeKey struct{}
+
+// WithLifetime gives a copy of ctx along with the context for the lifetime of
+// whatever the trigger is being run for (such as a monitored service), which
+// is cancelled once that has stopped (such as when the server is shutting
+// down). Work which outlives the context of a trigger (such as a trigger run
+// in the background) can then be given a context with Detach.
+func WithLifetime(ctx, lifetime context.Context) context.Context {
+	return context.WithValue(ctx, lifetimeKey{}, lifetime)
+}
+
+// detachedContext is a context which has the values of one context but is
+// only cancelled along with another.
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.values.Value(key)
+}
+
+// Detach gives a context for work which continues after ctx has been
+// cancelled, such as a trigger run in the background for a request which has
+// since finished. The context has the values of ctx, but is only cancelled
+// along with the context given to WithLifetime (and is never cancelled if no
+// such context was given).
+func Detach(ctx context.Context) context.Context {
+	lifetime, ok := ctx.Value(lifetimeKey{}).(context.Context)
+	if !ok {
+		lifetime = context.Background()
+	}
+
+	return detachedContext{Context: lifetime, values: ctx}
+}
@@ -0,0 +1,158 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/kubernetes"
+)
+
+// KubernetesTrigger is a Triggerrer that scales a Kubernetes Deployment (or
+// StatefulSet) to the given number of replicas, such as scaling a service up
+// to one replica when it is needed, and back down to zero replicas when it is
+// idle.
+type KubernetesTrigger struct {
+	Client    *kubernetes.Client
+	Kind      string
+	Namespace string
+	Name      string
+	Replicas  int32
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"kubernetestrigger",
+		func() json.Unmarshaler {
+			return new(KubernetesTrigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (k *KubernetesTrigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Server     string
+		Token      string
+		Kubeconfig string
+		Context    string
+		Kind       string
+		Namespace  string
+		Name       string
+		Replicas   *int32
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Kind == "" {
+		t.Kind = kubernetes.Deployment
+	}
+	switch strings.ToLower(t.Kind) {
+	case kubernetes.Deployment, kubernetes.StatefulSet:
+	default:
+		return fmt.Errorf(
+			"kubernetestrigger kind must be deployment or"+
+				" statefulset, but was given: %s",
+			t.Kind,
+		)
+	}
+
+	if t.Name == "" {
+		return fmt.Errorf("kubernetestrigger requires a name")
+	}
+
+	if t.Replicas == nil {
+		return fmt.Errorf("kubernetestrigger requires a replica count")
+	} else if *t.Replicas < 0 {
+		return fmt.Errorf(
+			"kubernetestrigger replicas must not be negative, but"+
+				" was given: %d",
+			*t.Replicas,
+		)
+	}
+
+	var c *kubernetes.Client
+	if t.Server != "" {
+		c = kubernetes.NewClient(t.Server, t.Token)
+	} else {
+		var e error
+		if c, e = kubernetes.LoadClient(t.Kubeconfig, t.Context); e != nil {
+			return e
+		}
+	}
+
+	k.Client = c
+	k.Kind = t.Kind
+	k.Namespace = t.Namespace
+	k.Name = t.Name
+	k.Replicas = *t.Replicas
+
+	return nil
+}
+
+// NewKubernetesTrigger initializes a KubernetesTrigger which scales the named
+// Deployment (in the default namespace of the client) to the given number of
+// replicas.
+func NewKubernetesTrigger(
+	client *kubernetes.Client,
+	name string,
+	replicas int32,
+) *KubernetesTrigger {
+	return &KubernetesTrigger{
+		Client:   client,
+		Kind:     kubernetes.Deployment,
+		Name:     name,
+		Replicas: replicas,
+	}
+}
+
+// Trigger scales the workload.
+func (k *KubernetesTrigger) Trigger(
+	ctx context.Context,
+	_ Event,
+) (output string, err error) {
+	defer countInvocation("kubernetestrigger", &err)
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	_ = log.Debug(
+		fmt.Sprintf(
+			"kubernetestrigger scaling %s %s to %d replicas",
+			k.Kind,
+			k.Name,
+			k.Replicas,
+		),
+	)
+
+	err = k.Client.Scale(ctx, k.Kind, k.Namespace, k.Name, k.Replicas)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"kubernetestrigger failed to scale %s %s: %v",
+				k.Kind,
+				k.Name,
+				err,
+			),
+		)
+		return "", err
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"kubernetestrigger scaled %s %s to %d replicas",
+			k.Kind,
+			k.Name,
+			k.Replicas,
+		),
+	)
+	return "", nil
+}
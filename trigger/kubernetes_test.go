@@ -0,0 +1,138 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/kubernetes"
+	"github.com/stuphlabs/pullcord/kubernetes/kubetest"
+)
+
+func TestKubernetesTrigger(t *testing.T) {
+	a := kubetest.NewAPIServer("secrettoken")
+	defer a.Close()
+	a.SetWorkload(kubernetes.Deployment, "default", "wiki", 0)
+
+	c := kubernetes.NewClient(a.URL, "secrettoken")
+	up := NewKubernetesTrigger(c, "wiki", 2)
+	down := NewKubernetesTrigger(c, "wiki", 0)
+
+	require.NoError(t, fire(up))
+	s, _ := a.Workload(kubernetes.Deployment, "default", "wiki")
+	assert.Equal(t, int32(2), s.Replicas)
+
+	require.NoError(t, fire(down))
+	s, _ = a.Workload(kubernetes.Deployment, "default", "wiki")
+	assert.Equal(t, int32(0), s.Replicas)
+
+	missing := NewKubernetesTrigger(c, "wiki", 1)
+	missing.Kind = kubernetes.StatefulSet
+	assert.Error(t, fire(missing))
+}
+
+func TestKubernetesTriggerCancelled(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(_ http.ResponseWriter, _ *http.Request) {
+				<-release
+			},
+		),
+	)
+	defer s.Close()
+	defer close(release)
+
+	c := kubernetes.NewClient(s.URL, "secrettoken")
+	c.Timeout = time.Hour
+
+	elapsed, err := fireCancelled(
+		NewKubernetesTrigger(c, "wiki", 1),
+		200*time.Millisecond,
+	)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.True(t, elapsed < 5*time.Second, elapsed.String())
+}
+
+func TestKubernetesTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "kubernetestrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"replicas": 1
+				}`,
+				Explanation: "missing name",
+			},
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"name": "wiki"
+				}`,
+				Explanation: "missing replicas",
+			},
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"name": "wiki",
+					"replicas": -1
+				}`,
+				Explanation: "negative replicas",
+			},
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"kind": "daemonset",
+					"name": "wiki",
+					"replicas": 1
+				}`,
+				Explanation: "unsupported kind",
+			},
+			{
+				Data: `{
+					"kubeconfig": "/nonexistent/kubeconfig",
+					"name": "wiki",
+					"replicas": 1
+				}`,
+				Explanation: "missing kubeconfig",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"server": "http://localhost:8001",
+					"name": "wiki",
+					"replicas": 0
+				}`,
+				Explanation: "scale to zero",
+			},
+			{
+				Data: `{
+					"server": "https://kubernetes.example.com",
+					"token": "secrettoken",
+					"kind": "statefulset",
+					"namespace": "apps",
+					"name": "db",
+					"replicas": 3
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
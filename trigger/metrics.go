@@ -0,0 +1,31 @@
+package trigger
+
+import (
+	"github.com/stuphlabs/pullcord/metrics"
+)
+
+var (
+	invocations = metrics.NewCounter(
+		"pullcord_trigger_invocations_total",
+		"Invocations of each type of trigger.",
+		"type",
+	)
+	invocationErrors = metrics.NewCounter(
+		"pullcord_trigger_errors_total",
+		"Invocations of each type of trigger which gave an error.",
+		"type",
+	)
+)
+
+func init() {
+	metrics.MustRegister(invocations, invocationErrors)
+}
+
+// countInvocation counts an invocation of a trigger of the given type, along
+// with the error it gave (if any). It is meant to be deferred by Trigger.
+func countInvocation(kind string, err *error) {
+	invocations.Inc(kind)
+	if *err != nil {
+		invocationErrors.Inc(kind)
+	}
+}
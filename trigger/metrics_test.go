@@ -0,0 +1,29 @@
+package trigger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerMetrics(t *testing.T) {
+	invocationsBefore := invocations.Value("compoundtrigger")
+	errorsBefore := invocationErrors.Value("compoundtrigger")
+
+	ct := CompoundTrigger{Triggers: []Triggerrer{&counterTriggerrer{}}}
+	assert.NoError(t, fire(&ct))
+
+	ct = CompoundTrigger{Triggers: []Triggerrer{&counterTriggerrer{-1}}}
+	assert.Error(t, fire(&ct))
+
+	assert.Equal(
+		t,
+		invocationsBefore+2,
+		invocations.Value("compoundtrigger"),
+	)
+	assert.Equal(
+		t,
+		errorsBefore+1,
+		invocationErrors.Value("compoundtrigger"),
+	)
+}
@@ -0,0 +1,18 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package trigger
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing on systems without process groups.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessGroup kills the command, though not any processes it started,
+// on systems without process groups.
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -2,9 +2,14 @@ package trigger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/proidiot/gone/log"
@@ -16,13 +21,56 @@ import (
 // guarded trigger will not be called.
 var ErrRateLimitExceeded = errors.New("Rate limit exceeded for trigger")
 
+// RateLimitReporter is implemented by triggers which may refuse to run for a
+// while due to a rate limit, so that a client can be told how long to wait
+// before trying again.
+type RateLimitReporter interface {
+	RetryAfter() time.Duration
+}
+
+// RetryAfter gives the longest time that the given trigger (or any trigger it
+// runs, see Wrapper) which is a RateLimitReporter will refuse to run for, which
+// is zero if none of them are being rate limited.
+func RetryAfter(t Triggerrer) time.Duration {
+	var retryAfter time.Duration
+	if r, ok := t.(RateLimitReporter); ok {
+		retryAfter = r.RetryAfter()
+	}
+
+	if w, ok := t.(Wrapper); ok {
+		for _, wrapped := range w.Unwrap() {
+			if wrapped == nil {
+				continue
+			}
+			if d := RetryAfter(wrapped); d > retryAfter {
+				retryAfter = d
+			}
+		}
+	}
+
+	return retryAfter
+}
+
 // RateLimitTrigger is a Triggerrer that will prevent a guarded trigger
 // from being called more than a specified number of times over a specified
-// duration.
+// duration. The limit is applied over a sliding window, so the guarded trigger
+// may be called again as soon as the oldest of the calls within the window is
+// more than the Period ago (see RetryAfter).
+//
+// If a StateFile is given, the times at which the guarded trigger was called
+// are saved to that file (as JSON) and loaded from it on first use, so that
+// the limit still applies after a restart (such as when pullcord itself keeps
+// crashing). Each StateFile must only be used by a single RateLimitTrigger,
+// though the same RateLimitTrigger may be shared by several services (such as
+// by using a reference to it in a config) to apply a single limit to all of
+// them.
 type RateLimitTrigger struct {
 	GuardedTrigger   Triggerrer
 	MaxAllowed       uint
 	Period           time.Duration
+	StateFile        string
+	mutex            sync.Mutex
+	loaded           bool
 	previousTriggers []time.Time
 }
 
@@ -41,6 +89,7 @@ func (r *RateLimitTrigger) UnmarshalJSON(input []byte) error {
 		GuardedTrigger config.Resource
 		MaxAllowed     uint
 		Period         string
+		StateFile      string
 	}
 
 	dec := json.NewDecoder(bytes.NewReader(input))
@@ -48,19 +97,11 @@ func (r *RateLimitTrigger) UnmarshalJSON(input []byte) error {
 		return e
 	}
 
-	gt := t.GuardedTrigger.Unmarshalled
-	switch gt := gt.(type) {
-	case Triggerrer:
-		r.GuardedTrigger = gt
-	default:
-		_ = log.Err(
-			fmt.Sprintf(
-				"Registry value is not a Trigger: %s",
-				gt,
-			),
-		)
+	gt, ok := FromResource(t.GuardedTrigger.Unmarshalled)
+	if !ok {
 		return config.UnexpectedResourceType
 	}
+	r.GuardedTrigger = gt
 
 	p, e := time.ParseDuration(t.Period)
 	if e != nil {
@@ -71,6 +112,8 @@ func (r *RateLimitTrigger) UnmarshalJSON(input []byte) error {
 
 	r.MaxAllowed = t.MaxAllowed
 
+	r.StateFile = t.StateFile
+
 	return nil
 }
 
@@ -82,40 +125,174 @@ func NewRateLimitTrigger(
 	period time.Duration,
 ) *RateLimitTrigger {
 	return &RateLimitTrigger{
-		guardedTrigger,
-		maxAllowed,
-		period,
-		nil,
+		GuardedTrigger: guardedTrigger,
+		MaxAllowed:     maxAllowed,
+		Period:         period,
 	}
 }
 
 // Trigger executes its guarded trigger if and only if it has not be called more
 // than the allowed number of times within the specified rolling window of time.
 // If the rate limit is exceeded, ErrRateLimitExceeded will be returned, and
-// the guarded trigger will not be called.
-func (r *RateLimitTrigger) Trigger() error {
-	now := time.Now()
-	_ = log.Debug("rate limit trigger initiated")
+// the guarded trigger will not be called. A call made once the context has
+// been cancelled does not count towards the limit.
+func (r *RateLimitTrigger) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	defer countInvocation("ratelimittrigger", &err)
 
-	if r.previousTriggers != nil {
-		_ = log.Debug("determine if rate limit has been exceeded")
-		for len(
-			r.previousTriggers,
-		) > 0 && now.After(r.previousTriggers[0].Add(r.Period)) {
-			r.previousTriggers = r.previousTriggers[1:]
-		}
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
 
-		if uint(len(r.previousTriggers)) >= r.MaxAllowed {
-			_ = log.Debug("rate limit has been exceeded")
-			return ErrRateLimitExceeded
-		}
-	} else {
-		_ = log.Debug("first rate limited trigger")
-		r.previousTriggers = make([]time.Time, r.MaxAllowed)
+	_ = log.Debug("rate limit trigger initiated")
+
+	r.mutex.Lock()
+	now := time.Now()
+	r.prune(now)
+	if uint(len(r.previousTriggers)) >= r.MaxAllowed {
+		r.mutex.Unlock()
+		_ = log.Debug("rate limit has been exceeded")
+		return "", ErrRateLimitExceeded
 	}
 
 	r.previousTriggers = append(r.previousTriggers, now)
+	r.save()
+	r.mutex.Unlock()
 
 	_ = log.Debug("rate limit not exceeded, cascading the trigger")
-	return r.GuardedTrigger.Trigger()
+	return r.GuardedTrigger.Trigger(ctx, e)
+}
+
+// RetryAfter gives how long it will be until the guarded trigger may be called
+// again, which is zero if it may be called now. If MaxAllowed is zero, the
+// guarded trigger may never be called, and so the Period is given.
+func (r *RateLimitTrigger) RetryAfter() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.prune(now)
+	if r.MaxAllowed == 0 {
+		return r.Period
+	}
+
+	count := uint(len(r.previousTriggers))
+	if count < r.MaxAllowed {
+		return 0
+	}
+
+	// Enough of the oldest calls must leave the window for there to be
+	// fewer than MaxAllowed left in it.
+	return r.previousTriggers[count-r.MaxAllowed].Add(r.Period).Sub(now)
+}
+
+// prune forgets the calls which are no longer within the window ending at the
+// given time, first loading the calls from the StateFile if that has not yet
+// been done. The mutex must be held.
+func (r *RateLimitTrigger) prune(now time.Time) {
+	if !r.loaded {
+		r.load()
+		r.loaded = true
+	}
+
+	expired := 0
+	for expired < len(r.previousTriggers) &&
+		!now.Before(r.previousTriggers[expired].Add(r.Period)) {
+		expired++
+	}
+	if expired > 0 {
+		r.previousTriggers = append(
+			[]time.Time(nil),
+			r.previousTriggers[expired:]...,
+		)
+	}
+}
+
+// load reads the calls from the StateFile, if one was given. A StateFile which
+// does not yet exist is treated as having no calls, while one which cannot be
+// read is logged and otherwise ignored. The mutex must be held.
+func (r *RateLimitTrigger) load() {
+	if r.StateFile == "" {
+		return
+	}
+
+	contents, err := ioutil.ReadFile(r.StateFile)
+	if os.IsNotExist(err) {
+		return
+	} else if err == nil {
+		var previousTriggers []time.Time
+		err = json.Unmarshal(contents, &previousTriggers)
+		if err == nil {
+			r.previousTriggers = append(
+				previousTriggers,
+				r.previousTriggers...,
+			)
+			return
+		}
+	}
+
+	_ = log.Err(
+		fmt.Sprintf(
+			"ratelimittrigger unable to load the state file %s,"+
+				" starting with no previous triggers: %v",
+			r.StateFile,
+			err,
+		),
+	)
+}
+
+// save writes the calls to the StateFile, if one was given. The file is
+// replaced in a single step, so that a crash while saving does not leave it
+// partially written. An error is logged but otherwise ignored, since failing
+// to save the calls is no reason not to run the guarded trigger. The mutex must
+// be held.
+func (r *RateLimitTrigger) save() {
+	if r.StateFile == "" {
+		return
+	}
+
+	err := func() error {
+		contents, err := json.Marshal(r.previousTriggers)
+		if err != nil {
+			return err
+		}
+
+		f, err := ioutil.TempFile(
+			filepath.Dir(r.StateFile),
+			"."+filepath.Base(r.StateFile)+".",
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = f.Write(contents)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), r.StateFile)
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+
+		return err
+	}()
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"ratelimittrigger unable to save the state file"+
+					" %s: %v",
+				r.StateFile,
+				err,
+			),
+		)
+	}
+}
+
+// Unwrap implements Wrapper.
+func (r *RateLimitTrigger) Unwrap() []Triggerrer {
+	return []Triggerrer{r.GuardedTrigger}
 }
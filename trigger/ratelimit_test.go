@@ -1,10 +1,15 @@
 package trigger
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	configutil "github.com/stuphlabs/pullcord/config/util"
 	"github.com/stuphlabs/pullcord/util"
 )
@@ -14,21 +19,131 @@ func TestRateLimit(t *testing.T) {
 
 	rlt := NewRateLimitTrigger(cth, 1, time.Second)
 
-	err := rlt.Trigger()
+	err := fire(rlt)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, cth.count)
 
-	err = rlt.Trigger()
+	err = fire(rlt)
 	assert.Error(t, err)
 	assert.Equal(t, ErrRateLimitExceeded, err)
 	assert.Equal(t, 1, cth.count)
 
 	time.Sleep(time.Second)
-	err = rlt.Trigger()
+	err = fire(rlt)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, cth.count)
 }
 
+func TestRateLimitSlidingWindow(t *testing.T) {
+	cth := &syncCounter{}
+
+	rlt := NewRateLimitTrigger(cth, 2, 4*tick)
+	assert.Equal(t, time.Duration(0), rlt.RetryAfter())
+
+	assert.NoError(t, fire(rlt))
+	time.Sleep(2 * tick)
+	assert.NoError(t, fire(rlt))
+	assert.Equal(t, ErrRateLimitExceeded, fire(rlt))
+	assert.Equal(t, 2, cth.get())
+
+	// The first call leaves the window before the second one does.
+	retryAfter := rlt.RetryAfter()
+	assert.True(t, retryAfter > 0 && retryAfter <= 2*tick, retryAfter)
+	time.Sleep(retryAfter)
+	assert.NoError(t, fire(rlt))
+	assert.Equal(t, ErrRateLimitExceeded, fire(rlt))
+	assert.Equal(t, 3, cth.get())
+}
+
+func TestRateLimitNoneAllowed(t *testing.T) {
+	cth := &syncCounter{}
+
+	rlt := NewRateLimitTrigger(cth, 0, time.Minute)
+	assert.Equal(t, ErrRateLimitExceeded, fire(rlt))
+	assert.Equal(t, 0, cth.get())
+	assert.Equal(t, time.Minute, rlt.RetryAfter())
+}
+
+func TestRateLimitConcurrent(t *testing.T) {
+	cth := &syncCounter{}
+
+	rlt := NewRateLimitTrigger(cth, 5, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = fire(rlt)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, cth.get())
+}
+
+func TestRateLimitStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pullcord-ratelimit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "ratelimit.json")
+
+	cth := &syncCounter{}
+	rlt := NewRateLimitTrigger(cth, 2, time.Minute)
+	rlt.StateFile = stateFile
+	assert.NoError(t, fire(rlt))
+	assert.NoError(t, fire(rlt))
+	assert.Equal(t, ErrRateLimitExceeded, fire(rlt))
+
+	// A new trigger using the same state file (as after a restart) still
+	// applies the limit.
+	restarted := NewRateLimitTrigger(cth, 2, time.Minute)
+	restarted.StateFile = stateFile
+	assert.True(t, restarted.RetryAfter() > 0)
+	assert.Equal(t, ErrRateLimitExceeded, fire(restarted))
+	assert.Equal(t, 2, cth.get())
+
+	// Previous calls which have since left the window are forgotten.
+	shorter := NewRateLimitTrigger(cth, 2, time.Nanosecond)
+	shorter.StateFile = stateFile
+	assert.NoError(t, fire(shorter))
+	assert.Equal(t, 3, cth.get())
+
+	// A state file which cannot be read is ignored.
+	require.NoError(t, ioutil.WriteFile(stateFile, []byte("nope"), 0600))
+	corrupt := NewRateLimitTrigger(cth, 1, time.Minute)
+	corrupt.StateFile = stateFile
+	assert.NoError(t, fire(corrupt))
+	assert.Equal(t, 4, cth.get())
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestRetryAfterWrapped(t *testing.T) {
+	cth := &syncCounter{}
+	short := NewRateLimitTrigger(cth, 1, time.Minute)
+	long := NewRateLimitTrigger(cth, 1, time.Hour)
+	wrapped := &CompoundTrigger{
+		Triggers: []Triggerrer{
+			&RetryTrigger{Wrapped: short, MaxAttempts: 1},
+			&AsyncTrigger{Wrapped: NewDelayTrigger(long, time.Hour)},
+		},
+	}
+	assert.Equal(t, time.Duration(0), RetryAfter(wrapped))
+
+	assert.NoError(t, fire(short))
+	retryAfter := RetryAfter(wrapped)
+	assert.True(t, retryAfter > 59*time.Second, retryAfter)
+
+	assert.NoError(t, fire(long))
+	retryAfter = RetryAfter(wrapped)
+	assert.True(t, retryAfter > 59*time.Minute, retryAfter)
+
+	assert.Equal(t, time.Duration(0), RetryAfter(cth))
+}
+
 func TestRateLimitTriggerFromConfig(t *testing.T) {
 	util.LoadPlugin()
 	test := configutil.ConfigTest{
@@ -134,6 +249,18 @@ func TestRateLimitTriggerFromConfig(t *testing.T) {
 				}`,
 				Explanation: "valid rate limit trigger",
 			},
+			{
+				Data: `{
+					"guardedtrigger": {
+						"type": "compoundtrigger",
+						"data": {}
+					},
+					"maxallowed": 42,
+					"period": "42s",
+					"statefile": "/var/lib/pullcord/ratelimit.json"
+				}`,
+				Explanation: "rate limit trigger with state file",
+			},
 		},
 	}
 	test.Run(t)
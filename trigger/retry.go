@@ -0,0 +1,386 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/docker"
+	"github.com/stuphlabs/pullcord/kubernetes"
+)
+
+// DefaultRetryMaxAttempts is the number of times a RetryTrigger will run the
+// other trigger (including the first time), if no other number has been
+// specified.
+const DefaultRetryMaxAttempts = 3
+
+// DefaultRetryInitialDelay is how long a RetryTrigger waits before the first
+// retry, if no other delay has been specified.
+const DefaultRetryInitialDelay = time.Second
+
+// DefaultRetryMaxDelay is the longest a RetryTrigger will wait between
+// attempts, if no other delay has been specified.
+const DefaultRetryMaxDelay = 30 * time.Second
+
+// DefaultRetryMultiplier is how much longer a RetryTrigger waits before each
+// retry than before the one before it, if no other multiplier has been
+// specified.
+const DefaultRetryMultiplier = 2.0
+
+// DefaultRetryJitter is the fraction by which the delay before each retry is
+// randomly varied by a RetryTrigger created from a config or with
+// NewRetryTrigger, if no other fraction has been specified.
+const DefaultRetryJitter = 0.2
+
+// RetryTrigger is a Triggerrer that runs another trigger again if it fails,
+// such as a trigger which calls a cloud API that fails now and then.
+//
+// The other trigger is run at most MaxAttempts times in total. Before the
+// first retry, the trigger waits InitialDelay, and before each later retry it
+// waits Multiplier times as long as it did before the previous one, but never
+// more than MaxDelay. Each delay is varied randomly by up to the fraction
+// Jitter of the delay in either direction, so that several instances of
+// Pullcord do not all retry at once. If a Deadline is given, no retry will be
+// started unless it can begin before the Deadline has passed since the
+// trigger was first run, and the context of any attempt which is still
+// running once the Deadline has passed is cancelled.
+//
+// Only errors for which Retryable (or DefaultRetryable, if no Retryable is
+// given) is true are retried, and any other error is given immediately. If the
+// trigger runs out of attempts (or time), the error from the last attempt is
+// given.
+type RetryTrigger struct {
+	Wrapped      Triggerrer
+	MaxAttempts  uint
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+	Deadline     time.Duration
+	Retryable    func(error) bool
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"retrytrigger",
+		func() json.Unmarshaler {
+			return new(RetryTrigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (r *RetryTrigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Trigger      config.Resource
+		MaxAttempts  *uint
+		InitialDelay string
+		MaxDelay     string
+		Multiplier   *float64
+		Jitter       *float64
+		Deadline     string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	wrapped, ok := FromResource(t.Trigger.Unmarshalled)
+	if !ok {
+		return config.UnexpectedResourceType
+	}
+
+	r.MaxAttempts = DefaultRetryMaxAttempts
+	if t.MaxAttempts != nil {
+		if *t.MaxAttempts == 0 {
+			return fmt.Errorf(
+				"retrytrigger requires at least one attempt",
+			)
+		}
+		r.MaxAttempts = *t.MaxAttempts
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"initial delay", t.InitialDelay, &r.InitialDelay},
+		{"max delay", t.MaxDelay, &r.MaxDelay},
+		{"deadline", t.Deadline, &r.Deadline},
+	}
+	for _, d := range durations {
+		*d.dest = 0
+		if d.value == "" {
+			continue
+		}
+
+		p, e := time.ParseDuration(d.value)
+		if e != nil {
+			return e
+		} else if p < 0 {
+			return fmt.Errorf(
+				"retrytrigger %s must not be negative: %s",
+				d.name,
+				d.value,
+			)
+		}
+		*d.dest = p
+	}
+
+	r.Multiplier = 0
+	if t.Multiplier != nil {
+		if *t.Multiplier < 1 {
+			return fmt.Errorf(
+				"retrytrigger multiplier must be at least 1: %v",
+				*t.Multiplier,
+			)
+		}
+		r.Multiplier = *t.Multiplier
+	}
+
+	r.Jitter = DefaultRetryJitter
+	if t.Jitter != nil {
+		if *t.Jitter < 0 || *t.Jitter > 1 {
+			return fmt.Errorf(
+				"retrytrigger jitter must be between 0 and 1: %v",
+				*t.Jitter,
+			)
+		}
+		r.Jitter = *t.Jitter
+	}
+
+	r.Wrapped = wrapped
+	r.Retryable = nil
+
+	return nil
+}
+
+// NewRetryTrigger initializes a RetryTrigger which runs the given trigger up
+// to the given number of times, using the default delays.
+func NewRetryTrigger(wrapped Triggerrer, maxAttempts uint) *RetryTrigger {
+	return &RetryTrigger{
+		Wrapped:     wrapped,
+		MaxAttempts: maxAttempts,
+		Jitter:      DefaultRetryJitter,
+	}
+}
+
+// retryableStatus determines if a request which received the given HTTP
+// status might succeed if it were made again.
+func retryableStatus(code int) bool {
+	return code == 408 || code == 429 || code >= 500
+}
+
+// DefaultRetryable determines if a trigger which gave the given error might
+// succeed if it were run again. Errors which show that a trigger must not (or
+// cannot) be run, such as ErrRateLimitExceeded or a trigger which is missing
+// part of its configuration, are never retried. Errors from APIs are only
+// retried if the API was throttling requests or was temporarily unavailable,
+// and any other error (such as a network error, a request which timed out, or
+// a command which failed) is retried. Errors are recognized even if they have
+// been wrapped (see errors.Is and errors.As), and a *CompoundError is retried
+// if any of the errors it holds would be.
+//
+// Whether the RetryTrigger itself has been cancelled (or has run out of time)
+// is decided from its own context rather than from the error, since an
+// attempt which timed out on its own gives an error wrapping
+// context.DeadlineExceeded even though it is well worth retrying.
+func DefaultRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var compoundErr *CompoundError
+	if errors.As(err, &compoundErr) {
+		for _, e := range compoundErr.Unwrap() {
+			if DefaultRetryable(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, permanent := range []error{
+		ErrRateLimitExceeded,
+		ErrSqsNoMessage,
+		ErrSqsNoQueue,
+		ErrSqsNoRegion,
+		ErrSqsNoCredentials,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	var sqsErr *SqsError
+	var webhookErr *WebhookStatusError
+	var awsErr *aws.APIError
+	var dockerErr *docker.APIError
+	var kubernetesErr *kubernetes.StatusError
+	switch {
+	case errors.As(err, &sqsErr):
+		return sqsErr.throttled()
+	case errors.As(err, &webhookErr):
+		return retryableStatus(webhookErr.StatusCode)
+	case errors.As(err, &awsErr):
+		return retryableStatus(awsErr.StatusCode) ||
+			awsErr.Code == "RequestLimitExceeded" ||
+			awsErr.Code == "Throttling"
+	case errors.As(err, &dockerErr):
+		return retryableStatus(dockerErr.StatusCode)
+	case errors.As(err, &kubernetesErr):
+		return retryableStatus(kubernetesErr.StatusCode)
+	}
+
+	return true
+}
+
+// delay gives how long to wait before the given retry (starting from 1),
+// where random is a number in [0, 1) used to apply the jitter.
+func (r *RetryTrigger) delay(retry uint, random float64) time.Duration {
+	initial := r.InitialDelay
+	if initial <= 0 {
+		initial = DefaultRetryInitialDelay
+	}
+	max := r.MaxDelay
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = DefaultRetryMultiplier
+	}
+
+	d := float64(initial)
+	for i := uint(1); i < retry && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+
+	if r.Jitter > 0 {
+		d += d * r.Jitter * (2*random - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// Trigger runs the other trigger for the given event until it succeeds, until
+// it should no longer be retried, or until the context is cancelled. The
+// output of the last attempt is given.
+func (r *RetryTrigger) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	defer countInvocation("retrytrigger", &err)
+
+	retryable := r.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+	maxAttempts := r.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultRetryMaxAttempts
+	}
+
+	start := time.Now()
+	if r.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Deadline)
+		defer cancel()
+	}
+
+	for attempt := uint(1); ; attempt++ {
+		if err = ctx.Err(); err != nil {
+			return output, err
+		}
+
+		output, err = r.Wrapped.Trigger(ctx, e)
+		if err == nil {
+			if attempt > 1 {
+				_ = log.Info(
+					fmt.Sprintf(
+						"retrytrigger succeeded on attempt"+
+							" %d",
+						attempt,
+					),
+				)
+			}
+			return output, nil
+		}
+
+		if ctx.Err() != nil {
+			_ = log.Err(
+				fmt.Sprintf(
+					"retrytrigger giving up after attempt %d"+
+						" as it has been cancelled: %v",
+					attempt,
+					err,
+				),
+			)
+			return output, err
+		} else if !retryable(err) {
+			_ = log.Err(
+				fmt.Sprintf(
+					"retrytrigger received an error which"+
+						" will not be retried: %v",
+					err,
+				),
+			)
+			return output, err
+		} else if attempt >= maxAttempts {
+			_ = log.Err(
+				fmt.Sprintf(
+					"retrytrigger giving up after %d"+
+						" attempts: %v",
+					attempt,
+					err,
+				),
+			)
+			return output, err
+		}
+
+		delay := r.delay(attempt, rand.Float64())
+		if r.Deadline > 0 && time.Since(start)+delay > r.Deadline {
+			_ = log.Err(
+				fmt.Sprintf(
+					"retrytrigger giving up after %d"+
+						" attempts since the deadline of"+
+						" %s would be exceeded: %v",
+					attempt,
+					r.Deadline.String(),
+					err,
+				),
+			)
+			return output, err
+		}
+
+		_ = log.Warning(
+			fmt.Sprintf(
+				"retrytrigger will retry in %s after attempt %d"+
+					" failed: %v",
+				delay.String(),
+				attempt,
+				err,
+			),
+		)
+		if err = sleep(ctx, delay); err != nil {
+			return output, err
+		}
+	}
+}
+
+// Unwrap implements Wrapper.
+func (r *RetryTrigger) Unwrap() []Triggerrer {
+	return []Triggerrer{r.Wrapped}
+}
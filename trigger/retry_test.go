@@ -0,0 +1,411 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/aws"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/docker"
+	"github.com/stuphlabs/pullcord/kubernetes"
+)
+
+// flakyTriggerrer is a Triggerrer which gives an error the first few times it
+// is run, counting the number of times it has been run.
+type flakyTriggerrer struct {
+	failures int
+	err      error
+	runs     int
+}
+
+func (f *flakyTriggerrer) Trigger(context.Context, Event) (string, error) {
+	f.runs++
+	if f.runs <= f.failures {
+		return "", f.err
+	}
+
+	return "", nil
+}
+
+func getRetryTrigger(f *flakyTriggerrer, maxAttempts uint) *RetryTrigger {
+	r := NewRetryTrigger(f, maxAttempts)
+	r.InitialDelay = time.Millisecond
+	r.MaxDelay = 4 * time.Millisecond
+
+	return r
+}
+
+func TestRetryTrigger(t *testing.T) {
+	f := &flakyTriggerrer{failures: 2, err: errors.New("flaky")}
+	r := getRetryTrigger(f, 3)
+
+	assert.NoError(t, fire(r))
+	assert.Equal(t, 3, f.runs)
+}
+
+func TestRetryTriggerGivesUp(t *testing.T) {
+	flaky := errors.New("flaky")
+	f := &flakyTriggerrer{failures: 10, err: flaky}
+	r := getRetryTrigger(f, 4)
+
+	assert.Equal(t, flaky, fire(r))
+	assert.Equal(t, 4, f.runs)
+}
+
+func TestRetryTriggerNotRetryable(t *testing.T) {
+	f := &flakyTriggerrer{failures: 10, err: ErrRateLimitExceeded}
+	r := getRetryTrigger(f, 4)
+
+	assert.Equal(t, ErrRateLimitExceeded, fire(r))
+	assert.Equal(t, 1, f.runs)
+
+	f = &flakyTriggerrer{failures: 1, err: ErrRateLimitExceeded}
+	r = getRetryTrigger(f, 4)
+	r.Retryable = func(error) bool { return true }
+
+	assert.NoError(t, fire(r))
+	assert.Equal(t, 2, f.runs)
+}
+
+func TestRetryTriggerDeadline(t *testing.T) {
+	f := &flakyTriggerrer{failures: 10, err: errors.New("flaky")}
+	r := getRetryTrigger(f, 10)
+	r.InitialDelay = 20 * time.Millisecond
+	r.MaxDelay = time.Second
+	r.Jitter = 0
+	r.Deadline = 50 * time.Millisecond
+
+	// Retries would start after 20ms and 60ms, so only the first can
+	// begin before the deadline.
+	start := time.Now()
+	assert.Error(t, fire(r))
+	assert.Equal(t, 2, f.runs)
+	assert.True(t, time.Since(start) < r.Deadline)
+}
+
+func TestRetryTriggerDelay(t *testing.T) {
+	r := &RetryTrigger{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   3,
+	}
+
+	assert.Equal(t, time.Second, r.delay(1, 0.9))
+	assert.Equal(t, 3*time.Second, r.delay(2, 0.9))
+	assert.Equal(t, 9*time.Second, r.delay(3, 0.9))
+	assert.Equal(t, 10*time.Second, r.delay(4, 0.9))
+	assert.Equal(t, 10*time.Second, r.delay(100, 0.9))
+
+	r.Jitter = 0.5
+	assert.Equal(t, 1500*time.Millisecond, r.delay(1, 1))
+	assert.Equal(t, 500*time.Millisecond, r.delay(1, 0))
+	assert.Equal(t, time.Second, r.delay(1, 0.5))
+
+	r = &RetryTrigger{}
+	assert.Equal(t, DefaultRetryInitialDelay, r.delay(1, 0))
+	assert.Equal(t, DefaultRetryMaxDelay, r.delay(100, 0))
+}
+
+func TestDefaultRetryableWrapped(t *testing.T) {
+	for _, c := range []struct {
+		err       error
+		retryable bool
+	}{
+		{
+			fmt.Errorf("guarded: %w", ErrRateLimitExceeded),
+			false,
+		},
+		{
+			fmt.Errorf("waiting: %w", context.Canceled),
+			true,
+		},
+		{
+			fmt.Errorf("waiting: %w", context.DeadlineExceeded),
+			true,
+		},
+		{
+			fmt.Errorf("sqs: %w", ErrSqsNoQueue),
+			false,
+		},
+		{
+			fmt.Errorf("hook: %w", &WebhookStatusError{StatusCode: 503}),
+			true,
+		},
+		{
+			fmt.Errorf("hook: %w", &WebhookStatusError{StatusCode: 404}),
+			false,
+		},
+		{
+			fmt.Errorf(
+				"ec2: %w",
+				&aws.APIError{StatusCode: 400, Code: "Throttling"},
+			),
+			true,
+		},
+		{
+			fmt.Errorf(
+				"ec2: %w",
+				&aws.APIError{StatusCode: 400, Code: "Invalid"},
+			),
+			false,
+		},
+		{
+			fmt.Errorf("docker: %w", &docker.APIError{StatusCode: 500}),
+			true,
+		},
+		{
+			fmt.Errorf("docker: %w", &docker.APIError{StatusCode: 409}),
+			false,
+		},
+		{
+			fmt.Errorf(
+				"kubernetes: %w",
+				&kubernetes.StatusError{StatusCode: 503},
+			),
+			true,
+		},
+		{
+			fmt.Errorf(
+				"kubernetes: %w",
+				&kubernetes.StatusError{StatusCode: 403},
+			),
+			false,
+		},
+		{
+			fmt.Errorf(
+				"compound: %w",
+				&CompoundError{
+					Errors: []error{
+						fmt.Errorf("a: %w", ErrRateLimitExceeded),
+						nil,
+					},
+				},
+			),
+			false,
+		},
+		{
+			fmt.Errorf(
+				"compound: %w",
+				&CompoundError{
+					Errors: []error{
+						ErrRateLimitExceeded,
+						errors.New("connection refused"),
+					},
+				},
+			),
+			true,
+		},
+		{
+			fmt.Errorf("shell: %w", &ShellExitError{Code: 1}),
+			true,
+		},
+	} {
+		assert.Equal(t, c.retryable, DefaultRetryable(c.err), c.err.Error())
+	}
+}
+
+// TestRetryTriggerClientTimeout verifies that an attempt which times out on its
+// own (giving an error which wraps context.DeadlineExceeded) is retried.
+func TestRetryTriggerClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	requests := 0
+	s := httptest.NewServer(
+		http.HandlerFunc(
+			func(_ http.ResponseWriter, _ *http.Request) {
+				mutex.Lock()
+				requests++
+				mutex.Unlock()
+				<-release
+			},
+		),
+	)
+	defer s.Close()
+	defer close(release)
+
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	w := NewWebhookTrigger("POST", u, nil)
+	w.MaxRetries = 0
+	w.Timeout = 10 * time.Millisecond
+
+	r := NewRetryTrigger(w, 3)
+	r.InitialDelay = time.Millisecond
+	r.Jitter = 0
+
+	err = fire(r)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.True(t, DefaultRetryable(err), err.Error())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 3, requests)
+}
+
+func TestDefaultRetryable(t *testing.T) {
+	assert.False(t, DefaultRetryable(nil))
+	assert.False(t, DefaultRetryable(ErrRateLimitExceeded))
+	assert.False(t, DefaultRetryable(ErrSqsNoCredentials))
+	assert.True(t, DefaultRetryable(errors.New("connection refused")))
+	assert.True(t, DefaultRetryable(ErrShellTimeout))
+	assert.True(t, DefaultRetryable(&ShellExitError{Code: 1}))
+	assert.True(t, DefaultRetryable(&WebhookStatusError{StatusCode: 503}))
+	assert.True(t, DefaultRetryable(&WebhookStatusError{StatusCode: 429}))
+	assert.False(t, DefaultRetryable(&WebhookStatusError{StatusCode: 404}))
+	assert.True(t, DefaultRetryable(&SqsError{Code: "Throttling"}))
+	assert.True(
+		t,
+		DefaultRetryable(
+			&CompoundError{
+				Errors: []error{
+					nil,
+					ErrRateLimitExceeded,
+					ErrShellTimeout,
+				},
+			},
+		),
+	)
+	assert.False(
+		t,
+		DefaultRetryable(
+			&CompoundError{
+				Errors: []error{ErrRateLimitExceeded, nil},
+			},
+		),
+	)
+	assert.False(
+		t,
+		DefaultRetryable(
+			&aws.APIError{
+				StatusCode: 400,
+				Code:       "InvalidInstanceID.NotFound",
+			},
+		),
+	)
+	assert.True(
+		t,
+		DefaultRetryable(
+			&aws.APIError{
+				StatusCode: 503,
+				Code:       "RequestLimitExceeded",
+			},
+		),
+	)
+}
+
+func TestRetryTriggerOutput(t *testing.T) {
+	s := NewShellTriggerrer("sh", []string{"-c", "echo attempt; exit 3"})
+	r := NewRetryTrigger(s, 2)
+	r.InitialDelay = time.Millisecond
+
+	output, err := r.Trigger(context.Background(), Event{Time: time.Now()})
+	require.Error(t, err)
+	assert.Equal(t, "attempt\n", output)
+}
+
+func TestRetryTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "retrytrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data:        "{}",
+				Explanation: "missing trigger",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "compoundtrigger",
+						"data": {"triggers": []}
+					},
+					"maxattempts": 0
+				}`,
+				Explanation: "no attempts",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "compoundtrigger",
+						"data": {"triggers": []}
+					},
+					"initialdelay": "42q"
+				}`,
+				Explanation: "nonsensical initial delay",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "compoundtrigger",
+						"data": {"triggers": []}
+					},
+					"deadline": "-1s"
+				}`,
+				Explanation: "negative deadline",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "compoundtrigger",
+						"data": {"triggers": []}
+					},
+					"multiplier": 0.5
+				}`,
+				Explanation: "shrinking delays",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "compoundtrigger",
+						"data": {"triggers": []}
+					},
+					"jitter": 2
+				}`,
+				Explanation: "excessive jitter",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"trigger": {
+						"type": "compoundtrigger",
+						"data": {"triggers": []}
+					}
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"trigger": {
+						"type": "compoundtrigger",
+						"data": {"triggers": []}
+					},
+					"maxattempts": 5,
+					"initialdelay": "500ms",
+					"maxdelay": "1m",
+					"multiplier": 1.5,
+					"jitter": 0,
+					"deadline": "5m"
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
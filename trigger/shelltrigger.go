@@ -2,21 +2,84 @@ package trigger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/proidiot/gone/log"
 	"github.com/stuphlabs/pullcord/config"
 )
 
+// DefaultShellTimeout is how long a command may run before it is killed, if
+// no other timeout has been specified.
+const DefaultShellTimeout = 5 * time.Minute
+
+// MaxShellOutput is the most output of a command which is kept. Any further
+// output is discarded.
+const MaxShellOutput = 64 * 1024
+
+// shellOutputDrainDelay is how long the output of a command is still collected
+// for once the command has exited, since processes which it left running in
+// the background (such as a daemon it started) may keep its output open.
+const shellOutputDrainDelay = 100 * time.Millisecond
+
+// ErrShellTimeout indicates that a command run by a shell trigger did not
+// finish within its timeout, and so was killed.
+var ErrShellTimeout = errors.New("Shell trigger command timed out")
+
+// ShellExitError indicates that a command run by a shell trigger exited with
+// a code other than those which were expected.
+type ShellExitError struct {
+	Code   int
+	Output string
+}
+
+func (e *ShellExitError) Error() string {
+	return fmt.Sprintf(
+		"shell trigger command exited with unexpected code %d",
+		e.Code,
+	)
+}
+
 // ShellTriggerrer is a basic Triggerrer that calls a stored shell
 // command (along with arguments) when triggered.
 //
-// The message given to TriggerString will be passed to the command via stdin.
+// The arguments, the Stdin given to the command, and the values of Env are
+// text/template templates, which are given the Event that caused the trigger
+// to run (so that "{{.Service}}" is the name of the service, and
+// "{{.Request.Path}}" is the path of the request, if any).
+//
+// If neither Env nor PassEnv is given, the command inherits the whole
+// environment of Pullcord. Otherwise, the command is given only the variables
+// named in PassEnv (with their values from the environment of Pullcord) along
+// with the variables in Env.
+//
+// The command is run in Dir (or the working directory of Pullcord), and if it
+// has not exited within Timeout (or DefaultShellTimeout), it is killed along
+// with any processes it started. Once the command has exited, any processes it
+// left running in the background are left alone, even if they keep its output
+// open. The command is considered to have succeeded if its exit code is one of
+// ExpectedExitCodes (or zero, if none are given). The combined stdout and
+// stderr of the command is given as the output of the trigger, though output
+// written by processes left running in the background may be missing.
 type ShellTriggerrer struct {
-	Command string
-	Args    []string
+	Command           string
+	Args              []string
+	Stdin             string
+	Env               map[string]string
+	PassEnv           []string
+	Dir               string
+	Timeout           time.Duration
+	ExpectedExitCodes []int
 }
 
 func init() {
@@ -36,8 +99,14 @@ func (s *ShellTriggerrer) UnmarshalJSON(input []byte) error {
 	// non-pointer ShellTriggerrer also uses this function to
 	// unmarshal, resulting in an infinite stack.
 	var t struct {
-		Command string
-		Args    []string
+		Command           string
+		Args              []string
+		Stdin             string
+		Env               map[string]string
+		PassEnv           []string
+		Dir               string
+		Timeout           string
+		ExpectedExitCodes []int
 	}
 
 	dec := json.NewDecoder(bytes.NewReader(input))
@@ -45,32 +114,254 @@ func (s *ShellTriggerrer) UnmarshalJSON(input []byte) error {
 		return e
 	}
 
+	templates := append([]string{t.Stdin}, t.Args...)
+	for _, v := range t.Env {
+		templates = append(templates, v)
+	}
+	for _, text := range templates {
+		if _, e := template.New("").Parse(text); e != nil {
+			return e
+		}
+	}
+
+	s.Timeout = 0
+	if t.Timeout != "" {
+		d, e := time.ParseDuration(t.Timeout)
+		if e != nil {
+			return e
+		} else if d <= 0 {
+			return fmt.Errorf(
+				"shelltrigger timeout must be positive, but was"+
+					" given: %s",
+				t.Timeout,
+			)
+		}
+		s.Timeout = d
+	}
+
 	s.Command = t.Command
 	s.Args = t.Args
+	s.Stdin = t.Stdin
+	s.Env = t.Env
+	s.PassEnv = t.PassEnv
+	s.Dir = t.Dir
+	s.ExpectedExitCodes = t.ExpectedExitCodes
 
 	return nil
 }
 
-// Trigger will execute the given command with the given args using the system
-// shell.
-func (s *ShellTriggerrer) Trigger() (err error) {
+// limitedBuffer is a buffer which keeps only the first limit bytes written to
+// it, discarding the rest. It is safe for concurrent use.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	mutex sync.Mutex
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		if room > 0 {
+			_, _ = b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.String()
+}
+
+func execute(text string, e Event) (string, error) {
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, e); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// environ gives the environment of the command, or nil if the command should
+// inherit the environment of Pullcord.
+func (s *ShellTriggerrer) environ(e Event) ([]string, error) {
+	if len(s.Env) == 0 && len(s.PassEnv) == 0 {
+		return nil, nil
+	}
+
+	env := []string{}
+	for _, name := range s.PassEnv {
+		if v, present := os.LookupEnv(name); present {
+			env = append(env, name+"="+v)
+		}
+	}
+
+	names := make([]string, 0, len(s.Env))
+	for name := range s.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, err := execute(s.Env[name], e)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, name+"="+v)
+	}
+
+	return env, nil
+}
+
+func (s *ShellTriggerrer) expected(code int) bool {
+	if len(s.ExpectedExitCodes) == 0 {
+		return code == 0
+	}
+
+	for _, c := range s.ExpectedExitCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run runs the command for the given event, giving its output. The command is
+// killed if the context is cancelled.
+//
+// The output is read from a pipe rather than given to the command as a
+// buffer, since exec.Cmd.Wait would then also wait for any processes the
+// command left running in the background to close the output, and so a
+// command which starts a daemon would never be found to have finished. The
+// pipe is read until all of those processes have closed it (lest they be
+// killed for writing to a pipe which nothing is reading), but only what was
+// read shortly after the command exited is given.
+func (s *ShellTriggerrer) run(ctx context.Context, e Event) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	args := make([]string, len(s.Args))
+	for i, arg := range s.Args {
+		var err error
+		if args[i], err = execute(arg, e); err != nil {
+			return "", err
+		}
+	}
+
+	env, err := s.environ(e)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(s.Command, args...)
+	cmd.Dir = s.Dir
+	cmd.Env = env
+	if s.Stdin != "" {
+		stdin, err := execute(s.Stdin, e)
+		if err != nil {
+			return "", err
+		}
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	outputReader, outputWriter, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+	setProcessGroup(cmd)
+
+	err = cmd.Start()
+	// The command has its own copy of the writing end of the pipe.
+	_ = outputWriter.Close()
+	if err != nil {
+		_ = outputReader.Close()
+		return "", err
+	}
+
+	output := &limitedBuffer{limit: MaxShellOutput}
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(output, outputReader)
+		_ = outputReader.Close()
+		close(copied)
+	}()
+	drain := func() string {
+		timer := time.NewTimer(shellOutputDrainDelay)
+		defer timer.Stop()
+
+		select {
+		case <-copied:
+		case <-timer.C:
+		}
+
+		return output.String()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultShellTimeout
+	}
+	timer := time.NewTimer(timeout)
+	select {
+	case err = <-done:
+		timer.Stop()
+	case <-timer.C:
+		killProcessGroup(cmd)
+		<-done
+		return drain(), ErrShellTimeout
+	case <-ctx.Done():
+		timer.Stop()
+		killProcessGroup(cmd)
+		<-done
+		return drain(), ctx.Err()
+	}
+
+	out := drain()
+	if _, exited := err.(*exec.ExitError); err == nil || exited {
+		if code := cmd.ProcessState.ExitCode(); !s.expected(code) {
+			return out, &ShellExitError{
+				Code:   code,
+				Output: out,
+			}
+		}
+		err = nil
+	}
+
+	return out, err
+}
+
+// Trigger runs the command for the given event, giving its output. The command
+// is killed if the context is cancelled before it has finished.
+func (s *ShellTriggerrer) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	defer countInvocation("shelltrigger", &err)
+
 	_ = log.Debug("shelltrigger running trigger")
-	cmd := exec.Command(s.Command, s.Args...)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
+	output, err = s.run(ctx, e)
 	_ = log.Debug(
 		fmt.Sprintf(
-			"shelltrigger command wrote to stdout: %s",
-			stdout.String(),
-		),
-	)
-	_ = log.Debug(
-		fmt.Sprintf(
-			"shelltrigger command wrote to stderr: %s",
-			stderr.String(),
+			"shelltrigger command wrote: %s",
+			output,
 		),
 	)
 	if err != nil {
@@ -80,19 +371,19 @@ func (s *ShellTriggerrer) Trigger() (err error) {
 				err,
 			),
 		)
-		return err
+		return output, err
 	}
 
 	_ = log.Info("shelltrigger trigger sent")
-	return nil
+	return output, nil
 }
 
 // NewShellTriggerrer constructs a new ShellTriggerrer given the
-// command (and arguments) to be run each time TriggerString is called. Entire
+// command (and arguments) to be run each time Trigger is called. Entire
 // shell scripts could potentially be stored in the arguments, though the
 // trigger could just as easily call an external shell script. As a result, a
-// wide variety of actions could be taken based on the message passed in via
-// stdin.
+// wide variety of actions could be taken based on the event which caused the
+// trigger to run.
 func NewShellTriggerrer(
 	command string,
 	args []string,
@@ -1,11 +1,17 @@
 package trigger
 
 import (
+	"context"
 	"io/ioutil"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	configutil "github.com/stuphlabs/pullcord/config/util"
 )
 
@@ -31,7 +37,7 @@ func TestShellTriggerTee(t *testing.T) {
 	}
 
 	handler := NewShellTriggerrer(testCommand, testArgs)
-	err = handler.Trigger()
+	err = fire(handler)
 
 	assert.NoError(t, err)
 	data, err := ioutil.ReadFile(testFile)
@@ -44,11 +50,164 @@ func TestShellTriggerFail(t *testing.T) {
 	testArgs := []string{"1", "-eq", "0"}
 
 	handler := NewShellTriggerrer(testCommand, testArgs)
-	err := handler.Trigger()
+	err := fire(handler)
 
 	assert.Error(t, err)
 }
 
+func TestShellTriggerEvent(t *testing.T) {
+	req := httptest.NewRequest("GET", "/wiki/Main?x=1", nil)
+	req.Header.Set("X-User", "alice")
+	req.Header.Set("Authorization", "Bearer secret")
+
+	handler := NewShellTriggerrer(
+		"/bin/sh",
+		[]string{
+			"-c",
+			`echo "$1 $2 $3"; cat; echo "$SERVICE"`,
+			"sh",
+			"{{.Service}}",
+			"{{.Request.Path}}",
+			`{{.Request.Header.Get "X-User"}}` +
+				`{{.Request.Header.Get "Authorization"}}`,
+		},
+	)
+	handler.Stdin = "{{.Trigger}}\n"
+	handler.Env = map[string]string{"SERVICE": "svc={{.Service}}"}
+
+	output, err := handler.Trigger(
+		context.Background(),
+		Event{
+			Service: "wiki",
+			Trigger: "ondown",
+			Time:    time.Now(),
+			Request: NewRequestInfo(req),
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "wiki /wiki/Main alice\nondown\nsvc=wiki\n", output)
+
+	output, err = handler.Trigger(
+		context.Background(),
+		Event{Service: "other"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "other  \n\nsvc=other\n", output)
+}
+
+func TestShellTriggerEnv(t *testing.T) {
+	require.NoError(t, os.Setenv("PULLCORD_TEST_PASSED", "yes"))
+	require.NoError(t, os.Setenv("PULLCORD_TEST_HIDDEN", "yes"))
+	defer func() {
+		_ = os.Unsetenv("PULLCORD_TEST_PASSED")
+		_ = os.Unsetenv("PULLCORD_TEST_HIDDEN")
+	}()
+
+	handler := NewShellTriggerrer(
+		"/bin/sh",
+		[]string{
+			"-c",
+			`echo "$PULLCORD_TEST_PASSED$PULLCORD_TEST_HIDDEN"; pwd`,
+		},
+	)
+
+	output, err := handler.Trigger(context.Background(), Event{})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(output, "yesyes\n"))
+
+	tmpdir, err := ioutil.TempDir("", "test_shell_trigger")
+	require.NoError(t, err)
+	defer goRemoveAll(tmpdir)
+
+	handler.PassEnv = []string{"PULLCORD_TEST_PASSED"}
+	handler.Dir = tmpdir
+	output, err = handler.Trigger(context.Background(), Event{})
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "yes", lines[0])
+	assert.Equal(t, filepath.Base(tmpdir), filepath.Base(lines[1]))
+}
+
+func TestShellTriggerExitCodes(t *testing.T) {
+	handler := NewShellTriggerrer(
+		"/bin/sh",
+		[]string{"-c", "echo failing >&2; exit 3"},
+	)
+
+	output, err := handler.Trigger(context.Background(), Event{})
+	require.Error(t, err)
+	exitErr, ok := err.(*ShellExitError)
+	require.True(t, ok)
+	assert.Equal(t, 3, exitErr.Code)
+	assert.Equal(t, "failing\n", exitErr.Output)
+	assert.Equal(t, "failing\n", output)
+
+	handler.ExpectedExitCodes = []int{0, 3}
+	assert.NoError(t, fire(handler))
+
+	handler.ExpectedExitCodes = []int{1}
+	handler.Args = []string{"-c", "true"}
+	assert.Error(t, fire(handler))
+}
+
+func TestShellTriggerTimeout(t *testing.T) {
+	handler := NewShellTriggerrer(
+		"/bin/sh",
+		[]string{"-c", "echo started; sleep 30 & sleep 30; wait"},
+	)
+	handler.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	output, err := handler.Trigger(context.Background(), Event{})
+	assert.Equal(t, ErrShellTimeout, err)
+	assert.Equal(t, "started\n", output)
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
+// TestShellTriggerBackground verifies that a command which leaves a process
+// running in the background (such as a daemon it started) is done once it has
+// exited, and that the process it left running is not killed.
+func TestShellTriggerBackground(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "test_shell_trigger")
+	require.NoError(t, err)
+	defer goRemoveAll(tmpdir)
+	alive := filepath.Join(tmpdir, "alive")
+
+	handler := NewShellTriggerrer(
+		"/bin/sh",
+		[]string{
+			"-c",
+			"(sleep 1; echo still running; touch " + alive + ") &" +
+				" echo started",
+		},
+	)
+	handler.Timeout = 500 * time.Millisecond
+
+	output, err := handler.Trigger(context.Background(), Event{})
+	require.NoError(t, err)
+	assert.Equal(t, "started\n", output)
+
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(alive); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.NoError(t, err, "the background process was killed")
+}
+
+func TestShellTriggerOutputLimit(t *testing.T) {
+	handler := NewShellTriggerrer(
+		"/bin/sh",
+		[]string{"-c", "yes | head -c 100000"},
+	)
+
+	output, err := handler.Trigger(context.Background(), Event{})
+	require.NoError(t, err)
+	assert.Equal(t, MaxShellOutput, len(output))
+}
+
 func TestShellTriggerFromConfig(t *testing.T) {
 	test := configutil.ConfigTest{
 		ResourceType: "shelltrigger",
@@ -99,6 +258,43 @@ func TestShellTriggerFromConfig(t *testing.T) {
 				Data:        "42",
 				Explanation: "numeric config",
 			},
+			{
+				Data: `{
+					"command": "echo",
+					"args": ["{{.Service"]
+				}`,
+				Explanation: "bad argument template",
+			},
+			{
+				Data: `{
+					"command": "echo",
+					"env": {
+						"SERVICE": "{{.Service"
+					}
+				}`,
+				Explanation: "bad environment template",
+			},
+			{
+				Data: `{
+					"command": "echo",
+					"timeout": "42q"
+				}`,
+				Explanation: "nonsensical timeout",
+			},
+			{
+				Data: `{
+					"command": "echo",
+					"timeout": "-1s"
+				}`,
+				Explanation: "negative timeout",
+			},
+			{
+				Data: `{
+					"command": "echo",
+					"expectedexitcodes": "0"
+				}`,
+				Explanation: "non-array expected exit codes",
+			},
 		},
 		Good: []configutil.ConfigTestData{
 			{
@@ -125,6 +321,24 @@ func TestShellTriggerFromConfig(t *testing.T) {
 				}`,
 				Explanation: "basic valid compound trigger",
 			},
+			{
+				Data: `{
+					"command": "/usr/local/bin/start-service",
+					"args": [
+						"{{.Service}}",
+						"{{.Request.Path}}"
+					],
+					"stdin": "{{.Trigger}}",
+					"env": {
+						"SERVICE": "{{.Service}}"
+					},
+					"passenv": ["PATH", "HOME"],
+					"dir": "/srv",
+					"timeout": "90s",
+					"expectedexitcodes": [0, 3]
+				}`,
+				Explanation: "full config",
+			},
 		},
 	}
 	test.Run(t)
@@ -1,27 +1,422 @@
 package trigger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
-	// "github.com/stuphlabs/pullcord"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/aws"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// DefaultSqsMaxRetries is the number of times a message which was throttled
+// (or which could not be sent due to a temporary failure) will be retried, if
+// no other number has been specified.
+const DefaultSqsMaxRetries = 3
+
+// DefaultSqsRetryDelay is how long to wait before the first retry of a
+// message, if no other delay has been specified. Each later retry waits twice
+// as long as the one before.
+const DefaultSqsRetryDelay = 200 * time.Millisecond
+
+// DefaultSqsTimeout is the amount of time an SQS trigger will wait for a
+// response to each attempt at sending a message, unless a Client has been
+// given.
+const DefaultSqsTimeout = 10 * time.Second
+
+const sqsAPIVersion = "2012-11-05"
+
+// ErrSqsNoMessage indicates that an SQS trigger has no message to send.
+var ErrSqsNoMessage = errors.New("No message body given for SQS trigger")
+
+// ErrSqsNoQueue indicates that an SQS trigger has no queue URL to send to.
+var ErrSqsNoQueue = errors.New("No queue URL given for SQS trigger")
+
+// ErrSqsNoRegion indicates that the region of the queue of an SQS trigger
+// could not be determined.
+var ErrSqsNoRegion = errors.New("Unable to determine the region of SQS queue")
+
+// ErrSqsNoCredentials indicates that no AWS credentials were available to an
+// SQS trigger.
+var ErrSqsNoCredentials = errors.New(
+	"No AWS credentials available for SQS trigger",
 )
 
-// SqsTriggerrer is a work-in-progress that is intended to eventually send
-// SQS messages as the result of a triggering event.
+// SqsError is an error returned by an SQS-compatible queue.
+type SqsError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *SqsError) Error() string {
+	return fmt.Sprintf(
+		"SQS request failed with status %d: %s: %s",
+		e.StatusCode,
+		e.Code,
+		e.Message,
+	)
+}
+
+// throttled determines if the request which got this error should be retried
+// later, either because the queue is throttling requests or because it is
+// temporarily unavailable.
+func (e *SqsError) throttled() bool {
+	if e.StatusCode == 429 || e.StatusCode >= 500 {
+		return true
+	}
+
+	return strings.Contains(e.Code, "Throttl") ||
+		strings.HasSuffix(e.Code, "RequestThrottled") ||
+		e.Code == "ServiceUnavailable"
+}
+
+// SqsTriggerrer is a Triggerrer that sends a message to an SQS queue (or any
+// queue which is compatible with the SQS API) each time it is triggered.
+//
+// Requests are signed with AWS Signature Version 4 using the given
+// Credentials, or the standard AWS environment variables if no access key has
+// been given. The region is taken from Region if given, from the host of the
+// queue URL if it is an SQS endpoint, or from the AWS_REGION (or
+// AWS_DEFAULT_REGION) environment variable. If Endpoint is given, requests are
+// sent there (keeping the path of QueueURL) instead, which allows a local
+// SQS-compatible queue to be used.
+//
+// A message which is throttled (or which could not be sent due to a temporary
+// failure) is retried up to MaxRetries times, waiting RetryDelay (or
+// DefaultSqsRetryDelay) before the first retry and twice as long before each
+// subsequent retry. Each attempt is abandoned if no response has been received
+// within DefaultSqsTimeout, unless a Client has been given.
 type SqsTriggerrer struct {
-	url string
+	QueueURL    string
+	Endpoint    string
+	Region      string
+	Message     string
+	Attributes  map[string]string
+	Credentials aws.Credentials
+	MaxRetries  uint
+	RetryDelay  time.Duration
+	Client      *http.Client
 }
 
-// Trigger implemented Triggerrer and actually performs the encapsulated
-// behavior.
-func (handler *SqsTriggerrer) Trigger(message string) (err error) {
-	return errors.New("Not yet implemented")
+func init() {
+	config.MustRegisterResourceType(
+		"sqstrigger",
+		func() json.Unmarshaler {
+			return new(SqsTriggerrer)
+		},
+	)
 }
 
-// NewSqsTriggerrer initializes a SqsTriggerrer. It may no longer be
-// strictly necessary.
-func NewSqsTriggerrer(url string) *SqsTriggerrer {
-	var handler SqsTriggerrer
-	handler.url = url
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (s *SqsTriggerrer) UnmarshalJSON(input []byte) error {
+	var t struct {
+		QueueURL        string
+		Endpoint        string
+		Region          string
+		Message         string
+		Attributes      map[string]string
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+		MaxRetries      *uint
+		RetryDelay      string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.QueueURL == "" {
+		return ErrSqsNoQueue
+	} else if _, e := url.Parse(t.QueueURL); e != nil {
+		return e
+	}
+
+	if t.Endpoint != "" {
+		if _, e := url.Parse(t.Endpoint); e != nil {
+			return e
+		}
+	}
+
+	if t.Message == "" {
+		return ErrSqsNoMessage
+	}
+
+	if (t.AccessKeyID == "") != (t.SecretAccessKey == "") {
+		return ErrSqsNoCredentials
+	}
+
+	s.RetryDelay = 0
+	if t.RetryDelay != "" {
+		d, e := time.ParseDuration(t.RetryDelay)
+		if e != nil {
+			return e
+		} else if d < 0 {
+			return fmt.Errorf(
+				"sqstrigger retry delay must not be negative:"+
+					" %s",
+				t.RetryDelay,
+			)
+		}
+		s.RetryDelay = d
+	}
+
+	s.MaxRetries = DefaultSqsMaxRetries
+	if t.MaxRetries != nil {
+		s.MaxRetries = *t.MaxRetries
+	}
+
+	s.QueueURL = t.QueueURL
+	s.Endpoint = t.Endpoint
+	s.Region = t.Region
+	s.Message = t.Message
+	s.Attributes = t.Attributes
+	s.Credentials = aws.Credentials{
+		AccessKeyID:     t.AccessKeyID,
+		SecretAccessKey: t.SecretAccessKey,
+		SessionToken:    t.SessionToken,
+	}
+	s.Client = nil
+
+	return nil
+}
+
+// NewSqsTriggerrer initializes a SqsTriggerrer which sends the given message
+// to the given queue, using the credentials in the environment.
+func NewSqsTriggerrer(queueURL string, message string) *SqsTriggerrer {
+	return &SqsTriggerrer{
+		QueueURL:   queueURL,
+		Message:    message,
+		MaxRetries: DefaultSqsMaxRetries,
+	}
+}
+
+// requestURL gives the URL to which messages are sent, which is the queue URL
+// with the scheme and host replaced by those of Endpoint (if given).
+func (s *SqsTriggerrer) requestURL() (*url.URL, error) {
+	u, err := url.Parse(s.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Endpoint != "" {
+		e, err := url.Parse(s.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		u.Scheme = e.Scheme
+		u.Host = e.Host
+		u.Path = strings.TrimSuffix(e.Path, "/") + u.Path
+		u.RawPath = ""
+	}
+
+	return u, nil
+}
+
+// region gives the region of the queue.
+func (s *SqsTriggerrer) region() (string, error) {
+	if s.Region != "" {
+		return s.Region, nil
+	}
+
+	if u, err := url.Parse(s.QueueURL); err == nil {
+		// SQS endpoints look like sqs.us-east-1.amazonaws.com (or
+		// us-east-1.queue.amazonaws.com for legacy endpoints).
+		parts := strings.Split(u.Hostname(), ".")
+		if len(parts) >= 4 && parts[0] == "sqs" {
+			return parts[1], nil
+		} else if len(parts) >= 4 && parts[1] == "queue" {
+			return parts[0], nil
+		}
+	}
+
+	if r := aws.EnvRegion(); r != "" {
+		return r, nil
+	}
+
+	return "", ErrSqsNoRegion
+}
+
+// body gives the form-encoded SendMessage request.
+func (s *SqsTriggerrer) body() []byte {
+	form := url.Values{}
+	form.Set("Action", "SendMessage")
+	form.Set("Version", sqsAPIVersion)
+	form.Set("MessageBody", s.Message)
+
+	names := make([]string, 0, len(s.Attributes))
+	for name := range s.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		prefix := "MessageAttribute." + strconv.Itoa(i+1) + "."
+		form.Set(prefix+"Name", name)
+		form.Set(prefix+"Value.DataType", "String")
+		form.Set(prefix+"Value.StringValue", s.Attributes[name])
+	}
+
+	return []byte(form.Encode())
+}
+
+// send makes a single attempt at sending the message, giving the ID assigned
+// to the message by the queue.
+func (s *SqsTriggerrer) send(
+	ctx context.Context,
+	u *url.URL,
+	region string,
+	creds aws.Credentials,
+	body []byte,
+) (string, error) {
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(
+		"Content-Type",
+		"application/x-www-form-urlencoded; charset=utf-8",
+	)
+	aws.SignV4(req, body, "sqs", region, creds, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultSqsTimeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var r struct {
+			Error struct {
+				Code    string
+				Message string
+			}
+		}
+		_ = xml.Unmarshal(contents, &r)
+
+		return "", &SqsError{
+			StatusCode: resp.StatusCode,
+			Code:       r.Error.Code,
+			Message:    r.Error.Message,
+		}
+	}
+
+	var r struct {
+		MessageID string `xml:"SendMessageResult>MessageId"`
+	}
+	if err = xml.Unmarshal(contents, &r); err != nil {
+		return "", err
+	}
+
+	return r.MessageID, nil
+}
+
+// Trigger sends the message to the queue, retrying if the message is
+// throttled. The message is abandoned if the context is cancelled.
+func (s *SqsTriggerrer) Trigger(
+	ctx context.Context,
+	_ Event,
+) (output string, err error) {
+	defer countInvocation("sqstrigger", &err)
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	_ = log.Debug("sqstrigger running trigger")
+	if s.Message == "" {
+		return "", ErrSqsNoMessage
+	} else if s.QueueURL == "" {
+		return "", ErrSqsNoQueue
+	}
+
+	creds := s.Credentials.Resolve()
+	if !creds.Valid() {
+		return "", ErrSqsNoCredentials
+	}
+
+	region, err := s.region()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := s.requestURL()
+	if err != nil {
+		return "", err
+	}
+
+	delay := s.RetryDelay
+	if delay <= 0 {
+		delay = DefaultSqsRetryDelay
+	}
+
+	body := s.body()
+	for attempt := uint(0); ; attempt++ {
+		var id string
+		id, err = s.send(ctx, u, region, creds, body)
+		if err == nil {
+			_ = log.Info(
+				fmt.Sprintf(
+					"sqstrigger sent message to %s: %s",
+					s.QueueURL,
+					id,
+				),
+			)
+			return "", nil
+		}
+
+		if sqsErr, ok := err.(*SqsError); ok && !sqsErr.throttled() {
+			break
+		} else if attempt >= s.MaxRetries {
+			break
+		}
+
+		_ = log.Warning(
+			fmt.Sprintf(
+				"sqstrigger will retry in %s after failing to"+
+					" send message to %s: %v",
+				delay.String(),
+				s.QueueURL,
+				err,
+			),
+		)
+		if err = sleep(ctx, delay); err != nil {
+			break
+		}
+		delay *= 2
+	}
 
-	return &handler
+	_ = log.Err(
+		fmt.Sprintf(
+			"sqstrigger failed to send message to %s: %v",
+			s.QueueURL,
+			err,
+		),
+	)
+	return "", err
 }
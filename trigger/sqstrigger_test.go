@@ -0,0 +1,222 @@
+package trigger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stuphlabs/pullcord/aws"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+// fakeSqs is a local SQS-compatible queue which throttles the first few
+// messages sent to it.
+type fakeSqs struct {
+	throttle int
+	messages []map[string]string
+	auth     []string
+	mutex    sync.Mutex
+}
+
+func (f *fakeSqs) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := req.ParseForm(); err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	f.auth = append(f.auth, req.Header.Get("Authorization"))
+
+	if f.throttle > 0 {
+		f.throttle--
+		w.WriteHeader(400)
+		_, _ = w.Write([]byte(
+			"<ErrorResponse><Error><Type>Sender</Type>" +
+				"<Code>Throttling</Code>" +
+				"<Message>Rate exceeded</Message>" +
+				"</Error></ErrorResponse>",
+		))
+		return
+	} else if req.URL.Path != "/123456789012/testqueue" {
+		w.WriteHeader(400)
+		_, _ = w.Write([]byte(
+			"<ErrorResponse><Error><Type>Sender</Type>" +
+				"<Code>AWS.SimpleQueueService.NonExistentQueue" +
+				"</Code><Message>No such queue</Message>" +
+				"</Error></ErrorResponse>",
+		))
+		return
+	}
+
+	message := make(map[string]string)
+	for key := range req.PostForm {
+		message[key] = req.PostForm.Get(key)
+	}
+	f.messages = append(f.messages, message)
+
+	_, _ = w.Write([]byte(
+		"<SendMessageResponse><SendMessageResult>" +
+			"<MessageId>abc-123</MessageId>" +
+			"</SendMessageResult></SendMessageResponse>",
+	))
+}
+
+func getSqsTrigger(
+	t *testing.T,
+	throttle int,
+) (*SqsTriggerrer, *fakeSqs, func()) {
+	f := &fakeSqs{throttle: throttle}
+	server := httptest.NewServer(f)
+
+	s := NewSqsTriggerrer(
+		"https://sqs.us-west-2.amazonaws.com/123456789012/testqueue",
+		"start",
+	)
+	s.Endpoint = server.URL
+	s.Credentials = aws.Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	}
+	s.RetryDelay = time.Millisecond
+	s.Attributes = map[string]string{"service": "wiki"}
+
+	return s, f, server.Close
+}
+
+func TestSqsTrigger(t *testing.T) {
+	s, f, done := getSqsTrigger(t, 0)
+	defer done()
+
+	require.NoError(t, fire(s))
+	require.Len(t, f.messages, 1)
+	assert.Equal(t, "SendMessage", f.messages[0]["Action"])
+	assert.Equal(t, "start", f.messages[0]["MessageBody"])
+	assert.Equal(t, "service", f.messages[0]["MessageAttribute.1.Name"])
+	assert.Equal(
+		t,
+		"wiki",
+		f.messages[0]["MessageAttribute.1.Value.StringValue"],
+	)
+	assert.True(
+		t,
+		strings.Contains(f.auth[0], "/us-west-2/sqs/aws4_request"),
+	)
+}
+
+func TestSqsTriggerThrottled(t *testing.T) {
+	s, f, done := getSqsTrigger(t, 2)
+	defer done()
+
+	require.NoError(t, fire(s))
+	assert.Len(t, f.messages, 1)
+	assert.Len(t, f.auth, 3)
+
+	f.throttle = 10
+	err := fire(s)
+	require.Error(t, err)
+	sqsErr, ok := err.(*SqsError)
+	require.True(t, ok)
+	assert.Equal(t, "Throttling", sqsErr.Code)
+	assert.Len(t, f.auth, 3+1+DefaultSqsMaxRetries)
+}
+
+func TestSqsTriggerNotRetried(t *testing.T) {
+	s, f, done := getSqsTrigger(t, 0)
+	defer done()
+
+	s.QueueURL = "https://sqs.us-west-2.amazonaws.com/123456789012/other"
+	err := fire(s)
+	require.Error(t, err)
+	assert.Len(t, f.auth, 1)
+}
+
+func TestSqsTriggerRegion(t *testing.T) {
+	s := NewSqsTriggerrer(
+		"https://sqs.eu-west-1.amazonaws.com/123456789012/q",
+		"start",
+	)
+	r, err := s.region()
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", r)
+
+	s.Region = "ap-south-1"
+	r, err = s.region()
+	assert.NoError(t, err)
+	assert.Equal(t, "ap-south-1", r)
+}
+
+func TestSqsTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "sqstrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"message": "start"
+				}`,
+				Explanation: "missing queue url",
+			},
+			{
+				Data: `{
+					"queueurl": "http://localhost:9324/000/q"
+				}`,
+				Explanation: "missing message",
+			},
+			{
+				Data: `{
+					"queueurl": "http://localhost:9324/000/q",
+					"message": "start",
+					"retrydelay": "42q"
+				}`,
+				Explanation: "nonsensical retry delay",
+			},
+			{
+				Data: `{
+					"queueurl": "http://localhost:9324/000/q",
+					"message": "start",
+					"accesskeyid": "AKIDEXAMPLE"
+				}`,
+				Explanation: "access key without secret",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"queueurl": "https://sqs.us-east-1.amazonaws.com/1/q",
+					"message": "start"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"queueurl": "http://localhost:9324/000/q",
+					"endpoint": "http://localhost:9324",
+					"region": "elasticmq",
+					"message": "start",
+					"attributes": {
+						"service": "wiki"
+					},
+					"accesskeyid": "x",
+					"secretaccesskey": "y",
+					"maxretries": 5,
+					"retrydelay": "1s"
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
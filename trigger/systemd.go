@@ -0,0 +1,140 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+	"github.com/stuphlabs/pullcord/systemd"
+)
+
+// SystemdTrigger is a Triggerrer that starts, stops, or restarts a systemd
+// unit over the system D-Bus, without the need for the sudo rights that
+// running systemctl from a ShellTriggerrer would require. Unless NoWait is
+// set, the trigger does not return until the job has finished, giving an
+// error if the job was not successful.
+//
+// Unless Pullcord is running as root, polkit must authorize the user Pullcord
+// runs as to manage the unit, such as with a rule allowing the
+// org.freedesktop.systemd1.manage-units action for that unit.
+type SystemdTrigger struct {
+	Client *systemd.Client
+	Unit   string
+	Action string
+	Mode   string
+	NoWait bool
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"systemdtrigger",
+		func() json.Unmarshaler {
+			return new(SystemdTrigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (s *SystemdTrigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Address string
+		Unit    string
+		Action  string
+		Mode    string
+		NoWait  bool
+		Timeout string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.Unit == "" {
+		return fmt.Errorf("systemdtrigger requires a unit")
+	}
+
+	switch t.Action {
+	case systemd.Start, systemd.Stop, systemd.Restart:
+	default:
+		return fmt.Errorf(
+			"systemdtrigger action must be one of start, stop, or"+
+				" restart, but was given: %s",
+			t.Action,
+		)
+	}
+
+	c := systemd.NewClient(t.Address)
+	if t.Timeout != "" {
+		d, e := time.ParseDuration(t.Timeout)
+		if e != nil {
+			return e
+		}
+		c.Timeout = d
+	}
+
+	s.Client = c
+	s.Unit = t.Unit
+	s.Action = t.Action
+	s.Mode = t.Mode
+	s.NoWait = t.NoWait
+
+	return nil
+}
+
+// NewSystemdTrigger initializes a SystemdTrigger which performs the given
+// action on the given unit using the system bus.
+func NewSystemdTrigger(unit string, action string) *SystemdTrigger {
+	return &SystemdTrigger{
+		Client: systemd.NewClient(""),
+		Unit:   unit,
+		Action: action,
+	}
+}
+
+// Trigger performs the action on the unit, giving up (without waiting any
+// further) if the context is cancelled.
+func (s *SystemdTrigger) Trigger(
+	ctx context.Context,
+	_ Event,
+) (output string, err error) {
+	defer countInvocation("systemdtrigger", &err)
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	_ = log.Debug(
+		fmt.Sprintf(
+			"systemdtrigger running %s on unit: %s",
+			s.Action,
+			s.Unit,
+		),
+	)
+
+	err = s.Client.Run(ctx, s.Action, s.Unit, s.Mode, !s.NoWait)
+	if err != nil {
+		_ = log.Err(
+			fmt.Sprintf(
+				"systemdtrigger failed to %s unit %s: %v",
+				s.Action,
+				s.Unit,
+				err,
+			),
+		)
+		return "", err
+	}
+
+	_ = log.Info(
+		fmt.Sprintf(
+			"systemdtrigger ran %s on unit: %s",
+			s.Action,
+			s.Unit,
+		),
+	)
+	return "", nil
+}
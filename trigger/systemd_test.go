@@ -0,0 +1,119 @@
+package trigger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+	"github.com/stuphlabs/pullcord/systemd"
+	"github.com/stuphlabs/pullcord/systemd/systemdtest"
+)
+
+func TestSystemdTrigger(t *testing.T) {
+	b, err := systemdtest.NewBus()
+	require.NoError(t, err)
+	defer func() {
+		_ = b.Close()
+	}()
+	b.SetUnit("wiki.service", "inactive", false)
+	b.SetUnit("broken.service", "inactive", true)
+
+	s := NewSystemdTrigger("wiki.service", systemd.Start)
+	s.Client.Address = b.Address
+
+	require.NoError(t, fire(s))
+	state, _ := b.Unit("wiki.service")
+	assert.Equal(t, "active", state)
+
+	s.Action = systemd.Stop
+	require.NoError(t, fire(s))
+	state, _ = b.Unit("wiki.service")
+	assert.Equal(t, "inactive", state)
+
+	s.Unit = "broken.service"
+	s.Action = systemd.Start
+	assert.Error(t, fire(s))
+
+	s.NoWait = true
+	assert.NoError(t, fire(s))
+}
+
+func TestSystemdTriggerCancelled(t *testing.T) {
+	b, err := systemdtest.NewBus()
+	require.NoError(t, err)
+	defer func() {
+		_ = b.Close()
+	}()
+	b.SetUnit("wiki.service", "inactive", false)
+	b.StallUnit("wiki.service")
+
+	s := NewSystemdTrigger("wiki.service", systemd.Start)
+	s.Client.Address = b.Address
+	s.Client.Timeout = time.Hour
+
+	elapsed, err := fireCancelled(s, 200*time.Millisecond)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, elapsed < 5*time.Second, elapsed.String())
+	assert.Contains(t, b.Calls, "StartUnit wiki.service replace")
+}
+
+func TestSystemdTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "systemdtrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"action": "start"
+				}`,
+				Explanation: "missing unit",
+			},
+			{
+				Data: `{
+					"unit": "wiki.service",
+					"action": "enable"
+				}`,
+				Explanation: "unknown action",
+			},
+			{
+				Data: `{
+					"unit": "wiki.service",
+					"action": "start",
+					"timeout": "42q"
+				}`,
+				Explanation: "nonsensical timeout",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"unit": "wiki.service",
+					"action": "start"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"address": "unix:path=/run/dbus/system_bus_socket",
+					"unit": "wiki.service",
+					"action": "restart",
+					"mode": "fail",
+					"nowait": true,
+					"timeout": "5m"
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -1,9 +1,94 @@
 package trigger
 
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/proidiot/gone/log"
+)
+
 // Triggerrer is an abstract interface describing a system which provides
 // triggers that can be called based on certain events (like a service being
 // detected as down, an amount of time passing without a service being
 // accessed, etc.).
+//
+// The trigger is given the Event which caused it to be run, and should stop
+// (giving an error) if the context is cancelled, such as when the client which
+// caused it has disconnected or the server is shutting down. Any output of the
+// trigger (such as the output of a command) is given so that it can be kept
+// along with the history of the trigger.
 type Triggerrer interface {
+	Trigger(ctx context.Context, e Event) (output string, err error)
+}
+
+// Wrapper is implemented by triggers which run other triggers, so that the
+// triggers run by a trigger can be inspected (such as by RetryAfter).
+type Wrapper interface {
+	Unwrap() []Triggerrer
+}
+
+// LegacyTriggerrer is a trigger written for the original form of Triggerrer,
+// which was given neither a context nor an Event.
+type LegacyTriggerrer interface {
 	Trigger() (err error)
 }
+
+// legacyTriggerrer adapts a LegacyTriggerrer to be a Triggerrer.
+type legacyTriggerrer struct {
+	legacy LegacyTriggerrer
+}
+
+// Legacy adapts a LegacyTriggerrer to be a Triggerrer. Since the
+// LegacyTriggerrer cannot be cancelled, it is only prevented from starting if
+// the context has already been cancelled.
+func Legacy(t LegacyTriggerrer) Triggerrer {
+	return &legacyTriggerrer{t}
+}
+
+// Trigger implements Triggerrer.
+func (l *legacyTriggerrer) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return "", l.legacy.Trigger()
+}
+
+// FromResource gives the Triggerrer which was unmarshalled from a config
+// resource, adapting it with Legacy if it is a LegacyTriggerrer. False is
+// given if the resource is not a trigger of either kind, in which case the
+// error is logged.
+func FromResource(r interface{}) (Triggerrer, bool) {
+	switch t := r.(type) {
+	case Triggerrer:
+		return t, true
+	case LegacyTriggerrer:
+		return Legacy(t), true
+	default:
+		_ = log.Err(
+			fmt.Sprintf(
+				"Registry value is not a Trigger: %#v",
+				r,
+			),
+		)
+		return nil, false
+	}
+}
+
+// sleep waits for the given duration, giving the error of the context if it
+// is cancelled first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,132 @@
+package trigger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fire runs the given trigger with a background context and an event with no
+// details, giving only the error.
+func fire(t Triggerrer) error {
+	_, err := t.Trigger(context.Background(), Event{Time: time.Now()})
+	return err
+}
+
+// fireCancelled runs the given trigger with a context which is cancelled after
+// the given delay, giving the error along with how long the trigger took to
+// return.
+func fireCancelled(
+	t Triggerrer,
+	delay time.Duration,
+) (time.Duration, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := time.AfterFunc(delay, cancel)
+	defer timer.Stop()
+
+	start := time.Now()
+	_, err := t.Trigger(ctx, Event{Time: start})
+
+	return time.Since(start), err
+}
+
+// legacyCounter is a LegacyTriggerrer which counts the number of times it has
+// been run.
+type legacyCounter struct {
+	count int
+}
+
+func (l *legacyCounter) Trigger() error {
+	l.count++
+	return nil
+}
+
+func TestLegacy(t *testing.T) {
+	l := &legacyCounter{}
+	tr := Legacy(l)
+
+	assert.NoError(t, fire(tr))
+	assert.Equal(t, 1, l.count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := tr.Trigger(ctx, Event{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, l.count)
+}
+
+func TestFromResource(t *testing.T) {
+	c := &counterTriggerrer{}
+	tr, ok := FromResource(c)
+	assert.True(t, ok)
+	assert.Equal(t, c, tr)
+
+	l := &legacyCounter{}
+	tr, ok = FromResource(l)
+	require.True(t, ok)
+	assert.NoError(t, fire(tr))
+	assert.Equal(t, 1, l.count)
+
+	_, ok = FromResource(42)
+	assert.False(t, ok)
+}
+
+type testKey struct{}
+
+func TestDetach(t *testing.T) {
+	lifetime, stop := context.WithCancel(context.Background())
+	defer stop()
+	req, done := context.WithCancel(
+		context.WithValue(context.Background(), testKey{}, "value"),
+	)
+	ctx := WithLifetime(req, lifetime)
+
+	detached := Detach(ctx)
+	done()
+	assert.Error(t, ctx.Err())
+	assert.NoError(t, detached.Err())
+	assert.Equal(t, "value", detached.Value(testKey{}))
+
+	stop()
+	<-detached.Done()
+	assert.Equal(t, context.Canceled, detached.Err())
+
+	assert.NoError(t, Detach(req).Err())
+}
+
+func TestCancelledTriggers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := &counterTriggerrer{}
+	triggers := []Triggerrer{
+		&CompoundTrigger{Triggers: []Triggerrer{c}},
+		NewRateLimitTrigger(c, 1, time.Minute),
+		NewShellTriggerrer("true", nil),
+		NewRetryTrigger(c, 2),
+	}
+	for _, tr := range triggers {
+		_, err := tr.Trigger(ctx, Event{})
+		assert.Equal(t, context.Canceled, err, "%T", tr)
+	}
+	assert.Equal(t, 0, c.count)
+}
+
+func TestShellTriggerCancelled(t *testing.T) {
+	handler := NewShellTriggerrer("sh", []string{"-c", "echo started; sleep 10"})
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		200*time.Millisecond,
+	)
+	defer cancel()
+
+	start := time.Now()
+	output, err := handler.Trigger(ctx, Event{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, "started\n", output)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
@@ -0,0 +1,397 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+// DefaultWebhookTimeout is the amount of time a WebhookTrigger will wait for a
+// response if no other timeout has been specified.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// DefaultWebhookMaxRetries is the number of times a failed webhook will be
+// retried, if no other number has been specified.
+const DefaultWebhookMaxRetries = 2
+
+// DefaultWebhookRetryDelay is how long to wait before the first retry of a
+// webhook, if no other delay has been specified. Each later retry waits twice
+// as long as the one before.
+const DefaultWebhookRetryDelay = 500 * time.Millisecond
+
+// DefaultWebhookSignatureHeader is the header in which the HMAC signature of
+// the body of a webhook is given, if no other header has been specified.
+const DefaultWebhookSignatureHeader = "X-Pullcord-Signature"
+
+// maxWebhookErrorBodySize is the most of the body of an unexpected response
+// which will be logged.
+const maxWebhookErrorBodySize = 1024
+
+// WebhookStatusError indicates that a webhook received a response with an
+// unexpected status code.
+type WebhookStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *WebhookStatusError) Error() string {
+	return fmt.Sprintf(
+		"webhook to %s received unexpected status: %d",
+		e.URL,
+		e.StatusCode,
+	)
+}
+
+// WebhookContext is the information given to the body template of a
+// WebhookTrigger. Time is when the webhook is being sent, Attempt is the
+// number of the attempt (starting from 1), Data holds any additional values
+// given in the configuration of the trigger, and Event is the Event which
+// caused the trigger to be run.
+type WebhookContext struct {
+	Time    time.Time
+	Attempt uint
+	Data    map[string]string
+	Event   Event
+}
+
+// WebhookTrigger is a Triggerrer that sends an HTTP request (to a CI job, an
+// orchestrator, or any other HTTP API) each time it is triggered.
+//
+// The body of the request is rendered from a text/template given a
+// WebhookContext. The webhook has succeeded if the status code of the
+// response is one of the expected status codes (or any 2xx status if none are
+// specified). If HMACSecret is given, the hex-encoded HMAC-SHA256 of the body
+// is given (prefixed with "sha256=") in the SignatureHeader (or
+// DefaultWebhookSignatureHeader).
+//
+// A webhook which fails because no response was received, or because of a 429
+// or 5xx response, is retried up to MaxRetries times, waiting RetryDelay (or
+// DefaultWebhookRetryDelay) before the first retry and twice as long before
+// each subsequent retry.
+type WebhookTrigger struct {
+	Method          string
+	URL             *url.URL
+	Headers         map[string]string
+	Body            *template.Template
+	Data            map[string]string
+	Timeout         time.Duration
+	ExpectedStatus  []int
+	HMACSecret      string
+	SignatureHeader string
+	MaxRetries      uint
+	RetryDelay      time.Duration
+	Client          *http.Client
+}
+
+func init() {
+	config.MustRegisterResourceType(
+		"webhooktrigger",
+		func() json.Unmarshaler {
+			return new(WebhookTrigger)
+		},
+	)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (w *WebhookTrigger) UnmarshalJSON(input []byte) error {
+	var t struct {
+		Method          string
+		URL             string
+		Headers         map[string]string
+		Body            string
+		Data            map[string]string
+		Timeout         string
+		ExpectedStatus  []int
+		HMACSecret      string
+		SignatureHeader string
+		MaxRetries      *uint
+		RetryDelay      string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	if t.URL == "" {
+		return fmt.Errorf("webhooktrigger requires a url")
+	}
+	u, e := url.Parse(t.URL)
+	if e != nil {
+		return e
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf(
+			"webhooktrigger url must be http or https, but was"+
+				" given: %s",
+			t.URL,
+		)
+	}
+
+	for _, s := range t.ExpectedStatus {
+		if s < 100 || s > 999 {
+			return fmt.Errorf(
+				"webhooktrigger expected status must be a"+
+					" valid HTTP status code, but was"+
+					" given: %d",
+				s,
+			)
+		}
+	}
+
+	w.Body = nil
+	if t.Body != "" {
+		b, e := template.New("webhook").Parse(t.Body)
+		if e != nil {
+			return e
+		}
+		w.Body = b
+	}
+
+	w.Timeout = 0
+	if t.Timeout != "" {
+		d, e := time.ParseDuration(t.Timeout)
+		if e != nil {
+			return e
+		}
+		w.Timeout = d
+	}
+
+	w.RetryDelay = 0
+	if t.RetryDelay != "" {
+		d, e := time.ParseDuration(t.RetryDelay)
+		if e != nil {
+			return e
+		} else if d < 0 {
+			return fmt.Errorf(
+				"webhooktrigger retry delay must not be"+
+					" negative: %s",
+				t.RetryDelay,
+			)
+		}
+		w.RetryDelay = d
+	}
+
+	w.MaxRetries = DefaultWebhookMaxRetries
+	if t.MaxRetries != nil {
+		w.MaxRetries = *t.MaxRetries
+	}
+
+	w.Method = t.Method
+	w.URL = u
+	w.Headers = t.Headers
+	w.Data = t.Data
+	w.ExpectedStatus = t.ExpectedStatus
+	w.HMACSecret = t.HMACSecret
+	w.SignatureHeader = t.SignatureHeader
+	w.Client = nil
+
+	return nil
+}
+
+// NewWebhookTrigger initializes a WebhookTrigger which sends a request with the
+// given method to the given URL, with the body rendered from the given
+// template (if any).
+func NewWebhookTrigger(
+	method string,
+	u *url.URL,
+	body *template.Template,
+) *WebhookTrigger {
+	return &WebhookTrigger{
+		Method:     method,
+		URL:        u,
+		Body:       body,
+		MaxRetries: DefaultWebhookMaxRetries,
+	}
+}
+
+func (w *WebhookTrigger) statusExpected(status int) bool {
+	if len(w.ExpectedStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+
+	for _, s := range w.ExpectedStatus {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sign gives the value of the signature header for the given body.
+func (w *WebhookTrigger) sign(body []byte) string {
+	h := hmac.New(sha256.New, []byte(w.HMACSecret))
+	_, _ = h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// send makes a single attempt at sending the webhook for the given event,
+// reporting whether a failed attempt should be retried.
+func (w *WebhookTrigger) send(
+	ctx context.Context,
+	e Event,
+	attempt uint,
+) (retry bool, err error) {
+	var body bytes.Buffer
+	if w.Body != nil {
+		err = w.Body.Execute(
+			&body,
+			WebhookContext{
+				Time:    time.Now(),
+				Attempt: attempt,
+				Data:    w.Data,
+				Event:   e,
+			},
+		)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	method := w.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequest(
+		method,
+		w.URL.String(),
+		bytes.NewReader(body.Bytes()),
+	)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range w.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if w.HMACSecret != "" {
+		header := w.SignatureHeader
+		if header == "" {
+			header = DefaultWebhookSignatureHeader
+		}
+		req.Header.Set(header, w.sign(body.Bytes()))
+	}
+
+	client := w.Client
+	if client == nil {
+		timeout := w.Timeout
+		if timeout <= 0 {
+			timeout = DefaultWebhookTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if !w.statusExpected(resp.StatusCode) {
+		contents, _ := ioutil.ReadAll(
+			io.LimitReader(resp.Body, maxWebhookErrorBodySize),
+		)
+		_ = log.Debug(
+			fmt.Sprintf(
+				"webhooktrigger received unexpected response"+
+					" from %s: %s",
+				w.URL.String(),
+				string(contents),
+			),
+		)
+
+		return resp.StatusCode == 429 || resp.StatusCode >= 500,
+			&WebhookStatusError{
+				URL:        w.URL.String(),
+				StatusCode: resp.StatusCode,
+			}
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return false, nil
+}
+
+// Trigger sends the webhook, retrying if it fails with what is likely a
+// temporary failure. The webhook is abandoned if the context is cancelled.
+func (w *WebhookTrigger) Trigger(
+	ctx context.Context,
+	e Event,
+) (output string, err error) {
+	defer countInvocation("webhooktrigger", &err)
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	_ = log.Debug("webhooktrigger running trigger")
+	if w.URL == nil {
+		return "", fmt.Errorf("webhooktrigger has no url")
+	}
+
+	delay := w.RetryDelay
+	if delay <= 0 {
+		delay = DefaultWebhookRetryDelay
+	}
+
+	for attempt := uint(1); ; attempt++ {
+		var retry bool
+		retry, err = w.send(ctx, e, attempt)
+		if err == nil {
+			_ = log.Info(
+				fmt.Sprintf(
+					"webhooktrigger sent webhook to %s",
+					w.URL.String(),
+				),
+			)
+			return "", nil
+		} else if !retry || attempt > w.MaxRetries {
+			break
+		}
+
+		_ = log.Warning(
+			fmt.Sprintf(
+				"webhooktrigger will retry in %s after failing"+
+					" to send webhook to %s: %v",
+				delay.String(),
+				w.URL.String(),
+				err,
+			),
+		)
+		if err = sleep(ctx, delay); err != nil {
+			break
+		}
+		delay *= 2
+	}
+
+	_ = log.Err(
+		fmt.Sprintf(
+			"webhooktrigger failed to send webhook to %s: %v",
+			w.URL.String(),
+			err,
+		),
+	)
+	return "", err
+}
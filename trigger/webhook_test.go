@@ -0,0 +1,230 @@
+package trigger
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+type webhookRequest struct {
+	method    string
+	body      string
+	token     string
+	signature string
+}
+
+// fakeWebhook is a local HTTP API which responds to the first requests it
+// receives with the given status codes, and with 200 afterward.
+type fakeWebhook struct {
+	statuses []int
+	requests []webhookRequest
+	mutex    sync.Mutex
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	body, _ := ioutil.ReadAll(req.Body)
+	f.requests = append(
+		f.requests,
+		webhookRequest{
+			method:    req.Method,
+			body:      string(body),
+			token:     req.Header.Get("X-Token"),
+			signature: req.Header.Get(DefaultWebhookSignatureHeader),
+		},
+	)
+
+	status := 200
+	if len(f.statuses) > 0 {
+		status = f.statuses[0]
+		f.statuses = f.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func getWebhookTrigger(
+	t *testing.T,
+	statuses ...int,
+) (*WebhookTrigger, *fakeWebhook, func()) {
+	f := &fakeWebhook{statuses: statuses}
+	server := httptest.NewServer(f)
+
+	u, err := url.Parse(server.URL + "/job/start")
+	require.NoError(t, err)
+
+	w := NewWebhookTrigger(
+		"POST",
+		u,
+		template.Must(
+			template.New("body").Parse(
+				`{"service":"{{.Data.service}}",`+
+					`"attempt":{{.Attempt}}}`,
+			),
+		),
+	)
+	w.Data = map[string]string{"service": "wiki"}
+	w.Headers = map[string]string{"X-Token": "abc"}
+	w.RetryDelay = time.Millisecond
+
+	return w, f, server.Close
+}
+
+func TestWebhookTrigger(t *testing.T) {
+	w, f, done := getWebhookTrigger(t)
+	defer done()
+
+	require.NoError(t, fire(w))
+	require.Len(t, f.requests, 1)
+	assert.Equal(t, "POST", f.requests[0].method)
+	assert.Equal(t, `{"service":"wiki","attempt":1}`, f.requests[0].body)
+	assert.Equal(t, "abc", f.requests[0].token)
+	assert.Equal(t, "", f.requests[0].signature)
+}
+
+func TestWebhookTriggerSigned(t *testing.T) {
+	w, f, done := getWebhookTrigger(t)
+	defer done()
+	w.HMACSecret = "secret"
+
+	require.NoError(t, fire(w))
+	require.Len(t, f.requests, 1)
+	assert.Equal(
+		t,
+		w.sign([]byte(f.requests[0].body)),
+		f.requests[0].signature,
+	)
+	assert.Contains(t, f.requests[0].signature, "sha256=")
+}
+
+func TestWebhookTriggerRetry(t *testing.T) {
+	w, f, done := getWebhookTrigger(t, 503, 429)
+	defer done()
+
+	require.NoError(t, fire(w))
+	require.Len(t, f.requests, 3)
+	assert.Equal(t, `{"service":"wiki","attempt":3}`, f.requests[2].body)
+
+	f.statuses = []int{500, 500, 500, 500}
+	err := fire(w)
+	require.Error(t, err)
+	statusErr, ok := err.(*WebhookStatusError)
+	require.True(t, ok)
+	assert.Equal(t, 500, statusErr.StatusCode)
+	assert.Len(t, f.requests, 3+1+DefaultWebhookMaxRetries)
+}
+
+func TestWebhookTriggerNotRetried(t *testing.T) {
+	w, f, done := getWebhookTrigger(t, 404)
+	defer done()
+
+	assert.Error(t, fire(w))
+	assert.Len(t, f.requests, 1)
+
+	w.ExpectedStatus = []int{404}
+	f.statuses = []int{404}
+	assert.NoError(t, fire(w))
+}
+
+func TestWebhookTriggerRateLimited(t *testing.T) {
+	w, f, done := getWebhookTrigger(t)
+	defer done()
+
+	r := NewRateLimitTrigger(w, 1, time.Minute)
+	assert.NoError(t, fire(r))
+	assert.Equal(t, ErrRateLimitExceeded, fire(r))
+	assert.Len(t, f.requests, 1)
+}
+
+func TestWebhookTriggerFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "webhooktrigger",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data:        "{}",
+				Explanation: "missing url",
+			},
+			{
+				Data: `{
+					"url": "ftp://example.com/"
+				}`,
+				Explanation: "non-http url",
+			},
+			{
+				Data: `{
+					"url": "http://example.com/",
+					"body": "{{.Unclosed"
+				}`,
+				Explanation: "unparseable body template",
+			},
+			{
+				Data: `{
+					"url": "http://example.com/",
+					"expectedstatus": [42]
+				}`,
+				Explanation: "invalid expected status",
+			},
+			{
+				Data: `{
+					"url": "http://example.com/",
+					"timeout": "42q"
+				}`,
+				Explanation: "nonsensical timeout",
+			},
+			{
+				Data: `{
+					"url": "http://example.com/",
+					"retrydelay": "-1s"
+				}`,
+				Explanation: "negative retry delay",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"url": "http://example.com/"
+				}`,
+				Explanation: "basic config",
+			},
+			{
+				Data: `{
+					"method": "PUT",
+					"url": "https://ci.example.com/job/start",
+					"headers": {
+						"Content-Type": "application/json"
+					},
+					"body": "{\"service\": \"{{.Data.service}}\"}",
+					"data": {
+						"service": "wiki"
+					},
+					"timeout": "5s",
+					"expectedstatus": [200, 201],
+					"hmacsecret": "secret",
+					"signatureheader": "X-Hub-Signature-256",
+					"maxretries": 4,
+					"retrydelay": "1s"
+				}`,
+				Explanation: "full config",
+			},
+		},
+	}
+	test.Run(t)
+}
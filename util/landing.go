@@ -1,8 +1,8 @@
 package util
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
 	"net/http"
 
 	"github.com/proidiot/gone/log"
@@ -10,8 +10,11 @@ import (
 )
 
 // LandingHandler is a net/http.Handler that acts as a default landing page for
-// a (presumably not-yet-production) Pullcord instance.
+// a (presumably not-yet-production) Pullcord instance. The page is rendered
+// using the LandingPage template of Pages (or the built-in default if Pages is
+// nil).
 type LandingHandler struct {
+	Pages *PageTemplate
 }
 
 func init() {
@@ -25,41 +28,39 @@ func init() {
 
 // UnmarshalJSON implements encoding/json.Unmarshaler.
 func (l *LandingHandler) UnmarshalJSON(data []byte) error {
+	var t struct {
+		Pages *config.Resource
+	}
+
+	l.Pages = nil
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if e := dec.Decode(&t); e != nil {
+		if _, ok := e.(*json.UnmarshalTypeError); ok {
+			// Anything other than an object has always been
+			// accepted as a plain landing page config.
+			return nil
+		}
+		return e
+	}
+
+	if t.Pages != nil && t.Pages.Unmarshalled != nil {
+		p, ok := t.Pages.Unmarshalled.(*PageTemplate)
+		if !ok {
+			return config.UnexpectedResourceType
+		}
+		l.Pages = p
+	}
+
 	return nil
 }
 
-// NewLandingHandler generates an http.Handler that produces a simple landing
-// page.
+// ServeHTTP implements net/http.Handler by producing a simple landing page.
 func (l *LandingHandler) ServeHTTP(
 	w http.ResponseWriter,
 	req *http.Request,
 ) {
 	_ = log.Info("running landing handler")
 
-	w.WriteHeader(200)
-	_, err := w.Write(
-		[]byte(
-			"<html><head><title>" +
-				"Pullcord Landing Page" +
-				"</title></head><body><h1>" +
-				"Pullcord Landing Page" +
-				"</h1><p>" +
-				"This is the landing page for Pullcord, " +
-				"a reverse proxy for cloud-based web apps " +
-				"that allows the servers the web apps run on " +
-				"to be turned off when not in use." +
-				"</p><p>" +
-				"If you are unsure of how to proceed, " +
-				"please contact the site administrator." +
-				"</p></body></html>",
-		),
-	)
-	if err != nil {
-		_ = log.Error(
-			fmt.Sprintf(
-				"error while writing landing page: %s",
-				err.Error(),
-			),
-		)
-	}
+	l.Pages.ServePage(w, req, LandingPage, PageContext{})
 }
@@ -56,6 +56,15 @@ func TestLandingHandlerFromConfig(t *testing.T) {
 				Data:        "",
 				Explanation: "empty config",
 			},
+			{
+				Data: `{
+					"pages": {
+						"type": "standardresponse",
+						"data": 404
+					}
+				}`,
+				Explanation: "pages of the wrong type",
+			},
 		},
 		Good: []configutil.ConfigTestData{
 			{
@@ -74,6 +83,19 @@ func TestLandingHandlerFromConfig(t *testing.T) {
 				Data:        `"anything goes"`,
 				Explanation: "string config",
 			},
+			{
+				Data: `{
+					"pages": {
+						"type": "pagetemplate",
+						"data": {
+							"inline": {
+								"landing": "<p>Welcome</p>"
+							}
+						}
+					}
+				}`,
+				Explanation: "custom landing page",
+			},
 		},
 	}
 	test.Run(t)
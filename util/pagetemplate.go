@@ -0,0 +1,417 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/proidiot/gone/log"
+	"github.com/stuphlabs/pullcord/config"
+)
+
+const (
+	// LandingPage is the name of the template for the landing page.
+	LandingPage = "landing"
+	// ErrorPage is the name of the template for error pages which have no
+	// more specific template (see PageTemplate.ServeError).
+	ErrorPage = "error"
+	// NotReadyPage is the name of the template for the page given while a
+	// service is not yet ready.
+	NotReadyPage = "notready"
+	// LoginPage is the name of the template for the login page.
+	LoginPage = "login"
+)
+
+// RequestIDHeader is the header from which the request ID given to page
+// templates is taken. If a request does not have this header, a request ID is
+// generated and the header is added to the response.
+const RequestIDHeader = "X-Request-Id"
+
+// PageContext is the information given to a page template when it is rendered.
+// Data holds anything specific to a particular page (such as the fields of the
+// login form, or the status of a service which is not yet ready).
+type PageContext struct {
+	ServiceName   string
+	Path          string
+	StatusCode    int
+	Title         string
+	Message       string
+	ShouldContact bool
+	RequestID     string
+	Data          interface{}
+}
+
+// PageTemplate is a set of html/template templates used to render the pages
+// Pullcord itself produces. Any page which has not been given a template falls
+// back to the built-in default, and a nil PageTemplate gives the built-in
+// defaults for every page.
+//
+// When configured, templates can be given either inline or as paths to files,
+// keyed by the name of the page (LandingPage, ErrorPage, NotReadyPage,
+// LoginPage, or the status code or class of an error page, such as "404" or
+// "5xx").
+type PageTemplate struct {
+	templates *template.Template
+}
+
+var defaultPageSources = map[string]string{
+	LandingPage: `<!DOCTYPE html>
+<html>
+ <head>
+  <title>
+   Pullcord Landing Page
+  </title>
+ </head>
+ <body>
+  <h1>
+   Pullcord Landing Page
+  </h1>
+  <p>
+   This is the landing page for Pullcord, a reverse proxy for cloud-based web
+   apps that allows the servers the web apps run on to be turned off when not
+   in use.
+  </p>
+  <p>
+   If you are unsure of how to proceed, please contact the site
+   administrator.
+  </p>
+ </body>
+</html>
+`,
+	ErrorPage: `<!DOCTYPE html>
+<html>
+ <head>
+  <title>
+   {{.Title}}
+  </title>
+ </head>
+ <body>
+  <h1>
+   {{.Title}}
+  </h1>
+  <p>
+   {{.Message}}
+   {{- if .ShouldContact}} Please contact your system administrator.{{end}}
+  </p>
+ </body>
+</html>
+`,
+	NotReadyPage: `<!DOCTYPE html>
+<html>
+ <head>
+  <title>
+   Pullcord - Service Not Ready
+  </title>
+  <noscript>
+   <meta http-equiv="refresh" content="{{.Data.RetryAfter}}">
+  </noscript>
+ </head>
+ <body>
+  <h1>
+   Pullcord - Service Not Ready
+  </h1>
+  <p>
+   The requested service ({{.ServiceName}}) is not yet ready, but any trigger
+   to start the service has been started successfully, so hopefully the
+   service will be up in a few minutes. This page will reload once the
+   service is ready.
+  </p>
+  <p>
+   Time spent waiting so far:
+   <span id="pullcord-elapsed">{{.Data.Elapsed}}</span> seconds.
+  </p>
+  <p>
+   If you would like further information, please contact the site
+   administrator.
+  </p>
+  <script>
+   (function() {
+    var statusPath = {{.Data.StatusPath}};
+    var elapsed = document.getElementById("pullcord-elapsed");
+    function poll() {
+     var req = new XMLHttpRequest();
+     req.onload = function() {
+      // Only a service which is up would give any other response.
+      if (req.getResponseHeader("X-Pullcord-State") === null) {
+       window.location.reload();
+       return;
+      }
+      var status = JSON.parse(req.responseText);
+      elapsed.textContent = status.elapsed;
+      if (status.up) {
+       window.location.reload();
+      } else {
+       setTimeout(poll, {{.Data.RetryAfter}} * 1000);
+      }
+     };
+     req.onerror = function() {
+      setTimeout(poll, {{.Data.RetryAfter}} * 1000);
+     };
+     req.open("GET", statusPath);
+     req.setRequestHeader("Accept", "application/json");
+     req.send();
+    }
+    setTimeout(poll, {{.Data.RetryAfter}} * 1000);
+   })();
+  </script>
+ </body>
+</html>
+`,
+	LoginPage: `<!DOCTYPE html>
+<html>
+ <head>
+  <title>
+   Pullcord Login
+  </title>
+ </head>
+ <body>
+  <form method="POST" action="{{.Path}}">
+   <fieldset>
+    <legend>Pullcord Login</legend>
+    {{- if .Message}}
+    <label class="error">{{.Message}}</label><br />
+    {{- end}}
+    <label for="username">Username:</label>
+    <input type="text" name="{{.Data.UsernameField}}" id="username" />
+    <label for="password">Password:</label>
+    <input type="password" name="{{.Data.PasswordField}}" id="password" />
+    <input type="hidden" name="{{.Data.XSRFField}}" value="{{.Data.XSRFToken}}" />
+    <input type="submit" value="Login" />
+   </fieldset>
+  </form>
+ </body>
+</html>
+`,
+}
+
+var defaultPageTemplate = MustNewPageTemplate(nil, nil)
+
+func init() {
+	config.MustRegisterResourceType(
+		"pagetemplate",
+		func() json.Unmarshaler {
+			return new(PageTemplate)
+		},
+	)
+}
+
+// NewPageTemplate creates a PageTemplate from the given inline templates and
+// the templates in the given files (both keyed by page name), with the
+// built-in default being used for any page not given.
+func NewPageTemplate(
+	inline map[string]string,
+	files map[string]string,
+) (*PageTemplate, error) {
+	sources := make(map[string]string)
+	for name, text := range defaultPageSources {
+		sources[name] = text
+	}
+
+	for name, text := range inline {
+		sources[name] = text
+	}
+
+	for name, path := range files {
+		if _, present := inline[name]; present {
+			return nil, fmt.Errorf(
+				"pagetemplate was given both an inline template"+
+					" and a template file for: %s",
+				name,
+			)
+		}
+
+		text, e := ioutil.ReadFile(path)
+		if e != nil {
+			return nil, e
+		}
+		sources[name] = string(text)
+	}
+
+	t := template.New("pagetemplate")
+	for name, text := range sources {
+		if _, e := t.New(name).Parse(text); e != nil {
+			return nil, e
+		}
+	}
+
+	return &PageTemplate{templates: t}, nil
+}
+
+// MustNewPageTemplate is a convenience function around NewPageTemplate that
+// panics on error.
+func MustNewPageTemplate(
+	inline map[string]string,
+	files map[string]string,
+) *PageTemplate {
+	p, e := NewPageTemplate(inline, files)
+	if e != nil {
+		panic(e)
+	}
+
+	return p
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (p *PageTemplate) UnmarshalJSON(data []byte) error {
+	var t struct {
+		Inline map[string]string
+		Files  map[string]string
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if e := dec.Decode(&t); e != nil {
+		return e
+	}
+
+	n, e := NewPageTemplate(t.Inline, t.Files)
+	if e != nil {
+		return e
+	}
+
+	*p = *n
+	return nil
+}
+
+func (p *PageTemplate) lookup(names ...string) *template.Template {
+	if p == nil || p.templates == nil {
+		p = defaultPageTemplate
+	}
+
+	for _, name := range names {
+		if t := p.templates.Lookup(name); t != nil {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func requestID(w http.ResponseWriter, req *http.Request) string {
+	if id := req.Header.Get(RequestIDHeader); id != "" {
+		return id
+	} else if id = w.Header().Get(RequestIDHeader); id != "" {
+		return id
+	}
+
+	raw := make([]byte, 8)
+	if _, e := rand.Read(raw); e != nil {
+		_ = log.Warning(
+			fmt.Sprintf(
+				"unable to generate request ID: %s",
+				e.Error(),
+			),
+		)
+		return ""
+	}
+
+	id := hex.EncodeToString(raw)
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// ServePage renders the named page with the given context. The Path,
+// RequestID, and (if not already set) StatusCode of the context are filled in
+// from the request before the page is rendered.
+func (p *PageTemplate) ServePage(
+	w http.ResponseWriter,
+	req *http.Request,
+	name string,
+	ctx PageContext,
+) {
+	p.servePage(w, req, ctx, name)
+}
+
+// servePage renders the first of the named pages which has a template.
+func (p *PageTemplate) servePage(
+	w http.ResponseWriter,
+	req *http.Request,
+	ctx PageContext,
+	names ...string,
+) {
+	ctx.Path = req.URL.Path
+	ctx.RequestID = requestID(w, req)
+	if ctx.StatusCode == 0 {
+		ctx.StatusCode = 200
+	}
+
+	var buf bytes.Buffer
+	t := p.lookup(names...)
+	if t == nil {
+		_ = log.Error(
+			fmt.Sprintf(
+				"no page template found for %v (request ID: %s)",
+				names,
+				ctx.RequestID,
+			),
+		)
+		InternalServerError.ServeHTTP(w, req)
+		return
+	} else if e := t.Execute(&buf, ctx); e != nil {
+		_ = log.Error(
+			fmt.Sprintf(
+				"error while executing page template %s"+
+					" (request ID: %s): %s",
+				t.Name(),
+				ctx.RequestID,
+				e.Error(),
+			),
+		)
+		if p != nil && p != defaultPageTemplate {
+			defaultPageTemplate.servePage(w, req, ctx, names...)
+		} else {
+			w.WriteHeader(500)
+		}
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.WriteHeader(ctx.StatusCode)
+	if _, e := buf.WriteTo(w); e != nil {
+		_ = log.Error(
+			fmt.Sprintf(
+				"error while writing page %s: %s",
+				t.Name(),
+				e.Error(),
+			),
+		)
+	}
+}
+
+// ServeError renders the error page for the given HTTP status code. The most
+// specific template available is used: one named for the code itself (e.g.
+// "404"), then one named for the class of the code (e.g. "4xx"), and finally
+// the generic ErrorPage.
+func (p *PageTemplate) ServeError(
+	w http.ResponseWriter,
+	req *http.Request,
+	code int,
+) {
+	if code < MinimumStandardResponse {
+		code = 500
+	}
+
+	rs := StandardResponse(code)
+	ctx := PageContext{
+		StatusCode:    code,
+		Title:         responseTitle[rs],
+		Message:       responseText[rs],
+		ShouldContact: responseContact[rs],
+	}
+
+	p.servePage(
+		w,
+		req,
+		ctx,
+		strconv.Itoa(code),
+		strconv.Itoa(code/100)+"xx",
+		ErrorPage,
+	)
+}
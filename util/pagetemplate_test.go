@@ -0,0 +1,272 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	configutil "github.com/stuphlabs/pullcord/config/util"
+)
+
+func servePageTemplateError(
+	t *testing.T,
+	p *PageTemplate,
+	code int,
+) (int, string) {
+	request := httptest.NewRequest("GET", "/some/page", nil)
+	w := httptest.NewRecorder()
+	p.ServeError(w, request, code)
+	response := w.Result()
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	return response.StatusCode, string(contents)
+}
+
+func TestDefaultPageTemplate(t *testing.T) {
+	var p *PageTemplate
+
+	code, contents := servePageTemplateError(t, p, 404)
+	assert.Equal(t, 404, code)
+	assert.Contains(t, contents, "Not Found")
+
+	code, contents = servePageTemplateError(t, p, 500)
+	assert.Equal(t, 500, code)
+	assert.Contains(t, contents, "Internal Server Error")
+	assert.Contains(t, contents, "contact your system administrator")
+
+	request := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	p.ServePage(w, request, LandingPage, PageContext{})
+	response := w.Result()
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Contains(t, response.Header.Get("Content-Type"), "text/html")
+	body, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "Pullcord Landing Page")
+}
+
+func TestInlinePageTemplate(t *testing.T) {
+	p, err := NewPageTemplate(
+		map[string]string{
+			"404":   "missing {{.Path}} ({{.StatusCode}})",
+			"5xx":   "broken: {{.Title}}",
+			"error": "generic {{.StatusCode}}",
+		},
+		nil,
+	)
+	require.NoError(t, err)
+
+	code, contents := servePageTemplateError(t, p, 404)
+	assert.Equal(t, 404, code)
+	assert.Equal(t, "missing /some/page (404)", contents)
+
+	code, contents = servePageTemplateError(t, p, 501)
+	assert.Equal(t, 501, code)
+	assert.Equal(t, "broken: Not Implemented", contents)
+
+	code, contents = servePageTemplateError(t, p, 403)
+	assert.Equal(t, 403, code)
+	assert.Equal(t, "generic 403", contents)
+}
+
+func TestFilePageTemplate(t *testing.T) {
+	f, err := ioutil.TempFile("", "pullcord-pagetemplate")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	_, err = f.WriteString("<p>Welcome to {{.Path}}</p>")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	p, err := NewPageTemplate(
+		nil,
+		map[string]string{LandingPage: f.Name()},
+	)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest("GET", "/a&b", nil)
+	w := httptest.NewRecorder()
+	p.ServePage(w, request, LandingPage, PageContext{})
+	contents, err := ioutil.ReadAll(w.Result().Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Welcome to /a&amp;b</p>", string(contents))
+
+	code, body := servePageTemplateError(t, p, 404)
+	assert.Equal(t, 404, code)
+	assert.Contains(t, body, "Not Found")
+
+	_, err = NewPageTemplate(
+		map[string]string{LandingPage: "inline"},
+		map[string]string{LandingPage: f.Name()},
+	)
+	assert.Error(t, err)
+
+	_, err = NewPageTemplate(
+		nil,
+		map[string]string{LandingPage: f.Name() + ".missing"},
+	)
+	assert.Error(t, err)
+}
+
+func TestPageTemplateRequestID(t *testing.T) {
+	p, err := NewPageTemplate(
+		map[string]string{"error": "{{.RequestID}}"},
+		nil,
+	)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIDHeader, "abc123")
+	w := httptest.NewRecorder()
+	p.ServeError(w, request, 404)
+	contents, err := ioutil.ReadAll(w.Result().Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", string(contents))
+
+	request = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	p.ServeError(w, request, 404)
+	response := w.Result()
+	contents, err = ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "", string(contents))
+	assert.Equal(t, string(contents), response.Header.Get(RequestIDHeader))
+}
+
+func TestBrokenPageTemplate(t *testing.T) {
+	_, err := NewPageTemplate(
+		map[string]string{LandingPage: "{{.Unclosed"},
+		nil,
+	)
+	assert.Error(t, err)
+
+	p, err := NewPageTemplate(
+		map[string]string{"404": "{{.NoSuchField}}"},
+		nil,
+	)
+	require.NoError(t, err)
+
+	code, contents := servePageTemplateError(t, p, 404)
+	assert.Equal(t, 404, code)
+	assert.Contains(t, contents, "Not Found")
+}
+
+func TestTemplatedResponse(t *testing.T) {
+	s := &TemplatedResponse{
+		Code: 403,
+		Pages: MustNewPageTemplate(
+			map[string]string{"4xx": "nope"},
+			nil,
+		),
+	}
+
+	request := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	response := w.Result()
+	assert.Equal(t, 403, response.StatusCode)
+	contents, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "nope", string(contents))
+}
+
+func TestPageTemplateFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "pagetemplate",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "",
+				Explanation: "empty config",
+			},
+			{
+				Data:        "42",
+				Explanation: "numeric config",
+			},
+			{
+				Data: `{
+					"inline": {
+						"landing": "{{.Unclosed"
+					}
+				}`,
+				Explanation: "unparseable template",
+			},
+			{
+				Data: `{
+					"files": {
+						"landing": "/no/such/pullcord/template"
+					}
+				}`,
+				Explanation: "missing template file",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data:        "{}",
+				Explanation: "empty object",
+			},
+			{
+				Data: `{
+					"inline": {
+						"landing": "<p>Welcome</p>",
+						"404": "<p>Not here: {{.Path}}</p>"
+					}
+				}`,
+				Explanation: "inline templates",
+			},
+		},
+	}
+	test.Run(t)
+}
+
+func TestTemplatedResponseFromConfig(t *testing.T) {
+	test := configutil.ConfigTest{
+		ResourceType: "templatedresponse",
+		SyntacticallyBad: []configutil.ConfigTestData{
+			{
+				Data:        "404",
+				Explanation: "bare status code",
+			},
+			{
+				Data:        "{}",
+				Explanation: "missing status code",
+			},
+			{
+				Data: `{
+					"code": 404,
+					"pages": {
+						"type": "standardresponse",
+						"data": 404
+					}
+				}`,
+				Explanation: "pages of the wrong type",
+			},
+		},
+		Good: []configutil.ConfigTestData{
+			{
+				Data: `{
+					"code": 404
+				}`,
+				Explanation: "default pages",
+			},
+			{
+				Data: `{
+					"code": 404,
+					"pages": {
+						"type": "pagetemplate",
+						"data": {
+							"inline": {
+								"4xx": "<p>Oops</p>"
+							}
+						}
+					}
+				}`,
+				Explanation: "custom pages",
+			},
+		},
+	}
+	test.Run(t)
+}
@@ -1,12 +1,11 @@
 package util
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"text/template"
 
-	"github.com/proidiot/gone/log"
 	"github.com/stuphlabs/pullcord/config"
 )
 
@@ -29,6 +28,13 @@ func init() {
 			return new(StandardResponse)
 		},
 	)
+
+	config.MustRegisterResourceType(
+		"templatedresponse",
+		func() json.Unmarshaler {
+			return new(TemplatedResponse)
+		},
+	)
 }
 
 // UnmarshalJSON implements encoding/json.Unmarshaler.
@@ -60,6 +66,8 @@ const (
 	InternalServerError = StandardResponse(500)
 	// NotImplemented is a canned StandardResponse for an HTTP 501
 	NotImplemented = StandardResponse(501)
+	// ServiceUnavailable is a canned StandardResponse for an HTTP 503
+	ServiceUnavailable = StandardResponse(503)
 )
 
 var responseTitle = map[StandardResponse]string{
@@ -67,6 +75,7 @@ var responseTitle = map[StandardResponse]string{
 	NotFound:            "Not Found",
 	InternalServerError: "Internal Server Error",
 	NotImplemented:      "Not Implemented",
+	ServiceUnavailable:  "Service Unavailable",
 }
 
 var responseText = map[StandardResponse]string{
@@ -75,6 +84,8 @@ var responseText = map[StandardResponse]string{
 	InternalServerError: "An internal server error occurred.",
 	NotImplemented: "The requested behavior has not yet been" +
 		" implemented.",
+	ServiceUnavailable: "The requested service is currently" +
+		" unavailable.",
 }
 
 var responseContact = map[StandardResponse]bool{
@@ -82,62 +93,56 @@ var responseContact = map[StandardResponse]bool{
 	NotFound:            false,
 	InternalServerError: true,
 	NotImplemented:      true,
+	ServiceUnavailable:  true,
 }
 
-var responseStringTemplate = template.Must(
-	template.New("standardResponse").Parse(`<!DOCTYPE html>
-<html>
- <head>
-  <title>
-   {{.Title}}
-  </title>
- </head>
- <body>
-  <h1>
-   {{.Title}}
-  </h1>
-  <p>
-   {{.Message}}
-   {{- if .ShouldContact}}Please contact your system administrator.{{end}}
-  </p>
- </body>
-</html>`))
-
-var responseContactString = "Please contact your system administrator."
-
 func (s StandardResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	values := struct {
-		Title         string
-		Message       string
-		ShouldContact bool
-	}{}
-
-	rs := s
-	if rs < MinimumStandardResponse {
-		rs = 500
-	}
+	defaultPageTemplate.ServeError(w, r, int(s))
+}
 
-	if v, present := responseContact[rs]; present && v {
-		values.ShouldContact = v
-	}
+// TemplatedResponse is a net/http.Handler that gives the same response as a
+// StandardResponse with the given Code, but rendered using the error pages of
+// the given PageTemplate.
+type TemplatedResponse struct {
+	Code  int
+	Pages *PageTemplate
+}
 
-	if v, present := responseTitle[rs]; present {
-		values.Title = v
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (s *TemplatedResponse) UnmarshalJSON(data []byte) error {
+	var t struct {
+		Code  int
+		Pages *config.Resource
 	}
 
-	if v, present := responseText[rs]; present {
-		values.Message = v
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if e := dec.Decode(&t); e != nil {
+		return e
 	}
 
-	w.WriteHeader(int(rs))
-	err := responseStringTemplate.Execute(w, values)
-	if err != nil {
-		_ = log.Error(
-			fmt.Sprintf(
-				"error while writing standard response"+
-					" template: %s",
-				err.Error(),
-			),
+	if t.Code < MinimumStandardResponse {
+		return fmt.Errorf(
+			"TemplatedResponse must be given a valid HTTP status"+
+				" code (an integer greater than %d), but was"+
+				" given: %d",
+			MinimumStandardResponse,
+			t.Code,
 		)
 	}
+	s.Code = t.Code
+
+	s.Pages = nil
+	if t.Pages != nil && t.Pages.Unmarshalled != nil {
+		p, ok := t.Pages.Unmarshalled.(*PageTemplate)
+		if !ok {
+			return config.UnexpectedResourceType
+		}
+		s.Pages = p
+	}
+
+	return nil
+}
+
+func (s *TemplatedResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Pages.ServeError(w, r, s.Code)
 }
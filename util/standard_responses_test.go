@@ -26,6 +26,9 @@ func TestStandardResponseFilterRequest(t *testing.T) {
 		{
 			s: NotImplemented,
 		},
+		{
+			s: ServiceUnavailable,
+		},
 		{
 			s: 200,
 		},